@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+type AccountHandler struct {
+	accountService services.AccountService
+	balanceService services.BalanceService
+}
+
+func NewAccountHandler(accountService *services.AccountService, balanceService *services.BalanceService) *AccountHandler {
+	return &AccountHandler{*accountService, *balanceService}
+}
+
+// overviewView is the data rendered by the accountsOverview template. OOB
+// marks the fragment for an htmx out-of-band swap.
+type overviewView struct {
+	Accounts []models.AccountBalance
+	NetWorth models.NetWorth
+	OOB      bool
+}
+
+func loadOverview(balanceService *services.BalanceService, userID int, oob bool) (overviewView, error) {
+	accounts, err := balanceService.GetAccountBalances(userID)
+	if err != nil {
+		return overviewView{}, err
+	}
+
+	netWorth, err := balanceService.GetNetWorth(userID)
+	if err != nil {
+		return overviewView{}, err
+	}
+
+	return overviewView{
+		Accounts: accounts,
+		NetWorth: netWorth,
+		OOB:      oob,
+	}, nil
+}
+
+func (h *AccountHandler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	accounts, err := h.balanceService.GetAccountBalances(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(accounts)
+}
+
+func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/accounts/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.accountService.GetAccount(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(account)
+}
+
+// GetAccountOptions renders the user's accounts as <option> elements for the
+// account pickers in the forms.
+func (h *AccountHandler) GetAccountOptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	accounts, err := h.accountService.GetAccountsByUserID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	selected, _ := strconv.Atoi(r.URL.Query().Get("selected"))
+
+	tmpl, err := template.ParseFiles("templates/components/accountOptions.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Accounts []models.Account
+		Selected int
+	}{
+		Accounts: accounts,
+		Selected: selected,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+func (h *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	account, err := accountFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	account.UserID = userID
+
+	_, err = h.accountService.CreateAccount(account)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+func (h *AccountHandler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/accounts/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	account, err := accountFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.accountService.UpdateAccount(userID, id, account)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/accounts/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.accountService.DeleteAccount(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+// renderOverview responds with the refreshed accounts overview, which
+// replaces the existing one on the page.
+func (h *AccountHandler) renderOverview(w http.ResponseWriter, userID int) {
+	overview, err := loadOverview(&h.balanceService, userID, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/accountsOverview.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	tmpl.ExecuteTemplate(w, "accountsOverview", overview)
+}
+
+func accountFromForm(r *http.Request) (models.Account, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	currency := r.Form.Get("currency")
+	if currency == "" {
+		currency = services.DefaultCurrency
+	}
+
+	openingBalance := money.Zero(currency)
+	if value := r.Form.Get("opening_balance"); value != "" {
+		openingBalance, err = money.Parse(value, currency)
+		if err != nil {
+			return models.Account{}, err
+		}
+	}
+
+	return models.Account{
+		Name:           r.Form.Get("name"),
+		Type:           models.AccountType(r.Form.Get("type")),
+		Currency:       currency,
+		OpeningBalance: openingBalance,
+	}, nil
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"html/template"
+	"net"
 	"net/http"
-	"text/template"
+	"strings"
 	"time"
 
 	"balance-tracker/models"
@@ -12,11 +15,11 @@ import (
 )
 
 type AuthHandler struct {
-	authService services.AuthService
+	authService *services.AuthService
 }
 
 func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{*authService}
+	return &AuthHandler{authService}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -28,24 +31,57 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.authService.Login(username, password)
+	tokens, err := h.authService.Login(username, password, clientFrom(r))
 	if err != nil {
+		if isAPIRequest(r) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		h.renderTemplate(w, "login", map[string]string{"Error": err.Error()})
 		return
 	}
 
-	// Set the token as a cookie
-	cookie := &http.Cookie{
-		Name:  "token",
-		Value: token,
-		Path:  "/",
+	// API clients keep the tokens themselves
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+		return
 	}
 
-	http.SetCookie(w, cookie)
+	setTokenCookies(w, tokens)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Refresh exchanges a refresh token, sent as the refresh_token form value or
+// cookie, for a new token pair.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	refreshToken := r.FormValue("refresh_token")
+	if refreshToken == "" {
+		if cookie, err := r.Cookie("refresh_token"); err == nil {
+			refreshToken = cookie.Value
+		}
+	}
+
+	tokens, err := h.authService.Refresh(refreshToken, clientFrom(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := r.Cookie("refresh_token"); err == nil {
+		setTokenCookies(w, tokens)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
 func (h *AuthHandler) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 	tmpl, err := template.ParseFiles("templates/" + name + ".html")
 	if err != nil {
@@ -93,68 +129,147 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
+	var accessToken, refreshToken string
+	if cookie, err := r.Cookie("token"); err == nil {
+		accessToken = cookie.Value
+	}
+	if cookie, err := r.Cookie("refresh_token"); err == nil {
+		refreshToken = cookie.Value
+	}
+	if token, ok := bearerToken(r); ok {
+		accessToken = token
 	}
 
-	// Get the token value from the cookie
-	tokenString := cookie.Value
-	err = h.authService.Logout(tokenString)
+	err := h.authService.Logout(accessToken, refreshToken)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Clear the cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   "",
-		Expires: time.Unix(0, 0),
-	})
+	clearTokenCookies(w)
 
 	http.Redirect(w, r, "/login", http.StatusFound)
-	return
 }
 
+// AuthMiddleware accepts an access token from the Authorization header or
+// the token cookie. Browsers whose access token has expired are refreshed
+// transparently with their refresh cookie; API clients get a 401 and are
+// expected to call /auth/refresh themselves.
 func (h *AuthHandler) AuthMiddleware() func(next http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// Get the cookie by name
-			cookie, err := r.Cookie("token")
-			if err != nil {
-				http.Redirect(w, r, "/login", http.StatusFound)
-				return
-			}
-
-			// Get the token value from the cookie
-			tokenString := cookie.Value
-
-			// Check if the token exists in the database
-			if !h.authService.TokenValid(tokenString) {
-				// Delete the token cookie
-				http.SetCookie(w, &http.Cookie{
-					Name:    "token",
-					Value:   "",
-					Expires: time.Unix(0, 0),
-				})
-				http.Redirect(w, r, "/login", http.StatusFound)
-				return
-			}
-
-			// Parse the JWT token
-			claims, err := utils.ParseToken(tokenString)
+			claims, err := h.authenticate(w, r)
 			if err != nil {
-				http.Redirect(w, r, "/login", http.StatusFound)
+				h.unauthorized(w, r)
 				return
 			}
 
-			// Store the UserID in the request context
+			// Store the UserID and session in the request context
 			ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+			ctx = context.WithValue(ctx, "sessionID", claims.SessionID)
 
 			// Call the next handler function with the updated context
 			next(w, r.WithContext(ctx))
 		}
 	}
 }
+
+func (h *AuthHandler) authenticate(w http.ResponseWriter, r *http.Request) (*utils.Claims, error) {
+	if token, ok := bearerToken(r); ok {
+		return h.authService.Authenticate(token)
+	}
+
+	if cookie, err := r.Cookie("token"); err == nil {
+		claims, err := h.authService.Authenticate(cookie.Value)
+		if err == nil {
+			return claims, nil
+		}
+	}
+
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.authService.Refresh(cookie.Value, clientFrom(r))
+	if err != nil {
+		return nil, err
+	}
+	setTokenCookies(w, tokens)
+
+	return h.authService.Authenticate(tokens.AccessToken)
+}
+
+func (h *AuthHandler) unauthorized(w http.ResponseWriter, r *http.Request) {
+	if isAPIRequest(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	clearTokenCookies(w)
+
+	// htmx would swap the login page into the middle of the current one
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", "/login")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+func clientFrom(r *http.Request) services.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return services.Client{UserAgent: r.UserAgent(), IP: ip}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// isAPIRequest reports whether the client handles its own tokens rather than
+// relying on cookies and redirects.
+func isAPIRequest(r *http.Request) bool {
+	if _, ok := bearerToken(r); ok {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func setTokenCookies(w http.ResponseWriter, tokens services.TokenPair) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		Expires:  tokens.AccessExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if tokens.RefreshToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "refresh_token",
+			Value:    tokens.RefreshToken,
+			Path:     "/",
+			Expires:  tokens.RefreshExpiresAt,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+func clearTokenCookies(w http.ResponseWriter) {
+	for _, name := range []string{"token", "refresh_token"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:    name,
+			Value:   "",
+			Path:    "/",
+			Expires: time.Unix(0, 0),
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+// maxBackupSize bounds the size of a backup to restore.
+const maxBackupSize = 100 << 20
+
+type BackupHandler struct {
+	backupService services.BackupService
+}
+
+func NewBackupHandler(backupService *services.BackupService) *BackupHandler {
+	return &BackupHandler{*backupService}
+}
+
+// GetBackupPage handles GET /backup. API clients get the backup itself.
+func (h *BackupHandler) GetBackupPage(w http.ResponseWriter, r *http.Request) {
+	if isAPIRequest(r) {
+		h.Export(w, r)
+		return
+	}
+
+	h.renderBackup(w, "backup.html", nil)
+}
+
+// Export handles GET /backup/export, sending the user's backup as a file to
+// download.
+func (h *BackupHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	now := time.Now()
+	backup, err := h.backupService.Export(userID, now)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="balance-tracker-backup-%s.json"`, now.Format("2006-01-02")))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(backup)
+}
+
+// Restore handles POST /backup/restore?mode=, with the backup uploaded as
+// the form's file field or sent as the JSON body. The mode is merge unless
+// it says replace.
+func (h *BackupHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		data, err = readUpload(w, r, maxBackupSize, services.ErrInvalidBackup)
+	} else {
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackupSize))
+		if err != nil {
+			err = fmt.Errorf("%w: %v", services.ErrInvalidBackup, err)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	var backup models.Backup
+	err = json.Unmarshal(data, &backup)
+	if err != nil {
+		http.Error(w, fmt.Errorf("%w: %v", services.ErrInvalidBackup, err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	mode := models.RestoreMode(r.FormValue("mode"))
+	if mode == "" {
+		mode = models.RestoreMerge
+	}
+
+	result, err := h.backupService.Restore(userID, backup, mode)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	h.renderBackup(w, "restoreResult", result)
+}
+
+func (h *BackupHandler) renderBackup(w http.ResponseWriter, name string, data any) {
+	tmpl, err := template.ParseFiles("templates/backup.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -4,26 +4,28 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"path"
 	"strconv"
-	"text/template"
 
-	"balance-tracker/models"
+	"balance-tracker/money"
 	"balance-tracker/services"
-
-	"github.com/go-chi/chi/v5"
 )
 
 type BalanceHandler struct {
-	balanceService services.BalanceService
+	balanceService     services.BalanceService
+	transactionService services.TransactionService
+	accountService     services.AccountService
 }
 
-func NewBalanceHandler(balanceService *services.BalanceService) *BalanceHandler {
-	return &BalanceHandler{*balanceService}
+func NewBalanceHandler(balanceService *services.BalanceService, transactionService *services.TransactionService, accountService *services.AccountService) *BalanceHandler {
+	return &BalanceHandler{*balanceService, *transactionService, *accountService}
 }
 
+// GetBalances returns the user's balance snapshots. They are derived from
+// the ledger and change only through it, so they cannot be edited here.
 func (h *BalanceHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
-	balances, err := h.balanceService.GetBalances()
+	userID := r.Context().Value("userID").(int)
+
+	balances, err := h.balanceService.GetBalancesByUserID(userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -33,32 +35,21 @@ func (h *BalanceHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *BalanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	balance, err := h.balanceService.GetBalance(id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
-	}
-
-	json.NewEncoder(w).Encode(balance)
-}
+	userID := r.Context().Value("userID").(int)
 
-func (h *BalanceHandler) UpdateBalance(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	var balance models.Balance
-	err := json.NewDecoder(r.Body).Decode(&balance)
+	id, err := idFromPath(r.URL.Path, "/balances/")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, "Invalid id", http.StatusBadRequest)
 		return
 	}
 
-	err = h.balanceService.UpdateBalance(id, balance)
+	balance, err := h.balanceService.GetBalance(userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), statusFor(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(balance)
 }
 
 func (h *BalanceHandler) CreateBalance(w http.ResponseWriter, r *http.Request) {
@@ -72,107 +63,36 @@ func (h *BalanceHandler) CreateBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	amount, err := strconv.ParseFloat(r.Form.Get("amount"), 64)
+	accountID, err := strconv.Atoi(r.Form.Get("account_id"))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	err = h.balanceService.CreateBalance(models.Balance{
-		UserID: userID,
-		Amount: amount,
-	})
+	account, err := h.accountService.GetAccount(userID, accountID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(statusFor(err))
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	balance, err := h.balanceService.GetLastBalanceByUserID(userID)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	tmpl := template.Must(template.ParseFiles("templates/components/balanceCard.html"))
-	w.WriteHeader(http.StatusOK)
-	tmpl.Execute(w, balance)
-
-}
-
-func (h *BalanceHandler) DeleteBalance(w http.ResponseWriter, r *http.Request) {
-	id := path.Base(r.URL.Path)
-	if id == "" {
-		log.Println("Missing id parameter")
-		http.Error(w, "Missing id parameter", http.StatusBadRequest)
-		return
-	}
-
-	idInt, err := strconv.Atoi(id)
+	amount, err := money.Parse(r.Form.Get("amount"), account.Currency)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "Invalid id", http.StatusBadRequest)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	err = h.balanceService.DeleteBalance(idInt)
+	// Setting a balance records an adjustment entry in the ledger
+	transaction, _, err := h.transactionService.SetBalance(userID, accountID, amount)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *BalanceHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("userID").(int)
-
-	earn, err := strconv.Atoi(r.FormValue("earn"))
-	if err != nil {
-		http.Error(w, "Invalid earn value", http.StatusBadRequest)
-		return
-	}
-
-	expense, err := strconv.Atoi(r.FormValue("expense"))
-	if err != nil {
-		http.Error(w, "Invalid expense value", http.StatusBadRequest)
-		return
-	}
-
-	amount := earn - expense
-
-	balance, err := h.balanceService.CreateNewTransactionByID(userID, amount)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Return the balanceCard.html template
-	tmpl, err := template.ParseFiles("templates/components/balanceCard.html")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		w.WriteHeader(statusFor(err))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+	transaction.UserID = userID
 
-	data := struct {
-		Amount    float64
-		CreatedAt string
-		ID        int
-	}{
-		Amount:    balance.Amount,
-		CreatedAt: balance.CreatedAt,
-		ID:        balance.ID,
-	}
-	log.Println(data)
-
-	// if err := tmpl.Execute(w, data); err != nil {
-	// 	log.Println(err)
-	// 	http.Error(w, err.Error(), http.StatusInternalServerError)
-	// 	return
-	// }
-	w.WriteHeader(http.StatusOK)
-	tmpl.Execute(w, data)
+	renderTransactionTemplate(w, &h.balanceService, "transactionCreated", transaction)
 }
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+type BudgetHandler struct {
+	budgetService   services.BudgetService
+	envelopeService services.EnvelopeService
+	userService     services.UserService
+}
+
+func NewBudgetHandler(budgetService *services.BudgetService, envelopeService *services.EnvelopeService, userService *services.UserService) *BudgetHandler {
+	return &BudgetHandler{*budgetService, *envelopeService, *userService}
+}
+
+// budgetView is the data rendered by the budgetOverview template.
+type budgetView struct {
+	Month    time.Time
+	Currency string
+	Statuses []models.BudgetStatus
+}
+
+// GetBudgets handles GET /budgets?month=2024-06, listing the budgets of the
+// month, the current one by default.
+func (h *BudgetHandler) GetBudgets(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	budgets, err := h.budgetService.GetBudgets(userID, month)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// GetBudgetStatus handles GET /budgets/status?month=2024-06, reporting
+// spent, remaining and percent used for each budget of the month, the
+// current one by default. API clients get JSON and the index page its
+// budgets panel.
+func (h *BudgetHandler) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	if isAPIRequest(r) {
+		statuses, err := h.budgetService.GetBudgetStatuses(userID, month)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+		return
+	}
+
+	h.renderOverview(w, userID, month)
+}
+
+// SetBudget handles POST /budgets, setting the limit of the category_id
+// for the month, replacing any it had.
+func (h *BudgetHandler) SetBudget(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	budget, err := h.budgetFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+	budget.CategoryID = categoryID
+
+	budget.Month, err = parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	budget, err = h.budgetService.SetBudget(budget)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(budget)
+		return
+	}
+
+	h.renderOverview(w, userID, budget.Month)
+}
+
+func (h *BudgetHandler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/budgets/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	budget, err := h.budgetFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	budget, err = h.budgetService.UpdateBudget(userID, id, budget)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(budget)
+		return
+	}
+
+	h.renderOverview(w, userID, budget.Month)
+}
+
+func (h *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/budgets/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	budget, err := h.budgetService.GetBudget(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	err = h.budgetService.DeleteBudget(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.renderOverview(w, userID, budget.Month)
+}
+
+// CopyPreviousMonth handles POST /budgets/copy?month=2024-06, copying last
+// month's budgets into the month.
+func (h *BudgetHandler) CopyPreviousMonth(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	copied, err := h.budgetService.CopyPreviousMonth(userID, month)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Copied int `json:"copied"`
+		}{copied})
+		return
+	}
+
+	h.renderOverview(w, userID, month)
+}
+
+// budgetFromForm reads the limit, entered in the user's base currency, and
+// whether unspent amounts roll over.
+func (h *BudgetHandler) budgetFromForm(r *http.Request, userID int) (models.Budget, error) {
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	amount, err := money.Parse(r.FormValue("amount"), user.BaseCurrency)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	rollover, _ := strconv.ParseBool(r.FormValue("rollover"))
+	if r.FormValue("rollover") == "on" {
+		rollover = true
+	}
+
+	return models.Budget{
+		UserID:   userID,
+		Amount:   amount,
+		Rollover: rollover,
+	}, nil
+}
+
+// renderOverview renders the index page's budgets panel. In envelope
+// budgeting the envelopes of the month take the place of the limits.
+func (h *BudgetHandler) renderOverview(w http.ResponseWriter, userID int, month time.Time) {
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/budgetOverview.html", "templates/components/envelopeMonth.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.EnvelopeStart != nil && !month.Before(*user.EnvelopeStart) {
+		envelopes, err := h.envelopeService.GetMonth(userID, month)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+
+		err = tmpl.ExecuteTemplate(w, "envelopeSummary", envelopeView{Currency: user.BaseCurrency, Month: envelopes})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	statuses, err := h.budgetService.GetBudgetStatuses(userID, month)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	view := budgetView{
+		Month:    time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC),
+		Currency: user.BaseCurrency,
+		Statuses: statuses,
+	}
+
+	err = tmpl.ExecuteTemplate(w, "budgetOverview", view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseMonth parses a month input value like 2024-06. An empty value means
+// the current month.
+func parseMonth(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+
+	return time.Parse("2006-01", value)
+}
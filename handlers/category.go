@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+type CategoryHandler struct {
+	categoryService services.CategoryService
+	payeeService    services.PayeeService
+}
+
+func NewCategoryHandler(categoryService *services.CategoryService, payeeService *services.PayeeService) *CategoryHandler {
+	return &CategoryHandler{*categoryService, *payeeService}
+}
+
+func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	categories, err := h.categoryService.GetCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(categories)
+}
+
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/categories/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.GetCategory(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+// GetCategoryTotals handles GET /categories/totals?from=2024-06-01&to=2024-07-01,
+// summing each category over the period, with to exclusive. The period
+// defaults to the current month.
+func (h *CategoryHandler) GetCategoryTotals(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	totals, err := h.categoryService.GetCategoryTotals(userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(totals)
+}
+
+// GetCategoryOptions renders the user's categories as <option> elements,
+// grouped by kind, for the category pickers in the forms. With ?none=1 the
+// list starts with an empty choice, for picking an optional parent. With
+// ?payee= the payee's default category is preselected. ?kind=expense or
+// ?kind=income leaves out the other kind. The category for balance
+// adjustments is never offered.
+func (h *CategoryHandler) GetCategoryOptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	categories, err := h.categoryService.GetCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type group struct {
+		Label      string
+		Categories []models.Category
+	}
+	groups := []group{{Label: "Expense"}, {Label: "Income"}}
+	for _, category := range categories {
+		switch category.Kind {
+		case models.CategoryKindExpense:
+			groups[0].Categories = append(groups[0].Categories, category)
+		case models.CategoryKindIncome:
+			groups[1].Categories = append(groups[1].Categories, category)
+		}
+	}
+	switch models.CategoryKind(r.URL.Query().Get("kind")) {
+	case models.CategoryKindExpense:
+		groups = groups[:1]
+	case models.CategoryKindIncome:
+		groups = groups[1:]
+	}
+
+	selected, _ := strconv.Atoi(r.URL.Query().Get("selected"))
+	if name := r.URL.Query().Get("payee"); name != "" {
+		payee, err := h.payeeService.FindPayee(userID, name)
+		if err == nil && payee.DefaultCategoryID != nil {
+			selected = *payee.DefaultCategoryID
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/categoryOptions.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Groups   []group
+		Selected int
+		None     bool
+	}{
+		Groups:   groups,
+		Selected: selected,
+		None:     r.URL.Query().Get("none") != "",
+	}
+
+	tmpl.Execute(w, data)
+}
+
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	category, err := categoryFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	category.UserID = userID
+
+	category, err = h.categoryService.CreateCategory(category)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/categoryOptions.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl.ExecuteTemplate(w, "categoryCreated", category)
+}
+
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/categories/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	category, err := categoryFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err = h.categoryService.UpdateCategory(userID, id, category)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/categories/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.categoryService.DeleteCategory(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func categoryFromForm(r *http.Request) (models.Category, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	category := models.Category{
+		Name: r.Form.Get("name"),
+		Kind: models.CategoryKind(r.Form.Get("kind")),
+	}
+
+	if value := r.Form.Get("parent_id"); value != "" {
+		parentID, err := strconv.Atoi(value)
+		if err != nil {
+			return models.Category{}, err
+		}
+		category.ParentID = &parentID
+	}
+
+	return category, nil
+}
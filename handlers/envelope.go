@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+type EnvelopeHandler struct {
+	envelopeService services.EnvelopeService
+	userService     services.UserService
+}
+
+func NewEnvelopeHandler(envelopeService *services.EnvelopeService, userService *services.UserService) *EnvelopeHandler {
+	return &EnvelopeHandler{*envelopeService, *userService}
+}
+
+// envelopeView is the data rendered by envelopes.html and its fragments. Off
+// is set while envelope budgeting is turned off, and Month is then empty.
+type envelopeView struct {
+	Off      bool
+	Currency string
+	Month    models.EnvelopeMonth
+}
+
+// GetEnvelopes handles GET /envelopes?month=2024-06, showing the envelopes
+// and the money to be assigned for the month, the current one by default.
+func (h *EnvelopeHandler) GetEnvelopes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	if isAPIRequest(r) {
+		result, err := h.envelopeService.GetMonth(userID, month)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	h.renderEnvelopes(w, userID, "envelopes.html", month)
+}
+
+// SetMode handles POST /envelopes/mode. With enabled=true envelope budgeting
+// starts from ?month=, the current month by default; enabled=false turns it
+// off again, going back to limit budgets.
+func (h *EnvelopeHandler) SetMode(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "Invalid enabled", http.StatusBadRequest)
+		return
+	}
+
+	var start *time.Time
+	if enabled {
+		month, err := parseMonth(r.FormValue("month"))
+		if err != nil {
+			http.Error(w, "Invalid month", http.StatusBadRequest)
+			return
+		}
+		start = &month
+	}
+
+	user, err := h.envelopeService.SetStart(userID, start)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			EnvelopeStart *time.Time `json:"envelope_start"`
+		}{user.EnvelopeStart})
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/envelopes")
+}
+
+// Assign handles POST /envelopes/assign, setting the amount assigned to the
+// category_id's envelope for the month.
+func (h *EnvelopeHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := h.amountFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+
+	err = h.envelopeService.Assign(userID, categoryID, month, amount, r.FormValue("note"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderChange(w, r, userID, month)
+}
+
+// Move handles POST /envelopes/move, moving the amount from the
+// from_category_id's envelope to the to_category_id's for the month.
+func (h *EnvelopeHandler) Move(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	month, err := parseMonth(r.FormValue("month"))
+	if err != nil {
+		http.Error(w, "Invalid month", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := h.amountFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	fromID, err := strconv.Atoi(r.FormValue("from_category_id"))
+	if err != nil {
+		http.Error(w, "Invalid from category", http.StatusBadRequest)
+		return
+	}
+	toID, err := strconv.Atoi(r.FormValue("to_category_id"))
+	if err != nil {
+		http.Error(w, "Invalid to category", http.StatusBadRequest)
+		return
+	}
+
+	err = h.envelopeService.Move(userID, fromID, toID, month, amount, r.FormValue("note"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderChange(w, r, userID, month)
+}
+
+// amountFromForm reads the amount, entered in the user's base currency.
+func (h *EnvelopeHandler) amountFromForm(r *http.Request, userID int) (money.Money, error) {
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return money.Parse(r.FormValue("amount"), user.BaseCurrency)
+}
+
+// renderChange answers a change to the envelopes with the month as it now
+// stands.
+func (h *EnvelopeHandler) renderChange(w http.ResponseWriter, r *http.Request, userID int, month time.Time) {
+	if isAPIRequest(r) {
+		result, err := h.envelopeService.GetMonth(userID, month)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	h.renderEnvelopes(w, userID, "envelopeMonth", month)
+}
+
+func (h *EnvelopeHandler) renderEnvelopes(w http.ResponseWriter, userID int, name string, month time.Time) {
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view := envelopeView{Currency: user.BaseCurrency}
+	view.Month, err = h.envelopeService.GetMonth(userID, month)
+	if errors.Is(err, services.ErrEnvelopesOff) {
+		view.Off = true
+	} else if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/envelopes.html", "templates/components/envelopeMonth.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, name, view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
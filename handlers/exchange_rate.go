@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"balance-tracker/services"
+)
+
+type ExchangeRateHandler struct {
+	exchangeRateService services.ExchangeRateService
+}
+
+func NewExchangeRateHandler(exchangeRateService *services.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{*exchangeRateService}
+}
+
+// GetExchangeRates lists the latest rate of every currency pair, as of today
+// or the date given by ?date=2006-01-02. Rates are imported with the
+// "rates import" command.
+func (h *ExchangeRateHandler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	on := time.Now()
+	if value := r.URL.Query().Get("date"); value != "" {
+		var err error
+		on, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rates, err := h.exchangeRateService.GetExchangeRates(on)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rates)
+}
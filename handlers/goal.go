@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+type GoalHandler struct {
+	goalService     services.GoalService
+	accountService  services.AccountService
+	categoryService services.CategoryService
+	userService     services.UserService
+}
+
+func NewGoalHandler(goalService *services.GoalService, accountService *services.AccountService, categoryService *services.CategoryService, userService *services.UserService) *GoalHandler {
+	return &GoalHandler{*goalService, *accountService, *categoryService, *userService}
+}
+
+// goalView is the data rendered by the goalOverview template. Accounts and
+// Categories fill the form's link choices.
+type goalView struct {
+	Goals      []models.GoalProgress
+	Accounts   []models.Account
+	Categories []models.Category
+	Currency   string
+}
+
+// GetGoals lists the user's goals with their progress, as JSON for API
+// clients and as the index page's goals panel otherwise.
+func (h *GoalHandler) GetGoals(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if isAPIRequest(r) {
+		goals, err := h.goalService.GetGoalsProgress(userID, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goals)
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+func (h *GoalHandler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/goals/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	progress, err := h.goalService.GetGoalProgress(userID, id, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+func (h *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	goal, err := h.goalFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	goal, err = h.goalService.CreateGoal(goal)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(goal)
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+func (h *GoalHandler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/goals/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	goal, err := h.goalFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	goal, err = h.goalService.UpdateGoal(userID, id, goal)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goal)
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+func (h *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/goals/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.goalService.DeleteGoal(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.renderOverview(w, userID)
+}
+
+// goalFromForm reads a goal linked to either the account_id or the
+// category_id. The target is in currency, which defaults to the account's
+// currency or else the user's base currency, and target_month is like
+// 2027-06.
+func (h *GoalHandler) goalFromForm(r *http.Request, userID int) (models.Goal, error) {
+	goal := models.Goal{UserID: userID, Name: r.FormValue("name")}
+
+	currency := strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))
+	if value := r.FormValue("account_id"); value != "" {
+		accountID, err := strconv.Atoi(value)
+		if err != nil {
+			return models.Goal{}, fmt.Errorf("%w: invalid account", services.ErrInvalidGoal)
+		}
+		account, err := h.accountService.GetAccount(userID, accountID)
+		if err != nil {
+			return models.Goal{}, err
+		}
+		goal.AccountID = &accountID
+		if currency == "" {
+			currency = account.Currency
+		}
+	}
+	if value := r.FormValue("category_id"); value != "" {
+		categoryID, err := strconv.Atoi(value)
+		if err != nil {
+			return models.Goal{}, fmt.Errorf("%w: invalid category", services.ErrInvalidGoal)
+		}
+		goal.CategoryID = &categoryID
+	}
+	if currency == "" {
+		user, err := h.userService.GetUser(userID)
+		if err != nil {
+			return models.Goal{}, err
+		}
+		currency = user.BaseCurrency
+	}
+
+	var err error
+	goal.Target, err = money.Parse(r.FormValue("target"), currency)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	goal.TargetMonth, err = time.Parse("2006-01", r.FormValue("target_month"))
+	if err != nil {
+		return models.Goal{}, fmt.Errorf("%w: invalid target month", services.ErrInvalidGoal)
+	}
+
+	return goal, nil
+}
+
+func (h *GoalHandler) renderOverview(w http.ResponseWriter, userID int) {
+	goals, err := h.goalService.GetGoalsProgress(userID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	accounts, err := h.accountService.GetAccountsByUserID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := h.categoryService.GetCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/goalOverview.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view := goalView{
+		Goals:      goals,
+		Accounts:   accounts,
+		Categories: categories,
+		Currency:   user.BaseCurrency,
+	}
+
+	err = tmpl.ExecuteTemplate(w, "goalOverview", view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+// maxImportSize bounds the size of an uploaded import file.
+const maxImportSize = 10 << 20
+
+type ImportHandler struct {
+	importService   services.ImportService
+	accountService  services.AccountService
+	categoryService services.CategoryService
+}
+
+func NewImportHandler(importService *services.ImportService, accountService *services.AccountService, categoryService *services.CategoryService) *ImportHandler {
+	return &ImportHandler{*importService, *accountService, *categoryService}
+}
+
+// importView is the data rendered by import.html and its fragments.
+type importView struct {
+	Accounts  []models.Account
+	Expenses  []models.Category
+	Incomes   []models.Category
+	Profiles  []models.ImportProfile
+	Profile   models.ImportProfile
+	Preview   models.ImportPreview
+	Result    models.ImportResult
+	Committed bool
+	ProfileID int
+}
+
+// GetImportPage shows the upload form.
+func (h *ImportHandler) GetImportPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	view := importView{Profile: defaultImportProfile()}
+
+	accounts, err := h.accountService.GetAccountsByUserID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view.Accounts = accounts
+
+	categories, err := h.categoryService.GetCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, category := range categories {
+		switch category.Kind {
+		case models.CategoryKindIncome:
+			view.Incomes = append(view.Incomes, category)
+		case models.CategoryKindExpense:
+			view.Expenses = append(view.Expenses, category)
+		}
+	}
+
+	view.Profiles, err = h.importService.GetProfiles(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderImport(w, "import.html", view)
+}
+
+// GetMapping handles GET /import/mapping?profile_id=, filling the upload
+// form's column mapping from a saved profile.
+func (h *ImportHandler) GetMapping(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	view := importView{Profile: defaultImportProfile()}
+	if value := r.FormValue("profile_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid profile", http.StatusBadRequest)
+			return
+		}
+		view.Profile, err = h.importService.GetProfile(userID, id)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+	}
+
+	h.renderImport(w, "importMapping", view)
+}
+
+// Preview handles POST /import/preview, a multipart upload of a statement
+// file with the import options. OFX, QFX and QIF files are recognized; CSV
+// files also need their column mapping. Nothing is booked.
+func (h *ImportHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	data, options, profile, err := h.upload(w, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	preview, err := h.importService.Preview(userID, options, profile, data)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderPreview(w, r, preview)
+}
+
+// Import handles POST /import, booking a statement file's entries. It takes
+// the same upload as Preview.
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	data, options, profile, err := h.upload(w, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	result, err := h.importService.Import(userID, options, profile, data)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderResult(w, r, result)
+}
+
+// PreviewCSV handles POST /import/csv/preview, which is like Preview but
+// always reads the file as CSV.
+func (h *ImportHandler) PreviewCSV(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	data, options, profile, err := h.csvUpload(w, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	preview, err := h.importService.PreviewCSV(userID, options, profile, data)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderPreview(w, r, preview)
+}
+
+// ImportCSV handles POST /import/csv, booking a CSV file's entries. It takes
+// the same upload as PreviewCSV.
+func (h *ImportHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	data, options, profile, err := h.csvUpload(w, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	result, err := h.importService.ImportCSV(userID, options, profile, data)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderResult(w, r, result)
+}
+
+// GetProfiles lists the user's saved CSV mappings.
+func (h *ImportHandler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	profiles, err := h.importService.GetProfiles(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profiles)
+		return
+	}
+
+	h.renderImport(w, "importProfileOptions", importView{Profiles: profiles, ProfileID: atoiOrZero(r.FormValue("profile_id"))})
+}
+
+// SaveProfile handles POST /import/profiles, saving the column mapping under
+// its name.
+func (h *ImportHandler) SaveProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	profile, err := profileFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+	profile.UserID = userID
+
+	profile, err = h.importService.SaveProfile(profile)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+		return
+	}
+
+	profiles, err := h.importService.GetProfiles(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderImport(w, "importProfileOptions", importView{Profiles: profiles, ProfileID: profile.ID})
+}
+
+func (h *ImportHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/import/profiles/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.importService.DeleteProfile(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload reads an uploaded file with its import options and any column
+// mapping. The mapping comes from the form's fields, or from the saved
+// profile_id when the form has no date_column, and is nil if there is
+// neither.
+func (h *ImportHandler) upload(w http.ResponseWriter, r *http.Request, userID int) ([]byte, models.ImportOptions, *models.ImportProfile, error) {
+	data, err := readUpload(w, r, maxImportSize, services.ErrInvalidImport)
+	if err != nil {
+		return nil, models.ImportOptions{}, nil, err
+	}
+
+	options, err := importOptionsFromForm(r)
+	if err != nil {
+		return nil, models.ImportOptions{}, nil, err
+	}
+
+	var profile models.ImportProfile
+	switch {
+	case r.FormValue("date_column") != "":
+		profile, err = profileFromForm(r)
+		if err != nil {
+			return nil, models.ImportOptions{}, nil, err
+		}
+	case r.FormValue("profile_id") != "":
+		id, err := strconv.Atoi(r.FormValue("profile_id"))
+		if err != nil {
+			return nil, models.ImportOptions{}, nil, fmt.Errorf("%w: invalid profile", services.ErrInvalidImport)
+		}
+		profile, err = h.importService.GetProfile(userID, id)
+		if err != nil {
+			return nil, models.ImportOptions{}, nil, err
+		}
+	default:
+		return data, options, nil, nil
+	}
+
+	return data, options, &profile, nil
+}
+
+// csvUpload is like upload but requires a column mapping.
+func (h *ImportHandler) csvUpload(w http.ResponseWriter, r *http.Request, userID int) ([]byte, models.ImportOptions, models.ImportProfile, error) {
+	data, options, profile, err := h.upload(w, r, userID)
+	if err != nil {
+		return nil, models.ImportOptions{}, models.ImportProfile{}, err
+	}
+	if profile == nil {
+		return nil, models.ImportOptions{}, models.ImportProfile{}, fmt.Errorf("%w: a date column is required", services.ErrInvalidImport)
+	}
+
+	return data, options, *profile, nil
+}
+
+// readUpload reads the multipart upload's file field, of at most maxSize
+// bytes. Bad uploads are reported as invalid.
+func readUpload(w http.ResponseWriter, r *http.Request, maxSize int64, invalid error) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	err := r.ParseMultipartForm(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", invalid, err)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("%w: a file is required", invalid)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: the file is larger than %d MB", invalid, maxSize>>20)
+	}
+
+	return data, nil
+}
+
+// importOptionsFromForm reads the account_id to import into, the
+// expense_category_id and income_category_id for entries whose payee has no
+// default category, and include_duplicates.
+func importOptionsFromForm(r *http.Request) (models.ImportOptions, error) {
+	accountID, err := strconv.Atoi(r.FormValue("account_id"))
+	if err != nil {
+		return models.ImportOptions{}, fmt.Errorf("%w: an account is required", services.ErrInvalidImport)
+	}
+
+	options := models.ImportOptions{
+		AccountID:         accountID,
+		IncludeDuplicates: formBool(r, "include_duplicates"),
+	}
+	options.ExpenseCategoryID, err = optionalInt(r, "expense_category_id")
+	if err != nil {
+		return models.ImportOptions{}, err
+	}
+	options.IncomeCategoryID, err = optionalInt(r, "income_category_id")
+	if err != nil {
+		return models.ImportOptions{}, err
+	}
+
+	return options, nil
+}
+
+// profileFromForm reads a CSV column mapping. Columns are counted from 0.
+func profileFromForm(r *http.Request) (models.ImportProfile, error) {
+	profile := models.ImportProfile{
+		Name:         r.FormValue("name"),
+		Delimiter:    r.FormValue("delimiter"),
+		Encoding:     r.FormValue("encoding"),
+		HasHeader:    formBool(r, "has_header"),
+		DateFormat:   r.FormValue("date_format"),
+		DecimalComma: formBool(r, "decimal_comma"),
+		Negate:       formBool(r, "negate"),
+	}
+
+	var err error
+	if value := r.FormValue("skip_rows"); value != "" {
+		profile.SkipRows, err = strconv.Atoi(value)
+		if err != nil {
+			return models.ImportProfile{}, fmt.Errorf("%w: invalid rows to skip", services.ErrInvalidImport)
+		}
+	}
+
+	profile.DateColumn, err = strconv.Atoi(r.FormValue("date_column"))
+	if err != nil {
+		return models.ImportProfile{}, fmt.Errorf("%w: a date column is required", services.ErrInvalidImport)
+	}
+	profile.AmountColumn, err = strconv.Atoi(r.FormValue("amount_column"))
+	if err != nil {
+		return models.ImportProfile{}, fmt.Errorf("%w: an amount column is required", services.ErrInvalidImport)
+	}
+	for name, column := range map[string]**int{"credit_column": &profile.CreditColumn, "payee_column": &profile.PayeeColumn, "memo_column": &profile.MemoColumn} {
+		*column, err = optionalInt(r, name)
+		if err != nil {
+			return models.ImportProfile{}, err
+		}
+	}
+
+	return profile, nil
+}
+
+// optionalInt reads a form field that may be left empty.
+func optionalInt(r *http.Request, name string) (*int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s", services.ErrInvalidImport, name)
+	}
+	return &n, nil
+}
+
+// formBool reads a checkbox, which browsers send as "on", or a boolean.
+func formBool(r *http.Request, name string) bool {
+	value := r.FormValue(name)
+	if value == "on" {
+		return true
+	}
+	b, _ := strconv.ParseBool(value)
+	return b
+}
+
+func atoiOrZero(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// defaultImportProfile is the mapping the upload form starts with: a header
+// row, then date, amount and payee columns.
+func defaultImportProfile() models.ImportProfile {
+	payeeColumn := 2
+	return models.ImportProfile{HasHeader: true, AmountColumn: 1, PayeeColumn: &payeeColumn}
+}
+
+func (h *ImportHandler) renderPreview(w http.ResponseWriter, r *http.Request, preview models.ImportPreview) {
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+		return
+	}
+
+	h.renderImport(w, "importPreview", importView{Preview: preview})
+}
+
+func (h *ImportHandler) renderResult(w http.ResponseWriter, r *http.Request, result models.ImportResult) {
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	h.renderImport(w, "importPreview", importView{Result: result, Committed: true})
+}
+
+func (h *ImportHandler) renderImport(w http.ResponseWriter, name string, view importView) {
+	tmpl, err := template.ParseFiles("templates/import.html", "templates/components/importPreview.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, name, view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"balance-tracker/services"
+)
+
+type JournalHandler struct {
+	journalService services.JournalService
+}
+
+func NewJournalHandler(journalService *services.JournalService) *JournalHandler {
+	return &JournalHandler{*journalService}
+}
+
+// ExportBeancount handles GET /export/beancount.
+func (h *JournalHandler) ExportBeancount(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, h.journalService.ExportBeancount, "beancount")
+}
+
+// ExportLedger handles GET /export/ledger, for Ledger and hledger.
+func (h *JournalHandler) ExportLedger(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, h.journalService.ExportLedger, "journal")
+}
+
+// export sends a journal as a file to download. It is written in full
+// first, so that an error can still be reported.
+func (h *JournalHandler) export(w http.ResponseWriter, r *http.Request, write func(int, io.Writer, time.Time) error, extension string) {
+	userID := r.Context().Value("userID").(int)
+
+	now := time.Now()
+	var journal bytes.Buffer
+	err := write(userID, &journal, now)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="balance-tracker-%s.%s"`, now.Format("2006-01-02"), extension))
+	journal.WriteTo(w)
+}
+
+// ImportBeancount handles POST /import/beancount, with the file uploaded as
+// the form's file field or sent as the body. Prices in the file are left
+// out; they are shared by all users and imported from the command line.
+func (h *JournalHandler) ImportBeancount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		data, err = readUpload(w, r, maxBackupSize, services.ErrInvalidJournal)
+	} else {
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackupSize))
+		if err != nil {
+			err = fmt.Errorf("%w: %v", services.ErrInvalidJournal, err)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	result, err := h.journalService.ImportBeancount(userID, data, false)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/backup.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "restoreResult", result.RestoreResult)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -5,28 +5,35 @@ package handlers
 import (
 	"balance-tracker/models"
 	"balance-tracker/services"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"text/template"
 )
 
 type PageHandler struct {
-	template       *template.Template
-	balanceService *services.BalanceService
+	template           *template.Template
+	balanceService     *services.BalanceService
+	transactionService *services.TransactionService
+	categoryService    *services.CategoryService
+	payeeService       *services.PayeeService
 }
 
-func NewPageHandler(balanceService *services.BalanceService) *PageHandler {
-	tmpl, err := template.ParseFiles("templates/index.html", "templates/login.html", "templates/register.html")
+func NewPageHandler(balanceService *services.BalanceService, transactionService *services.TransactionService, categoryService *services.CategoryService, payeeService *services.PayeeService) *PageHandler {
+	tmpl, err := template.ParseFiles("templates/index.html", "templates/login.html", "templates/register.html", "templates/components/transactionCard.html", "templates/components/accountsOverview.html")
 	if err != nil {
 		log.Fatal(err)
 		return nil
 	}
 	return &PageHandler{
-		template:       tmpl,
-		balanceService: balanceService,
+		template:           tmpl,
+		balanceService:     balanceService,
+		transactionService: transactionService,
+		categoryService:    categoryService,
+		payeeService:       payeeService,
 	}
 }
 
@@ -46,9 +53,16 @@ func (h *PageHandler) HandleRegisterPage(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// HandleIndexPage renders the first page of the transaction listing, with
+// the filters and sort in the query string. Later pages are loaded from
+// GET /api/v1/transactions as the listing is scrolled.
 func (h *PageHandler) HandleIndexPage(w http.ResponseWriter, r *http.Request) {
 	type BalancePage struct {
-		Balances []models.Balance
+		Overview   overviewView
+		Page       transactionPageView
+		Query      url.Values
+		Categories []models.Category
+		Payees     []models.Payee
 	}
 
 	// Retrieve the UserID from the request context
@@ -58,14 +72,39 @@ func (h *PageHandler) HandleIndexPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	balances, err := h.balanceService.GetBalancesByUserID(userID)
+	query, err := transactionQueryFrom(r)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+	page, err := h.transactionService.ListTransactions(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	overview, err := loadOverview(h.balanceService, userID, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	categories, err := h.categoryService.GetCategories(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payees, err := h.payeeService.GetPayees(userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	balancePage := BalancePage{
-		Balances: balances,
+		Overview:   overview,
+		Page:       newTransactionPageView(r, page),
+		Query:      r.URL.Query(),
+		Categories: categories,
+		Payees:     payees,
 	}
 
 	err = h.template.ExecuteTemplate(w, "index.html", balancePage)
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+// maxPayeeSuggestions caps the autocomplete list in the transaction forms.
+const maxPayeeSuggestions = 10
+
+type PayeeHandler struct {
+	payeeService services.PayeeService
+}
+
+func NewPayeeHandler(payeeService *services.PayeeService) *PayeeHandler {
+	return &PayeeHandler{*payeeService}
+}
+
+func (h *PayeeHandler) GetPayees(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	payees, err := h.payeeService.GetPayees(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(payees)
+}
+
+func (h *PayeeHandler) GetPayee(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/payees/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	payee, err := h.payeeService.GetPayee(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(payee)
+}
+
+// GetPayeeOptions renders <option> elements for the payee <datalist> of the
+// transaction forms, matching what has been typed into ?payee= against
+// names and aliases.
+func (h *PayeeHandler) GetPayeeOptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	payees, err := h.payeeService.SuggestPayees(userID, r.URL.Query().Get("payee"), maxPayeeSuggestions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/payeeOptions.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl.Execute(w, payees)
+}
+
+func (h *PayeeHandler) CreatePayee(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	payee, err := payeeFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payee.UserID = userID
+
+	payee, err = h.payeeService.CreatePayee(payee)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payee)
+}
+
+func (h *PayeeHandler) UpdatePayee(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/payees/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	payee, err := payeeFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payee, err = h.payeeService.UpdatePayee(userID, id, payee)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(payee)
+}
+
+func (h *PayeeHandler) DeletePayee(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/payees/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.payeeService.DeletePayee(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MergePayee handles POST /payees/{id}/merge, folding the payee into the one
+// given by the into form value.
+func (h *PayeeHandler) MergePayee(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(strings.TrimSuffix(r.URL.Path, "/merge"), "/payees/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	intoID, err := strconv.Atoi(r.FormValue("into"))
+	if err != nil {
+		http.Error(w, "Invalid payee to merge into", http.StatusBadRequest)
+		return
+	}
+
+	payee, err := h.payeeService.MergePayees(userID, id, intoID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(payee)
+}
+
+// payeeFromForm reads a payee from the name, default_category_id and alias
+// fields. Aliases can be repeated alias fields or one per line.
+func payeeFromForm(r *http.Request) (models.Payee, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	payee := models.Payee{Name: r.Form.Get("name")}
+
+	for _, value := range r.Form["alias"] {
+		payee.Aliases = append(payee.Aliases, strings.Split(value, "\n")...)
+	}
+
+	if value := r.Form.Get("default_category_id"); value != "" {
+		categoryID, err := strconv.Atoi(value)
+		if err != nil {
+			return models.Payee{}, err
+		}
+		payee.DefaultCategoryID = &categoryID
+	}
+
+	return payee, nil
+}
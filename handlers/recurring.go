@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+// defaultUpcomingDays is how far ahead the recurring page looks.
+const defaultUpcomingDays = 60
+
+type RecurringHandler struct {
+	recurringService services.RecurringService
+	accountService   services.AccountService
+	categoryService  services.CategoryService
+}
+
+func NewRecurringHandler(recurringService *services.RecurringService, accountService *services.AccountService, categoryService *services.CategoryService) *RecurringHandler {
+	return &RecurringHandler{*recurringService, *accountService, *categoryService}
+}
+
+// recurringView is the data rendered by recurring.html and its fragments. OOB
+// marks the upcoming list for an htmx out-of-band swap.
+type recurringView struct {
+	Recurring []models.RecurringTransaction
+	Upcoming  []models.RecurringOccurrence
+	OOB       bool
+}
+
+// GetRecurringTransactions lists the user's recurring transactions, as JSON
+// for API clients and as a page with the upcoming dates otherwise.
+func (h *RecurringHandler) GetRecurringTransactions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	recurring, err := h.recurringService.GetRecurringTransactions(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recurring)
+		return
+	}
+
+	upcoming, err := h.recurringService.GetUpcoming(userID, defaultUpcomingDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderRecurring(w, "recurring.html", recurringView{Recurring: recurring, Upcoming: upcoming})
+}
+
+// GetUpcoming lists the dates not posted yet over the next ?days=, 60 by
+// default.
+func (h *RecurringHandler) GetUpcoming(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	days := defaultUpcomingDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 || days > 3660 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	upcoming, err := h.recurringService.GetUpcoming(userID, days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(upcoming)
+		return
+	}
+
+	h.renderRecurring(w, "upcomingList", recurringView{Upcoming: upcoming})
+}
+
+func (h *RecurringHandler) GetRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/recurring/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	recurring, err := h.recurringService.GetRecurringTransaction(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(recurring)
+}
+
+func (h *RecurringHandler) CreateRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	recurring, err := h.recurringFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	recurring, err = h.recurringService.CreateRecurringTransaction(recurring)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(recurring)
+		return
+	}
+
+	h.renderLists(w, userID)
+}
+
+func (h *RecurringHandler) UpdateRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/recurring/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	recurring, err := h.recurringFromForm(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	recurring, err = h.recurringService.UpdateRecurringTransaction(userID, id, recurring)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(recurring)
+		return
+	}
+
+	h.renderLists(w, userID)
+}
+
+func (h *RecurringHandler) DeleteRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/recurring/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.recurringService.DeleteRecurringTransaction(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.renderLists(w, userID)
+}
+
+// SkipOccurrence handles POST /recurring/{id}/occurrences/{date}/skip.
+func (h *RecurringHandler) SkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, date, err := occurrenceFromPath(strings.TrimSuffix(r.URL.Path, "/skip"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.recurringService.SkipOccurrence(userID, id, date)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderUpcoming(w, r, userID)
+}
+
+// EditOccurrence handles PUT /recurring/{id}/occurrences/{date}, changing
+// the amount and memo of one date. Like the template's, the amount is
+// entered as a positive number.
+func (h *RecurringHandler) EditOccurrence(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, date, err := occurrenceFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recurring, err := h.recurringService.GetRecurringTransaction(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	amount, err := money.Parse(r.FormValue("amount"), recurring.Amount.Currency())
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+	amount = amount.Abs()
+	if recurring.Amount.IsNegative() {
+		amount = amount.Neg()
+	}
+
+	err = h.recurringService.EditOccurrence(userID, id, date, amount, r.FormValue("memo"))
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderUpcoming(w, r, userID)
+}
+
+// ResetOccurrence handles DELETE /recurring/{id}/occurrences/{date}, undoing
+// a skip or an edit.
+func (h *RecurringHandler) ResetOccurrence(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, date, err := occurrenceFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.recurringService.ResetOccurrence(userID, id, date)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.renderUpcoming(w, r, userID)
+}
+
+// recurringFromForm reads a template from the form. The amount is entered as
+// a positive number in the account's currency and signed by the category's
+// kind.
+func (h *RecurringHandler) recurringFromForm(r *http.Request, userID int) (models.RecurringTransaction, error) {
+	accountID, err := strconv.Atoi(r.FormValue("account_id"))
+	if err != nil {
+		return models.RecurringTransaction{}, fmt.Errorf("%w: an account is required", services.ErrInvalidRecurring)
+	}
+	account, err := h.accountService.GetAccount(userID, accountID)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		return models.RecurringTransaction{}, fmt.Errorf("%w: a category is required", services.ErrInvalidCategory)
+	}
+	category, err := h.categoryService.GetCategory(userID, categoryID)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	amount, err := money.Parse(r.FormValue("amount"), account.Currency)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	startDate, err := parseDate(r.FormValue("start_date"))
+	if err != nil {
+		return models.RecurringTransaction{}, fmt.Errorf("%w: invalid start date", services.ErrInvalidRecurring)
+	}
+
+	return models.RecurringTransaction{
+		UserID:     userID,
+		AccountID:  accountID,
+		CategoryID: categoryID,
+		PayeeName:  r.FormValue("payee"),
+		Amount:     signedAmount(amount, category),
+		Memo:       r.FormValue("memo"),
+		Rule:       r.FormValue("rule"),
+		StartDate:  startDate,
+	}, nil
+}
+
+// occurrenceFromPath reads the id and date of
+// /recurring/{id}/occurrences/{date}.
+func occurrenceFromPath(urlPath string) (int, time.Time, error) {
+	rest, date, ok := strings.Cut(strings.TrimPrefix(urlPath, "/recurring/"), "/occurrences/")
+	if !ok {
+		return 0, time.Time{}, errors.New("missing date parameter")
+	}
+
+	id, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, time.Time{}, errors.New("invalid id")
+	}
+
+	parsed, err := time.Parse("2006-01-02", strings.Trim(date, "/"))
+	if err != nil {
+		return 0, time.Time{}, errors.New("invalid date")
+	}
+
+	return id, parsed, nil
+}
+
+func (h *RecurringHandler) renderUpcoming(w http.ResponseWriter, r *http.Request, userID int) {
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	upcoming, err := h.recurringService.GetUpcoming(userID, defaultUpcomingDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderRecurring(w, "upcomingList", recurringView{Upcoming: upcoming})
+}
+
+// renderLists re-renders the template list, along with an out-of-band update
+// of the upcoming dates it changes.
+func (h *RecurringHandler) renderLists(w http.ResponseWriter, userID int) {
+	recurring, err := h.recurringService.GetRecurringTransactions(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	upcoming, err := h.recurringService.GetUpcoming(userID, defaultUpcomingDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderRecurring(w, "recurringLists", recurringView{Recurring: recurring, Upcoming: upcoming, OOB: true})
+}
+
+func (h *RecurringHandler) renderRecurring(w http.ResponseWriter, name string, view recurringView) {
+	tmpl, err := template.ParseFiles("templates/recurring.html", "templates/components/recurringList.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, name, view)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+type SessionHandler struct {
+	authService *services.AuthService
+}
+
+func NewSessionHandler(authService *services.AuthService) *SessionHandler {
+	return &SessionHandler{authService}
+}
+
+// GetSessions lists the user's signed-in devices, as JSON for API clients
+// and as a page otherwise.
+func (h *SessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	sessionID := r.Context().Value("sessionID").(string)
+
+	sessions, err := h.authService.GetSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+		return
+	}
+
+	h.renderSessions(w, "sessions.html", sessions)
+}
+
+// DeleteSession signs out one device. Signing out the current one ends the
+// request's own session as well.
+func (h *SessionHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	sessionID := r.Context().Value("sessionID").(string)
+
+	id, err := idFromPath(r.URL.Path, "/sessions/")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.authService.RevokeSession(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if session.FamilyID == sessionID {
+		if isAPIRequest(r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		clearTokenCookies(w)
+		w.Header().Set("HX-Redirect", "/login")
+		return
+	}
+
+	h.renderRemaining(w, r, userID, sessionID)
+}
+
+// DeleteOtherSessions signs out every device except the current one.
+func (h *SessionHandler) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	sessionID := r.Context().Value("sessionID").(string)
+
+	err := h.authService.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderRemaining(w, r, userID, sessionID)
+}
+
+func (h *SessionHandler) renderRemaining(w http.ResponseWriter, r *http.Request, userID int, sessionID string) {
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sessions, err := h.authService.GetSessions(userID, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderSessions(w, "sessionList", sessions)
+}
+
+func (h *SessionHandler) renderSessions(w http.ResponseWriter, name string, sessions []models.Session) {
+	tmpl, err := template.ParseFiles("templates/sessions.html", "templates/components/sessionList.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, name, sessions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
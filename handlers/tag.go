@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"balance-tracker/models"
+	"balance-tracker/services"
+)
+
+// maxTagSuggestions caps the autocomplete list in the transaction forms.
+const maxTagSuggestions = 10
+
+type TagHandler struct {
+	tagService services.TagService
+}
+
+func NewTagHandler(tagService *services.TagService) *TagHandler {
+	return &TagHandler{*tagService}
+}
+
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	tags, err := h.tagService.GetTags(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+// GetTagOptions renders <option> elements for the tags <datalist> of the
+// transaction forms. It completes the last tag typed into ?tags=, keeping the
+// ones before it, so picking a suggestion fills in the whole field.
+func (h *TagHandler) GetTagOptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	value := r.URL.Query().Get("tags")
+	split := strings.LastIndexFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	typed, prefix := value[:split+1], value[split+1:]
+
+	entered, err := services.ParseTags(typed)
+	if err != nil {
+		entered = nil
+	}
+
+	tags, err := h.tagService.SuggestTags(userID, prefix, maxTagSuggestions+len(entered))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	suggestions := []models.Tag{}
+	for _, tag := range tags {
+		if !slices.Contains(entered, tag.Name) && len(suggestions) < maxTagSuggestions {
+			suggestions = append(suggestions, tag)
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/tagOptions.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Typed string
+		Tags  []models.Tag
+	}{
+		Typed: typed,
+		Tags:  suggestions,
+	}
+
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,600 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/services"
+)
+
+type TransactionHandler struct {
+	transactionService services.TransactionService
+	balanceService     services.BalanceService
+	accountService     services.AccountService
+	categoryService    services.CategoryService
+}
+
+func NewTransactionHandler(transactionService *services.TransactionService, balanceService *services.BalanceService, accountService *services.AccountService, categoryService *services.CategoryService) *TransactionHandler {
+	return &TransactionHandler{*transactionService, *balanceService, *accountService, *categoryService}
+}
+
+func (h *TransactionHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	filter, err := transactionFilterFrom(r)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	transactions, err := h.transactionService.GetTransactionsByUserID(userID, filter)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(transactions)
+}
+
+// ListTransactions handles GET /api/v1/transactions, one page of the
+// user's transactions with the filters, sort and cursor of
+// transactionQueryFrom. Browsers get the page as cards, ending in one that
+// loads the next page when it scrolls into view.
+func (h *TransactionHandler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	query, err := transactionQueryFrom(r)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	page, err := h.transactionService.ListTransactions(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/transactionCard.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "transactionPage", newTransactionPageView(r, page))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/transactions/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := h.transactionService.GetTransaction(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(transaction)
+}
+
+func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	accountID, err := strconv.Atoi(r.FormValue("account_id"))
+	if err != nil {
+		http.Error(w, "Invalid account", http.StatusBadRequest)
+		return
+	}
+
+	// Amounts are entered in the account's currency
+	account, err := h.accountService.GetAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	// The transfer form posts here too, naming the destination account
+	if r.FormValue("to_account_id") != "" {
+		h.createTransfer(w, r, account)
+		return
+	}
+
+	splits, err := h.splitsFromForm(r, userID, account.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	// A split transaction takes its categories from its split lines
+	var categoryID *int
+	var amount money.Money
+	if len(splits) > 0 {
+		amount, err = splitAmountFromForm(r, account.Currency, splits)
+	} else {
+		var category models.Category
+		category, amount, err = h.categorizedAmountFromForm(r, userID, account.Currency)
+		categoryID = &category.ID
+		splits = nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := services.ParseTags(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	transaction, _, err := h.transactionService.CreateTransaction(models.Transaction{
+		UserID:     userID,
+		AccountID:  accountID,
+		CategoryID: categoryID,
+		Amount:     amount,
+		Date:       date,
+		PayeeName:  r.FormValue("payee"),
+		Memo:       r.FormValue("memo"),
+		Tags:       tags,
+		Splits:     splits,
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	renderTransactionTemplate(w, &h.balanceService, "transactionCreated", transaction)
+}
+
+// createTransfer moves money out of the from account. The amount is entered
+// in its currency and the rate converts it into the destination's.
+func (h *TransactionHandler) createTransfer(w http.ResponseWriter, r *http.Request, from models.Account) {
+	toAccountID, err := strconv.Atoi(r.FormValue("to_account_id"))
+	if err != nil {
+		http.Error(w, "Invalid account", http.StatusBadRequest)
+		return
+	}
+
+	amount, err := money.Parse(r.FormValue("amount"), from.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	date, err := parseDate(r.FormValue("date"))
+	if err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := h.transactionService.CreateTransfer(models.Transfer{
+		UserID:        from.UserID,
+		FromAccountID: from.ID,
+		ToAccountID:   toAccountID,
+		Amount:        amount,
+		Rate:          money.Decimal(r.FormValue("rate")),
+		Date:          date,
+		Memo:          r.FormValue("memo"),
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	renderTransactionTemplate(w, &h.balanceService, "transactionCreated", transaction)
+}
+
+func (h *TransactionHandler) EditTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(strings.TrimSuffix(r.URL.Path, "/edit"), "/transactions/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := h.transactionService.GetTransaction(userID, id)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	// Balance adjustments keep their category and are edited with their
+	// signed amount
+	view := struct {
+		models.Transaction
+		Adjustment bool
+	}{Transaction: transaction}
+	if transaction.CategoryID != nil {
+		category, err := h.categoryService.GetCategory(userID, *transaction.CategoryID)
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+		view.Adjustment = category.Kind == models.CategoryKindAdjustment
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/editTransactionForm.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl.Execute(w, view)
+}
+
+func (h *TransactionHandler) UpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/transactions/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	accountID, err := strconv.Atoi(r.FormValue("account_id"))
+	if err != nil {
+		http.Error(w, "Invalid account", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.accountService.GetAccount(userID, accountID)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	splits, err := h.splitsFromForm(r, userID, account.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	// Split lines replace the category, and balance adjustments, which are
+	// sent without one, keep theirs along with their signed amount
+	update := models.Transaction{AccountID: accountID}
+	switch {
+	case len(splits) > 0:
+		update.Splits = splits
+		update.Amount, err = splitAmountFromForm(r, account.Currency, splits)
+	case r.FormValue("category_id") == "":
+		update.Amount, err = money.Parse(r.FormValue("amount"), account.Currency)
+	default:
+		var category models.Category
+		category, update.Amount, err = h.categorizedAmountFromForm(r, userID, account.Currency)
+		update.CategoryID = &category.ID
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	update.Date, err = parseDate(r.FormValue("date"))
+	if err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	update.PayeeName = r.FormValue("payee")
+	update.Memo = r.FormValue("memo")
+	if _, ok := r.Form["tags"]; ok {
+		update.Tags, err = services.ParseTags(r.FormValue("tags"))
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+	}
+
+	transaction, _, err := h.transactionService.UpdateTransaction(userID, id, update)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	renderTransactionTemplate(w, &h.balanceService, "transactionUpdated", transaction)
+}
+
+func (h *TransactionHandler) DeleteTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := idFromPath(r.URL.Path, "/transactions/")
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.transactionService.DeleteTransaction(userID, id)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	renderTransactionTemplate(w, &h.balanceService, "transactionDeleted", models.Transaction{UserID: userID})
+}
+
+// categorizedAmountFromForm reads the category and the amount, which is
+// entered as a positive number in the account's currency and signed by the
+// category's kind.
+func (h *TransactionHandler) categorizedAmountFromForm(r *http.Request, userID int, currency string) (models.Category, money.Money, error) {
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		return models.Category{}, money.Money{}, fmt.Errorf("%w: a category is required", services.ErrInvalidCategory)
+	}
+
+	category, err := h.categoryService.GetCategory(userID, categoryID)
+	if err != nil {
+		return models.Category{}, money.Money{}, err
+	}
+
+	amount, err := money.Parse(r.FormValue("amount"), currency)
+	if err != nil {
+		return models.Category{}, money.Money{}, err
+	}
+
+	return category, signedAmount(amount, category), nil
+}
+
+// splitsFromForm reads the split lines of the transaction forms from the
+// repeated split_category_id, split_amount and split_memo fields. Lines
+// without an amount are left out. Like the transaction's amount, each amount
+// is entered as a positive number and signed by its category's kind.
+func (h *TransactionHandler) splitsFromForm(r *http.Request, userID int, currency string) ([]models.Split, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs, amounts, memos := r.Form["split_category_id"], r.Form["split_amount"], r.Form["split_memo"]
+	splits := []models.Split{}
+	for i, value := range amounts {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if i >= len(categoryIDs) {
+			return nil, fmt.Errorf("%w: split line %d has no category", services.ErrInvalidCategory, i+1)
+		}
+
+		categoryID, err := strconv.Atoi(categoryIDs[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: split line %d has no category", services.ErrInvalidCategory, i+1)
+		}
+		category, err := h.categoryService.GetCategory(userID, categoryID)
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := money.Parse(value, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		split := models.Split{CategoryID: category.ID, Amount: signedAmount(amount, category)}
+		if i < len(memos) {
+			split.Memo = memos[i]
+		}
+		splits = append(splits, split)
+	}
+
+	return splits, nil
+}
+
+// splitAmountFromForm reads the total of a split transaction, entered as a
+// positive number. It is an expense if the split lines add up to one.
+func splitAmountFromForm(r *http.Request, currency string, splits []models.Split) (money.Money, error) {
+	amount, err := money.Parse(r.FormValue("amount"), currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	total := money.Zero(currency)
+	for _, split := range splits {
+		total, err = total.Add(split.Amount)
+		if err != nil {
+			return money.Money{}, err
+		}
+	}
+
+	amount = amount.Abs()
+	if total.IsNegative() {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
+
+// signedAmount makes an amount entered as a positive number an expense or an
+// earning according to the category's kind. Balance adjustments are entered
+// with their sign.
+func signedAmount(amount money.Money, category models.Category) money.Money {
+	switch category.Kind {
+	case models.CategoryKindExpense:
+		return amount.Abs().Neg()
+	case models.CategoryKindIncome:
+		return amount.Abs()
+	}
+	return amount
+}
+
+// renderTransactionTemplate renders one of the fragments defined in
+// transactionCard.html, along with an out-of-band update of the accounts
+// overview. The ledgerChanged event it triggers refreshes the budgets.
+func renderTransactionTemplate(w http.ResponseWriter, balanceService *services.BalanceService, name string, transaction models.Transaction) {
+	overview, err := loadOverview(balanceService, transaction.UserID, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/transactionCard.html", "templates/components/accountsOverview.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Transaction models.Transaction
+		Overview    overviewView
+	}{
+		Transaction: transaction,
+		Overview:    overview,
+	}
+
+	w.Header().Set("HX-Trigger", "ledgerChanged")
+	w.WriteHeader(http.StatusOK)
+	tmpl.ExecuteTemplate(w, name, data)
+}
+
+// idFromPath extracts the numeric id that follows prefix in the URL path.
+func idFromPath(urlPath string, prefix string) (int, error) {
+	id := strings.Trim(strings.TrimPrefix(urlPath, prefix), "/")
+	if id == "" {
+		return 0, errors.New("missing id parameter")
+	}
+
+	return strconv.Atoi(id)
+}
+
+// transactionFilterFrom reads listing filters from the query string: tags,
+// e.g. ?tag=trip-kyoto&tag=reimbursable or ?tag=trip-kyoto+reimbursable,
+// from and to dates, account_id, category_id, payee_id, min_amount and
+// max_amount, and q for text in the memo or payee. Empty values are left
+// out. The service normalizes and checks the rest.
+func transactionFilterFrom(r *http.Request) (models.TransactionFilter, error) {
+	query := r.URL.Query()
+	filter := models.TransactionFilter{
+		Tags: services.SplitTags(strings.Join(query["tag"], ",")),
+		Text: query.Get("q"),
+	}
+
+	for name, date := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return models.TransactionFilter{}, fmt.Errorf("%w: invalid %s date %q, expected YYYY-MM-DD", services.ErrInvalidTransaction, name, value)
+			}
+			*date = &parsed
+		}
+	}
+
+	for name, id := range map[string]**int{"account_id": &filter.AccountID, "category_id": &filter.CategoryID, "payee_id": &filter.PayeeID} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return models.TransactionFilter{}, fmt.Errorf("%w: invalid %s %q", services.ErrInvalidTransaction, name, value)
+			}
+			*id = &parsed
+		}
+	}
+
+	for name, amount := range map[string]**money.Decimal{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := strings.ReplaceAll(strings.TrimSpace(query.Get(name)), ",", ""); value != "" {
+			decimal := money.Decimal(value)
+			*amount = &decimal
+		}
+	}
+
+	return filter, nil
+}
+
+// transactionQueryFrom reads a page of a transaction listing from the query
+// string: the filters of transactionFilterFrom, sort, cursor and limit.
+func transactionQueryFrom(r *http.Request) (models.TransactionQuery, error) {
+	filter, err := transactionFilterFrom(r)
+	if err != nil {
+		return models.TransactionQuery{}, err
+	}
+
+	query := models.TransactionQuery{
+		Filter: filter,
+		Sort:   models.TransactionSort(r.URL.Query().Get("sort")),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return models.TransactionQuery{}, fmt.Errorf("%w: invalid limit %q", services.ErrInvalidTransaction, value)
+		}
+	}
+
+	return query, nil
+}
+
+// transactionPageView is a page of transaction cards. Next is the URL of
+// the page after it, with the same filters and sort.
+type transactionPageView struct {
+	Transactions []models.Transaction
+	Next         string
+}
+
+func newTransactionPageView(r *http.Request, page models.TransactionPage) transactionPageView {
+	view := transactionPageView{Transactions: page.Transactions}
+	if page.NextCursor != "" {
+		query := r.URL.Query()
+		query.Set("cursor", page.NextCursor)
+		view.Next = "/api/v1/transactions?" + query.Encode()
+	}
+	return view
+}
+
+// parseDate parses a date input value. An empty value means today.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound), errors.Is(err, services.ErrAccountNotFound), errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrCategoryNotFound),
+		errors.Is(err, services.ErrPayeeNotFound), errors.Is(err, services.ErrRecurringNotFound), errors.Is(err, services.ErrOccurrenceNotFound),
+		errors.Is(err, services.ErrBudgetNotFound), errors.Is(err, services.ErrGoalNotFound), errors.Is(err, services.ErrImportProfileNotFound),
+		errors.Is(err, services.ErrBalanceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAccountHasTransactions), errors.Is(err, services.ErrCategoryInUse), errors.Is(err, services.ErrPayeeInUse),
+		errors.Is(err, services.ErrOccurrenceIsHistory), errors.Is(err, services.ErrEnvelopesOff):
+		return http.StatusConflict
+	case errors.Is(err, money.ErrCurrencyMismatch), errors.Is(err, money.ErrInvalidCurrency), errors.Is(err, money.ErrInvalidAmount), errors.Is(err, services.ErrInvalidCategory),
+		errors.Is(err, services.ErrInvalidTag), errors.Is(err, services.ErrInvalidTransaction), errors.Is(err, services.ErrInvalidPayee),
+		errors.Is(err, services.ErrInvalidRecurring), errors.Is(err, services.ErrInvalidRecurrence), errors.Is(err, services.ErrInvalidBudget),
+		errors.Is(err, services.ErrInvalidEnvelope), errors.Is(err, services.ErrInvalidGoal), errors.Is(err, services.ErrInvalidImport), errors.Is(err, services.ErrInvalidBackup),
+		errors.Is(err, services.ErrInvalidJournal):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"balance-tracker/services"
+)
+
+type UserHandler struct {
+	userService    services.UserService
+	balanceService services.BalanceService
+}
+
+func NewUserHandler(userService *services.UserService, balanceService *services.BalanceService) *UserHandler {
+	return &UserHandler{*userService, *balanceService}
+}
+
+// UpdateBaseCurrency changes the currency totals are shown in and responds
+// with the refreshed accounts overview.
+func (h *UserHandler) UpdateBaseCurrency(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	_, err := h.userService.SetBaseCurrency(userID, r.FormValue("base_currency"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	overview, err := loadOverview(&h.balanceService, userID, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/components/accountsOverview.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl.ExecuteTemplate(w, "accountsOverview", overview)
+}
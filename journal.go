@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"balance-tracker/repositories"
+	"balance-tracker/services"
+)
+
+// runJournal implements the "journal" subcommand:
+//
+//	balance-tracker journal export beancount USERNAME [FILE]   write the user's ledger for Beancount
+//	balance-tracker journal export ledger USERNAME [FILE]      write the user's ledger for Ledger and hledger
+//	balance-tracker journal import USERNAME FILE               merge a Beancount file, with its prices
+//
+// Exports go to standard output unless a file is given.
+func runJournal(db *repositories.DB, args []string) error {
+	userRepository := repositories.NewUserRepository(db)
+	exchangeRateRepository := repositories.NewExchangeRateRepository(db)
+	txRunner := repositories.NewTxRunner(db)
+	backupService := services.NewBackupService(userRepository, repositories.NewAccountRepository(db), repositories.NewCategoryRepository(db), repositories.NewTagRepository(db), repositories.NewPayeeRepository(db), repositories.NewTransactionRepository(db), repositories.NewTransferRepository(db), repositories.NewRecurringRepository(db), repositories.NewBudgetRepository(db), repositories.NewEnvelopeRepository(db), repositories.NewGoalRepository(db), repositories.NewImportProfileRepository(db), repositories.NewBalanceRepository(db), txRunner)
+	journalService := services.NewJournalService(userRepository, exchangeRateRepository, backupService, txRunner)
+
+	if len(args) == 0 {
+		return fmt.Errorf("expected journal export beancount|ledger USERNAME [FILE] or journal import USERNAME FILE")
+	}
+
+	switch args[0] {
+	case "export":
+		if len(args) < 3 || len(args) > 4 {
+			return fmt.Errorf("expected journal export beancount|ledger USERNAME [FILE]")
+		}
+		var export func(int, io.Writer, time.Time) error
+		switch args[1] {
+		case "beancount":
+			export = journalService.ExportBeancount
+		case "ledger":
+			export = journalService.ExportLedger
+		default:
+			return fmt.Errorf("unknown journal format %q, expected beancount or ledger", args[1])
+		}
+		user, err := userRepository.GetUserByUsername(args[2])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[2], err)
+		}
+
+		out := os.Stdout
+		if len(args) == 4 {
+			out, err = os.Create(args[3])
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		return export(user.ID, out, time.Now())
+	case "import":
+		if len(args) != 3 {
+			return fmt.Errorf("expected journal import USERNAME FILE")
+		}
+		user, err := userRepository.GetUserByUsername(args[1])
+		if err != nil {
+			return fmt.Errorf("user %s: %w", args[1], err)
+		}
+		data, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		result, err := journalService.ImportBeancount(user.ID, data, true)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[2], err)
+		}
+		log.Printf("imported %d accounts, %d categories, %d payees, %d transactions and %d prices from %s, %d records were there already", result.Accounts, result.Categories, result.Payees, result.Transactions, result.Prices, args[2], result.Skipped)
+		return nil
+	default:
+		return fmt.Errorf("unknown journal command %q, expected export or import", args[0])
+	}
+}
@@ -1,48 +1,147 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"balance-tracker/handlers"
 	"balance-tracker/repositories"
 	"balance-tracker/services"
 	"balance-tracker/utils"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 func main() {
 	// Load environment variables
 	envs := utils.NewEnvEngine()
-	dbHost := envs.LoadEnv("DB_HOST")
-	dbPort := envs.LoadEnv("DB_PORT")
-	dbUser := envs.LoadEnv("DB_USER")
-	dbPassword := envs.LoadEnv("DB_PASSWORD")
-	dbName := envs.LoadEnv("DB_NAME")
-
-	// Connect to PostgreSQL database
-	db, err := sql.Open("pgx", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName))
+	backend := envs.LoadEnv("DB_BACKEND")
+
+	// Connect to the storage backend
+	var dsn string
+	switch backend {
+	case "sqlite":
+		dsn = envs.LoadEnv("DB_PATH")
+	case "memory":
+	default:
+		dbHost := envs.LoadEnv("DB_HOST")
+		dbPort := envs.LoadEnv("DB_PORT")
+		dbUser := envs.LoadEnv("DB_USER")
+		dbPassword := envs.LoadEnv("DB_PASSWORD")
+		dbName := envs.LoadEnv("DB_NAME")
+		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName)
+	}
+
+	db, err := repositories.Open(backend, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
+	// Schema migrations
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(db, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// Exchange rates
+	if len(os.Args) > 1 && os.Args[1] == "rates" {
+		err := runRates(db, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// Beancount and Ledger journals
+	if len(os.Args) > 1 && os.Args[1] == "journal" {
+		err := runJournal(db, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// An in-memory database starts out empty every time
+	if envs.LoadEnv("MIGRATE_ON_START") == "true" || backend == "memory" {
+		err := runMigrate(db, []string{"up"})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Signing keys for session tokens
+	tokenIssuer, err := utils.LoadTokenIssuer(envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Create repositories
 	balanceRepository := repositories.NewBalanceRepository(db)
+	transactionRepository := repositories.NewTransactionRepository(db)
+	accountRepository := repositories.NewAccountRepository(db)
+	txRunner := repositories.NewTxRunner(db)
 	userRepository := repositories.NewUserRepository(db)
 	sessionRepository := repositories.NewSessionRepository(db)
+	categoryRepository := repositories.NewCategoryRepository(db)
+	tagRepository := repositories.NewTagRepository(db)
+	payeeRepository := repositories.NewPayeeRepository(db)
+	exchangeRateRepository := repositories.NewExchangeRateRepository(db)
+	transferRepository := repositories.NewTransferRepository(db)
+	recurringRepository := repositories.NewRecurringRepository(db)
+	budgetRepository := repositories.NewBudgetRepository(db)
+	envelopeRepository := repositories.NewEnvelopeRepository(db)
+	goalRepository := repositories.NewGoalRepository(db)
+	importProfileRepository := repositories.NewImportProfileRepository(db)
 
 	// Create services
-	authService := services.NewAuthService(userRepository, sessionRepository)
-	balanceService := services.NewBalanceService(balanceRepository)
+	authService := services.NewAuthService(userRepository, sessionRepository, tokenIssuer)
+	balanceService := services.NewBalanceService(balanceRepository, accountRepository, userRepository, exchangeRateRepository)
+	transactionService := services.NewTransactionService(transactionRepository, balanceRepository, accountRepository, categoryRepository, payeeRepository, transferRepository, txRunner)
+	accountService := services.NewAccountService(accountRepository, transactionRepository, balanceRepository, txRunner)
+	categoryService := services.NewCategoryService(categoryRepository, transactionRepository)
+	tagService := services.NewTagService(tagRepository)
+	payeeService := services.NewPayeeService(payeeRepository, transactionRepository, categoryRepository, txRunner)
+	exchangeRateService := services.NewExchangeRateService(exchangeRateRepository, txRunner)
+	userService := services.NewUserService(userRepository)
+	budgetService := services.NewBudgetService(budgetRepository, userRepository, exchangeRateRepository, categoryService, txRunner)
+	envelopeService := services.NewEnvelopeService(envelopeRepository, userRepository, accountRepository, transactionRepository, exchangeRateRepository, categoryService, txRunner)
+	goalService := services.NewGoalService(goalRepository, accountRepository, transactionRepository, exchangeRateRepository, categoryService)
+	importService := services.NewImportService(importProfileRepository, transactionService)
+	backupService := services.NewBackupService(userRepository, accountRepository, categoryRepository, tagRepository, payeeRepository, transactionRepository, transferRepository, recurringRepository, budgetRepository, envelopeRepository, goalRepository, importProfileRepository, balanceRepository, txRunner)
+	journalService := services.NewJournalService(userRepository, exchangeRateRepository, backupService, txRunner)
+	recurringService := services.NewRecurringService(recurringRepository, accountRepository, categoryRepository, transactionService, txRunner)
+
+	// Give new users somewhere to record into
+	authService.OnRegister(accountService.CreateDefaultAccount)
+	authService.OnRegister(categoryService.CreateDefaultCategories)
+
+	// Post recurring transactions as they come due. The first run catches
+	// up on any dates missed while the server was down.
+	go recurringService.RunScheduler(context.Background(), time.Hour)
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	balanceHandler := handlers.NewBalanceHandler(balanceService)
-	pageHandler := handlers.NewPageHandler(balanceService)
+	balanceHandler := handlers.NewBalanceHandler(balanceService, transactionService, accountService)
+	transactionHandler := handlers.NewTransactionHandler(transactionService, balanceService, accountService, categoryService)
+	accountHandler := handlers.NewAccountHandler(accountService, balanceService)
+	sessionHandler := handlers.NewSessionHandler(authService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService, payeeService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	payeeHandler := handlers.NewPayeeHandler(payeeService)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(exchangeRateService)
+	userHandler := handlers.NewUserHandler(userService, balanceService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService, envelopeService, userService)
+	envelopeHandler := handlers.NewEnvelopeHandler(envelopeService, userService)
+	goalHandler := handlers.NewGoalHandler(goalService, accountService, categoryService, userService)
+	importHandler := handlers.NewImportHandler(importService, accountService, categoryService)
+	backupHandler := handlers.NewBackupHandler(backupService)
+	journalHandler := handlers.NewJournalHandler(journalService)
+	recurringHandler := handlers.NewRecurringHandler(recurringService, accountService, categoryService)
+	pageHandler := handlers.NewPageHandler(balanceService, transactionService, categoryService, payeeService)
 
 	// Create HTTP server
 	server := http.NewServeMux()
@@ -69,6 +168,7 @@ func main() {
 	})
 
 	server.HandleFunc("/logout", authHandler.Logout)
+	server.HandleFunc("/auth/refresh", authHandler.Refresh)
 
 	// Authenticated routes
 	authMiddleware := authHandler.AuthMiddleware()
@@ -90,10 +190,376 @@ func main() {
 			balanceHandler.GetBalance(w, r)
 		case http.MethodPost:
 			balanceHandler.CreateBalance(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/accounts", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			accountHandler.GetAccounts(w, r)
+		case http.MethodPost:
+			accountHandler.CreateAccount(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/accounts/options", authMiddleware(accountHandler.GetAccountOptions))
+
+	server.HandleFunc("/accounts/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			accountHandler.GetAccount(w, r)
+		case http.MethodPut:
+			accountHandler.UpdateAccount(w, r)
+		case http.MethodDelete:
+			accountHandler.DeleteAccount(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/categories", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryHandler.GetCategories(w, r)
+		case http.MethodPost:
+			categoryHandler.CreateCategory(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/categories/options", authMiddleware(categoryHandler.GetCategoryOptions))
+	server.HandleFunc("/categories/totals", authMiddleware(categoryHandler.GetCategoryTotals))
+
+	server.HandleFunc("/categories/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryHandler.GetCategory(w, r)
+		case http.MethodPut:
+			categoryHandler.UpdateCategory(w, r)
+		case http.MethodDelete:
+			categoryHandler.DeleteCategory(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/tags", authMiddleware(tagHandler.GetTags))
+	server.HandleFunc("/tags/options", authMiddleware(tagHandler.GetTagOptions))
+
+	server.HandleFunc("/payees", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			payeeHandler.GetPayees(w, r)
+		case http.MethodPost:
+			payeeHandler.CreatePayee(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/payees/options", authMiddleware(payeeHandler.GetPayeeOptions))
+
+	server.HandleFunc("/payees/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/merge"):
+			payeeHandler.MergePayee(w, r)
+		case r.Method == http.MethodGet:
+			payeeHandler.GetPayee(w, r)
+		case r.Method == http.MethodPut:
+			payeeHandler.UpdatePayee(w, r)
+		case r.Method == http.MethodDelete:
+			payeeHandler.DeletePayee(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/exchange-rates", authMiddleware(exchangeRateHandler.GetExchangeRates))
+	server.HandleFunc("/settings/base-currency", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userHandler.UpdateBaseCurrency(w, r)
+	}))
+
+	server.HandleFunc("/transactions", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			transactionHandler.GetTransactions(w, r)
+		case http.MethodPost:
+			transactionHandler.CreateTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/api/v1/transactions", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		transactionHandler.ListTransactions(w, r)
+	}))
+
+	server.HandleFunc("/transactions/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/edit"):
+			transactionHandler.EditTransaction(w, r)
+		case r.Method == http.MethodGet:
+			transactionHandler.GetTransaction(w, r)
+		case r.Method == http.MethodPut:
+			transactionHandler.UpdateTransaction(w, r)
+		case r.Method == http.MethodDelete:
+			transactionHandler.DeleteTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/budgets", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			budgetHandler.GetBudgets(w, r)
+		case http.MethodPost:
+			budgetHandler.SetBudget(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/budgets/status", authMiddleware(budgetHandler.GetBudgetStatus))
+	server.HandleFunc("/budgets/copy", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		budgetHandler.CopyPreviousMonth(w, r)
+	}))
+
+	server.HandleFunc("/budgets/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			budgetHandler.UpdateBudget(w, r)
+		case http.MethodDelete:
+			budgetHandler.DeleteBudget(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/envelopes", authMiddleware(envelopeHandler.GetEnvelopes))
+	server.HandleFunc("/envelopes/mode", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		envelopeHandler.SetMode(w, r)
+	}))
+	server.HandleFunc("/envelopes/assign", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		envelopeHandler.Assign(w, r)
+	}))
+	server.HandleFunc("/envelopes/move", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		envelopeHandler.Move(w, r)
+	}))
+
+	server.HandleFunc("/goals", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			goalHandler.GetGoals(w, r)
+		case http.MethodPost:
+			goalHandler.CreateGoal(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/goals/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			goalHandler.GetGoal(w, r)
 		case http.MethodPut:
-			balanceHandler.UpdateBalance(w, r)
+			goalHandler.UpdateGoal(w, r)
+		case http.MethodDelete:
+			goalHandler.DeleteGoal(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/import", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			importHandler.GetImportPage(w, r)
+		case http.MethodPost:
+			importHandler.Import(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/import/preview", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		importHandler.Preview(w, r)
+	}))
+
+	server.HandleFunc("/import/mapping", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		importHandler.GetMapping(w, r)
+	}))
+
+	server.HandleFunc("/import/csv/preview", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		importHandler.PreviewCSV(w, r)
+	}))
+
+	server.HandleFunc("/import/csv", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		importHandler.ImportCSV(w, r)
+	}))
+
+	server.HandleFunc("/import/profiles", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			importHandler.GetProfiles(w, r)
+		case http.MethodPost:
+			importHandler.SaveProfile(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/import/profiles/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		importHandler.DeleteProfile(w, r)
+	}))
+
+	server.HandleFunc("/backup", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		backupHandler.GetBackupPage(w, r)
+	}))
+
+	server.HandleFunc("/backup/export", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		backupHandler.Export(w, r)
+	}))
+
+	server.HandleFunc("/backup/restore", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		backupHandler.Restore(w, r)
+	}))
+
+	server.HandleFunc("/export/beancount", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		journalHandler.ExportBeancount(w, r)
+	}))
+
+	server.HandleFunc("/export/ledger", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		journalHandler.ExportLedger(w, r)
+	}))
+
+	server.HandleFunc("/import/beancount", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		journalHandler.ImportBeancount(w, r)
+	}))
+
+	server.HandleFunc("/recurring", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			recurringHandler.GetRecurringTransactions(w, r)
+		case http.MethodPost:
+			recurringHandler.CreateRecurringTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/recurring/upcoming", authMiddleware(recurringHandler.GetUpcoming))
+
+	server.HandleFunc("/recurring/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		occurrence := strings.Contains(r.URL.Path, "/occurrences/")
+		switch {
+		case occurrence && r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/skip"):
+			recurringHandler.SkipOccurrence(w, r)
+		case occurrence && r.Method == http.MethodPut:
+			recurringHandler.EditOccurrence(w, r)
+		case occurrence && r.Method == http.MethodDelete:
+			recurringHandler.ResetOccurrence(w, r)
+		case occurrence:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		case r.Method == http.MethodGet:
+			recurringHandler.GetRecurringTransaction(w, r)
+		case r.Method == http.MethodPut:
+			recurringHandler.UpdateRecurringTransaction(w, r)
+		case r.Method == http.MethodDelete:
+			recurringHandler.DeleteRecurringTransaction(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/sessions", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			sessionHandler.GetSessions(w, r)
+		case http.MethodDelete:
+			sessionHandler.DeleteOtherSessions(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	server.HandleFunc("/sessions/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
 		case http.MethodDelete:
-			balanceHandler.DeleteBalance(w, r)
+			sessionHandler.DeleteSession(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -103,7 +569,7 @@ func main() {
 	server.HandleFunc("/htmx.min.js", pageHandler.HandleHtmxServe)
 	server.HandleFunc("/tailwind.js", pageHandler.HandleTailwindServe)
 	server.HandleFunc("/static/*", pageHandler.HandleStaticServe)
-	server.HandleFunc("/create-transaction", authMiddleware(balanceHandler.CreateTransaction))
+	server.HandleFunc("/create-transaction", authMiddleware(transactionHandler.CreateTransaction))
 
 	// Start HTTP server
 	log.Println("Server listening on port 8080")
@@ -0,0 +1,314 @@
+// Package migrations keeps the database schema in versioned SQL files that
+// are embedded into the binary and applied in order.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"balance-tracker/repositories"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockID identifies the Postgres advisory lock that keeps two processes from
+// migrating the same database at once. SQLite transactions already exclude
+// each other.
+const lockID = 7231604
+
+// baselineTable is created by the first migration. A database that has it
+// but no record of that migration was set up by hand before migrations
+// existed.
+const baselineTable = "users"
+
+// Migration is one schema change. Files are named NNNN_name.up.sql and
+// NNNN_name.down.sql, and optionally NNNN_name.baseline.sql, which runs
+// instead of the up file to adopt a database set up before migrations.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Baseline string
+}
+
+// Status reports whether a migration has been applied to the database.
+type Status struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+type Migrator struct {
+	db         *repositories.DB
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations written for the database's dialect. The
+// in-memory backend has no schema, so its migrator has nothing to do.
+func NewMigrator(db *repositories.DB) (*Migrator, error) {
+	if db.InMemory() {
+		return &Migrator{db, nil}, nil
+	}
+
+	migrations, err := load(files, db.Dialect.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db, migrations}, nil
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		case strings.HasSuffix(name, ".baseline.sql"):
+			direction = "baseline"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: label}
+			byVersion[version] = migration
+		} else if migration.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, label)
+		}
+
+		switch direction {
+		case "up":
+			migration.Up = string(body)
+		case "down":
+			migration.Down = string(body)
+		case "baseline":
+			migration.Baseline = string(body)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and when it was applied, if at all.
+func (m *Migrator) Status() ([]Status, error) {
+	if m.db.InMemory() {
+		return []Status{}, nil
+	}
+
+	err := m.ensureTable()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = sql.NullTime{Time: appliedAt, Valid: true}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns the ones
+// it applied. Each migration runs in its own transaction.
+func (m *Migrator) Up() ([]Migration, error) {
+	if m.db.InMemory() {
+		return []Migration{}, nil
+	}
+
+	err := m.ensureTable()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range m.migrations {
+		ran, err := m.apply(migration, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// Down reverts the most recently applied migrations, at most steps of them,
+// and returns the ones it reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if m.db.InMemory() {
+		return []Migration{}, nil
+	}
+
+	err := m.ensureTable()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		ran, err := m.apply(migration, false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// apply runs one migration in the given direction unless the database is
+// already on that side of it. It reports whether anything was run.
+func (m *Migrator) apply(migration Migration, up bool) (bool, error) {
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.db.Dialect.Name() == "postgres" {
+		_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", lockID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	var applied bool
+	err = tx.QueryRow(m.db.Dialect.Rewrite("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)"), migration.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		script := migration.Up
+		if migration.Baseline != "" {
+			var exists bool
+			exists, err = m.tableExists(tx, baselineTable)
+			if err != nil {
+				return false, err
+			}
+			if exists {
+				script = migration.Baseline
+			}
+		}
+		_, err = tx.Exec(script)
+		if err == nil {
+			_, err = tx.Exec(m.db.Dialect.Rewrite("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"), migration.Version, migration.Name)
+		}
+	} else {
+		if migration.Down == "" {
+			return false, fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+		}
+		_, err = tx.Exec(migration.Down)
+		if err == nil {
+			_, err = tx.Exec(m.db.Dialect.Rewrite("DELETE FROM schema_migrations WHERE version = $1"), migration.Version)
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return true, tx.Commit()
+}
+
+func (m *Migrator) tableExists(tx *sql.Tx, name string) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1)"
+	if m.db.Dialect.Name() == "sqlite" {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)"
+	}
+
+	var exists bool
+	err := tx.QueryRow(m.db.Dialect.Rewrite(query), name).Scan(&exists)
+	return exists, err
+}
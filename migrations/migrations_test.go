@@ -0,0 +1,226 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"balance-tracker/repositories"
+)
+
+// openTestPostgres returns a connection to a schema of its own in the
+// database named by TEST_DATABASE_URL, so that migrating down does not touch
+// what other tests use. It skips the test if no database is named.
+func openTestPostgres(t *testing.T) *repositories.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := repositories.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin, err := repositories.Open("postgres", url)
+		if err == nil {
+			admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			admin.Close()
+		}
+	})
+
+	separator := " "
+	if strings.Contains(url, "://") {
+		separator = "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+	}
+	db, err := repositories.Open("postgres", url+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func openTestSQLite(t *testing.T) *repositories.DB {
+	t.Helper()
+
+	db, err := repositories.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestUpDownUp(t *testing.T) {
+	for name, open := range map[string]func(*testing.T) *repositories.DB{"sqlite": openTestSQLite, "postgres": openTestPostgres} {
+		t.Run(name, func(t *testing.T) {
+			db := open(t)
+			migrator, err := NewMigrator(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all := len(migrator.migrations)
+
+			for round := 1; round <= 2; round++ {
+				applied, err := migrator.Up()
+				if err != nil {
+					t.Fatalf("up, round %d: %v", round, err)
+				}
+				if len(applied) != all {
+					t.Fatalf("up, round %d: applied %d migrations, want %d", round, len(applied), all)
+				}
+				assertApplied(t, migrator, all)
+
+				applied, err = migrator.Up()
+				if err != nil || len(applied) != 0 {
+					t.Fatalf("up again, round %d: applied %d, err = %v, want nothing", round, len(applied), err)
+				}
+
+				reverted, err := migrator.Down(all)
+				if err != nil {
+					t.Fatalf("down, round %d: %v", round, err)
+				}
+				if len(reverted) != all {
+					t.Fatalf("down, round %d: reverted %d migrations, want %d", round, len(reverted), all)
+				}
+				assertApplied(t, migrator, 0)
+			}
+
+			_, err = migrator.Up()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertApplied(t, migrator, all)
+		})
+	}
+}
+
+func assertApplied(t *testing.T, migrator *Migrator, want int) {
+	t.Helper()
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := 0
+	for _, status := range statuses {
+		if status.AppliedAt.Valid {
+			applied++
+		}
+	}
+	if applied != want {
+		t.Fatalf("%d migrations applied, want %d", applied, want)
+	}
+}
+
+func TestBaselineAdoptsExistingTables(t *testing.T) {
+	db := openTestSQLite(t)
+	fsys := fstest.MapFS{
+		"sqlite/0001_init.up.sql":       {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT NOT NULL); CREATE TABLE notes (id INTEGER PRIMARY KEY);")},
+		"sqlite/0001_init.baseline.sql": {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY);")},
+		"sqlite/0001_init.down.sql":     {Data: []byte("DROP TABLE notes; DROP TABLE users;")},
+		"sqlite/0002_more.up.sql":       {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"sqlite/0002_more.down.sql":     {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+	}
+	migrations, err := load(fsys, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := &Migrator{db, migrations}
+
+	// A database from before migrations
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT NOT NULL); INSERT INTO users (username) VALUES ('alice');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("applied %d migrations, want 2", len(applied))
+	}
+
+	var username string
+	err = db.QueryRow("SELECT username FROM users").Scan(&username)
+	if err != nil || username != "alice" {
+		t.Fatalf("existing user: %q, %v", username, err)
+	}
+	_, err = db.Exec("INSERT INTO notes (id) VALUES (1)")
+	if err != nil {
+		t.Fatalf("baseline did not create the missing table: %v", err)
+	}
+
+	// Once recorded, the migration reverts and reapplies normally
+	_, err = migrator.Down(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, migrator, 2)
+}
+
+func TestPostgresBaseline(t *testing.T) {
+	db := openTestPostgres(t)
+
+	// The tables as they were before migrations existed
+	_, err := db.Exec(`
+		CREATE TABLE users (id SERIAL PRIMARY KEY, username TEXT NOT NULL UNIQUE, password TEXT NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT now(), updated_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE TABLE sessions (id SERIAL PRIMARY KEY, created_at TIMESTAMPTZ NOT NULL DEFAULT now(), deleted_at TIMESTAMPTZ, token TEXT NOT NULL UNIQUE);
+		CREATE TABLE balances (id SERIAL PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id), amount DOUBLE PRECISION NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT now(), updated_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		INSERT INTO users (username, password) VALUES ('alice', 'hash');
+		INSERT INTO balances (user_id, amount, created_at) VALUES (1, 100, '2024-01-01'), (1, 250.5, '2024-02-01');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, migrator, len(migrator.migrations))
+
+	var name, openingBalance string
+	var accountID int
+	err = db.QueryRow("SELECT id, name, opening_balance::TEXT FROM accounts WHERE user_id = 1").Scan(&accountID, &name, &openingBalance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Cash" || openingBalance != "250.5000" {
+		t.Fatalf("account %q opens with %s, want Cash with the latest balance 250.5000", name, openingBalance)
+	}
+
+	var unassigned int
+	err = db.QueryRow("SELECT COUNT(*) FROM balances WHERE account_id IS DISTINCT FROM $1", accountID).Scan(&unassigned)
+	if err != nil || unassigned != 0 {
+		t.Fatalf("%d balances outside the account, err = %v", unassigned, err)
+	}
+}
@@ -0,0 +1,60 @@
+-- Runs instead of 0001_init.up.sql on a database that was set up by hand
+-- before migrations existed. Such a database has the users, sessions and
+-- balances tables, the latter as a single running total per user, and may
+-- have some of the others. Everything is brought to the shape of 0001_init.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    opening_balance NUMERIC(20, 4) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    amount NUMERIC(20, 4) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    date TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transactions_user_id_date_idx ON transactions (user_id, date DESC, id DESC);
+CREATE INDEX IF NOT EXISTS transactions_account_id_idx ON transactions (account_id);
+
+ALTER TABLE balances ALTER COLUMN amount TYPE NUMERIC(20, 4);
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts (id) ON DELETE CASCADE;
+ALTER TABLE balances ADD COLUMN IF NOT EXISTS currency CHAR(3);
+
+-- A user's running totals move into a cash account that opens with the
+-- latest of them, so the balance derived from the ledger matches
+INSERT INTO accounts (user_id, name, type, currency, opening_balance)
+SELECT DISTINCT ON (user_id) user_id, 'Cash', 'cash', 'JPY', amount
+FROM balances
+WHERE account_id IS NULL
+ORDER BY user_id, created_at DESC, id DESC;
+
+UPDATE balances
+SET account_id = (SELECT MAX(accounts.id) FROM accounts WHERE accounts.user_id = balances.user_id),
+    currency = 'JPY'
+WHERE account_id IS NULL;
+
+ALTER TABLE balances ALTER COLUMN account_id SET NOT NULL;
+ALTER TABLE balances ALTER COLUMN currency SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS balances_user_id_created_at_idx ON balances (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS balances_account_id_created_at_idx ON balances (account_id, created_at DESC, id DESC);
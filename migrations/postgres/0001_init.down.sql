@@ -0,0 +1,5 @@
+DROP TABLE balances;
+DROP TABLE transactions;
+DROP TABLE accounts;
+DROP TABLE sessions;
+DROP TABLE users;
@@ -0,0 +1,8 @@
+DROP TABLE sessions;
+
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at TIMESTAMPTZ,
+    token TEXT NOT NULL UNIQUE
+);
@@ -0,0 +1,17 @@
+-- Sessions used to hold year-long JWTs, which are no longer accepted. Each
+-- row is now one refresh token. Rotating a token marks it used and adds its
+-- successor to the same family.
+DROP TABLE sessions;
+
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_family_id_idx ON sessions (family_id);
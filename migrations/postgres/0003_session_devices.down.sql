@@ -0,0 +1,5 @@
+DROP INDEX sessions_user_id_idx;
+
+ALTER TABLE sessions DROP COLUMN last_seen_at;
+ALTER TABLE sessions DROP COLUMN ip;
+ALTER TABLE sessions DROP COLUMN user_agent;
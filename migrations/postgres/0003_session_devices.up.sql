@@ -0,0 +1,10 @@
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMPTZ;
+
+UPDATE sessions SET last_seen_at = created_at;
+
+ALTER TABLE sessions ALTER COLUMN last_seen_at SET NOT NULL;
+ALTER TABLE sessions ALTER COLUMN last_seen_at SET DEFAULT now();
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
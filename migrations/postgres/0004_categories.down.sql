@@ -0,0 +1,4 @@
+DROP INDEX transactions_category_id_idx;
+ALTER TABLE transactions DROP COLUMN category_id;
+
+DROP TABLE categories;
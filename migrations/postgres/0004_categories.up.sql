@@ -0,0 +1,17 @@
+CREATE TABLE categories (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES categories (id),
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX categories_user_id_idx ON categories (user_id);
+
+-- Entries recorded before categories existed, and balance adjustments, have
+-- no category.
+ALTER TABLE transactions ADD COLUMN category_id INTEGER REFERENCES categories (id);
+
+CREATE INDEX transactions_category_id_idx ON transactions (category_id);
@@ -0,0 +1,14 @@
+-- One unit of base is worth rate units of quote on the given date.
+CREATE TABLE exchange_rates (
+    id SERIAL PRIMARY KEY,
+    date DATE NOT NULL,
+    base TEXT NOT NULL,
+    quote TEXT NOT NULL,
+    rate NUMERIC NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (base, quote, date)
+);
+
+-- Totals across accounts are converted into the user's base currency.
+ALTER TABLE users ADD COLUMN base_currency TEXT NOT NULL DEFAULT 'JPY';
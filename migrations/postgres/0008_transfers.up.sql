@@ -0,0 +1,16 @@
+-- A transfer moves money between two of a user's accounts. It is recorded as
+-- two ledger entries, one per account, linked through transfer_id. The rate
+-- is the number of units of the destination currency per unit of the source
+-- currency, 1 between accounts in the same currency.
+CREATE TABLE transfers (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rate NUMERIC NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX transfers_user_id_idx ON transfers (user_id);
+
+ALTER TABLE transactions ADD COLUMN transfer_id INTEGER REFERENCES transfers (id) ON DELETE CASCADE;
+
+CREATE INDEX transactions_transfer_id_idx ON transactions (transfer_id);
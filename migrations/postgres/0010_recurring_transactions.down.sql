@@ -0,0 +1,2 @@
+DROP TABLE recurring_occurrences;
+DROP TABLE recurring_transactions;
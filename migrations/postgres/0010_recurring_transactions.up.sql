@@ -0,0 +1,35 @@
+-- Templates for entries that repeat on a schedule. rule is an RRULE counted
+-- from start_date, and next_date is the first date not posted yet, NULL once
+-- the schedule has ended.
+CREATE TABLE recurring_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id),
+    payee_name TEXT NOT NULL DEFAULT '',
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    memo TEXT NOT NULL DEFAULT '',
+    rule TEXT NOT NULL,
+    start_date TIMESTAMPTZ NOT NULL,
+    next_date TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX recurring_transactions_user_id_idx ON recurring_transactions (user_id);
+CREATE INDEX recurring_transactions_next_date_idx ON recurring_transactions (next_date);
+
+-- Dates of a schedule that were posted, skipped or edited. A date is posted
+-- at most once, which is what keeps the scheduler idempotent. amount is NULL
+-- unless the date was edited.
+CREATE TABLE recurring_occurrences (
+    id SERIAL PRIMARY KEY,
+    recurring_id INTEGER NOT NULL REFERENCES recurring_transactions (id) ON DELETE CASCADE,
+    date TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    amount NUMERIC,
+    memo TEXT NOT NULL DEFAULT '',
+    transaction_id INTEGER REFERENCES transactions (id) ON DELETE SET NULL,
+    UNIQUE (recurring_id, date)
+);
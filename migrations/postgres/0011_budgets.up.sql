@@ -0,0 +1,15 @@
+-- Monthly spending limits per category. month is the first day of the month
+-- the limit applies to. With rollover, what was left unspent of the previous
+-- month's budget is added to the limit.
+CREATE TABLE budgets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id) ON DELETE CASCADE,
+    month TIMESTAMPTZ NOT NULL,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    rollover BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, category_id, month)
+);
@@ -0,0 +1,2 @@
+DROP TABLE envelope_assignments;
+ALTER TABLE users DROP COLUMN envelope_start;
@@ -0,0 +1,20 @@
+-- Envelope budgeting is on for users with an envelope_start, the first month
+-- budgeted that way.
+ALTER TABLE users ADD COLUMN envelope_start TIMESTAMPTZ;
+
+-- Changes to the money assigned to an envelope, an expense category, for a
+-- month. What is assigned is the sum of its changes, which keeps the history.
+-- Moving money between envelopes writes one change for each.
+CREATE TABLE envelope_assignments (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id),
+    month TIMESTAMPTZ NOT NULL,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX envelope_assignments_user_id_month_idx ON envelope_assignments (user_id, month);
+CREATE INDEX envelope_assignments_category_id_idx ON envelope_assignments (category_id);
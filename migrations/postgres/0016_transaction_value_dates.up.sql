@@ -0,0 +1,3 @@
+-- The date an entry took effect for interest, when the bank's statement
+-- gives one that differs from the booking date.
+ALTER TABLE transactions ADD COLUMN value_date TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+DROP INDEX transactions_account_id_import_id_key;
+
+CREATE INDEX transactions_account_id_import_id_idx ON transactions (account_id, import_id) WHERE import_id IS NOT NULL;
@@ -0,0 +1,8 @@
+DROP TABLE sessions;
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    token TEXT NOT NULL UNIQUE
+);
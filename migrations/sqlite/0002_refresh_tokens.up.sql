@@ -0,0 +1,17 @@
+-- Sessions used to hold year-long JWTs, which are no longer accepted. Each
+-- row is now one refresh token. Rotating a token marks it used and adds its
+-- successor to the same family.
+DROP TABLE sessions;
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    deleted_at DATETIME
+);
+
+CREATE INDEX sessions_family_id_idx ON sessions (family_id);
@@ -0,0 +1,9 @@
+-- SQLite cannot add a column defaulting to CURRENT_TIMESTAMP, so
+-- last_seen_at is filled in here and on every insert.
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+
+UPDATE sessions SET last_seen_at = created_at;
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
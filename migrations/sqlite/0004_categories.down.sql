@@ -0,0 +1,22 @@
+-- SQLite cannot drop a column with a foreign key, so the table is rebuilt.
+CREATE TABLE transactions_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO transactions_old (id, user_id, account_id, amount, currency, date, created_at, updated_at)
+SELECT id, user_id, account_id, amount, currency, date, created_at, updated_at FROM transactions;
+
+DROP TABLE transactions;
+ALTER TABLE transactions_old RENAME TO transactions;
+
+CREATE INDEX transactions_user_id_date_idx ON transactions (user_id, date DESC, id DESC);
+CREATE INDEX transactions_account_id_idx ON transactions (account_id);
+
+DROP TABLE categories;
@@ -0,0 +1,17 @@
+CREATE TABLE categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES categories (id),
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX categories_user_id_idx ON categories (user_id);
+
+-- Entries recorded before categories existed, and balance adjustments, have
+-- no category.
+ALTER TABLE transactions ADD COLUMN category_id INTEGER REFERENCES categories (id);
+
+CREATE INDEX transactions_category_id_idx ON transactions (category_id);
@@ -0,0 +1,4 @@
+DROP TABLE transaction_tags;
+DROP TABLE tags;
+
+ALTER TABLE transactions DROP COLUMN memo;
@@ -0,0 +1,27 @@
+CREATE TABLE payees (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    default_category_id INTEGER REFERENCES categories (id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX payees_user_id_idx ON payees (user_id);
+
+-- Every spelling a payee is known by, including its own name. The key is the
+-- normalized spelling and resolves to exactly one of the user's payees.
+CREATE TABLE payee_aliases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    payee_id INTEGER NOT NULL REFERENCES payees (id) ON DELETE CASCADE,
+    alias TEXT NOT NULL,
+    alias_key TEXT NOT NULL,
+    UNIQUE (user_id, alias_key)
+);
+
+CREATE INDEX payee_aliases_payee_id_idx ON payee_aliases (payee_id);
+
+ALTER TABLE transactions ADD COLUMN payee_id INTEGER REFERENCES payees (id);
+
+CREATE INDEX transactions_payee_id_idx ON transactions (payee_id);
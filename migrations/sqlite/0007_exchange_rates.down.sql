@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN base_currency;
+
+DROP TABLE exchange_rates;
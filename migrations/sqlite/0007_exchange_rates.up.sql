@@ -0,0 +1,15 @@
+-- One unit of base is worth rate units of quote on the given date. Rates are
+-- kept as text so that no digits are lost to floating point.
+CREATE TABLE exchange_rates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    date DATE NOT NULL,
+    base TEXT NOT NULL,
+    quote TEXT NOT NULL,
+    rate TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (base, quote, date)
+);
+
+-- Totals across accounts are converted into the user's base currency.
+ALTER TABLE users ADD COLUMN base_currency TEXT NOT NULL DEFAULT 'JPY';
@@ -0,0 +1,33 @@
+-- SQLite cannot drop a column with a foreign key, so the table is rebuilt.
+-- Dropping it cascades to the tag links, which are put back afterwards.
+CREATE TEMP TABLE transaction_tags_backup AS SELECT transaction_id, tag_id FROM transaction_tags;
+
+CREATE TABLE transactions_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    category_id INTEGER REFERENCES categories (id),
+    memo TEXT NOT NULL DEFAULT '',
+    payee_id INTEGER REFERENCES payees (id)
+);
+
+INSERT INTO transactions_old (id, user_id, account_id, amount, currency, date, created_at, updated_at, category_id, memo, payee_id)
+SELECT id, user_id, account_id, amount, currency, date, created_at, updated_at, category_id, memo, payee_id FROM transactions;
+
+DROP TABLE transactions;
+ALTER TABLE transactions_old RENAME TO transactions;
+
+CREATE INDEX transactions_user_id_date_idx ON transactions (user_id, date DESC, id DESC);
+CREATE INDEX transactions_account_id_idx ON transactions (account_id);
+CREATE INDEX transactions_category_id_idx ON transactions (category_id);
+CREATE INDEX transactions_payee_id_idx ON transactions (payee_id);
+
+INSERT INTO transaction_tags (transaction_id, tag_id) SELECT transaction_id, tag_id FROM transaction_tags_backup;
+DROP TABLE transaction_tags_backup;
+
+DROP TABLE transfers;
@@ -0,0 +1,14 @@
+-- The lines of a split transaction, each with its own category. Amounts are
+-- signed like the transaction's, in its currency, and add up to its amount.
+-- A split transaction has no category of its own.
+CREATE TABLE transaction_splits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id),
+    amount NUMERIC NOT NULL,
+    memo TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL
+);
+
+CREATE INDEX transaction_splits_transaction_id_idx ON transaction_splits (transaction_id);
+CREATE INDEX transaction_splits_category_id_idx ON transaction_splits (category_id);
@@ -0,0 +1,20 @@
+-- Envelope budgeting is on for users with an envelope_start, the first month
+-- budgeted that way.
+ALTER TABLE users ADD COLUMN envelope_start DATETIME;
+
+-- Changes to the money assigned to an envelope, an expense category, for a
+-- month. What is assigned is the sum of its changes, which keeps the history.
+-- Moving money between envelopes writes one change for each.
+CREATE TABLE envelope_assignments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (id),
+    month DATETIME NOT NULL,
+    amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX envelope_assignments_user_id_month_idx ON envelope_assignments (user_id, month);
+CREATE INDEX envelope_assignments_category_id_idx ON envelope_assignments (category_id);
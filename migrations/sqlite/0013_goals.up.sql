@@ -0,0 +1,18 @@
+-- Savings goals. A goal tracks either the balance of an account or the money
+-- put into a category, and is due by the end of the month starting on
+-- target_month.
+CREATE TABLE goals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    target_amount NUMERIC NOT NULL,
+    currency TEXT NOT NULL,
+    target_month DATETIME NOT NULL,
+    account_id INTEGER REFERENCES accounts (id) ON DELETE CASCADE,
+    category_id INTEGER REFERENCES categories (id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((account_id IS NULL) <> (category_id IS NULL))
+);
+
+CREATE INDEX goals_user_id_idx ON goals (user_id);
@@ -0,0 +1,22 @@
+-- Saved ways of reading a bank's CSV exports. Columns are counted from 0; an
+-- empty delimiter, encoding or date_format is detected from the file.
+CREATE TABLE import_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    delimiter TEXT NOT NULL DEFAULT '',
+    encoding TEXT NOT NULL DEFAULT '',
+    skip_rows INTEGER NOT NULL DEFAULT 0,
+    has_header BOOLEAN NOT NULL DEFAULT TRUE,
+    date_column INTEGER NOT NULL,
+    date_format TEXT NOT NULL DEFAULT '',
+    amount_column INTEGER NOT NULL,
+    credit_column INTEGER,
+    payee_column INTEGER,
+    memo_column INTEGER,
+    decimal_comma BOOLEAN NOT NULL DEFAULT FALSE,
+    negate BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
@@ -0,0 +1,3 @@
+DROP INDEX transactions_account_id_import_id_idx;
+
+ALTER TABLE transactions DROP COLUMN import_id;
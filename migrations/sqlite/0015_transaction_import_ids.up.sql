@@ -0,0 +1,5 @@
+-- The id a bank gives an imported entry, such as an OFX FITID, so importing
+-- the same statement again finds the entries already booked.
+ALTER TABLE transactions ADD COLUMN import_id TEXT;
+
+CREATE INDEX transactions_account_id_import_id_idx ON transactions (account_id, import_id) WHERE import_id IS NOT NULL;
@@ -0,0 +1,9 @@
+-- An account books each of its bank's entries once. Entries imported twice
+-- before this keep the first one's import id.
+UPDATE transactions SET import_id = NULL
+WHERE import_id IS NOT NULL
+  AND id > (SELECT MIN(t.id) FROM transactions t WHERE t.account_id = transactions.account_id AND t.import_id = transactions.import_id);
+
+DROP INDEX transactions_account_id_import_id_idx;
+
+CREATE UNIQUE INDEX transactions_account_id_import_id_key ON transactions (account_id, import_id) WHERE import_id IS NOT NULL;
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+type AccountType string
+
+const (
+	AccountTypeCash       AccountType = "cash"
+	AccountTypeChecking   AccountType = "checking"
+	AccountTypeCreditCard AccountType = "credit_card"
+	AccountTypeSavings    AccountType = "savings"
+)
+
+// AccountTypes lists the supported account types in display order.
+var AccountTypes = []AccountType{
+	AccountTypeCash,
+	AccountTypeChecking,
+	AccountTypeCreditCard,
+	AccountTypeSavings,
+}
+
+func (t AccountType) Valid() bool {
+	for _, accountType := range AccountTypes {
+		if t == accountType {
+			return true
+		}
+	}
+	return false
+}
+
+// Account is a named pot of money owned by a user, such as a wallet or a
+// bank account. Its balance is the opening balance plus its ledger entries.
+type Account struct {
+	ID             int         `json:"id"`
+	UserID         int         `json:"user_id"`
+	Name           string      `json:"name"`
+	Type           AccountType `json:"type"`
+	Currency       string      `json:"currency"`
+	OpeningBalance money.Money `json:"opening_balance"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// AccountBalance is an account together with its current balance.
+type AccountBalance struct {
+	Account
+	Balance money.Money `json:"balance"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// BackupFormat and BackupVersion identify a backup file. The version goes up
+// whenever a change to the file would stop an older instance restoring it.
+const (
+	BackupFormat  = "balance-tracker-backup"
+	BackupVersion = 1
+)
+
+// Backup is everything a user owns, as written to a backup file. Records
+// refer to each other by the IDs they had when the backup was made, which
+// are mapped to new IDs on restore. Transfers are listed once, by their
+// outgoing leg, with the other leg in Transfer.
+type Backup struct {
+	Format              string               `json:"format"`
+	Version             int                  `json:"version"`
+	ExportedAt          time.Time            `json:"exported_at"`
+	Settings            BackupSettings       `json:"settings"`
+	Accounts            []Account            `json:"accounts"`
+	Categories          []Category           `json:"categories"`
+	Tags                []string             `json:"tags"`
+	Payees              []Payee              `json:"payees"`
+	Transactions        []Transaction        `json:"transactions"`
+	Recurring           []BackupRecurring    `json:"recurring"`
+	Budgets             []Budget             `json:"budgets"`
+	EnvelopeAssignments []EnvelopeAssignment `json:"envelope_assignments"`
+	Goals               []Goal               `json:"goals"`
+	ImportProfiles      []ImportProfile      `json:"import_profiles"`
+}
+
+// BackupSettings are the user's own settings.
+type BackupSettings struct {
+	BaseCurrency  string     `json:"base_currency"`
+	EnvelopeStart *time.Time `json:"envelope_start"`
+}
+
+// BackupRecurring is a recurring transaction with the dates that were
+// posted, skipped or edited.
+type BackupRecurring struct {
+	RecurringTransaction
+	Occurrences []BackupOccurrence `json:"occurrences"`
+}
+
+// BackupOccurrence is one date of a recurring transaction. Amount is nil
+// unless the date was edited.
+type BackupOccurrence struct {
+	Date          time.Time        `json:"date"`
+	Status        OccurrenceStatus `json:"status"`
+	Amount        *money.Money     `json:"amount"`
+	Memo          string           `json:"memo"`
+	TransactionID *int             `json:"transaction_id"`
+}
+
+type RestoreMode string
+
+const (
+	// RestoreMerge adds the backup to the user's data, leaving out records
+	// they have already.
+	RestoreMerge RestoreMode = "merge"
+	// RestoreReplace deletes the user's data and settings before restoring.
+	RestoreReplace RestoreMode = "replace"
+)
+
+func (m RestoreMode) Valid() bool {
+	return m == RestoreMerge || m == RestoreReplace
+}
+
+// RestoreResult counts the records a restore created and, when merging, the
+// ones it Skipped because the user had them already.
+type RestoreResult struct {
+	Mode                RestoreMode `json:"mode"`
+	Accounts            int         `json:"accounts"`
+	Categories          int         `json:"categories"`
+	Payees              int         `json:"payees"`
+	Transactions        int         `json:"transactions"`
+	Recurring           int         `json:"recurring"`
+	Budgets             int         `json:"budgets"`
+	EnvelopeAssignments int         `json:"envelope_assignments"`
+	Goals               int         `json:"goals"`
+	ImportProfiles      int         `json:"import_profiles"`
+	Skipped             int         `json:"skipped"`
+}
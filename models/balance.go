@@ -1,10 +1,16 @@
 package models
 
+import (
+	"balance-tracker/money"
+)
+
+// Balance is a snapshot of an account's running total. Snapshots are written
+// whenever the ledger changes; the ledger itself is the source of truth.
 type Balance struct {
-    ID        int     `json:"id"`
-    UserID    int     `json:"user_id"`
-    Amount    float64 `json:"amount"`
-    CreatedAt string   `json:"created_at"`
-    UpdatedAt string   `json:"updated_at"`
+	ID        int         `json:"id"`
+	UserID    int         `json:"user_id"`
+	AccountID int         `json:"account_id"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt string      `json:"created_at"`
+	UpdatedAt string      `json:"updated_at"`
 }
-
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// Budget is a spending limit for an expense category over one calendar
+// month, starting on Month. Spending in the category's subcategories counts
+// towards it. With Rollover, what was left of the previous month's budget
+// for the category is added to Amount.
+type Budget struct {
+	ID           int         `json:"id"`
+	UserID       int         `json:"user_id"`
+	CategoryID   int         `json:"category_id"`
+	CategoryName string      `json:"category_name,omitempty"`
+	Month        time.Time   `json:"month"`
+	Amount       money.Money `json:"amount"`
+	Rollover     bool        `json:"rollover"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// BudgetStatus is how far a budget has been used. All amounts are in the
+// budget's currency; spending in currencies without an exchange rate is
+// listed in MissingRates and left out. Spent is net of refunds, and
+// Remaining is negative once the budget is overspent.
+type BudgetStatus struct {
+	Budget
+	Carried      money.Money `json:"carried"`
+	Available    money.Money `json:"available"`
+	Spent        money.Money `json:"spent"`
+	Remaining    money.Money `json:"remaining"`
+	PercentUsed  int         `json:"percent_used"`
+	MissingRates []string    `json:"missing_rates"`
+}
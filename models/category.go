@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// CategoryKind separates categories for money coming in from those for money
+// going out.
+type CategoryKind string
+
+const (
+	CategoryKindIncome  CategoryKind = "income"
+	CategoryKindExpense CategoryKind = "expense"
+	// CategoryKindAdjustment is the kind of the category every user has for
+	// balance adjustments. These can go either way, so they count as
+	// neither income nor expense.
+	CategoryKindAdjustment CategoryKind = "adjustment"
+)
+
+// Valid reports whether k is a kind users can give their own categories.
+func (k CategoryKind) Valid() bool {
+	return k == CategoryKindIncome || k == CategoryKindExpense
+}
+
+// Category groups transactions. Categories nest, e.g. Food > Groceries, and a
+// subcategory always has the same kind as its parent.
+type Category struct {
+	ID        int          `json:"id"`
+	UserID    int          `json:"user_id"`
+	ParentID  *int         `json:"parent_id"`
+	Name      string       `json:"name"`
+	Kind      CategoryKind `json:"kind"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	// Path and Depth place the category in its tree, e.g. "Food > Groceries"
+	// at depth 1. They are filled in when listing categories.
+	Path  string `json:"path,omitempty"`
+	Depth int    `json:"depth"`
+}
+
+// CategoryTotal is what was booked to a category in one currency over a
+// period. Split transactions count by their split lines.
+type CategoryTotal struct {
+	CategoryID   int          `json:"category_id"`
+	CategoryName string       `json:"category_name"`
+	Kind         CategoryKind `json:"kind"`
+	Total        money.Money  `json:"total"`
+}
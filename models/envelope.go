@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// EnvelopeAssignment is one change to the money assigned to an envelope for
+// a month, such as assigning income to it or moving money out of it.
+type EnvelopeAssignment struct {
+	ID           int         `json:"id"`
+	UserID       int         `json:"user_id"`
+	CategoryID   int         `json:"category_id"`
+	CategoryName string      `json:"category_name,omitempty"`
+	Month        time.Time   `json:"month"`
+	Amount       money.Money `json:"amount"`
+	Note         string      `json:"note"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// Envelope is an expense category's share of the money in envelope
+// budgeting for one month. Available is what was Carried over from the
+// previous month plus what was Assigned, less what was Spent; it is negative
+// when the envelope is overspent.
+type Envelope struct {
+	CategoryID   int         `json:"category_id"`
+	CategoryName string      `json:"category_name"`
+	Carried      money.Money `json:"carried"`
+	Assigned     money.Money `json:"assigned"`
+	Spent        money.Money `json:"spent"`
+	Available    money.Money `json:"available"`
+}
+
+// EnvelopeMonth is the state of envelope budgeting for one month, in the
+// user's base currency. ToBeAssigned is the money not yet assigned to any
+// envelope, after Overspent, what the envelopes were overspent by at the end
+// of the previous month, has been taken out of it.
+type EnvelopeMonth struct {
+	Month        time.Time            `json:"month"`
+	Start        time.Time            `json:"start"`
+	Income       money.Money          `json:"income"`
+	Assigned     money.Money          `json:"assigned"`
+	Overspent    money.Money          `json:"overspent"`
+	ToBeAssigned money.Money          `json:"to_be_assigned"`
+	Envelopes    []Envelope           `json:"envelopes"`
+	History      []EnvelopeAssignment `json:"history"`
+	MissingRates []string             `json:"missing_rates"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// ExchangeRate says that on Date one unit of Base is worth Rate units of
+// Quote.
+type ExchangeRate struct {
+	ID        int           `json:"id"`
+	Date      time.Time     `json:"date"`
+	Base      string        `json:"base"`
+	Quote     string        `json:"quote"`
+	Rate      money.Decimal `json:"rate"`
+	Source    string        `json:"source"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// NetWorth is the total of a user's accounts. ByCurrency holds the total in
+// each currency held, and Total their sum in the user's base currency, which
+// leaves out the currencies listed in MissingRates.
+type NetWorth struct {
+	Total        money.Money   `json:"total"`
+	ByCurrency   []money.Money `json:"by_currency"`
+	MissingRates []string      `json:"missing_rates"`
+}
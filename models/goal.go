@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// Goal is a savings target to reach by the end of the month starting on
+// TargetMonth. Progress comes from exactly one of an account, whose balance
+// is what has been saved, or a category, whose transactions are the money
+// put aside. LinkedName is the name of the account or category.
+type Goal struct {
+	ID          int         `json:"id"`
+	UserID      int         `json:"user_id"`
+	Name        string      `json:"name"`
+	Target      money.Money `json:"target"`
+	TargetMonth time.Time   `json:"target_month"`
+	AccountID   *int        `json:"account_id"`
+	CategoryID  *int        `json:"category_id"`
+	LinkedName  string      `json:"linked_name,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// GoalProgress is how far a goal has come, in the goal's currency. Amounts
+// in currencies without an exchange rate are listed in MissingRates and left
+// out. MonthlyRate is the average saved per month recently, and
+// ProjectedDate when the goal is reached at that rate; it is nil when the
+// goal is already reached or the rate would never reach it.
+type GoalProgress struct {
+	Goal
+	Saved           money.Money `json:"saved"`
+	Remaining       money.Money `json:"remaining"`
+	PercentComplete int         `json:"percent_complete"`
+	RequiredMonthly money.Money `json:"required_monthly"`
+	MonthlyRate     money.Money `json:"monthly_rate"`
+	ProjectedDate   *time.Time  `json:"projected_date"`
+	Reached         bool        `json:"reached"`
+	OnTrack         bool        `json:"on_track"`
+	MissingRates    []string    `json:"missing_rates"`
+}
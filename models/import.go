@@ -0,0 +1,109 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// ImportProfile is a saved way of reading one bank's CSV exports. Columns
+// are counted from 0. An empty Delimiter, Encoding or DateFormat, a Go time
+// layout, is detected from the file. With a CreditColumn, AmountColumn holds
+// money going out and CreditColumn money coming in; otherwise AmountColumn
+// is signed, and Negate flips it for exports that show spending as positive.
+type ImportProfile struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	Delimiter    string    `json:"delimiter"`
+	Encoding     string    `json:"encoding"`
+	SkipRows     int       `json:"skip_rows"`
+	HasHeader    bool      `json:"has_header"`
+	DateColumn   int       `json:"date_column"`
+	DateFormat   string    `json:"date_format"`
+	AmountColumn int       `json:"amount_column"`
+	CreditColumn *int      `json:"credit_column"`
+	PayeeColumn  *int      `json:"payee_column"`
+	MemoColumn   *int      `json:"memo_column"`
+	DecimalComma bool      `json:"decimal_comma"`
+	Negate       bool      `json:"negate"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ImportOptions says where imported entries go. Entries whose payee has no
+// default category are booked to ExpenseCategoryID when money goes out and
+// IncomeCategoryID when it comes in. Duplicates are left out unless
+// IncludeDuplicates is set, and an entry with an import id the account
+// already has is always left out.
+type ImportOptions struct {
+	AccountID         int  `json:"account_id"`
+	ExpenseCategoryID *int `json:"expense_category_id"`
+	IncomeCategoryID  *int `json:"income_category_id"`
+	IncludeDuplicates bool `json:"include_duplicates"`
+}
+
+// ImportRow is one entry read from an import file, numbered by its Line in
+// the file. A row that could not be read has an Error instead. ImportID is
+// the bank's id for the entry, if the file has one, ValueDate the date it
+// took effect for interest if that differs from Date, and Category the
+// category the file names. Duplicate marks a row that matches an entry
+// already in the account, by its ImportID or else by date and amount.
+type ImportRow struct {
+	Line         int         `json:"line"`
+	ImportID     string      `json:"import_id,omitempty"`
+	Date         time.Time   `json:"date"`
+	ValueDate    *time.Time  `json:"value_date,omitempty"`
+	Amount       money.Money `json:"amount"`
+	Payee        string      `json:"payee"`
+	Memo         string      `json:"memo"`
+	Category     string      `json:"category,omitempty"`
+	CategoryID   *int        `json:"category_id"`
+	CategoryName string      `json:"category_name,omitempty"`
+	Duplicate    bool        `json:"duplicate"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// ImportPreview is what an import would do, without booking anything.
+// Format is the kind of file read: "csv", "ofx", "qif", "camt.053" or
+// "mt940", with Version telling OFX 1 from OFX 2. For CSV files, Header and
+// Sample show the first records for mapping their columns. Statements that
+// give their balances are checked against the account in Statement.
+type ImportPreview struct {
+	Format     string          `json:"format"`
+	Version    string          `json:"version,omitempty"`
+	Encoding   string          `json:"encoding"`
+	Delimiter  string          `json:"delimiter"`
+	DateFormat string          `json:"date_format"`
+	Header     []string        `json:"header"`
+	Sample     [][]string      `json:"sample"`
+	Rows       []ImportRow     `json:"rows"`
+	New        int             `json:"new"`
+	Duplicates int             `json:"duplicates"`
+	Errors     int             `json:"errors"`
+	Statement  *StatementCheck `json:"statement,omitempty"`
+}
+
+// StatementCheck compares the balances a bank statement opens and closes
+// with to the account's balance in the tracker. The tracker's closing
+// balance runs to the ClosingDate and counts the entries about to be
+// imported; its opening balance is that less the statement's entries. The
+// differences are the tracker's balances less the statement's.
+type StatementCheck struct {
+	ClosingDate       time.Time   `json:"closing_date"`
+	Opening           money.Money `json:"opening"`
+	Closing           money.Money `json:"closing"`
+	TrackerOpening    money.Money `json:"tracker_opening"`
+	TrackerClosing    money.Money `json:"tracker_closing"`
+	OpeningDifference money.Money `json:"opening_difference"`
+	ClosingDifference money.Money `json:"closing_difference"`
+	Matches           bool        `json:"matches"`
+}
+
+// ImportResult counts what an import booked and left out. Statement checks
+// the account against the statement's balances once the entries are booked.
+type ImportResult struct {
+	Imported   int             `json:"imported"`
+	Duplicates int             `json:"duplicates"`
+	Statement  *StatementCheck `json:"statement,omitempty"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// JournalImportResult is what importing a Beancount file did: the records
+// merged into the user's data and the Prices stored as exchange rates.
+type JournalImportResult struct {
+	RestoreResult
+	Prices int `json:"prices"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Payee is the merchant or person on the other side of a transaction. A
+// payee is known by its name and any number of aliases, so that spellings
+// like "AMZN Mktp" and "Amazon.co.jp" resolve to the same payee.
+type Payee struct {
+	ID                  int       `json:"id"`
+	UserID              int       `json:"user_id"`
+	Name                string    `json:"name"`
+	DefaultCategoryID   *int      `json:"default_category_id"`
+	DefaultCategoryName string    `json:"default_category_name,omitempty"`
+	Aliases             []string  `json:"aliases"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// RecurringTransaction is a template for a ledger entry that repeats on a
+// schedule, such as rent or a salary. Rule is an RRULE counted from
+// StartDate, and each date is posted as a transaction once it has come.
+// NextDate is the first date not posted yet, or nil once the schedule has
+// ended.
+type RecurringTransaction struct {
+	ID           int         `json:"id"`
+	UserID       int         `json:"user_id"`
+	AccountID    int         `json:"account_id"`
+	AccountName  string      `json:"account_name,omitempty"`
+	CategoryID   int         `json:"category_id"`
+	CategoryName string      `json:"category_name,omitempty"`
+	PayeeName    string      `json:"payee_name"`
+	Amount       money.Money `json:"amount"`
+	Memo         string      `json:"memo"`
+	Rule         string      `json:"rule"`
+	StartDate    time.Time   `json:"start_date"`
+	NextDate     *time.Time  `json:"next_date"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type OccurrenceStatus string
+
+const (
+	OccurrenceScheduled OccurrenceStatus = "scheduled"
+	OccurrenceSkipped   OccurrenceStatus = "skipped"
+	OccurrencePosted    OccurrenceStatus = "posted"
+)
+
+// RecurringOccurrence is one date of a recurring transaction. It is posted
+// with the template's amount and memo unless it has been Edited.
+// TransactionID is the entry it was posted as.
+type RecurringOccurrence struct {
+	RecurringID   int              `json:"recurring_id"`
+	Date          time.Time        `json:"date"`
+	Status        OccurrenceStatus `json:"status"`
+	Amount        money.Money      `json:"amount"`
+	Memo          string           `json:"memo"`
+	Edited        bool             `json:"edited"`
+	TransactionID *int             `json:"transaction_id"`
+	AccountName   string           `json:"account_name,omitempty"`
+	CategoryName  string           `json:"category_name,omitempty"`
+	PayeeName     string           `json:"payee_name,omitempty"`
+}
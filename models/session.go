@@ -5,9 +5,21 @@ import (
 	"time"
 )
 
+// Session is one refresh token. Tokens issued by rotating each other share a
+// FamilyID, which identifies the login they descend from, i.e. one device.
+// UserAgent, IP and LastSeenAt describe the device as of the last refresh.
 type Session struct {
-	ID        int          `json:"id"`
-	CreatedAt time.Time    `json:"created_at"`
-	DeletedAt sql.NullTime `json:"deleted_at"`
-	Token     string       `json:"token"`
+	ID         int          `json:"id"`
+	UserID     int          `json:"user_id"`
+	FamilyID   string       `json:"family_id"`
+	TokenHash  string       `json:"-"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	UsedAt     sql.NullTime `json:"used_at"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
+	UserAgent  string       `json:"user_agent"`
+	IP         string       `json:"ip"`
+	LastSeenAt time.Time    `json:"last_seen_at"`
+	// Current is set when listing sessions for the device that asked
+	Current bool `json:"current"`
 }
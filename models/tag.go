@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Tag is a free-form label such as "trip-kyoto" that can be attached to any
+// number of transactions. Names are stored without the leading '#'.
+type Tag struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Count is the number of transactions carrying the tag.
+	Count int `json:"count"`
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// Transaction is a single movement in the ledger. Positive amounts are
+// earnings and negative amounts are expenses. Balance adjustments are booked
+// to the user's adjustment category and the two legs of a transfer have no
+// category, so neither counts as income or expense. Split transactions carry
+// their categories on their Splits instead. Transfer is the other leg of a
+// transfer. ImportID is the bank's id for an imported entry, such as an OFX
+// FITID, and ValueDate the date it took effect for interest if the bank's
+// statement gives one.
+type Transaction struct {
+	ID           int          `json:"id"`
+	UserID       int          `json:"user_id"`
+	AccountID    int          `json:"account_id"`
+	AccountName  string       `json:"account_name,omitempty"`
+	CategoryID   *int         `json:"category_id"`
+	CategoryName string       `json:"category_name,omitempty"`
+	PayeeID      *int         `json:"payee_id"`
+	PayeeName    string       `json:"payee_name,omitempty"`
+	Amount       money.Money  `json:"amount"`
+	Date         time.Time    `json:"date"`
+	ValueDate    *time.Time   `json:"value_date,omitempty"`
+	Memo         string       `json:"memo"`
+	ImportID     string       `json:"import_id,omitempty"`
+	Tags         []string     `json:"tags"`
+	Splits       []Split      `json:"splits"`
+	TransferID   *int         `json:"transfer_id"`
+	Transfer     *TransferLeg `json:"transfer,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// Split is one line of a split transaction, such as the groceries on a
+// supermarket receipt that also covers a gift. Its amount is signed like the
+// transaction's and in the same currency.
+type Split struct {
+	ID           int         `json:"id"`
+	CategoryID   int         `json:"category_id"`
+	CategoryName string      `json:"category_name,omitempty"`
+	Amount       money.Money `json:"amount"`
+	Memo         string      `json:"memo"`
+}
+
+// TransactionFilter narrows down a transaction listing. The zero value
+// matches every transaction.
+type TransactionFilter struct {
+	// Tags lists tag names a transaction must all carry.
+	Tags []string
+	// From and To bound the date, both days included.
+	From *time.Time
+	To   *time.Time
+	// AccountID matches entries in the account, and transfers into it.
+	AccountID *int
+	// CategoryID matches entries in the category or one of its
+	// subcategories, on their own or on a split line.
+	CategoryID *int
+	PayeeID    *int
+	// MinAmount and MaxAmount bound the size of the amount, whether it is
+	// spent or earned.
+	MinAmount *money.Decimal
+	MaxAmount *money.Decimal
+	// Text matches entries whose memo or payee contains it, ignoring case.
+	Text string
+}
+
+// TransactionSort orders a transaction listing. Amounts are compared
+// without regard to their currency.
+type TransactionSort string
+
+const (
+	TransactionSortDateDesc   TransactionSort = "date_desc"
+	TransactionSortDateAsc    TransactionSort = "date_asc"
+	TransactionSortAmountDesc TransactionSort = "amount_desc"
+	TransactionSortAmountAsc  TransactionSort = "amount_asc"
+)
+
+func (s TransactionSort) Valid() bool {
+	switch s {
+	case TransactionSortDateDesc, TransactionSortDateAsc, TransactionSortAmountDesc, TransactionSortAmountAsc:
+		return true
+	}
+	return false
+}
+
+// TransactionQuery asks for one page of a transaction listing. Cursor is
+// the NextCursor of the page before, empty for the first page. It only
+// continues the listing with the same Sort.
+type TransactionQuery struct {
+	Filter TransactionFilter
+	Sort   TransactionSort
+	Cursor string
+	Limit  int
+}
+
+// TransactionCursor is the position of the last entry of a page, which the
+// next page starts after.
+type TransactionCursor struct {
+	Date   time.Time
+	Amount money.Decimal
+	ID     int
+}
+
+// TransactionPage is one page of a transaction listing. NextCursor is empty
+// on the last page.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"balance-tracker/money"
+)
+
+// Transfer moves money between two of a user's accounts. It is recorded as
+// two linked ledger entries: Amount leaves the source account and the same
+// value at Rate arrives in the destination account.
+type Transfer struct {
+	ID            int           `json:"id"`
+	UserID        int           `json:"user_id"`
+	FromAccountID int           `json:"from_account_id"`
+	ToAccountID   int           `json:"to_account_id"`
+	Amount        money.Money   `json:"amount"`
+	Rate          money.Decimal `json:"rate"`
+	Date          time.Time     `json:"date"`
+	Memo          string        `json:"memo"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// TransferLeg describes the other side of a transfer as seen from one of its
+// ledger entries.
+type TransferLeg struct {
+	TransactionID int           `json:"transaction_id"`
+	AccountID     int           `json:"account_id"`
+	AccountName   string        `json:"account_name"`
+	Amount        money.Money   `json:"amount"`
+	Rate          money.Decimal `json:"rate"`
+}
@@ -4,10 +4,14 @@ import (
 	"time"
 )
 
+// User is an account holder. EnvelopeStart is the first month they budget
+// with envelopes, or nil if they budget with limits.
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int        `json:"id"`
+	Username      string     `json:"username"`
+	Password      string     `json:"password"`
+	BaseCurrency  string     `json:"base_currency"`
+	EnvelopeStart *time.Time `json:"envelope_start"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,64 @@
+package money
+
+import (
+	"errors"
+	"strings"
+)
+
+// Currency describes how amounts in an ISO 4217 currency are stored and
+// displayed. Exponent is the number of digits after the decimal point in the
+// currency's minor unit; amounts are always rounded to that many digits.
+type Currency struct {
+	Code     string
+	Exponent int
+	Symbol   string
+}
+
+var ErrInvalidCurrency = errors.New("currency must be a three-letter code")
+
+// currencies holds the currencies whose minor unit differs from the default
+// of two digits or that have a well known symbol.
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", Exponent: 2, Symbol: "A$"},
+	"BHD": {Code: "BHD", Exponent: 3, Symbol: "BHD "},
+	"CAD": {Code: "CAD", Exponent: 2, Symbol: "C$"},
+	"CHF": {Code: "CHF", Exponent: 2, Symbol: "CHF "},
+	"CLP": {Code: "CLP", Exponent: 0, Symbol: "CLP "},
+	"CNY": {Code: "CNY", Exponent: 2, Symbol: "CN¥"},
+	"EUR": {Code: "EUR", Exponent: 2, Symbol: "€"},
+	"GBP": {Code: "GBP", Exponent: 2, Symbol: "£"},
+	"HKD": {Code: "HKD", Exponent: 2, Symbol: "HK$"},
+	"ISK": {Code: "ISK", Exponent: 0, Symbol: "ISK "},
+	"JOD": {Code: "JOD", Exponent: 3, Symbol: "JOD "},
+	"JPY": {Code: "JPY", Exponent: 0, Symbol: "¥"},
+	"KRW": {Code: "KRW", Exponent: 0, Symbol: "₩"},
+	"KWD": {Code: "KWD", Exponent: 3, Symbol: "KWD "},
+	"NZD": {Code: "NZD", Exponent: 2, Symbol: "NZ$"},
+	"OMR": {Code: "OMR", Exponent: 3, Symbol: "OMR "},
+	"SGD": {Code: "SGD", Exponent: 2, Symbol: "S$"},
+	"TND": {Code: "TND", Exponent: 3, Symbol: "TND "},
+	"TWD": {Code: "TWD", Exponent: 2, Symbol: "NT$"},
+	"USD": {Code: "USD", Exponent: 2, Symbol: "$"},
+	"VND": {Code: "VND", Exponent: 0, Symbol: "₫"},
+}
+
+// LookupCurrency returns the currency for an ISO 4217 code. Codes that are
+// not listed above use two minor unit digits and the code as their symbol.
+func LookupCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return Currency{}, ErrInvalidCurrency
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return Currency{}, ErrInvalidCurrency
+		}
+	}
+
+	currency, ok := currencies[code]
+	if !ok {
+		currency = Currency{Code: code, Exponent: 2, Symbol: code + " "}
+	}
+
+	return currency, nil
+}
@@ -0,0 +1,82 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// Decimal is an exact decimal number in its textual form, as read from a
+// NUMERIC column or a form. It implements sql.Scanner and driver.Valuer so it
+// can be used for amounts whose currency is stored in a separate column.
+type Decimal string
+
+// plainDecimal matches an optional sign, digits and an optional fraction.
+// big.Rat alone would also take fractions such as "1/3" and exponents such
+// as "1e5".
+var plainDecimal = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+
+// Rat parses the decimal into an exact rational number.
+func (d Decimal) Rat() (*big.Rat, error) {
+	if d == "" {
+		return new(big.Rat), nil
+	}
+	if !plainDecimal.MatchString(string(d)) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidAmount, string(d))
+	}
+
+	r, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidAmount, string(d))
+	}
+
+	return r, nil
+}
+
+// Scan accepts the representations drivers use for NUMERIC values: pgx
+// returns text, SQLite may return integers or floats.
+func (d *Decimal) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*d = "0"
+	case string:
+		*d = Decimal(value)
+	case []byte:
+		*d = Decimal(value)
+	case int64:
+		*d = Decimal(strconv.FormatInt(value, 10))
+	case float64:
+		*d = Decimal(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		return fmt.Errorf("cannot scan %T into money.Decimal", src)
+	}
+
+	return nil
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	if d == "" {
+		return "0", nil
+	}
+	return string(d), nil
+}
+
+// UnmarshalJSON accepts both JSON strings and JSON numbers.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*d = Decimal(text)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+
+	*d = Decimal(number)
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package money provides an exact monetary amount type. Amounts are held as
+// integer minor units (cents, yen, ...) together with their currency code, so
+// no precision is lost between forms, the database and JSON.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// Money is an amount in a currency's minor unit. The zero value is a zero
+// amount without a currency, which adopts the currency of whatever it is
+// added to.
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// New returns an amount of minor units in the given currency.
+func New(minor int64, currency string) Money {
+	return Money{minor: minor, currency: strings.ToUpper(currency)}
+}
+
+// Zero returns a zero amount in the given currency.
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Parse reads a user-entered amount such as "1,234.5" and rounds it to the
+// currency's minor unit. Only plain decimals are accepted, not fractions or
+// exponents. Commas must separate groups of three digits before the decimal
+// point, so a decimal comma as in "1,50" is refused rather than read as 150.
+func Parse(value string, currency string) (Money, error) {
+	value = strings.NewReplacer("_", "", " ", "").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return Money{}, fmt.Errorf("%w: amount is required", ErrInvalidAmount)
+	}
+	value, err := removeThousandsSeparators(value)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return FromDecimal(Decimal(value), currency)
+}
+
+// removeThousandsSeparators drops the commas from the whole part of value,
+// which must split it into groups of three digits after the first.
+func removeThousandsSeparators(value string) (string, error) {
+	if !strings.Contains(value, ",") {
+		return value, nil
+	}
+
+	sign := ""
+	if value[0] == '-' || value[0] == '+' {
+		sign, value = value[:1], value[1:]
+	}
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if strings.Contains(fraction, ",") {
+		return "", fmt.Errorf("%w: comma after the decimal point", ErrInvalidAmount)
+	}
+
+	groups := strings.Split(whole, ",")
+	for i, group := range groups {
+		if group == "" || len(group) > 3 || (i > 0 && len(group) != 3) {
+			return "", fmt.Errorf("%w: commas must separate thousands, use a point for decimals", ErrInvalidAmount)
+		}
+	}
+
+	value = sign + strings.Join(groups, "")
+	if hasPoint {
+		value += "." + fraction
+	}
+	return value, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants.
+func MustParse(value string, currency string) Money {
+	m, err := Parse(value, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// FromDecimal converts an exact decimal into money, rounding half away from
+// zero to the currency's minor unit.
+func FromDecimal(d Decimal, currency string) (Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	r, err := d.Rat()
+	if err != nil {
+		return Money{}, err
+	}
+
+	minor, err := roundToMinor(r, c.Exponent)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{minor: minor, currency: c.Code}, nil
+}
+
+// FromRat converts an exact rational amount into money, rounding half away
+// from zero to the currency's minor unit.
+func FromRat(r *big.Rat, currency string) (Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	minor, err := roundToMinor(r, c.Exponent)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{minor: minor, currency: c.Code}, nil
+}
+
+func roundToMinor(r *big.Rat, exponent int) (int64, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(exponent)))
+
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// Round half away from zero: compare twice the remainder to the divisor
+	remainder.Abs(remainder)
+	remainder.Lsh(remainder, 1)
+	if remainder.Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if !quotient.IsInt64() {
+		return 0, errors.New("amount out of range")
+	}
+
+	return quotient.Int64(), nil
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// Minor returns the amount in the currency's minor unit.
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+// Currency returns the ISO 4217 code of the amount.
+func (m Money) Currency() string {
+	return m.currency
+}
+
+func (m Money) exponent() int {
+	c, err := LookupCurrency(m.currency)
+	if err != nil {
+		return 0
+	}
+	return c.Exponent
+}
+
+// Rat returns the amount in major units as an exact rational number.
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.minor), pow10(m.exponent()))
+}
+
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+func (m Money) Neg() Money {
+	return Money{minor: -m.minor, currency: m.currency}
+}
+
+func (m Money) Abs() Money {
+	if m.minor < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+func (m Money) sameCurrency(o Money) (string, error) {
+	switch {
+	case m.currency == o.currency:
+		return m.currency, nil
+	case m.currency == "" && m.minor == 0:
+		return o.currency, nil
+	case o.currency == "" && o.minor == 0:
+		return m.currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+}
+
+// Add returns the sum of two amounts in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	currency, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.minor + o.minor
+	if (o.minor > 0 && sum < m.minor) || (o.minor < 0 && sum > m.minor) {
+		return Money{}, fmt.Errorf("%w: %s plus %s is out of range", ErrInvalidAmount, m.Decimal(), o.Decimal())
+	}
+	return Money{minor: sum, currency: currency}, nil
+}
+
+// Sub returns the difference of two amounts in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	currency, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	difference := m.minor - o.minor
+	if (o.minor < 0 && difference < m.minor) || (o.minor > 0 && difference > m.minor) {
+		return Money{}, fmt.Errorf("%w: %s minus %s is out of range", ErrInvalidAmount, m.Decimal(), o.Decimal())
+	}
+	return Money{minor: difference, currency: currency}, nil
+}
+
+// Cmp compares two amounts in the same currency, returning -1, 0 or +1.
+func (m Money) Cmp(o Money) (int, error) {
+	_, err := m.sameCurrency(o)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Convert returns the amount in another currency at the given rate, the
+// number of units of that currency per unit of this one.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	return FromRat(new(big.Rat).Mul(m.Rat(), rate), currency)
+}
+
+// Decimal returns the plain decimal form of the amount, e.g. "-1234.50".
+func (m Money) Decimal() Decimal {
+	exponent := m.exponent()
+
+	digits := strconv.FormatInt(m.minor, 10)
+	sign := ""
+	if m.minor < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	if exponent == 0 {
+		return Decimal(sign + digits)
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	point := len(digits) - exponent
+
+	return Decimal(sign + digits[:point] + "." + digits[point:])
+}
+
+// String formats the amount for display, e.g. "-$1,234.50" or "¥1,234".
+func (m Money) String() string {
+	c, err := LookupCurrency(m.currency)
+	if err != nil {
+		return string(m.Decimal())
+	}
+
+	decimal := string(m.Decimal())
+	sign := ""
+	if strings.HasPrefix(decimal, "-") {
+		sign = "-"
+		decimal = decimal[1:]
+	}
+
+	whole, fraction, hasFraction := strings.Cut(decimal, ".")
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasFraction {
+		grouped.WriteString("." + fraction)
+	}
+
+	return sign + c.Symbol + grouped.String()
+}
+
+// Value stores the amount in a NUMERIC column. The currency is stored in a
+// column of its own.
+func (m Money) Value() (driver.Value, error) {
+	return string(m.Decimal()), nil
+}
+
+type moneyJSON struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as a decimal string so that JSON clients
+// never see a rounded float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var value moneyJSON
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := FromDecimal(value.Amount, value.Currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
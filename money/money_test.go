@@ -0,0 +1,174 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+	}{
+		{"1234.5", "USD", New(123450, "USD")},
+		{"1,234.50", "USD", New(123450, "USD")},
+		{"-1,234,567", "JPY", New(-1234567, "JPY")},
+		{"+12,345.6789", "KWD", New(12345679, "KWD")},
+		{" 1 234.50 ", "USD", New(123450, "USD")},
+		{"1_000", "USD", New(100000, "USD")},
+		{"-12.34", "EUR", New(-1234, "EUR")},
+		{"+12", "EUR", New(1200, "EUR")},
+		{".5", "USD", New(50, "USD")},
+		{"5.", "USD", New(500, "USD")},
+		{"-0.004", "USD", New(0, "USD")},
+		// Digits beyond the minor unit are rounded half away from zero
+		{"1.005", "USD", New(101, "USD")},
+		{"-1.005", "USD", New(-101, "USD")},
+		{"1.00499", "USD", New(100, "USD")},
+		{"1234.5", "JPY", New(1235, "JPY")},
+		{"-1234.4", "JPY", New(-1234, "JPY")},
+		{"1.2345", "KWD", New(1235, "KWD")},
+		{"-1.2344", "KWD", New(-1234, "KWD")},
+		{"1.5", "kwd", New(1500, "KWD")},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.value, test.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %s): %v", test.value, test.currency, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q, %s) = %#v, want %#v", test.value, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, value := range []string{"", " ", "1/3", "1e5", "1E-2", "0x10", "Inf", "NaN", "1.2.3", "--1", "1-", "abc", ".", "1,50", "-1,5", "12,3456", "1234,567", ",123", "1,,234", "1,234,", "1.234,5"} {
+		_, err := Parse(value, "USD")
+		if !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q): err = %v, want %v", value, err, ErrInvalidAmount)
+		}
+	}
+
+	_, err := Parse("1", "DOLLAR")
+	if !errors.Is(err, ErrInvalidCurrency) {
+		t.Errorf("Parse in invalid currency: err = %v, want %v", err, ErrInvalidCurrency)
+	}
+}
+
+func TestAddSubOverflow(t *testing.T) {
+	largest, smallest := New(math.MaxInt64, "USD"), New(math.MinInt64, "USD")
+	one := New(1, "USD")
+
+	if got, err := largest.Sub(one); err != nil || got != New(math.MaxInt64-1, "USD") {
+		t.Errorf("largest minus one = %s, %v", got, err)
+	}
+	if got, err := smallest.Add(one); err != nil || got != New(math.MinInt64+1, "USD") {
+		t.Errorf("smallest plus one = %s, %v", got, err)
+	}
+	if got, err := largest.Add(smallest); err != nil || got != New(-1, "USD") {
+		t.Errorf("largest plus smallest = %s, %v", got, err)
+	}
+
+	for name, result := range map[string]func() (Money, error){
+		"largest plus one":       func() (Money, error) { return largest.Add(one) },
+		"smallest minus one":     func() (Money, error) { return smallest.Sub(one) },
+		"largest minus smallest": func() (Money, error) { return largest.Sub(smallest) },
+		"one minus smallest":     func() (Money, error) { return one.Sub(smallest) },
+		"smallest plus smallest": func() (Money, error) { return smallest.Add(smallest) },
+	} {
+		if _, err := result(); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidAmount)
+		}
+	}
+}
+
+func TestConvertRounding(t *testing.T) {
+	tests := []struct {
+		amount   Money
+		rate     *big.Rat
+		currency string
+		want     Money
+	}{
+		{New(1000, "JPY"), big.NewRat(65, 10000), "USD", New(650, "USD")},
+		{New(1, "USD"), big.NewRat(1, 2), "JPY", New(0, "JPY")},
+		{New(50, "USD"), big.NewRat(1, 1), "JPY", New(1, "JPY")},
+		{New(-50, "USD"), big.NewRat(1, 1), "JPY", New(-1, "JPY")},
+		{New(1, "USD"), big.NewRat(1, 3), "KWD", New(3, "KWD")},
+		{New(5, "KWD"), big.NewRat(1, 1), "USD", New(1, "USD")},
+		{New(-5, "KWD"), big.NewRat(1, 1), "USD", New(-1, "USD")},
+		{New(4, "KWD"), big.NewRat(1, 1), "USD", New(0, "USD")},
+	}
+	for _, test := range tests {
+		got, err := test.amount.Convert(test.rate, test.currency)
+		if err != nil {
+			t.Errorf("%s.Convert(%s, %s): %v", test.amount, test.rate, test.currency, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s.Convert(%s, %s) = %s, want %s", test.amount, test.rate, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{New(123450, "USD"), "$1,234.50"},
+		{New(-123450, "USD"), "-$1,234.50"},
+		{New(5, "USD"), "$0.05"},
+		{New(-5, "USD"), "-$0.05"},
+		{New(1234567, "JPY"), "¥1,234,567"},
+		{New(-100, "JPY"), "-¥100"},
+		{New(1234, "KWD"), "KWD 1.234"},
+		{New(-1, "KWD"), "-KWD 0.001"},
+		{New(0, "EUR"), "€0.00"},
+	}
+	for _, test := range tests {
+		if got := test.amount.String(); got != test.want {
+			t.Errorf("%#v.String() = %q, want %q", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, amount := range []Money{New(123450, "USD"), New(-5, "USD"), New(1234567, "JPY"), New(-1234, "KWD"), New(0, "EUR")} {
+		data, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Money
+		err = json.Unmarshal(data, &decoded)
+		if err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if decoded != amount {
+			t.Errorf("%s decoded to %#v, want %#v", data, decoded, amount)
+		}
+	}
+
+	data, _ := json.Marshal(New(-1234, "KWD"))
+	if string(data) != `{"amount":"-1.234","currency":"KWD"}` {
+		t.Errorf("KWD encoded as %s", data)
+	}
+
+	var m Money
+	err := json.Unmarshal([]byte(`{"amount":12.5,"currency":"USD"}`), &m)
+	if err != nil || m != New(1250, "USD") {
+		t.Errorf("JSON number: got %#v, %v", m, err)
+	}
+	for _, data := range []string{`{"amount":"1/3","currency":"USD"}`, `{"amount":1e5,"currency":"USD"}`} {
+		err = json.Unmarshal([]byte(data), &m)
+		if !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("%s: err = %v, want %v", data, err, ErrInvalidAmount)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"balance-tracker/repositories"
+	"balance-tracker/services"
+)
+
+// runRates implements the "rates" subcommand:
+//
+//	balance-tracker rates import FILE...   load ECB eurofxref XML or CSV files
+//	balance-tracker rates list [DATE]      print the latest rates as of DATE
+func runRates(db *repositories.DB, args []string) error {
+	exchangeRateService := services.NewExchangeRateService(repositories.NewExchangeRateRepository(db), repositories.NewTxRunner(db))
+
+	if len(args) == 0 {
+		return fmt.Errorf("expected rates import FILE... or rates list [DATE]")
+	}
+
+	switch args[0] {
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("expected at least one file to import")
+		}
+		for _, path := range args[1:] {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			count, err := exchangeRateService.ImportRates(file, filepath.Base(path))
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			log.Printf("imported %d rates from %s", count, path)
+		}
+		return nil
+	case "list":
+		on := time.Now()
+		if len(args) > 1 {
+			var err error
+			on, err = time.Parse("2006-01-02", args[1])
+			if err != nil {
+				return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", args[1])
+			}
+		}
+		rates, err := exchangeRateService.GetExchangeRates(on)
+		if err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			fmt.Printf("%s\t%s/%s\t%s\t%s\n", rate.Date.Format("2006-01-02"), rate.Base, rate.Quote, rate.Rate, rate.Source)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown rates command %q, expected import or list", args[0])
+	}
+}
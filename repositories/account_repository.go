@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type accountRepository struct {
+	db querier
+}
+
+func NewAccountRepository(db *DB) AccountRepository {
+	if db.memory != nil {
+		return &memoryAccountRepository{store: db.memory}
+	}
+	return &accountRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *accountRepository) WithTx(tx *sql.Tx) AccountRepository {
+	return &accountRepository{r.db.withTx(tx)}
+}
+
+const accountColumns = "id, user_id, name, type, currency, opening_balance, created_at, updated_at"
+
+func scanAccount(row interface{ Scan(...any) error }, extra ...any) (models.Account, error) {
+	account := models.Account{}
+	var openingBalance money.Decimal
+	dest := append([]any{&account.ID, &account.UserID, &account.Name, &account.Type, &account.Currency, &openingBalance, &account.CreatedAt, &account.UpdatedAt}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	account.OpeningBalance, err = money.FromDecimal(openingBalance, account.Currency)
+	return account, err
+}
+
+func (r *accountRepository) GetAccount(id int) (models.Account, error) {
+	row := r.db.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = $1", id)
+
+	account, err := scanAccount(row)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+// LockAccount reads the account and locks its row until the surrounding
+// transaction ends, so that concurrent ledger writes to the same account are
+// applied one after another.
+func (r *accountRepository) LockAccount(id int) (models.Account, error) {
+	row := r.db.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = $1 FOR UPDATE", id)
+
+	account, err := scanAccount(row)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	return account, nil
+}
+
+func (r *accountRepository) GetAccountsByUserID(userID int) ([]models.Account, error) {
+	rows, err := r.db.Query("SELECT "+accountColumns+" FROM accounts WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// GetAccountBalancesByUserID returns every account of the user with its
+// balance derived from the opening balance and the ledger.
+func (r *accountRepository) GetAccountBalancesByUserID(userID int) ([]models.AccountBalance, error) {
+	rows, err := r.db.Query(`SELECT a.id, a.user_id, a.name, a.type, a.currency, a.opening_balance, a.created_at, a.updated_at,
+		a.opening_balance + COALESCE(SUM(t.amount), 0)
+		FROM accounts a
+		LEFT JOIN transactions t ON t.account_id = a.id
+		WHERE a.user_id = $1
+		GROUP BY a.id
+		ORDER BY a.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []models.AccountBalance{}
+	for rows.Next() {
+		var amount money.Decimal
+		account, err := scanAccount(rows, &amount)
+		if err != nil {
+			return nil, err
+		}
+
+		balance, err := money.FromDecimal(amount, account.Currency)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, models.AccountBalance{Account: account, Balance: balance})
+	}
+
+	return balances, rows.Err()
+}
+
+func (r *accountRepository) CreateAccount(account models.Account) (models.Account, error) {
+	err := r.db.QueryRow("INSERT INTO accounts (user_id, name, type, currency, opening_balance) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at", account.UserID, account.Name, account.Type, account.Currency, account.OpeningBalance).
+		Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt)
+	return account, err
+}
+
+func (r *accountRepository) UpdateAccount(id int, account models.Account) error {
+	_, err := r.db.Exec("UPDATE accounts SET name = $1, type = $2, currency = $3, opening_balance = $4, updated_at = $5 WHERE id = $6", account.Name, account.Type, account.Currency, account.OpeningBalance, account.UpdatedAt, id)
+	return err
+}
+
+func (r *accountRepository) DeleteAccount(id int) error {
+	_, err := r.db.Exec("DELETE FROM accounts WHERE id = $1", id)
+	return err
+}
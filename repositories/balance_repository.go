@@ -5,41 +5,42 @@ import (
 	"errors"
 
 	"balance-tracker/models"
+	"balance-tracker/money"
 )
 
-type BalanceRepository struct {
-	db *sql.DB
+type balanceRepository struct {
+	db querier
 }
 
-func NewBalanceRepository(db *sql.DB) *BalanceRepository {
-	return &BalanceRepository{db}
+func NewBalanceRepository(db *DB) BalanceRepository {
+	if db.memory != nil {
+		return &memoryBalanceRepository{store: db.memory}
+	}
+	return &balanceRepository{newQuerier(db)}
 }
 
-func (r *BalanceRepository) GetBalances() ([]models.Balance, error) {
-	rows, err := r.db.Query("SELECT * FROM balances")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *balanceRepository) WithTx(tx *sql.Tx) BalanceRepository {
+	return &balanceRepository{r.db.withTx(tx)}
+}
 
-	balances := []models.Balance{}
-	for rows.Next() {
-		balance := models.Balance{}
-		err := rows.Scan(&balance.ID, &balance.UserID, &balance.Amount, &balance.CreatedAt, &balance.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		balances = append(balances, balance)
+func scanBalance(row interface{ Scan(...any) error }) (models.Balance, error) {
+	balance := models.Balance{}
+	var amount money.Decimal
+	var currency string
+	err := row.Scan(&balance.ID, &balance.UserID, &balance.AccountID, &amount, &currency, &balance.CreatedAt, &balance.UpdatedAt)
+	if err != nil {
+		return models.Balance{}, err
 	}
 
-	return balances, nil
+	balance.Amount, err = money.FromDecimal(amount, currency)
+	return balance, err
 }
 
-func (r *BalanceRepository) GetBalance(id string) (models.Balance, error) {
-	row := r.db.QueryRow("SELECT * FROM balances WHERE id = $1", id)
+func (r *balanceRepository) GetBalance(id int) (models.Balance, error) {
+	row := r.db.QueryRow("SELECT id, user_id, account_id, amount, currency, created_at, updated_at FROM balances WHERE id = $1", id)
 
-	balance := models.Balance{}
-	err := row.Scan(&balance.ID, &balance.UserID, &balance.Amount, &balance.CreatedAt, &balance.UpdatedAt)
+	balance, err := scanBalance(row)
 	if err != nil {
 		return models.Balance{}, err
 	}
@@ -47,30 +48,13 @@ func (r *BalanceRepository) GetBalance(id string) (models.Balance, error) {
 	return balance, nil
 }
 
-func (r *BalanceRepository) CreateBalance(balance models.Balance) error {
-	_, err := r.db.Exec("INSERT INTO balances (user_id, amount) VALUES ($1, $2)", balance.UserID, balance.Amount)
+func (r *balanceRepository) CreateBalance(balance models.Balance) error {
+	_, err := r.db.Exec("INSERT INTO balances (user_id, account_id, amount, currency) VALUES ($1, $2, $3, $4)", balance.UserID, balance.AccountID, balance.Amount, balance.Amount.Currency())
 	return err
 }
 
-func (r *BalanceRepository) UpdateBalance(id string, balance models.Balance) error {
-	_, err := r.db.Exec("UPDATE balances SET user_id = $1, amount = $2, updated_at = $3 WHERE id = $4", balance.UserID, balance.Amount, balance.UpdatedAt, id)
-	return err
-}
-
-func (r *BalanceRepository) DeleteBalance(id int) error {
-	_, err := r.db.Exec("DELETE FROM balances WHERE id = $1", id)
-	return err
-}
-
-func (r *BalanceRepository) GetLastBalance() (models.Balance, error) {
-	var balance models.Balance
-	query := "SELECT * FROM balances ORDER BY id DESC LIMIT 1"
-	err := r.db.QueryRow(query).Scan(&balance.ID, &balance.UserID, &balance.Amount, &balance.CreatedAt, &balance.UpdatedAt)
-	return balance, err
-}
-
-func (r *BalanceRepository) GetBalancesByUserID(userID int) ([]models.Balance, error) {
-	rows, err := r.db.Query("SELECT * FROM balances WHERE user_id = $1 ORDER BY created_at DESC", userID)
+func (r *balanceRepository) GetBalancesByUserID(userID int) ([]models.Balance, error) {
+	rows, err := r.db.Query("SELECT id, user_id, account_id, amount, currency, created_at, updated_at FROM balances WHERE user_id = $1 ORDER BY created_at DESC", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -78,8 +62,7 @@ func (r *BalanceRepository) GetBalancesByUserID(userID int) ([]models.Balance, e
 
 	balances := []models.Balance{}
 	for rows.Next() {
-		balance := models.Balance{}
-		err := rows.Scan(&balance.ID, &balance.UserID, &balance.Amount, &balance.CreatedAt, &balance.UpdatedAt)
+		balance, err := scanBalance(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -89,10 +72,8 @@ func (r *BalanceRepository) GetBalancesByUserID(userID int) ([]models.Balance, e
 	return balances, nil
 }
 
-func (r *BalanceRepository) GetLastBalanceByUserID(userID int) (models.Balance, error) {
-	var balance models.Balance
-	err := r.db.QueryRow("SELECT * FROM balances WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1", userID).
-		Scan(&balance.ID, &balance.UserID, &balance.Amount, &balance.CreatedAt, &balance.UpdatedAt)
+func (r *balanceRepository) GetLastBalanceByUserID(userID int) (models.Balance, error) {
+	balance, err := scanBalance(r.db.QueryRow("SELECT id, user_id, account_id, amount, currency, created_at, updated_at FROM balances WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1", userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Balance{}, errors.New("no balance found for user")
@@ -101,3 +82,14 @@ func (r *BalanceRepository) GetLastBalanceByUserID(userID int) (models.Balance,
 	}
 	return balance, nil
 }
+
+func (r *balanceRepository) GetLastBalanceByAccountID(accountID int) (models.Balance, error) {
+	balance, err := scanBalance(r.db.QueryRow("SELECT id, user_id, account_id, amount, currency, created_at, updated_at FROM balances WHERE account_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1", accountID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Balance{}, errors.New("no balance found for account")
+		}
+		return models.Balance{}, err
+	}
+	return balance, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type budgetRepository struct {
+	db querier
+}
+
+func NewBudgetRepository(db *DB) BudgetRepository {
+	if db.memory != nil {
+		return &memoryBudgetRepository{store: db.memory}
+	}
+	return &budgetRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *budgetRepository) WithTx(tx *sql.Tx) BudgetRepository {
+	return &budgetRepository{r.db.withTx(tx)}
+}
+
+const budgetColumns = "b.id, b.user_id, b.category_id, c.name, b.month, b.amount, b.currency, b.rollover, b.created_at, b.updated_at"
+
+const budgetTables = "budgets b JOIN categories c ON c.id = b.category_id"
+
+func scanBudget(row interface{ Scan(...any) error }) (models.Budget, error) {
+	var budget models.Budget
+	var amount money.Decimal
+	var currency string
+	err := row.Scan(&budget.ID, &budget.UserID, &budget.CategoryID, &budget.CategoryName, &budget.Month, &amount, &currency, &budget.Rollover, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	budget.Amount, err = money.FromDecimal(amount, currency)
+	return budget, err
+}
+
+func (r *budgetRepository) GetBudget(id int) (models.Budget, error) {
+	return scanBudget(r.db.QueryRow("SELECT "+budgetColumns+" FROM "+budgetTables+" WHERE b.id = $1", id))
+}
+
+// GetBudgetsByMonth returns the user's budgets for the month starting on
+// month.
+func (r *budgetRepository) GetBudgetsByMonth(userID int, month time.Time) ([]models.Budget, error) {
+	rows, err := r.db.Query("SELECT "+budgetColumns+" FROM "+budgetTables+" WHERE b.user_id = $1 AND b.month = $2 ORDER BY c.name, b.id", userID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.Budget{}
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+// GetBudgetsByUserID returns all of the user's budgets, oldest month first.
+func (r *budgetRepository) GetBudgetsByUserID(userID int) ([]models.Budget, error) {
+	rows, err := r.db.Query("SELECT "+budgetColumns+" FROM "+budgetTables+" WHERE b.user_id = $1 ORDER BY b.month, c.name, b.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.Budget{}
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+
+	return budgets, rows.Err()
+}
+
+// GetBudgetByCategory returns the category's budget for the month starting
+// on month.
+func (r *budgetRepository) GetBudgetByCategory(categoryID int, month time.Time) (models.Budget, error) {
+	return scanBudget(r.db.QueryRow("SELECT "+budgetColumns+" FROM "+budgetTables+" WHERE b.category_id = $1 AND b.month = $2", categoryID, month))
+}
+
+func (r *budgetRepository) CreateBudget(budget models.Budget) (models.Budget, error) {
+	err := r.db.QueryRow("INSERT INTO budgets (user_id, category_id, month, amount, currency, rollover) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		budget.UserID, budget.CategoryID, budget.Month, budget.Amount, budget.Amount.Currency(), budget.Rollover).
+		Scan(&budget.ID, &budget.CreatedAt, &budget.UpdatedAt)
+	return budget, err
+}
+
+func (r *budgetRepository) UpdateBudget(id int, budget models.Budget) error {
+	_, err := r.db.Exec("UPDATE budgets SET amount = $1, currency = $2, rollover = $3, updated_at = $4 WHERE id = $5",
+		budget.Amount, budget.Amount.Currency(), budget.Rollover, budget.UpdatedAt, id)
+	return err
+}
+
+func (r *budgetRepository) DeleteBudget(id int) error {
+	_, err := r.db.Exec("DELETE FROM budgets WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type categoryRepository struct {
+	db querier
+}
+
+func NewCategoryRepository(db *DB) CategoryRepository {
+	if db.memory != nil {
+		return &memoryCategoryRepository{store: db.memory}
+	}
+	return &categoryRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *categoryRepository) WithTx(tx *sql.Tx) CategoryRepository {
+	return &categoryRepository{r.db.withTx(tx)}
+}
+
+const categoryColumns = "id, user_id, parent_id, name, kind, created_at, updated_at"
+
+func scanCategory(row interface{ Scan(...any) error }) (models.Category, error) {
+	category := models.Category{}
+	err := row.Scan(&category.ID, &category.UserID, &category.ParentID, &category.Name, &category.Kind, &category.CreatedAt, &category.UpdatedAt)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return category, nil
+}
+
+func (r *categoryRepository) GetCategory(id int) (models.Category, error) {
+	row := r.db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = $1", id)
+	return scanCategory(row)
+}
+
+func (r *categoryRepository) GetCategoriesByUserID(userID int) ([]models.Category, error) {
+	rows, err := r.db.Query("SELECT "+categoryColumns+" FROM categories WHERE user_id = $1 ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+func (r *categoryRepository) CreateCategory(category models.Category) (models.Category, error) {
+	err := r.db.QueryRow("INSERT INTO categories (user_id, parent_id, name, kind) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at", category.UserID, category.ParentID, category.Name, category.Kind).
+		Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
+	return category, err
+}
+
+func (r *categoryRepository) UpdateCategory(id int, category models.Category) error {
+	_, err := r.db.Exec("UPDATE categories SET parent_id = $1, name = $2, kind = $3, updated_at = $4 WHERE id = $5", category.ParentID, category.Name, category.Kind, category.UpdatedAt, id)
+	return err
+}
+
+func (r *categoryRepository) DeleteCategory(id int) error {
+	_, err := r.db.Exec("DELETE FROM categories WHERE id = $1", id)
+	return err
+}
+
+func (r *categoryRepository) CountChildCategories(id int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM categories WHERE parent_id = $1", id).Scan(&count)
+	return count, err
+}
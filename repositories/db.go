@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect adapts the repositories' queries, which are written for Postgres,
+// to the database behind a DB.
+type Dialect interface {
+	// Name identifies the dialect, e.g. to pick its migrations.
+	Name() string
+	// Rewrite turns a Postgres query into one the backend understands.
+	Rewrite(query string) string
+	// IsRetryable reports whether a transaction that failed with err
+	// succeeds when it is simply run again.
+	IsRetryable(err error) bool
+}
+
+// DB is a database connection together with the dialect of its backend.
+// The "memory" backend has no SQL database behind it, only a store that its
+// repositories keep their data in.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+	memory  *memoryStore
+}
+
+// Open connects to a storage backend:
+//
+//   - "postgres": a Postgres server, dsn is a pgx connection string
+//   - "sqlite": a SQLite database file at dsn
+//   - "memory": data kept in the process's memory until it exits, for tests
+//     and trying the app out, dsn is ignored
+func Open(backend string, dsn string) (*DB, error) {
+	switch backend {
+	case "postgres", "":
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &DB{DB: db, Dialect: postgresDialect{}}, nil
+	case "sqlite":
+		// Transactions take the write lock up front, as SQLite has no row locks
+		db, err := sql.Open("sqlite3", "file:"+dsn+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+		if err != nil {
+			return nil, err
+		}
+		return &DB{DB: db, Dialect: sqliteDialect{}}, nil
+	case "memory":
+		return &DB{Dialect: memoryDialect{}, memory: newMemoryStore()}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected postgres, sqlite or memory", backend)
+	}
+}
+
+// InMemory reports whether the DB is the "memory" backend, which has no
+// schema to migrate.
+func (db *DB) InMemory() bool {
+	return db.memory != nil
+}
+
+func (db *DB) Close() error {
+	if db.DB == nil {
+		return nil
+	}
+	return db.DB.Close()
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Rewrite(query string) string { return query }
+
+func (postgresDialect) IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
+
+type sqliteDialect struct{}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+// Rewrite numbers placeholders the SQLite way and drops row locks, which are
+// unnecessary because each transaction holds the database's write lock.
+func (sqliteDialect) Rewrite(query string) string {
+	query = placeholder.ReplaceAllString(query, "?$1")
+	return strings.ReplaceAll(query, " FOR UPDATE", "")
+}
+
+func (sqliteDialect) IsRetryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+type memoryDialect struct{}
+
+func (memoryDialect) Name() string { return "memory" }
+
+func (memoryDialect) Rewrite(query string) string { return query }
+
+func (memoryDialect) IsRetryable(err error) bool { return false }
+
+// querier runs queries through the dialect, either directly on the database
+// or inside a transaction.
+type querier struct {
+	db      DBTX
+	dialect Dialect
+}
+
+func newQuerier(db *DB) querier {
+	return querier{db.DB, db.Dialect}
+}
+
+func (q querier) withTx(tx *sql.Tx) querier {
+	return querier{tx, q.dialect}
+}
+
+func (q querier) Exec(query string, args ...any) (sql.Result, error) {
+	return q.db.Exec(q.dialect.Rewrite(query), args...)
+}
+
+func (q querier) Query(query string, args ...any) (*sql.Rows, error) {
+	return q.db.Query(q.dialect.Rewrite(query), args...)
+}
+
+func (q querier) QueryRow(query string, args ...any) *sql.Row {
+	return q.db.QueryRow(q.dialect.Rewrite(query), args...)
+}
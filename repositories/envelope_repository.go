@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type envelopeRepository struct {
+	db querier
+}
+
+func NewEnvelopeRepository(db *DB) EnvelopeRepository {
+	if db.memory != nil {
+		return &memoryEnvelopeRepository{store: db.memory}
+	}
+	return &envelopeRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *envelopeRepository) WithTx(tx *sql.Tx) EnvelopeRepository {
+	return &envelopeRepository{r.db.withTx(tx)}
+}
+
+// GetAssignments returns the user's assignment changes for the months
+// starting from from to to, both included, oldest first.
+func (r *envelopeRepository) GetAssignments(userID int, from time.Time, to time.Time) ([]models.EnvelopeAssignment, error) {
+	rows, err := r.db.Query(`SELECT e.id, e.user_id, e.category_id, c.name, e.month, e.amount, e.currency, e.note, e.created_at
+		FROM envelope_assignments e JOIN categories c ON c.id = e.category_id
+		WHERE e.user_id = $1 AND e.month >= $2 AND e.month <= $3
+		ORDER BY e.month, e.id`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.EnvelopeAssignment{}
+	for rows.Next() {
+		var assignment models.EnvelopeAssignment
+		var amount money.Decimal
+		var currency string
+		err := rows.Scan(&assignment.ID, &assignment.UserID, &assignment.CategoryID, &assignment.CategoryName, &assignment.Month, &amount, &currency, &assignment.Note, &assignment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		assignment.Amount, err = money.FromDecimal(amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, rows.Err()
+}
+
+func (r *envelopeRepository) CreateAssignment(assignment models.EnvelopeAssignment) (models.EnvelopeAssignment, error) {
+	err := r.db.QueryRow("INSERT INTO envelope_assignments (user_id, category_id, month, amount, currency, note) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		assignment.UserID, assignment.CategoryID, assignment.Month, assignment.Amount, assignment.Amount.Currency(), assignment.Note).
+		Scan(&assignment.ID, &assignment.CreatedAt)
+	return assignment, err
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type exchangeRateRepository struct {
+	db querier
+}
+
+func NewExchangeRateRepository(db *DB) ExchangeRateRepository {
+	if db.memory != nil {
+		return &memoryExchangeRateRepository{store: db.memory}
+	}
+	return &exchangeRateRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *exchangeRateRepository) WithTx(tx *sql.Tx) ExchangeRateRepository {
+	return &exchangeRateRepository{r.db.withTx(tx)}
+}
+
+// SaveExchangeRate stores the rate, replacing any rate already stored for
+// the same pair and date.
+func (r *exchangeRateRepository) SaveExchangeRate(rate models.ExchangeRate) error {
+	_, err := r.db.Exec("INSERT INTO exchange_rates (date, base, quote, rate, source) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (base, quote, date) DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source", rate.Date, rate.Base, rate.Quote, rate.Rate, rate.Source)
+	return err
+}
+
+// GetLatestExchangeRates returns, for every currency pair, the most recent
+// rate dated on or before on.
+func (r *exchangeRateRepository) GetLatestExchangeRates(on time.Time) ([]models.ExchangeRate, error) {
+	rows, err := r.db.Query("SELECT r.id, r.date, r.base, r.quote, r.rate, r.source, r.created_at FROM exchange_rates r WHERE r.date = (SELECT MAX(l.date) FROM exchange_rates l WHERE l.base = r.base AND l.quote = r.quote AND l.date <= $1) ORDER BY r.base, r.quote", on)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		rate := models.ExchangeRate{}
+		err := rows.Scan(&rate.ID, &rate.Date, &rate.Base, &rate.Quote, &rate.Rate, &rate.Source, &rate.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (r *exchangeRateRepository) GetExchangeRatesByCurrencies(currencies []string, from time.Time) ([]models.ExchangeRate, error) {
+	if len(currencies) == 0 {
+		return []models.ExchangeRate{}, nil
+	}
+
+	args := []any{from}
+	placeholders := make([]string, len(currencies))
+	for i, currency := range currencies {
+		args = append(args, currency)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	in := strings.Join(placeholders, ", ")
+
+	rows, err := r.db.Query("SELECT r.id, r.date, r.base, r.quote, r.rate, r.source, r.created_at FROM exchange_rates r WHERE r.date >= $1 AND (r.base IN ("+in+") OR r.quote IN ("+in+")) ORDER BY r.date, r.base, r.quote", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		rate := models.ExchangeRate{}
+		err := rows.Scan(&rate.ID, &rate.Date, &rate.Base, &rate.Quote, &rate.Rate, &rate.Source, &rate.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
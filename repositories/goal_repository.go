@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type goalRepository struct {
+	db querier
+}
+
+func NewGoalRepository(db *DB) GoalRepository {
+	if db.memory != nil {
+		return &memoryGoalRepository{store: db.memory}
+	}
+	return &goalRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *goalRepository) WithTx(tx *sql.Tx) GoalRepository {
+	return &goalRepository{r.db.withTx(tx)}
+}
+
+const goalColumns = "g.id, g.user_id, g.name, g.target_amount, g.currency, g.target_month, g.account_id, g.category_id, COALESCE(a.name, c.name, ''), g.created_at, g.updated_at"
+
+const goalTables = "goals g LEFT JOIN accounts a ON a.id = g.account_id LEFT JOIN categories c ON c.id = g.category_id"
+
+func scanGoal(row interface{ Scan(...any) error }) (models.Goal, error) {
+	var goal models.Goal
+	var target money.Decimal
+	var currency string
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.Name, &target, &currency, &goal.TargetMonth, &goal.AccountID, &goal.CategoryID, &goal.LinkedName, &goal.CreatedAt, &goal.UpdatedAt)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	goal.Target, err = money.FromDecimal(target, currency)
+	return goal, err
+}
+
+func (r *goalRepository) GetGoal(id int) (models.Goal, error) {
+	return scanGoal(r.db.QueryRow("SELECT "+goalColumns+" FROM "+goalTables+" WHERE g.id = $1", id))
+}
+
+// GetGoalsByUserID returns the user's goals, the soonest due first.
+func (r *goalRepository) GetGoalsByUserID(userID int) ([]models.Goal, error) {
+	rows, err := r.db.Query("SELECT "+goalColumns+" FROM "+goalTables+" WHERE g.user_id = $1 ORDER BY g.target_month, g.name, g.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []models.Goal{}
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+
+	return goals, rows.Err()
+}
+
+func (r *goalRepository) CreateGoal(goal models.Goal) (models.Goal, error) {
+	err := r.db.QueryRow("INSERT INTO goals (user_id, name, target_amount, currency, target_month, account_id, category_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at",
+		goal.UserID, goal.Name, goal.Target, goal.Target.Currency(), goal.TargetMonth, goal.AccountID, goal.CategoryID).
+		Scan(&goal.ID, &goal.CreatedAt, &goal.UpdatedAt)
+	return goal, err
+}
+
+func (r *goalRepository) UpdateGoal(id int, goal models.Goal) error {
+	_, err := r.db.Exec("UPDATE goals SET name = $1, target_amount = $2, currency = $3, target_month = $4, account_id = $5, category_id = $6, updated_at = $7 WHERE id = $8",
+		goal.Name, goal.Target, goal.Target.Currency(), goal.TargetMonth, goal.AccountID, goal.CategoryID, goal.UpdatedAt, id)
+	return err
+}
+
+func (r *goalRepository) DeleteGoal(id int) error {
+	_, err := r.db.Exec("DELETE FROM goals WHERE id = $1", id)
+	return err
+}
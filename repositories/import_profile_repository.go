@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type importProfileRepository struct {
+	db querier
+}
+
+func NewImportProfileRepository(db *DB) ImportProfileRepository {
+	if db.memory != nil {
+		return &memoryImportProfileRepository{store: db.memory}
+	}
+	return &importProfileRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *importProfileRepository) WithTx(tx *sql.Tx) ImportProfileRepository {
+	return &importProfileRepository{r.db.withTx(tx)}
+}
+
+const importProfileColumns = "id, user_id, name, delimiter, encoding, skip_rows, has_header, date_column, date_format, amount_column, credit_column, payee_column, memo_column, decimal_comma, negate, created_at, updated_at"
+
+func scanImportProfile(row interface{ Scan(...any) error }) (models.ImportProfile, error) {
+	var profile models.ImportProfile
+	err := row.Scan(&profile.ID, &profile.UserID, &profile.Name, &profile.Delimiter, &profile.Encoding, &profile.SkipRows, &profile.HasHeader, &profile.DateColumn, &profile.DateFormat,
+		&profile.AmountColumn, &profile.CreditColumn, &profile.PayeeColumn, &profile.MemoColumn, &profile.DecimalComma, &profile.Negate, &profile.CreatedAt, &profile.UpdatedAt)
+	return profile, err
+}
+
+func (r *importProfileRepository) GetImportProfile(id int) (models.ImportProfile, error) {
+	return scanImportProfile(r.db.QueryRow("SELECT "+importProfileColumns+" FROM import_profiles WHERE id = $1", id))
+}
+
+func (r *importProfileRepository) GetImportProfileByName(userID int, name string) (models.ImportProfile, error) {
+	return scanImportProfile(r.db.QueryRow("SELECT "+importProfileColumns+" FROM import_profiles WHERE user_id = $1 AND name = $2", userID, name))
+}
+
+func (r *importProfileRepository) GetImportProfilesByUserID(userID int) ([]models.ImportProfile, error) {
+	rows, err := r.db.Query("SELECT "+importProfileColumns+" FROM import_profiles WHERE user_id = $1 ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []models.ImportProfile{}
+	for rows.Next() {
+		profile, err := scanImportProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+func (r *importProfileRepository) CreateImportProfile(profile models.ImportProfile) (models.ImportProfile, error) {
+	err := r.db.QueryRow(`INSERT INTO import_profiles (user_id, name, delimiter, encoding, skip_rows, has_header, date_column, date_format, amount_column, credit_column, payee_column, memo_column, decimal_comma, negate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id, created_at, updated_at`,
+		profile.UserID, profile.Name, profile.Delimiter, profile.Encoding, profile.SkipRows, profile.HasHeader, profile.DateColumn, profile.DateFormat,
+		profile.AmountColumn, profile.CreditColumn, profile.PayeeColumn, profile.MemoColumn, profile.DecimalComma, profile.Negate).
+		Scan(&profile.ID, &profile.CreatedAt, &profile.UpdatedAt)
+	return profile, err
+}
+
+func (r *importProfileRepository) UpdateImportProfile(id int, profile models.ImportProfile) error {
+	_, err := r.db.Exec(`UPDATE import_profiles SET name = $1, delimiter = $2, encoding = $3, skip_rows = $4, has_header = $5, date_column = $6, date_format = $7,
+		amount_column = $8, credit_column = $9, payee_column = $10, memo_column = $11, decimal_comma = $12, negate = $13, updated_at = $14 WHERE id = $15`,
+		profile.Name, profile.Delimiter, profile.Encoding, profile.SkipRows, profile.HasHeader, profile.DateColumn, profile.DateFormat,
+		profile.AmountColumn, profile.CreditColumn, profile.PayeeColumn, profile.MemoColumn, profile.DecimalComma, profile.Negate, profile.UpdatedAt, id)
+	return err
+}
+
+func (r *importProfileRepository) DeleteImportProfile(id int) error {
+	_, err := r.db.Exec("DELETE FROM import_profiles WHERE id = $1", id)
+	return err
+}
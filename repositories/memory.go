@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"errors"
+	"maps"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// errMemoryConstraint is returned by the in-memory repositories where a
+// database would report a constraint violation, such as a duplicate key or a
+// row that is still referenced.
+var errMemoryConstraint = errors.New("constraint violation")
+
+// memoryStore keeps the data of the "memory" backend in plain Go maps. A
+// mutex stands in for the database's locks: repositories take it for each
+// call, and a transaction holds it from start to end, so transactions run one
+// after another and a failed one is undone by restoring a copy of the data.
+type memoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+// memoryData holds one map per table, keyed by ID. Rows are stored by value
+// without the fields that SQL queries join in, such as account names.
+type memoryData struct {
+	nextID map[string]int
+
+	users               map[int]models.User
+	sessions            map[int]models.Session
+	accounts            map[int]models.Account
+	balances            map[int]memoryBalance
+	transactions        map[int]models.Transaction
+	transfers           map[int]models.Transfer
+	splits              map[int]memorySplit
+	tags                map[int]models.Tag
+	transactionTags     map[memoryTransactionTag]bool
+	categories          map[int]models.Category
+	payees              map[int]models.Payee
+	payeeAliases        map[int]memoryPayeeAlias
+	exchangeRates       map[int]models.ExchangeRate
+	recurring           map[int]models.RecurringTransaction
+	occurrences         map[memoryOccurrenceKey]memoryOccurrence
+	budgets             map[int]models.Budget
+	envelopeAssignments map[int]models.EnvelopeAssignment
+	goals               map[int]models.Goal
+	importProfiles      map[int]models.ImportProfile
+}
+
+type memoryBalance struct {
+	models.Balance
+	createdAt time.Time
+}
+
+type memorySplit struct {
+	ID            int
+	TransactionID int
+	CategoryID    int
+	Amount        money.Decimal
+	Memo          string
+	Position      int
+}
+
+type memoryTransactionTag struct {
+	TransactionID int
+	TagID         int
+}
+
+type memoryPayeeAlias struct {
+	ID      int
+	UserID  int
+	PayeeID int
+	Alias   string
+	Key     string
+}
+
+type memoryOccurrenceKey struct {
+	RecurringID int
+	Date        time.Time
+}
+
+// memoryOccurrence keeps an edited amount as a decimal, which is read back in
+// the template's currency like the SQL column.
+type memoryOccurrence struct {
+	models.RecurringOccurrence
+	amount *money.Decimal
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: &memoryData{
+		nextID:              map[string]int{},
+		users:               map[int]models.User{},
+		sessions:            map[int]models.Session{},
+		accounts:            map[int]models.Account{},
+		balances:            map[int]memoryBalance{},
+		transactions:        map[int]models.Transaction{},
+		transfers:           map[int]models.Transfer{},
+		splits:              map[int]memorySplit{},
+		tags:                map[int]models.Tag{},
+		transactionTags:     map[memoryTransactionTag]bool{},
+		categories:          map[int]models.Category{},
+		payees:              map[int]models.Payee{},
+		payeeAliases:        map[int]memoryPayeeAlias{},
+		exchangeRates:       map[int]models.ExchangeRate{},
+		recurring:           map[int]models.RecurringTransaction{},
+		occurrences:         map[memoryOccurrenceKey]memoryOccurrence{},
+		budgets:             map[int]models.Budget{},
+		envelopeAssignments: map[int]models.EnvelopeAssignment{},
+		goals:               map[int]models.Goal{},
+		importProfiles:      map[int]models.ImportProfile{},
+	}}
+}
+
+// clone copies the maps. The rows are values whose pointer fields are never
+// written through, so they can be shared.
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		nextID:              maps.Clone(d.nextID),
+		users:               maps.Clone(d.users),
+		sessions:            maps.Clone(d.sessions),
+		accounts:            maps.Clone(d.accounts),
+		balances:            maps.Clone(d.balances),
+		transactions:        maps.Clone(d.transactions),
+		transfers:           maps.Clone(d.transfers),
+		splits:              maps.Clone(d.splits),
+		tags:                maps.Clone(d.tags),
+		transactionTags:     maps.Clone(d.transactionTags),
+		categories:          maps.Clone(d.categories),
+		payees:              maps.Clone(d.payees),
+		payeeAliases:        maps.Clone(d.payeeAliases),
+		exchangeRates:       maps.Clone(d.exchangeRates),
+		recurring:           maps.Clone(d.recurring),
+		occurrences:         maps.Clone(d.occurrences),
+		budgets:             maps.Clone(d.budgets),
+		envelopeAssignments: maps.Clone(d.envelopeAssignments),
+		goals:               maps.Clone(d.goals),
+		importProfiles:      maps.Clone(d.importProfiles),
+	}
+}
+
+// newID returns the next ID of a table, counting from 1 like a serial
+// column.
+func (d *memoryData) newID(table string) int {
+	d.nextID[table]++
+	return d.nextID[table]
+}
+
+// lock takes the store's mutex unless the caller runs inside a transaction,
+// which holds it already, and returns the function that releases it.
+func (s *memoryStore) lock(inTx bool) func() {
+	if inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// runInTx runs fn with the store to itself and undoes its changes if it
+// fails.
+func (s *memoryStore) runInTx(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.data.clone()
+	err := fn()
+	if err != nil {
+		s.data = saved
+	}
+	return err
+}
+
+// The helpers below copy what a database would copy on the way in: times
+// lose their monotonic reading and location, and pointers are not shared
+// with the caller.
+
+func memoryTime(t time.Time) time.Time {
+	return t.UTC().Round(0)
+}
+
+func memoryTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := memoryTime(*t)
+	return &copied
+}
+
+func memoryIntPtr(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	copied := *i
+	return &copied
+}
+
+// sumDecimals adds up amounts exactly, like SUM over a NUMERIC column.
+func sumDecimals(amounts ...money.Decimal) (money.Decimal, error) {
+	sum := new(big.Rat)
+	for _, amount := range amounts {
+		r, err := amount.Rat()
+		if err != nil {
+			return "", err
+		}
+		sum.Add(sum, r)
+	}
+	return money.Decimal(sum.FloatString(4)), nil
+}
+
+// compareDecimals compares two amounts as numbers, returning -1, 0 or +1.
+func compareDecimals(a money.Decimal, b money.Decimal) int {
+	ra, err := a.Rat()
+	if err != nil {
+		ra = new(big.Rat)
+	}
+	rb, err := b.Rat()
+	if err != nil {
+		rb = new(big.Rat)
+	}
+	return ra.Cmp(rb)
+}
+
+// sortBy sorts rows in place, keeping rows that compare equal in the order
+// they came in.
+func sortBy[T any](rows []T, less func(a, b T) bool) {
+	sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type memoryAccountRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryAccountRepository) WithTx(tx *sql.Tx) AccountRepository {
+	return &memoryAccountRepository{r.store, true}
+}
+
+func (r *memoryAccountRepository) GetAccount(id int) (models.Account, error) {
+	defer r.store.lock(r.inTx)()
+
+	account, ok := r.store.data.accounts[id]
+	if !ok {
+		return models.Account{}, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+// LockAccount reads the account. The transaction holding the store already
+// keeps out every other writer.
+func (r *memoryAccountRepository) LockAccount(id int) (models.Account, error) {
+	return r.GetAccount(id)
+}
+
+func (r *memoryAccountRepository) GetAccountsByUserID(userID int) ([]models.Account, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.userAccounts(userID), nil
+}
+
+func (d *memoryData) userAccounts(userID int) []models.Account {
+	accounts := []models.Account{}
+	for _, account := range d.accounts {
+		if account.UserID == userID {
+			accounts = append(accounts, account)
+		}
+	}
+	sortBy(accounts, func(a, b models.Account) bool { return a.ID < b.ID })
+	return accounts
+}
+
+func (r *memoryAccountRepository) GetAccountBalancesByUserID(userID int) ([]models.AccountBalance, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	balances := []models.AccountBalance{}
+	for _, account := range d.userAccounts(userID) {
+		amounts := []money.Decimal{account.OpeningBalance.Decimal()}
+		for _, transaction := range d.transactions {
+			if transaction.AccountID == account.ID {
+				amounts = append(amounts, transaction.Amount.Decimal())
+			}
+		}
+		sum, err := sumDecimals(amounts...)
+		if err != nil {
+			return nil, err
+		}
+		balance, err := money.FromDecimal(sum, account.Currency)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, models.AccountBalance{Account: account, Balance: balance})
+	}
+	return balances, nil
+}
+
+func (r *memoryAccountRepository) CreateAccount(account models.Account) (models.Account, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.users[account.UserID]; !ok {
+		return models.Account{}, errMemoryConstraint
+	}
+
+	now := memoryTime(time.Now())
+	account.ID = d.newID("accounts")
+	account.CreatedAt = now
+	account.UpdatedAt = now
+	d.accounts[account.ID] = account
+	return account, nil
+}
+
+func (r *memoryAccountRepository) UpdateAccount(id int, account models.Account) error {
+	defer r.store.lock(r.inTx)()
+
+	existing, ok := r.store.data.accounts[id]
+	if !ok {
+		return nil
+	}
+	existing.Name = account.Name
+	existing.Type = account.Type
+	existing.Currency = account.Currency
+	existing.OpeningBalance = account.OpeningBalance
+	existing.UpdatedAt = memoryTime(account.UpdatedAt)
+	r.store.data.accounts[id] = existing
+	return nil
+}
+
+func (r *memoryAccountRepository) DeleteAccount(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	r.store.data.deleteAccount(id)
+	return nil
+}
+
+// deleteAccount deletes the account with its balances, ledger entries,
+// recurring transactions and goals.
+func (d *memoryData) deleteAccount(id int) {
+	for balanceID, balance := range d.balances {
+		if balance.AccountID == id {
+			delete(d.balances, balanceID)
+		}
+	}
+	for transactionID, transaction := range d.transactions {
+		if transaction.AccountID == id {
+			d.deleteTransaction(transactionID)
+		}
+	}
+	for recurringID, recurring := range d.recurring {
+		if recurring.AccountID == id {
+			d.deleteRecurring(recurringID)
+		}
+	}
+	for goalID, goal := range d.goals {
+		if goal.AccountID != nil && *goal.AccountID == id {
+			delete(d.goals, goalID)
+		}
+	}
+	delete(d.accounts, id)
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryBalanceRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryBalanceRepository) WithTx(tx *sql.Tx) BalanceRepository {
+	return &memoryBalanceRepository{r.store, true}
+}
+
+func (r *memoryBalanceRepository) GetBalance(id int) (models.Balance, error) {
+	defer r.store.lock(r.inTx)()
+
+	balance, ok := r.store.data.balances[id]
+	if !ok {
+		return models.Balance{}, sql.ErrNoRows
+	}
+	return balance.Balance, nil
+}
+
+func (r *memoryBalanceRepository) CreateBalance(balance models.Balance) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.accounts[balance.AccountID]; !ok {
+		return errMemoryConstraint
+	}
+
+	now := memoryTime(time.Now())
+	balance.ID = d.newID("balances")
+	balance.CreatedAt = now.Format(time.RFC3339Nano)
+	balance.UpdatedAt = balance.CreatedAt
+	d.balances[balance.ID] = memoryBalance{Balance: balance, createdAt: now}
+	return nil
+}
+
+// newestBalances returns the balances that match, the most recent first.
+func (d *memoryData) newestBalances(match func(models.Balance) bool) []models.Balance {
+	matching := []memoryBalance{}
+	for _, balance := range d.balances {
+		if match(balance.Balance) {
+			matching = append(matching, balance)
+		}
+	}
+	sortBy(matching, func(a, b memoryBalance) bool {
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.After(b.createdAt)
+		}
+		return a.ID > b.ID
+	})
+
+	balances := make([]models.Balance, len(matching))
+	for i, balance := range matching {
+		balances[i] = balance.Balance
+	}
+	return balances
+}
+
+func (r *memoryBalanceRepository) GetBalancesByUserID(userID int) ([]models.Balance, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.newestBalances(func(b models.Balance) bool { return b.UserID == userID }), nil
+}
+
+func (r *memoryBalanceRepository) GetLastBalanceByUserID(userID int) (models.Balance, error) {
+	defer r.store.lock(r.inTx)()
+
+	balances := r.store.data.newestBalances(func(b models.Balance) bool { return b.UserID == userID })
+	if len(balances) == 0 {
+		return models.Balance{}, errors.New("no balance found for user")
+	}
+	return balances[0], nil
+}
+
+func (r *memoryBalanceRepository) GetLastBalanceByAccountID(accountID int) (models.Balance, error) {
+	defer r.store.lock(r.inTx)()
+
+	balances := r.store.data.newestBalances(func(b models.Balance) bool { return b.AccountID == accountID })
+	if len(balances) == 0 {
+		return models.Balance{}, errors.New("no balance found for account")
+	}
+	return balances[0], nil
+}
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryBudgetRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryBudgetRepository) WithTx(tx *sql.Tx) BudgetRepository {
+	return &memoryBudgetRepository{r.store, true}
+}
+
+// queryBudgets returns the budgets that match with their category's name,
+// in the order given by less.
+func (d *memoryData) queryBudgets(match func(models.Budget) bool, less func(a, b models.Budget) bool) []models.Budget {
+	budgets := []models.Budget{}
+	for _, budget := range d.budgets {
+		if match(budget) {
+			budget.CategoryName = d.categories[budget.CategoryID].Name
+			budgets = append(budgets, budget)
+		}
+	}
+	sortBy(budgets, less)
+	return budgets
+}
+
+func budgetsByCategoryName(a, b models.Budget) bool {
+	if a.CategoryName != b.CategoryName {
+		return a.CategoryName < b.CategoryName
+	}
+	return a.ID < b.ID
+}
+
+func (r *memoryBudgetRepository) GetBudget(id int) (models.Budget, error) {
+	defer r.store.lock(r.inTx)()
+
+	budget, ok := r.store.data.budgets[id]
+	if !ok {
+		return models.Budget{}, sql.ErrNoRows
+	}
+	budget.CategoryName = r.store.data.categories[budget.CategoryID].Name
+	return budget, nil
+}
+
+// GetBudgetsByMonth returns the user's budgets for the month starting on
+// month.
+func (r *memoryBudgetRepository) GetBudgetsByMonth(userID int, month time.Time) ([]models.Budget, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryBudgets(func(b models.Budget) bool {
+		return b.UserID == userID && b.Month.Equal(month)
+	}, budgetsByCategoryName), nil
+}
+
+// GetBudgetsByUserID returns all of the user's budgets, oldest month first.
+func (r *memoryBudgetRepository) GetBudgetsByUserID(userID int) ([]models.Budget, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryBudgets(func(b models.Budget) bool {
+		return b.UserID == userID
+	}, func(a, b models.Budget) bool {
+		if !a.Month.Equal(b.Month) {
+			return a.Month.Before(b.Month)
+		}
+		return budgetsByCategoryName(a, b)
+	}), nil
+}
+
+// GetBudgetByCategory returns the category's budget for the month starting
+// on month.
+func (r *memoryBudgetRepository) GetBudgetByCategory(categoryID int, month time.Time) (models.Budget, error) {
+	defer r.store.lock(r.inTx)()
+
+	budgets := r.store.data.queryBudgets(func(b models.Budget) bool {
+		return b.CategoryID == categoryID && b.Month.Equal(month)
+	}, budgetsByCategoryName)
+	if len(budgets) == 0 {
+		return models.Budget{}, sql.ErrNoRows
+	}
+	return budgets[0], nil
+}
+
+func (r *memoryBudgetRepository) CreateBudget(budget models.Budget) (models.Budget, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.categories[budget.CategoryID]; !ok {
+		return models.Budget{}, errMemoryConstraint
+	}
+	month := memoryTime(budget.Month)
+	for _, existing := range d.budgets {
+		if existing.UserID == budget.UserID && existing.CategoryID == budget.CategoryID && existing.Month.Equal(month) {
+			return models.Budget{}, errMemoryConstraint
+		}
+	}
+
+	now := memoryTime(time.Now())
+	budget.ID = d.newID("budgets")
+	budget.CreatedAt = now
+	budget.UpdatedAt = now
+	stored := budget
+	stored.CategoryName = ""
+	stored.Month = month
+	d.budgets[budget.ID] = stored
+	return budget, nil
+}
+
+func (r *memoryBudgetRepository) UpdateBudget(id int, budget models.Budget) error {
+	defer r.store.lock(r.inTx)()
+
+	existing, ok := r.store.data.budgets[id]
+	if !ok {
+		return nil
+	}
+	existing.Amount = budget.Amount
+	existing.Rollover = budget.Rollover
+	existing.UpdatedAt = memoryTime(budget.UpdatedAt)
+	r.store.data.budgets[id] = existing
+	return nil
+}
+
+func (r *memoryBudgetRepository) DeleteBudget(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	delete(r.store.data.budgets, id)
+	return nil
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryCategoryRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryCategoryRepository) WithTx(tx *sql.Tx) CategoryRepository {
+	return &memoryCategoryRepository{r.store, true}
+}
+
+func (r *memoryCategoryRepository) GetCategory(id int) (models.Category, error) {
+	defer r.store.lock(r.inTx)()
+
+	category, ok := r.store.data.categories[id]
+	if !ok {
+		return models.Category{}, sql.ErrNoRows
+	}
+	category.ParentID = memoryIntPtr(category.ParentID)
+	return category, nil
+}
+
+func (r *memoryCategoryRepository) GetCategoriesByUserID(userID int) ([]models.Category, error) {
+	defer r.store.lock(r.inTx)()
+
+	categories := []models.Category{}
+	for _, category := range r.store.data.categories {
+		if category.UserID == userID {
+			category.ParentID = memoryIntPtr(category.ParentID)
+			categories = append(categories, category)
+		}
+	}
+	sortBy(categories, func(a, b models.Category) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return categories, nil
+}
+
+func (r *memoryCategoryRepository) CreateCategory(category models.Category) (models.Category, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if category.ParentID != nil {
+		if _, ok := d.categories[*category.ParentID]; !ok {
+			return models.Category{}, errMemoryConstraint
+		}
+	}
+
+	now := memoryTime(time.Now())
+	category.ID = d.newID("categories")
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	d.categories[category.ID] = models.Category{
+		ID:        category.ID,
+		UserID:    category.UserID,
+		ParentID:  memoryIntPtr(category.ParentID),
+		Name:      category.Name,
+		Kind:      category.Kind,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return category, nil
+}
+
+func (r *memoryCategoryRepository) UpdateCategory(id int, category models.Category) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.categories[id]
+	if !ok {
+		return nil
+	}
+	if category.ParentID != nil {
+		if _, ok := d.categories[*category.ParentID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	existing.ParentID = memoryIntPtr(category.ParentID)
+	existing.Name = category.Name
+	existing.Kind = category.Kind
+	existing.UpdatedAt = memoryTime(category.UpdatedAt)
+	d.categories[id] = existing
+	return nil
+}
+
+// DeleteCategory deletes the category with its budgets and goals, and
+// clears it as a payee's default. It fails while anything else is booked
+// to it or it has subcategories.
+func (r *memoryCategoryRepository) DeleteCategory(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if d.categoryReferences(id) > 0 || d.childCategories(id) > 0 {
+		return errMemoryConstraint
+	}
+	d.deleteCategory(id)
+	return nil
+}
+
+func (d *memoryData) deleteCategory(id int) {
+	for payeeID, payee := range d.payees {
+		if payee.DefaultCategoryID != nil && *payee.DefaultCategoryID == id {
+			payee.DefaultCategoryID = nil
+			d.payees[payeeID] = payee
+		}
+	}
+	for budgetID, budget := range d.budgets {
+		if budget.CategoryID == id {
+			delete(d.budgets, budgetID)
+		}
+	}
+	for goalID, goal := range d.goals {
+		if goal.CategoryID != nil && *goal.CategoryID == id {
+			delete(d.goals, goalID)
+		}
+	}
+	delete(d.categories, id)
+}
+
+func (r *memoryCategoryRepository) CountChildCategories(id int) (int, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.childCategories(id), nil
+}
+
+func (d *memoryData) childCategories(id int) int {
+	count := 0
+	for _, category := range d.categories {
+		if category.ParentID != nil && *category.ParentID == id {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryEnvelopeRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryEnvelopeRepository) WithTx(tx *sql.Tx) EnvelopeRepository {
+	return &memoryEnvelopeRepository{r.store, true}
+}
+
+// GetAssignments returns the user's assignment changes for the months
+// starting from from to to, both included, oldest first.
+func (r *memoryEnvelopeRepository) GetAssignments(userID int, from time.Time, to time.Time) ([]models.EnvelopeAssignment, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	assignments := []models.EnvelopeAssignment{}
+	for _, assignment := range d.envelopeAssignments {
+		if assignment.UserID == userID && !assignment.Month.Before(from) && !assignment.Month.After(to) {
+			assignment.CategoryName = d.categories[assignment.CategoryID].Name
+			assignments = append(assignments, assignment)
+		}
+	}
+	sortBy(assignments, func(a, b models.EnvelopeAssignment) bool {
+		if !a.Month.Equal(b.Month) {
+			return a.Month.Before(b.Month)
+		}
+		return a.ID < b.ID
+	})
+	return assignments, nil
+}
+
+func (r *memoryEnvelopeRepository) CreateAssignment(assignment models.EnvelopeAssignment) (models.EnvelopeAssignment, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.categories[assignment.CategoryID]; !ok {
+		return models.EnvelopeAssignment{}, errMemoryConstraint
+	}
+
+	assignment.ID = d.newID("envelope_assignments")
+	assignment.CreatedAt = memoryTime(time.Now())
+	stored := assignment
+	stored.CategoryName = ""
+	stored.Month = memoryTime(assignment.Month)
+	d.envelopeAssignments[assignment.ID] = stored
+	return assignment, nil
+}
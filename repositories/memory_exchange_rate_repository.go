@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryExchangeRateRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryExchangeRateRepository) WithTx(tx *sql.Tx) ExchangeRateRepository {
+	return &memoryExchangeRateRepository{r.store, true}
+}
+
+// SaveExchangeRate stores the rate, replacing any rate already stored for
+// the same pair and date.
+func (r *memoryExchangeRateRepository) SaveExchangeRate(rate models.ExchangeRate) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	rate.Date = memoryTime(rate.Date)
+	for id, existing := range d.exchangeRates {
+		if existing.Base == rate.Base && existing.Quote == rate.Quote && existing.Date.Equal(rate.Date) {
+			existing.Rate = rate.Rate
+			existing.Source = rate.Source
+			d.exchangeRates[id] = existing
+			return nil
+		}
+	}
+
+	rate.ID = d.newID("exchange_rates")
+	rate.CreatedAt = memoryTime(time.Now())
+	d.exchangeRates[rate.ID] = rate
+	return nil
+}
+
+// sortExchangeRates sorts rates by date, then base and quote currency.
+func sortExchangeRates(rates []models.ExchangeRate) {
+	sortBy(rates, func(a, b models.ExchangeRate) bool {
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Base != b.Base {
+			return a.Base < b.Base
+		}
+		return a.Quote < b.Quote
+	})
+}
+
+// GetLatestExchangeRates returns, for every currency pair, the most recent
+// rate dated on or before on.
+func (r *memoryExchangeRateRepository) GetLatestExchangeRates(on time.Time) ([]models.ExchangeRate, error) {
+	defer r.store.lock(r.inTx)()
+
+	type pair struct{ base, quote string }
+	latest := map[pair]models.ExchangeRate{}
+	for _, rate := range r.store.data.exchangeRates {
+		if rate.Date.After(on) {
+			continue
+		}
+		key := pair{rate.Base, rate.Quote}
+		if existing, ok := latest[key]; !ok || rate.Date.After(existing.Date) {
+			latest[key] = rate
+		}
+	}
+
+	rates := []models.ExchangeRate{}
+	for _, rate := range latest {
+		rates = append(rates, rate)
+	}
+	sortBy(rates, func(a, b models.ExchangeRate) bool {
+		if a.Base != b.Base {
+			return a.Base < b.Base
+		}
+		return a.Quote < b.Quote
+	})
+	return rates, nil
+}
+
+func (r *memoryExchangeRateRepository) GetExchangeRatesByCurrencies(currencies []string, from time.Time) ([]models.ExchangeRate, error) {
+	defer r.store.lock(r.inTx)()
+
+	wanted := map[string]bool{}
+	for _, currency := range currencies {
+		wanted[currency] = true
+	}
+
+	rates := []models.ExchangeRate{}
+	for _, rate := range r.store.data.exchangeRates {
+		if !rate.Date.Before(from) && (wanted[rate.Base] || wanted[rate.Quote]) {
+			rates = append(rates, rate)
+		}
+	}
+	sortExchangeRates(rates)
+	return rates, nil
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryGoalRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryGoalRepository) WithTx(tx *sql.Tx) GoalRepository {
+	return &memoryGoalRepository{r.store, true}
+}
+
+// goalRow fills in the name of the account or category the goal tracks.
+func (d *memoryData) goalRow(goal models.Goal) models.Goal {
+	goal.AccountID = memoryIntPtr(goal.AccountID)
+	goal.CategoryID = memoryIntPtr(goal.CategoryID)
+	goal.LinkedName = ""
+	if goal.AccountID != nil {
+		goal.LinkedName = d.accounts[*goal.AccountID].Name
+	} else if goal.CategoryID != nil {
+		goal.LinkedName = d.categories[*goal.CategoryID].Name
+	}
+	return goal
+}
+
+func (r *memoryGoalRepository) GetGoal(id int) (models.Goal, error) {
+	defer r.store.lock(r.inTx)()
+
+	goal, ok := r.store.data.goals[id]
+	if !ok {
+		return models.Goal{}, sql.ErrNoRows
+	}
+	return r.store.data.goalRow(goal), nil
+}
+
+// GetGoalsByUserID returns the user's goals, the soonest due first.
+func (r *memoryGoalRepository) GetGoalsByUserID(userID int) ([]models.Goal, error) {
+	defer r.store.lock(r.inTx)()
+
+	goals := []models.Goal{}
+	for _, goal := range r.store.data.goals {
+		if goal.UserID == userID {
+			goals = append(goals, r.store.data.goalRow(goal))
+		}
+	}
+	sortBy(goals, func(a, b models.Goal) bool {
+		if !a.TargetMonth.Equal(b.TargetMonth) {
+			return a.TargetMonth.Before(b.TargetMonth)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return goals, nil
+}
+
+// checkGoalReferences fails like the foreign keys of the goals table would.
+func (d *memoryData) checkGoalReferences(goal models.Goal) error {
+	if goal.AccountID != nil {
+		if _, ok := d.accounts[*goal.AccountID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	if goal.CategoryID != nil {
+		if _, ok := d.categories[*goal.CategoryID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	return nil
+}
+
+func (r *memoryGoalRepository) CreateGoal(goal models.Goal) (models.Goal, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if err := d.checkGoalReferences(goal); err != nil {
+		return models.Goal{}, err
+	}
+
+	now := memoryTime(time.Now())
+	goal.ID = d.newID("goals")
+	goal.CreatedAt = now
+	goal.UpdatedAt = now
+	stored := goal
+	stored.LinkedName = ""
+	stored.TargetMonth = memoryTime(goal.TargetMonth)
+	stored.AccountID = memoryIntPtr(goal.AccountID)
+	stored.CategoryID = memoryIntPtr(goal.CategoryID)
+	d.goals[goal.ID] = stored
+	return goal, nil
+}
+
+func (r *memoryGoalRepository) UpdateGoal(id int, goal models.Goal) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.goals[id]
+	if !ok {
+		return nil
+	}
+	if err := d.checkGoalReferences(goal); err != nil {
+		return err
+	}
+	existing.Name = goal.Name
+	existing.Target = goal.Target
+	existing.TargetMonth = memoryTime(goal.TargetMonth)
+	existing.AccountID = memoryIntPtr(goal.AccountID)
+	existing.CategoryID = memoryIntPtr(goal.CategoryID)
+	existing.UpdatedAt = memoryTime(goal.UpdatedAt)
+	d.goals[id] = existing
+	return nil
+}
+
+func (r *memoryGoalRepository) DeleteGoal(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	delete(r.store.data.goals, id)
+	return nil
+}
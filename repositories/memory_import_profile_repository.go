@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryImportProfileRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryImportProfileRepository) WithTx(tx *sql.Tx) ImportProfileRepository {
+	return &memoryImportProfileRepository{r.store, true}
+}
+
+// importProfileRow copies the profile's optional columns, so that callers
+// cannot change the stored row through them.
+func importProfileRow(profile models.ImportProfile) models.ImportProfile {
+	profile.CreditColumn = memoryIntPtr(profile.CreditColumn)
+	profile.PayeeColumn = memoryIntPtr(profile.PayeeColumn)
+	profile.MemoColumn = memoryIntPtr(profile.MemoColumn)
+	return profile
+}
+
+func (r *memoryImportProfileRepository) GetImportProfile(id int) (models.ImportProfile, error) {
+	defer r.store.lock(r.inTx)()
+
+	profile, ok := r.store.data.importProfiles[id]
+	if !ok {
+		return models.ImportProfile{}, sql.ErrNoRows
+	}
+	return importProfileRow(profile), nil
+}
+
+func (r *memoryImportProfileRepository) GetImportProfileByName(userID int, name string) (models.ImportProfile, error) {
+	defer r.store.lock(r.inTx)()
+
+	for _, profile := range r.store.data.importProfiles {
+		if profile.UserID == userID && profile.Name == name {
+			return importProfileRow(profile), nil
+		}
+	}
+	return models.ImportProfile{}, sql.ErrNoRows
+}
+
+func (r *memoryImportProfileRepository) GetImportProfilesByUserID(userID int) ([]models.ImportProfile, error) {
+	defer r.store.lock(r.inTx)()
+
+	profiles := []models.ImportProfile{}
+	for _, profile := range r.store.data.importProfiles {
+		if profile.UserID == userID {
+			profiles = append(profiles, importProfileRow(profile))
+		}
+	}
+	sortBy(profiles, func(a, b models.ImportProfile) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return profiles, nil
+}
+
+// importProfileNameTaken reports whether another of the user's profiles has the name.
+func (d *memoryData) importProfileNameTaken(id int, userID int, name string) bool {
+	for _, profile := range d.importProfiles {
+		if profile.ID != id && profile.UserID == userID && profile.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryImportProfileRepository) CreateImportProfile(profile models.ImportProfile) (models.ImportProfile, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if d.importProfileNameTaken(0, profile.UserID, profile.Name) {
+		return models.ImportProfile{}, errMemoryConstraint
+	}
+
+	now := memoryTime(time.Now())
+	profile.ID = d.newID("import_profiles")
+	profile.CreatedAt = now
+	profile.UpdatedAt = now
+	d.importProfiles[profile.ID] = importProfileRow(profile)
+	return profile, nil
+}
+
+func (r *memoryImportProfileRepository) UpdateImportProfile(id int, profile models.ImportProfile) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.importProfiles[id]
+	if !ok {
+		return nil
+	}
+	if d.importProfileNameTaken(id, existing.UserID, profile.Name) {
+		return errMemoryConstraint
+	}
+
+	profile.ID = existing.ID
+	profile.UserID = existing.UserID
+	profile.CreatedAt = existing.CreatedAt
+	profile.UpdatedAt = memoryTime(profile.UpdatedAt)
+	d.importProfiles[id] = importProfileRow(profile)
+	return nil
+}
+
+func (r *memoryImportProfileRepository) DeleteImportProfile(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	delete(r.store.data.importProfiles, id)
+	return nil
+}
@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryPayeeRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryPayeeRepository) WithTx(tx *sql.Tx) PayeeRepository {
+	return &memoryPayeeRepository{r.store, true}
+}
+
+// payeeRow fills in the default category's name and the aliases, sorted
+// like the SQL repository's.
+func (d *memoryData) payeeRow(payee models.Payee) models.Payee {
+	payee.DefaultCategoryID = memoryIntPtr(payee.DefaultCategoryID)
+	payee.DefaultCategoryName = ""
+	if payee.DefaultCategoryID != nil {
+		payee.DefaultCategoryName = d.categories[*payee.DefaultCategoryID].Name
+	}
+
+	aliases := []memoryPayeeAlias{}
+	for _, alias := range d.payeeAliases {
+		if alias.PayeeID == payee.ID {
+			aliases = append(aliases, alias)
+		}
+	}
+	sortBy(aliases, func(a, b memoryPayeeAlias) bool {
+		if a.Alias != b.Alias {
+			return a.Alias < b.Alias
+		}
+		return a.ID < b.ID
+	})
+
+	payee.Aliases = []string{}
+	for _, alias := range aliases {
+		payee.Aliases = append(payee.Aliases, alias.Alias)
+	}
+	return payee
+}
+
+func (r *memoryPayeeRepository) GetPayee(id int) (models.Payee, error) {
+	defer r.store.lock(r.inTx)()
+
+	payee, ok := r.store.data.payees[id]
+	if !ok {
+		return models.Payee{}, sql.ErrNoRows
+	}
+	return r.store.data.payeeRow(payee), nil
+}
+
+// GetPayeeByAliasKey returns the user's payee known by the normalized
+// spelling key.
+func (r *memoryPayeeRepository) GetPayeeByAliasKey(userID int, key string) (models.Payee, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	for _, alias := range d.payeeAliases {
+		if alias.UserID == userID && alias.Key == key {
+			return d.payeeRow(d.payees[alias.PayeeID]), nil
+		}
+	}
+	return models.Payee{}, sql.ErrNoRows
+}
+
+func (r *memoryPayeeRepository) GetPayeesByUserID(userID int) ([]models.Payee, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	payees := []models.Payee{}
+	for _, payee := range d.payees {
+		if payee.UserID == userID {
+			payees = append(payees, d.payeeRow(payee))
+		}
+	}
+	sortBy(payees, func(a, b models.Payee) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return payees, nil
+}
+
+func (r *memoryPayeeRepository) CreatePayee(payee models.Payee) (models.Payee, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if payee.DefaultCategoryID != nil {
+		if _, ok := d.categories[*payee.DefaultCategoryID]; !ok {
+			return models.Payee{}, errMemoryConstraint
+		}
+	}
+
+	now := memoryTime(time.Now())
+	payee.ID = d.newID("payees")
+	payee.CreatedAt = now
+	payee.UpdatedAt = now
+	d.payees[payee.ID] = models.Payee{
+		ID:                payee.ID,
+		UserID:            payee.UserID,
+		Name:              payee.Name,
+		DefaultCategoryID: memoryIntPtr(payee.DefaultCategoryID),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	return payee, nil
+}
+
+func (r *memoryPayeeRepository) UpdatePayee(id int, payee models.Payee) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.payees[id]
+	if !ok {
+		return nil
+	}
+	if payee.DefaultCategoryID != nil {
+		if _, ok := d.categories[*payee.DefaultCategoryID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	existing.Name = payee.Name
+	existing.DefaultCategoryID = memoryIntPtr(payee.DefaultCategoryID)
+	existing.UpdatedAt = memoryTime(payee.UpdatedAt)
+	d.payees[id] = existing
+	return nil
+}
+
+// DeletePayee deletes the payee with its aliases. It fails while
+// transactions are booked to it.
+func (r *memoryPayeeRepository) DeletePayee(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if d.payeeReferences(id) > 0 {
+		return errMemoryConstraint
+	}
+	for aliasID, alias := range d.payeeAliases {
+		if alias.PayeeID == id {
+			delete(d.payeeAliases, aliasID)
+		}
+	}
+	delete(d.payees, id)
+	return nil
+}
+
+func (r *memoryPayeeRepository) AddPayeeAlias(userID int, payeeID int, alias string, key string) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.payees[payeeID]; !ok {
+		return errMemoryConstraint
+	}
+	for _, existing := range d.payeeAliases {
+		if existing.UserID == userID && existing.Key == key {
+			return errMemoryConstraint
+		}
+	}
+
+	id := d.newID("payee_aliases")
+	d.payeeAliases[id] = memoryPayeeAlias{ID: id, UserID: userID, PayeeID: payeeID, Alias: alias, Key: key}
+	return nil
+}
+
+func (r *memoryPayeeRepository) DeletePayeeAliases(payeeID int) error {
+	defer r.store.lock(r.inTx)()
+
+	for id, alias := range r.store.data.payeeAliases {
+		if alias.PayeeID == payeeID {
+			delete(r.store.data.payeeAliases, id)
+		}
+	}
+	return nil
+}
+
+// MovePayeeAliases hands all aliases of one payee over to another.
+func (r *memoryPayeeRepository) MovePayeeAliases(fromID int, toID int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	for id, alias := range d.payeeAliases {
+		if alias.PayeeID == fromID {
+			alias.PayeeID = toID
+			d.payeeAliases[id] = alias
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type memoryRecurringRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryRecurringRepository) WithTx(tx *sql.Tx) RecurringRepository {
+	return &memoryRecurringRepository{r.store, true}
+}
+
+// recurringRow fills in the names of the template's account and category.
+func (d *memoryData) recurringRow(recurring models.RecurringTransaction) models.RecurringTransaction {
+	recurring.AccountName = d.accounts[recurring.AccountID].Name
+	recurring.CategoryName = d.categories[recurring.CategoryID].Name
+	recurring.NextDate = memoryTimePtr(recurring.NextDate)
+	return recurring
+}
+
+// queryRecurring returns the templates that match, ordered by their next
+// date with finished templates last.
+func (d *memoryData) queryRecurring(match func(models.RecurringTransaction) bool) []models.RecurringTransaction {
+	templates := []models.RecurringTransaction{}
+	for _, recurring := range d.recurring {
+		if match(recurring) {
+			templates = append(templates, d.recurringRow(recurring))
+		}
+	}
+	sortBy(templates, func(a, b models.RecurringTransaction) bool {
+		switch {
+		case a.NextDate == nil && b.NextDate == nil:
+		case a.NextDate == nil:
+			return false
+		case b.NextDate == nil:
+			return true
+		case !a.NextDate.Equal(*b.NextDate):
+			return a.NextDate.Before(*b.NextDate)
+		}
+		return a.ID < b.ID
+	})
+	return templates
+}
+
+func (r *memoryRecurringRepository) GetRecurringTransaction(id int) (models.RecurringTransaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	recurring, ok := r.store.data.recurring[id]
+	if !ok {
+		return models.RecurringTransaction{}, sql.ErrNoRows
+	}
+	return r.store.data.recurringRow(recurring), nil
+}
+
+// LockRecurringTransaction reads the template. The transaction holding the
+// store already keeps out every other writer.
+func (r *memoryRecurringRepository) LockRecurringTransaction(id int) (models.RecurringTransaction, error) {
+	return r.GetRecurringTransaction(id)
+}
+
+func (r *memoryRecurringRepository) GetRecurringTransactionsByUserID(userID int) ([]models.RecurringTransaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryRecurring(func(recurring models.RecurringTransaction) bool {
+		return recurring.UserID == userID
+	}), nil
+}
+
+// GetDueRecurringTransactions returns every user's templates with a date
+// not posted yet on or before on.
+func (r *memoryRecurringRepository) GetDueRecurringTransactions(on time.Time) ([]models.RecurringTransaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryRecurring(func(recurring models.RecurringTransaction) bool {
+		return recurring.NextDate != nil && !recurring.NextDate.After(on)
+	}), nil
+}
+
+// checkRecurringReferences fails like the foreign keys of the
+// recurring_transactions table would.
+func (d *memoryData) checkRecurringReferences(recurring models.RecurringTransaction) error {
+	if _, ok := d.accounts[recurring.AccountID]; !ok {
+		return errMemoryConstraint
+	}
+	if _, ok := d.categories[recurring.CategoryID]; !ok {
+		return errMemoryConstraint
+	}
+	return nil
+}
+
+func (r *memoryRecurringRepository) CreateRecurringTransaction(recurring models.RecurringTransaction) (models.RecurringTransaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if err := d.checkRecurringReferences(recurring); err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	now := memoryTime(time.Now())
+	recurring.ID = d.newID("recurring_transactions")
+	recurring.CreatedAt = now
+	recurring.UpdatedAt = now
+	stored := recurring
+	stored.AccountName = ""
+	stored.CategoryName = ""
+	stored.StartDate = memoryTime(recurring.StartDate)
+	stored.NextDate = memoryTimePtr(recurring.NextDate)
+	d.recurring[recurring.ID] = stored
+	return recurring, nil
+}
+
+func (r *memoryRecurringRepository) UpdateRecurringTransaction(id int, recurring models.RecurringTransaction) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.recurring[id]
+	if !ok {
+		return nil
+	}
+	existing.AccountID = recurring.AccountID
+	existing.CategoryID = recurring.CategoryID
+	if err := d.checkRecurringReferences(existing); err != nil {
+		return err
+	}
+	existing.PayeeName = recurring.PayeeName
+	existing.Amount = recurring.Amount
+	existing.Memo = recurring.Memo
+	existing.Rule = recurring.Rule
+	existing.StartDate = memoryTime(recurring.StartDate)
+	existing.NextDate = memoryTimePtr(recurring.NextDate)
+	existing.UpdatedAt = memoryTime(recurring.UpdatedAt)
+	d.recurring[id] = existing
+	return nil
+}
+
+func (r *memoryRecurringRepository) DeleteRecurringTransaction(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	r.store.data.deleteRecurring(id)
+	return nil
+}
+
+// deleteRecurring deletes the template with its stored dates.
+func (d *memoryData) deleteRecurring(id int) {
+	for key := range d.occurrences {
+		if key.RecurringID == id {
+			delete(d.occurrences, key)
+		}
+	}
+	delete(d.recurring, id)
+}
+
+// GetOccurrences returns the template's posted, skipped and edited dates
+// from from to to, both included.
+func (r *memoryRecurringRepository) GetOccurrences(recurringID int, from time.Time, to time.Time) ([]models.RecurringOccurrence, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	recurring, ok := d.recurring[recurringID]
+	if !ok {
+		return []models.RecurringOccurrence{}, nil
+	}
+
+	occurrences := []models.RecurringOccurrence{}
+	for key, stored := range d.occurrences {
+		if key.RecurringID != recurringID || key.Date.Before(from) || key.Date.After(to) {
+			continue
+		}
+		occurrence := models.RecurringOccurrence{
+			RecurringID:   recurringID,
+			Date:          key.Date,
+			Status:        stored.Status,
+			Memo:          stored.Memo,
+			TransactionID: memoryIntPtr(stored.TransactionID),
+		}
+		if stored.amount != nil {
+			amount, err := money.FromDecimal(*stored.amount, recurring.Amount.Currency())
+			if err != nil {
+				return nil, err
+			}
+			occurrence.Edited = true
+			occurrence.Amount = amount
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	sortBy(occurrences, func(a, b models.RecurringOccurrence) bool { return a.Date.Before(b.Date) })
+	return occurrences, nil
+}
+
+// SaveOccurrence stores the status of one date, replacing what was stored
+// for it. The amount and memo are only kept for edited dates.
+func (r *memoryRecurringRepository) SaveOccurrence(occurrence models.RecurringOccurrence) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.recurring[occurrence.RecurringID]; !ok {
+		return errMemoryConstraint
+	}
+	if occurrence.TransactionID != nil {
+		if _, ok := d.transactions[*occurrence.TransactionID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+
+	stored := memoryOccurrence{RecurringOccurrence: models.RecurringOccurrence{
+		RecurringID:   occurrence.RecurringID,
+		Date:          memoryTime(occurrence.Date),
+		Status:        occurrence.Status,
+		TransactionID: memoryIntPtr(occurrence.TransactionID),
+	}}
+	if occurrence.Edited {
+		amount := occurrence.Amount.Decimal()
+		stored.amount = &amount
+		stored.Memo = occurrence.Memo
+	}
+	d.occurrences[memoryOccurrenceKey{occurrence.RecurringID, stored.Date}] = stored
+	return nil
+}
+
+func (r *memoryRecurringRepository) DeleteOccurrence(recurringID int, date time.Time) error {
+	defer r.store.lock(r.inTx)()
+
+	delete(r.store.data.occurrences, memoryOccurrenceKey{recurringID, memoryTime(date)})
+	return nil
+}
@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memorySessionRepository struct {
+	store *memoryStore
+}
+
+func (r *memorySessionRepository) GetSession(id int) (models.Session, error) {
+	defer r.store.lock(false)()
+
+	session, ok := r.store.data.sessions[id]
+	if !ok {
+		return models.Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (r *memorySessionRepository) GetSessionByTokenHash(tokenHash string) (models.Session, error) {
+	defer r.store.lock(false)()
+
+	for _, session := range r.store.data.sessions {
+		if session.TokenHash == tokenHash {
+			return session, nil
+		}
+	}
+	return models.Session{}, errors.New("session not found")
+}
+
+func (r *memorySessionRepository) CreateSession(session models.Session) (models.Session, error) {
+	defer r.store.lock(false)()
+
+	d := r.store.data
+	for _, existing := range d.sessions {
+		if existing.TokenHash == session.TokenHash {
+			return models.Session{}, errMemoryConstraint
+		}
+	}
+
+	session.ID = d.newID("sessions")
+	session.CreatedAt = memoryTime(time.Now())
+	session.ExpiresAt = memoryTime(session.ExpiresAt)
+	session.LastSeenAt = memoryTime(session.LastSeenAt)
+	session.UsedAt = sql.NullTime{}
+	session.DeletedAt = sql.NullTime{}
+	session.Current = false
+	d.sessions[session.ID] = session
+	return session, nil
+}
+
+func (r *memorySessionRepository) GetActiveSessionsByUserID(userID int, now time.Time) ([]models.Session, error) {
+	defer r.store.lock(false)()
+
+	sessions := []models.Session{}
+	for _, session := range r.store.data.sessions {
+		if session.UserID == userID && !session.UsedAt.Valid && !session.DeletedAt.Valid && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sortBy(sessions, func(a, b models.Session) bool {
+		if !a.LastSeenAt.Equal(b.LastSeenAt) {
+			return a.LastSeenAt.After(b.LastSeenAt)
+		}
+		return a.ID > b.ID
+	})
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) MarkSessionUsed(id int, usedAt time.Time) (bool, error) {
+	defer r.store.lock(false)()
+
+	session, ok := r.store.data.sessions[id]
+	if !ok || session.UsedAt.Valid {
+		return false, nil
+	}
+	session.UsedAt = sql.NullTime{Time: memoryTime(usedAt), Valid: true}
+	r.store.data.sessions[id] = session
+	return true, nil
+}
+
+func (r *memorySessionRepository) DeleteSession(id int) error {
+	defer r.store.lock(false)()
+
+	session, ok := r.store.data.sessions[id]
+	if !ok {
+		return nil
+	}
+	r.store.data.revokeSessions(func(s models.Session) bool { return s.FamilyID == session.FamilyID })
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteOtherSessions(userID int, keepFamilyID string) error {
+	defer r.store.lock(false)()
+
+	r.store.data.revokeSessions(func(s models.Session) bool { return s.UserID == userID && s.FamilyID != keepFamilyID })
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteSessionFamily(familyID string) error {
+	defer r.store.lock(false)()
+
+	r.store.data.revokeSessions(func(s models.Session) bool { return s.FamilyID == familyID })
+	return nil
+}
+
+func (d *memoryData) revokeSessions(match func(models.Session) bool) {
+	now := memoryTime(time.Now())
+	for id, session := range d.sessions {
+		if match(session) && !session.DeletedAt.Valid {
+			session.DeletedAt = sql.NullTime{Time: now, Valid: true}
+			d.sessions[id] = session
+		}
+	}
+}
+
+func (r *memorySessionRepository) SessionFamilyActive(familyID string, now time.Time) (bool, error) {
+	defer r.store.lock(false)()
+
+	for _, session := range r.store.data.sessions {
+		if session.FamilyID == familyID && !session.DeletedAt.Valid && session.ExpiresAt.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryTagRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryTagRepository) WithTx(tx *sql.Tx) TagRepository {
+	return &memoryTagRepository{r.store, true}
+}
+
+// GetTagsByUserID returns the user's tags, the most used first.
+func (r *memoryTagRepository) GetTagsByUserID(userID int) ([]models.Tag, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	counts := map[int]int{}
+	for link := range d.transactionTags {
+		counts[link.TagID]++
+	}
+
+	tags := []models.Tag{}
+	for _, tag := range d.tags {
+		if tag.UserID == userID {
+			tag.Count = counts[tag.ID]
+			tags = append(tags, tag)
+		}
+	}
+	sortBy(tags, func(a, b models.Tag) bool {
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	return tags, nil
+}
+
+func (r *memoryTagRepository) CreateTag(userID int, name string) error {
+	defer r.store.lock(r.inTx)()
+
+	r.store.data.tagID(userID, name)
+	return nil
+}
+
+// tagID returns the ID of the user's tag, creating the tag if it does not
+// exist yet.
+func (d *memoryData) tagID(userID int, name string) int {
+	for _, tag := range d.tags {
+		if tag.UserID == userID && tag.Name == name {
+			return tag.ID
+		}
+	}
+
+	id := d.newID("tags")
+	d.tags[id] = models.Tag{ID: id, UserID: userID, Name: name, CreatedAt: memoryTime(time.Now())}
+	return id
+}
@@ -0,0 +1,699 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type memoryTransactionRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryTransactionRepository) WithTx(tx *sql.Tx) TransactionRepository {
+	return &memoryTransactionRepository{r.store, true}
+}
+
+// transactionRow fills in what the SQL repository joins in: the names of the
+// account, category and payee, and the other leg of a transfer. Tags and
+// split lines are only loaded if details is set.
+func (d *memoryData) transactionRow(transaction models.Transaction, details bool) (models.Transaction, error) {
+	transaction.AccountName = d.accounts[transaction.AccountID].Name
+	transaction.CategoryName = ""
+	if transaction.CategoryID != nil {
+		transaction.CategoryName = d.categories[*transaction.CategoryID].Name
+	}
+	transaction.PayeeName = ""
+	if transaction.PayeeID != nil {
+		transaction.PayeeName = d.payees[*transaction.PayeeID].Name
+	}
+	transaction.CategoryID = memoryIntPtr(transaction.CategoryID)
+	transaction.PayeeID = memoryIntPtr(transaction.PayeeID)
+	transaction.TransferID = memoryIntPtr(transaction.TransferID)
+	transaction.ValueDate = memoryTimePtr(transaction.ValueDate)
+
+	transaction.Transfer = nil
+	if other, ok := d.otherLeg(transaction); ok {
+		transaction.Transfer = &models.TransferLeg{
+			TransactionID: other.ID,
+			AccountID:     other.AccountID,
+			AccountName:   d.accounts[other.AccountID].Name,
+			Amount:        other.Amount,
+			Rate:          d.transfers[*transaction.TransferID].Rate,
+		}
+	}
+
+	transaction.Tags = []string{}
+	transaction.Splits = []models.Split{}
+	if !details {
+		return transaction, nil
+	}
+
+	transaction.Tags = d.transactionTagNames(transaction.ID)
+	for _, split := range d.transactionSplits(transaction.ID) {
+		amount, err := money.FromDecimal(split.Amount, transaction.Amount.Currency())
+		if err != nil {
+			return models.Transaction{}, err
+		}
+		transaction.Splits = append(transaction.Splits, models.Split{
+			ID:           split.ID,
+			CategoryID:   split.CategoryID,
+			CategoryName: d.categories[split.CategoryID].Name,
+			Amount:       amount,
+			Memo:         split.Memo,
+		})
+	}
+	return transaction, nil
+}
+
+// otherLeg returns the other entry of the transfer the transaction belongs
+// to, if it is one.
+func (d *memoryData) otherLeg(transaction models.Transaction) (models.Transaction, bool) {
+	if transaction.TransferID == nil {
+		return models.Transaction{}, false
+	}
+	var other models.Transaction
+	found := false
+	for _, candidate := range d.transactions {
+		if candidate.TransferID != nil && *candidate.TransferID == *transaction.TransferID && candidate.ID != transaction.ID && (!found || candidate.ID < other.ID) {
+			other, found = candidate, true
+		}
+	}
+	return other, found
+}
+
+// transactionTagNames returns the names of the transaction's tags, sorted.
+func (d *memoryData) transactionTagNames(transactionID int) []string {
+	names := []string{}
+	for link := range d.transactionTags {
+		if link.TransactionID == transactionID {
+			names = append(names, d.tags[link.TagID].Name)
+		}
+	}
+	sortBy(names, func(a, b string) bool { return a < b })
+	return names
+}
+
+// transactionSplits returns the transaction's split lines in their original
+// order.
+func (d *memoryData) transactionSplits(transactionID int) []memorySplit {
+	splits := []memorySplit{}
+	for _, split := range d.splits {
+		if split.TransactionID == transactionID {
+			splits = append(splits, split)
+		}
+	}
+	sortBy(splits, func(a, b memorySplit) bool { return a.Position < b.Position })
+	return splits
+}
+
+// queryTransactions returns the transactions that match, in the order given
+// by less.
+func (d *memoryData) queryTransactions(match func(models.Transaction) bool, less func(a, b models.Transaction) bool, details bool) ([]models.Transaction, error) {
+	matching := []models.Transaction{}
+	for _, transaction := range d.transactions {
+		if match(transaction) {
+			matching = append(matching, transaction)
+		}
+	}
+	sortBy(matching, less)
+
+	transactions := make([]models.Transaction, len(matching))
+	for i, transaction := range matching {
+		row, err := d.transactionRow(transaction, details)
+		if err != nil {
+			return nil, err
+		}
+		transactions[i] = row
+	}
+	return transactions, nil
+}
+
+func (r *memoryTransactionRepository) GetTransaction(id int) (models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	transaction, ok := r.store.data.transactions[id]
+	if !ok {
+		return models.Transaction{}, sql.ErrNoRows
+	}
+	return r.store.data.transactionRow(transaction, true)
+}
+
+func (r *memoryTransactionRepository) GetTransactionsByUserID(userID int, filter models.TransactionFilter) ([]models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	return d.queryTransactions(d.transactionFilter(userID, filter), newestTransactionFirst, true)
+}
+
+func newestTransactionFirst(a, b models.Transaction) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	return a.ID > b.ID
+}
+
+func (r *memoryTransactionRepository) GetTransactionsPage(userID int, filter models.TransactionFilter, sort models.TransactionSort, after *models.TransactionCursor, limit int) ([]models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	byAmount := sort == models.TransactionSortAmountDesc || sort == models.TransactionSortAmountAsc
+	descending := sort != models.TransactionSortDateAsc && sort != models.TransactionSortAmountAsc
+
+	// compare orders an entry against a sort value and ID, ascending
+	compare := func(t models.Transaction, date time.Time, amount money.Decimal, id int) int {
+		c := t.Date.Compare(date)
+		if byAmount {
+			c = compareDecimals(t.Amount.Decimal(), amount)
+		}
+		if c == 0 {
+			c = t.ID - id
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}
+
+	d := r.store.data
+	match := d.transactionFilter(userID, filter)
+	if after != nil {
+		filtered := match
+		match = func(t models.Transaction) bool {
+			return filtered(t) && compare(t, after.Date, after.Amount, after.ID) > 0
+		}
+	}
+
+	transactions, err := d.queryTransactions(match, func(a, b models.Transaction) bool {
+		return compare(a, b.Date, b.Amount.Decimal(), b.ID) < 0
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// transactionFilter matches what transactionFilterWhere selects: the user's
+// entries that pass the filter, with a transfer listed by its outgoing leg.
+func (d *memoryData) transactionFilter(userID int, filter models.TransactionFilter) func(models.Transaction) bool {
+	var categories map[int]bool
+	if filter.CategoryID != nil {
+		categories = d.categorySubtree(*filter.CategoryID)
+	}
+	text := strings.ToLower(filter.Text)
+
+	return func(t models.Transaction) bool {
+		if t.UserID != userID || (t.TransferID != nil && !t.Amount.IsNegative()) {
+			return false
+		}
+		if len(filter.Tags) > 0 {
+			names := map[string]bool{}
+			for _, name := range filter.Tags {
+				names[name] = true
+			}
+			matched := 0
+			for _, name := range d.transactionTagNames(t.ID) {
+				if names[name] {
+					matched++
+				}
+			}
+			if matched != len(filter.Tags) {
+				return false
+			}
+		}
+		if filter.From != nil && t.Date.Before(*filter.From) {
+			return false
+		}
+		if filter.To != nil && !t.Date.Before(filter.To.AddDate(0, 0, 1)) {
+			return false
+		}
+		if filter.AccountID != nil && t.AccountID != *filter.AccountID {
+			other, ok := d.otherLeg(t)
+			if !ok || other.AccountID != *filter.AccountID {
+				return false
+			}
+		}
+		if filter.CategoryID != nil && (t.CategoryID == nil || !categories[*t.CategoryID]) {
+			split := false
+			for _, line := range d.transactionSplits(t.ID) {
+				split = split || categories[line.CategoryID]
+			}
+			if !split {
+				return false
+			}
+		}
+		if filter.PayeeID != nil && (t.PayeeID == nil || *t.PayeeID != *filter.PayeeID) {
+			return false
+		}
+		if filter.MinAmount != nil && compareDecimals(t.Amount.Abs().Decimal(), *filter.MinAmount) < 0 {
+			return false
+		}
+		if filter.MaxAmount != nil && compareDecimals(t.Amount.Abs().Decimal(), *filter.MaxAmount) > 0 {
+			return false
+		}
+		if text != "" {
+			payeeName := ""
+			if t.PayeeID != nil {
+				payeeName = d.payees[*t.PayeeID].Name
+			}
+			if !strings.Contains(strings.ToLower(t.Memo), text) && !strings.Contains(strings.ToLower(payeeName), text) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// categorySubtree returns the IDs of the category and all its descendants.
+func (d *memoryData) categorySubtree(id int) map[int]bool {
+	tree := map[int]bool{id: true}
+	for grown := true; grown; {
+		grown = false
+		for _, category := range d.categories {
+			if category.ParentID != nil && tree[*category.ParentID] && !tree[category.ID] {
+				tree[category.ID] = true
+				grown = true
+			}
+		}
+	}
+	return tree
+}
+
+// GetTransactionsByTransferID returns both legs of a transfer, the outgoing
+// one first.
+func (r *memoryTransactionRepository) GetTransactionsByTransferID(transferID int) ([]models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryTransactions(func(t models.Transaction) bool {
+		return t.TransferID != nil && *t.TransferID == transferID
+	}, func(a, b models.Transaction) bool {
+		if c := compareDecimals(a.Amount.Decimal(), b.Amount.Decimal()); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	}, false)
+}
+
+// GetTransactionsByAccountIDBetween returns the account's entries dated from
+// from up to, but not including, to, oldest first. Tags and split lines are
+// not loaded.
+func (r *memoryTransactionRepository) GetTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) ([]models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.queryTransactions(func(t models.Transaction) bool {
+		return t.AccountID == accountID && !t.Date.Before(from) && t.Date.Before(to)
+	}, func(a, b models.Transaction) bool {
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.ID < b.ID
+	}, false)
+}
+
+// checkTransactionReferences fails like the foreign keys of the
+// transactions table would.
+func (d *memoryData) checkTransactionReferences(transaction models.Transaction) error {
+	if _, ok := d.accounts[transaction.AccountID]; !ok {
+		return errMemoryConstraint
+	}
+	if transaction.CategoryID != nil {
+		if _, ok := d.categories[*transaction.CategoryID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	if transaction.PayeeID != nil {
+		if _, ok := d.payees[*transaction.PayeeID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	if transaction.TransferID != nil {
+		if _, ok := d.transfers[*transaction.TransferID]; !ok {
+			return errMemoryConstraint
+		}
+	}
+	return nil
+}
+
+// hasImportID reports whether another entry of the account than id has the
+// import id, which the unique index on the transactions table would refuse.
+func (d *memoryData) hasImportID(accountID int, importID string, id int) bool {
+	if importID == "" {
+		return false
+	}
+	for _, t := range d.transactions {
+		if t.AccountID == accountID && t.ImportID == importID && t.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryTransactionRepository) CreateTransaction(transaction models.Transaction) (models.Transaction, error) {
+	defer r.store.lock(r.inTx)()
+
+	if r.store.data.hasImportID(transaction.AccountID, transaction.ImportID, 0) {
+		return models.Transaction{}, errMemoryConstraint
+	}
+	return r.store.data.createTransaction(transaction)
+}
+
+func (r *memoryTransactionRepository) CreateImportedTransaction(transaction models.Transaction) (models.Transaction, bool, error) {
+	defer r.store.lock(r.inTx)()
+
+	if r.store.data.hasImportID(transaction.AccountID, transaction.ImportID, 0) {
+		return models.Transaction{}, false, nil
+	}
+	created, err := r.store.data.createTransaction(transaction)
+	if err != nil {
+		return models.Transaction{}, false, err
+	}
+	return created, true, nil
+}
+
+func (d *memoryData) createTransaction(transaction models.Transaction) (models.Transaction, error) {
+	if err := d.checkTransactionReferences(transaction); err != nil {
+		return models.Transaction{}, err
+	}
+
+	now := memoryTime(time.Now())
+	transaction.ID = d.newID("transactions")
+	transaction.CreatedAt = now
+	transaction.UpdatedAt = now
+	d.transactions[transaction.ID] = models.Transaction{
+		ID:         transaction.ID,
+		UserID:     transaction.UserID,
+		AccountID:  transaction.AccountID,
+		CategoryID: memoryIntPtr(transaction.CategoryID),
+		PayeeID:    memoryIntPtr(transaction.PayeeID),
+		Amount:     transaction.Amount,
+		Date:       memoryTime(transaction.Date),
+		ValueDate:  memoryTimePtr(transaction.ValueDate),
+		Memo:       transaction.Memo,
+		ImportID:   transaction.ImportID,
+		TransferID: memoryIntPtr(transaction.TransferID),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	return transaction, nil
+}
+
+func (r *memoryTransactionRepository) UpdateTransaction(id int, transaction models.Transaction) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.transactions[id]
+	if !ok {
+		return nil
+	}
+	existing.AccountID = transaction.AccountID
+	existing.CategoryID = memoryIntPtr(transaction.CategoryID)
+	existing.PayeeID = memoryIntPtr(transaction.PayeeID)
+	if err := d.checkTransactionReferences(existing); err != nil {
+		return err
+	}
+	if d.hasImportID(existing.AccountID, existing.ImportID, id) {
+		return errMemoryConstraint
+	}
+	existing.Amount = transaction.Amount
+	existing.Date = memoryTime(transaction.Date)
+	existing.Memo = transaction.Memo
+	existing.UpdatedAt = memoryTime(transaction.UpdatedAt)
+	d.transactions[id] = existing
+	return nil
+}
+
+// SetTransactionTags replaces the transaction's tags, creating any of the
+// user's tags that do not exist yet.
+func (r *memoryTransactionRepository) SetTransactionTags(userID int, transactionID int, names []string) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.transactions[transactionID]; !ok && len(names) > 0 {
+		return errMemoryConstraint
+	}
+	for link := range d.transactionTags {
+		if link.TransactionID == transactionID {
+			delete(d.transactionTags, link)
+		}
+	}
+
+	for _, name := range names {
+		link := memoryTransactionTag{TransactionID: transactionID, TagID: d.tagID(userID, name)}
+		if d.transactionTags[link] {
+			return errMemoryConstraint
+		}
+		d.transactionTags[link] = true
+	}
+	return nil
+}
+
+// SetTransactionSplits replaces the transaction's split lines. The amounts
+// are stored without their currency, which is the transaction's.
+func (r *memoryTransactionRepository) SetTransactionSplits(transactionID int, splits []models.Split) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	if _, ok := d.transactions[transactionID]; !ok && len(splits) > 0 {
+		return errMemoryConstraint
+	}
+	for id, split := range d.splits {
+		if split.TransactionID == transactionID {
+			delete(d.splits, id)
+		}
+	}
+
+	for i, split := range splits {
+		if _, ok := d.categories[split.CategoryID]; !ok {
+			return errMemoryConstraint
+		}
+		id := d.newID("transaction_splits")
+		d.splits[id] = memorySplit{ID: id, TransactionID: transactionID, CategoryID: split.CategoryID, Amount: split.Amount.Decimal(), Memo: split.Memo, Position: i}
+	}
+	return nil
+}
+
+func (r *memoryTransactionRepository) DeleteTransaction(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	r.store.data.deleteTransaction(id)
+	return nil
+}
+
+// deleteTransaction deletes the entry with its split lines and tags, and
+// unlinks the recurring date it was posted for.
+func (d *memoryData) deleteTransaction(id int) {
+	for splitID, split := range d.splits {
+		if split.TransactionID == id {
+			delete(d.splits, splitID)
+		}
+	}
+	for link := range d.transactionTags {
+		if link.TransactionID == id {
+			delete(d.transactionTags, link)
+		}
+	}
+	for key, occurrence := range d.occurrences {
+		if occurrence.TransactionID != nil && *occurrence.TransactionID == id {
+			occurrence.TransactionID = nil
+			d.occurrences[key] = occurrence
+		}
+	}
+	delete(d.transactions, id)
+}
+
+// sumTransactions adds up the amounts of the entries that match.
+func (d *memoryData) sumTransactions(match func(models.Transaction) bool) (money.Decimal, error) {
+	amounts := []money.Decimal{}
+	for _, transaction := range d.transactions {
+		if match(transaction) {
+			amounts = append(amounts, transaction.Amount.Decimal())
+		}
+	}
+	return sumDecimals(amounts...)
+}
+
+// SumTransactionsByAccountID returns the total of the account's ledger
+// entries, excluding its opening balance.
+func (r *memoryTransactionRepository) SumTransactionsByAccountID(accountID int) (money.Decimal, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.sumTransactions(func(t models.Transaction) bool { return t.AccountID == accountID })
+}
+
+// SumTransactionsByAccountIDBetween totals the account's entries dated from
+// from up to, but not including, to.
+func (r *memoryTransactionRepository) SumTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) (money.Decimal, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.sumTransactions(func(t models.Transaction) bool {
+		return t.AccountID == accountID && !t.Date.Before(from) && t.Date.Before(to)
+	})
+}
+
+// SumTransactionsBefore totals the user's entries dated before the given
+// time, per currency.
+func (r *memoryTransactionRepository) SumTransactionsBefore(userID int, before time.Time) ([]money.Money, error) {
+	defer r.store.lock(r.inTx)()
+
+	amounts := map[string][]money.Decimal{}
+	for _, transaction := range r.store.data.transactions {
+		if transaction.UserID == userID && transaction.Date.Before(before) {
+			currency := transaction.Amount.Currency()
+			amounts[currency] = append(amounts[currency], transaction.Amount.Decimal())
+		}
+	}
+
+	sums := []money.Money{}
+	for currency, decimals := range amounts {
+		total, err := sumDecimals(decimals...)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := money.FromDecimal(total, currency)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, sum)
+	}
+	sortBy(sums, func(a, b money.Money) bool { return a.Currency() < b.Currency() })
+	return sums, nil
+}
+
+func (r *memoryTransactionRepository) CountTransactionsByAccountID(accountID int) (int, error) {
+	defer r.store.lock(r.inTx)()
+
+	count := 0
+	for _, transaction := range r.store.data.transactions {
+		if transaction.AccountID == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryTransactionRepository) CountTransactionsByCategoryID(categoryID int) (int, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.categoryReferences(categoryID), nil
+}
+
+// categoryReferences counts the transactions, split lines, recurring
+// transactions and envelope assignments booked to the category.
+func (d *memoryData) categoryReferences(categoryID int) int {
+	count := 0
+	for _, transaction := range d.transactions {
+		if transaction.CategoryID != nil && *transaction.CategoryID == categoryID {
+			count++
+		}
+	}
+	for _, split := range d.splits {
+		if split.CategoryID == categoryID {
+			count++
+		}
+	}
+	for _, recurring := range d.recurring {
+		if recurring.CategoryID == categoryID {
+			count++
+		}
+	}
+	for _, assignment := range d.envelopeAssignments {
+		if assignment.CategoryID == categoryID {
+			count++
+		}
+	}
+	return count
+}
+
+// GetCategoryTotals sums the user's entries per category and currency for
+// dates in [from, to). Split transactions count by their split lines.
+func (r *memoryTransactionRepository) GetCategoryTotals(userID int, from time.Time, to time.Time) ([]models.CategoryTotal, error) {
+	defer r.store.lock(r.inTx)()
+
+	type key struct {
+		categoryID int
+		currency   string
+	}
+	d := r.store.data
+	amounts := map[key][]money.Decimal{}
+	for _, transaction := range d.transactions {
+		if transaction.UserID != userID || transaction.Date.Before(from) || !transaction.Date.Before(to) {
+			continue
+		}
+		currency := transaction.Amount.Currency()
+		if transaction.CategoryID != nil {
+			k := key{*transaction.CategoryID, currency}
+			amounts[k] = append(amounts[k], transaction.Amount.Decimal())
+		}
+		for _, split := range d.transactionSplits(transaction.ID) {
+			k := key{split.CategoryID, currency}
+			amounts[k] = append(amounts[k], split.Amount)
+		}
+	}
+
+	totals := []models.CategoryTotal{}
+	for k, decimals := range amounts {
+		category, ok := d.categories[k.categoryID]
+		if !ok || category.Kind == models.CategoryKindAdjustment {
+			continue
+		}
+		sum, err := sumDecimals(decimals...)
+		if err != nil {
+			return nil, err
+		}
+		total, err := money.FromDecimal(sum, k.currency)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, models.CategoryTotal{CategoryID: category.ID, CategoryName: category.Name, Kind: category.Kind, Total: total})
+	}
+	sortBy(totals, func(a, b models.CategoryTotal) bool {
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.CategoryName != b.CategoryName {
+			return a.CategoryName < b.CategoryName
+		}
+		if a.Total.Currency() != b.Total.Currency() {
+			return a.Total.Currency() < b.Total.Currency()
+		}
+		return a.CategoryID < b.CategoryID
+	})
+	return totals, nil
+}
+
+func (r *memoryTransactionRepository) CountTransactionsByPayeeID(payeeID int) (int, error) {
+	defer r.store.lock(r.inTx)()
+
+	return r.store.data.payeeReferences(payeeID), nil
+}
+
+func (d *memoryData) payeeReferences(payeeID int) int {
+	count := 0
+	for _, transaction := range d.transactions {
+		if transaction.PayeeID != nil && *transaction.PayeeID == payeeID {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *memoryTransactionRepository) ReassignPayee(fromID int, toID int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	for id, transaction := range d.transactions {
+		if transaction.PayeeID != nil && *transaction.PayeeID == fromID {
+			transaction.PayeeID = &toID
+			d.transactions[id] = transaction
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+)
+
+type memoryTransferRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryTransferRepository) WithTx(tx *sql.Tx) TransferRepository {
+	return &memoryTransferRepository{r.store, true}
+}
+
+// CreateTransfer stores the transfer's user and rate, the only columns of
+// the transfers table.
+func (r *memoryTransferRepository) CreateTransfer(transfer models.Transfer) (models.Transfer, error) {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	transfer.ID = d.newID("transfers")
+	transfer.CreatedAt = memoryTime(time.Now())
+	d.transfers[transfer.ID] = models.Transfer{ID: transfer.ID, UserID: transfer.UserID, Rate: transfer.Rate, CreatedAt: transfer.CreatedAt}
+	return transfer, nil
+}
+
+// DeleteTransfer deletes the transfer together with its two legs.
+func (r *memoryTransferRepository) DeleteTransfer(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	for transactionID, transaction := range d.transactions {
+		if transaction.TransferID != nil && *transaction.TransferID == id {
+			d.deleteTransaction(transactionID)
+		}
+	}
+	delete(d.transfers, id)
+	return nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type memoryUserRepository struct {
+	store *memoryStore
+	inTx  bool
+}
+
+// WithTx returns a copy of the repository for use inside the store's
+// transaction.
+func (r *memoryUserRepository) WithTx(tx *sql.Tx) UserRepository {
+	return &memoryUserRepository{r.store, true}
+}
+
+func (r *memoryUserRepository) GetUser(id int) (models.User, error) {
+	defer r.store.lock(r.inTx)()
+
+	user, ok := r.store.data.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) GetUserByUsername(username string) (models.User, error) {
+	defer r.store.lock(r.inTx)()
+
+	for _, user := range r.store.data.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (r *memoryUserRepository) CreateUser(user models.User) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	for _, existing := range d.users {
+		if existing.Username == user.Username {
+			return errMemoryConstraint
+		}
+	}
+
+	user.ID = d.newID("users")
+	user.BaseCurrency = "JPY"
+	user.EnvelopeStart = nil
+	user.CreatedAt = memoryTime(user.CreatedAt)
+	user.UpdatedAt = memoryTime(user.UpdatedAt)
+	d.users[user.ID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateUser(id int, user models.User) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	existing, ok := d.users[id]
+	if !ok {
+		return nil
+	}
+	for _, other := range d.users {
+		if other.ID != id && other.Username == user.Username {
+			return errMemoryConstraint
+		}
+	}
+
+	existing.Username = user.Username
+	existing.Password = user.Password
+	existing.BaseCurrency = user.BaseCurrency
+	existing.EnvelopeStart = memoryTimePtr(user.EnvelopeStart)
+	existing.UpdatedAt = memoryTime(user.UpdatedAt)
+	d.users[id] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) DeleteUser(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	d := r.store.data
+	d.deleteUserData(id)
+	for sessionID, session := range d.sessions {
+		if session.UserID == id {
+			delete(d.sessions, sessionID)
+		}
+	}
+	delete(d.users, id)
+	return nil
+}
+
+func (r *memoryUserRepository) DeleteUserData(id int) error {
+	defer r.store.lock(r.inTx)()
+
+	r.store.data.deleteUserData(id)
+	return nil
+}
+
+// deleteUserData deletes what the user owns, the way the foreign keys
+// cascade in the database.
+func (d *memoryData) deleteUserData(userID int) {
+	for id, transaction := range d.transactions {
+		if transaction.UserID == userID {
+			d.deleteTransaction(id)
+		}
+	}
+	for id, transfer := range d.transfers {
+		if transfer.UserID == userID {
+			delete(d.transfers, id)
+		}
+	}
+	for id, recurring := range d.recurring {
+		if recurring.UserID == userID {
+			d.deleteRecurring(id)
+		}
+	}
+	for id, budget := range d.budgets {
+		if budget.UserID == userID {
+			delete(d.budgets, id)
+		}
+	}
+	for id, assignment := range d.envelopeAssignments {
+		if assignment.UserID == userID {
+			delete(d.envelopeAssignments, id)
+		}
+	}
+	for id, goal := range d.goals {
+		if goal.UserID == userID {
+			delete(d.goals, id)
+		}
+	}
+	for id, profile := range d.importProfiles {
+		if profile.UserID == userID {
+			delete(d.importProfiles, id)
+		}
+	}
+	for id, alias := range d.payeeAliases {
+		if alias.UserID == userID {
+			delete(d.payeeAliases, id)
+		}
+	}
+	for id, payee := range d.payees {
+		if payee.UserID == userID {
+			delete(d.payees, id)
+		}
+	}
+	for id, tag := range d.tags {
+		if tag.UserID == userID {
+			delete(d.tags, id)
+		}
+	}
+	for id, balance := range d.balances {
+		if balance.UserID == userID {
+			delete(d.balances, id)
+		}
+	}
+	for id, account := range d.accounts {
+		if account.UserID == userID {
+			delete(d.accounts, id)
+		}
+	}
+	for id, category := range d.categories {
+		if category.UserID == userID {
+			delete(d.categories, id)
+		}
+	}
+}
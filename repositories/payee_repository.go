@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type payeeRepository struct {
+	db querier
+}
+
+func NewPayeeRepository(db *DB) PayeeRepository {
+	if db.memory != nil {
+		return &memoryPayeeRepository{store: db.memory}
+	}
+	return &payeeRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *payeeRepository) WithTx(tx *sql.Tx) PayeeRepository {
+	return &payeeRepository{r.db.withTx(tx)}
+}
+
+const payeeColumns = "p.id, p.user_id, p.name, p.default_category_id, COALESCE(c.name, ''), p.created_at, p.updated_at"
+
+const payeeTables = "payees p LEFT JOIN categories c ON c.id = p.default_category_id"
+
+func scanPayee(row interface{ Scan(...any) error }) (models.Payee, error) {
+	payee := models.Payee{Aliases: []string{}}
+	err := row.Scan(&payee.ID, &payee.UserID, &payee.Name, &payee.DefaultCategoryID, &payee.DefaultCategoryName, &payee.CreatedAt, &payee.UpdatedAt)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	return payee, nil
+}
+
+func (r *payeeRepository) GetPayee(id int) (models.Payee, error) {
+	payee, err := scanPayee(r.db.QueryRow("SELECT "+payeeColumns+" FROM "+payeeTables+" WHERE p.id = $1", id))
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	aliases, err := r.loadAliases("payee_id = $1", id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+	payee.Aliases = append(payee.Aliases, aliases[id]...)
+
+	return payee, nil
+}
+
+// GetPayeeByAliasKey returns the user's payee known by the normalized
+// spelling key.
+func (r *payeeRepository) GetPayeeByAliasKey(userID int, key string) (models.Payee, error) {
+	var id int
+	err := r.db.QueryRow("SELECT payee_id FROM payee_aliases WHERE user_id = $1 AND alias_key = $2", userID, key).Scan(&id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	return r.GetPayee(id)
+}
+
+func (r *payeeRepository) GetPayeesByUserID(userID int) ([]models.Payee, error) {
+	rows, err := r.db.Query("SELECT "+payeeColumns+" FROM "+payeeTables+" WHERE p.user_id = $1 ORDER BY p.name, p.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payees := []models.Payee{}
+	for rows.Next() {
+		payee, err := scanPayee(rows)
+		if err != nil {
+			return nil, err
+		}
+		payees = append(payees, payee)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	aliases, err := r.loadAliases("user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payees {
+		payees[i].Aliases = append(payees[i].Aliases, aliases[payees[i].ID]...)
+	}
+
+	return payees, nil
+}
+
+// loadAliases returns the aliases matching where, keyed by payee ID.
+func (r *payeeRepository) loadAliases(where string, args ...any) (map[int][]string, error) {
+	rows, err := r.db.Query("SELECT payee_id, alias FROM payee_aliases WHERE "+where+" ORDER BY alias, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := map[int][]string{}
+	for rows.Next() {
+		var payeeID int
+		var alias string
+		err := rows.Scan(&payeeID, &alias)
+		if err != nil {
+			return nil, err
+		}
+		aliases[payeeID] = append(aliases[payeeID], alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+func (r *payeeRepository) CreatePayee(payee models.Payee) (models.Payee, error) {
+	err := r.db.QueryRow("INSERT INTO payees (user_id, name, default_category_id) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at", payee.UserID, payee.Name, payee.DefaultCategoryID).
+		Scan(&payee.ID, &payee.CreatedAt, &payee.UpdatedAt)
+	return payee, err
+}
+
+func (r *payeeRepository) UpdatePayee(id int, payee models.Payee) error {
+	_, err := r.db.Exec("UPDATE payees SET name = $1, default_category_id = $2, updated_at = $3 WHERE id = $4", payee.Name, payee.DefaultCategoryID, payee.UpdatedAt, id)
+	return err
+}
+
+func (r *payeeRepository) DeletePayee(id int) error {
+	_, err := r.db.Exec("DELETE FROM payees WHERE id = $1", id)
+	return err
+}
+
+func (r *payeeRepository) AddPayeeAlias(userID int, payeeID int, alias string, key string) error {
+	_, err := r.db.Exec("INSERT INTO payee_aliases (user_id, payee_id, alias, alias_key) VALUES ($1, $2, $3, $4)", userID, payeeID, alias, key)
+	return err
+}
+
+func (r *payeeRepository) DeletePayeeAliases(payeeID int) error {
+	_, err := r.db.Exec("DELETE FROM payee_aliases WHERE payee_id = $1", payeeID)
+	return err
+}
+
+// MovePayeeAliases hands all aliases of one payee over to another.
+func (r *payeeRepository) MovePayeeAliases(fromID int, toID int) error {
+	_, err := r.db.Exec("UPDATE payee_aliases SET payee_id = $1 WHERE payee_id = $2", toID, fromID)
+	return err
+}
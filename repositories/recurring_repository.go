@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type recurringRepository struct {
+	db querier
+}
+
+func NewRecurringRepository(db *DB) RecurringRepository {
+	if db.memory != nil {
+		return &memoryRecurringRepository{store: db.memory}
+	}
+	return &recurringRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *recurringRepository) WithTx(tx *sql.Tx) RecurringRepository {
+	return &recurringRepository{r.db.withTx(tx)}
+}
+
+const recurringColumns = "r.id, r.user_id, r.account_id, a.name, r.category_id, c.name, r.payee_name, r.amount, r.currency, r.memo, r.rule, r.start_date, r.next_date, r.created_at, r.updated_at"
+
+const recurringTables = "recurring_transactions r JOIN accounts a ON a.id = r.account_id JOIN categories c ON c.id = r.category_id"
+
+func scanRecurring(row interface{ Scan(...any) error }) (models.RecurringTransaction, error) {
+	var recurring models.RecurringTransaction
+	var amount money.Decimal
+	var currency string
+	err := row.Scan(&recurring.ID, &recurring.UserID, &recurring.AccountID, &recurring.AccountName, &recurring.CategoryID, &recurring.CategoryName, &recurring.PayeeName, &amount, &currency, &recurring.Memo, &recurring.Rule, &recurring.StartDate, &recurring.NextDate, &recurring.CreatedAt, &recurring.UpdatedAt)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	recurring.Amount, err = money.FromDecimal(amount, currency)
+	return recurring, err
+}
+
+func (r *recurringRepository) queryRecurring(where string, args ...any) ([]models.RecurringTransaction, error) {
+	rows, err := r.db.Query("SELECT "+recurringColumns+" FROM "+recurringTables+" WHERE "+where+" ORDER BY r.next_date, r.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurring := []models.RecurringTransaction{}
+	for rows.Next() {
+		template, err := scanRecurring(rows)
+		if err != nil {
+			return nil, err
+		}
+		recurring = append(recurring, template)
+	}
+
+	return recurring, rows.Err()
+}
+
+func (r *recurringRepository) GetRecurringTransaction(id int) (models.RecurringTransaction, error) {
+	return scanRecurring(r.db.QueryRow("SELECT "+recurringColumns+" FROM "+recurringTables+" WHERE r.id = $1", id))
+}
+
+// LockRecurringTransaction locks the template's row until the database
+// transaction ends, so that a date is never posted twice.
+func (r *recurringRepository) LockRecurringTransaction(id int) (models.RecurringTransaction, error) {
+	var locked int
+	err := r.db.QueryRow("SELECT id FROM recurring_transactions WHERE id = $1 FOR UPDATE", id).Scan(&locked)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	return r.GetRecurringTransaction(id)
+}
+
+func (r *recurringRepository) GetRecurringTransactionsByUserID(userID int) ([]models.RecurringTransaction, error) {
+	return r.queryRecurring("r.user_id = $1", userID)
+}
+
+// GetDueRecurringTransactions returns every user's templates with a date
+// not posted yet on or before on.
+func (r *recurringRepository) GetDueRecurringTransactions(on time.Time) ([]models.RecurringTransaction, error) {
+	return r.queryRecurring("r.next_date <= $1", on)
+}
+
+func (r *recurringRepository) CreateRecurringTransaction(recurring models.RecurringTransaction) (models.RecurringTransaction, error) {
+	err := r.db.QueryRow("INSERT INTO recurring_transactions (user_id, account_id, category_id, payee_name, amount, currency, memo, rule, start_date, next_date) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, updated_at",
+		recurring.UserID, recurring.AccountID, recurring.CategoryID, recurring.PayeeName, recurring.Amount, recurring.Amount.Currency(), recurring.Memo, recurring.Rule, recurring.StartDate, recurring.NextDate).
+		Scan(&recurring.ID, &recurring.CreatedAt, &recurring.UpdatedAt)
+	return recurring, err
+}
+
+func (r *recurringRepository) UpdateRecurringTransaction(id int, recurring models.RecurringTransaction) error {
+	_, err := r.db.Exec("UPDATE recurring_transactions SET account_id = $1, category_id = $2, payee_name = $3, amount = $4, currency = $5, memo = $6, rule = $7, start_date = $8, next_date = $9, updated_at = $10 WHERE id = $11",
+		recurring.AccountID, recurring.CategoryID, recurring.PayeeName, recurring.Amount, recurring.Amount.Currency(), recurring.Memo, recurring.Rule, recurring.StartDate, recurring.NextDate, recurring.UpdatedAt, id)
+	return err
+}
+
+func (r *recurringRepository) DeleteRecurringTransaction(id int) error {
+	_, err := r.db.Exec("DELETE FROM recurring_transactions WHERE id = $1", id)
+	return err
+}
+
+// GetOccurrences returns the template's posted, skipped and edited dates
+// from from to to, both included.
+func (r *recurringRepository) GetOccurrences(recurringID int, from time.Time, to time.Time) ([]models.RecurringOccurrence, error) {
+	rows, err := r.db.Query("SELECT o.recurring_id, o.date, o.status, o.amount, r.currency, o.memo, o.transaction_id FROM recurring_occurrences o JOIN recurring_transactions r ON r.id = o.recurring_id WHERE o.recurring_id = $1 AND o.date >= $2 AND o.date <= $3 ORDER BY o.date", recurringID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := []models.RecurringOccurrence{}
+	for rows.Next() {
+		var occurrence models.RecurringOccurrence
+		var amount sql.NullString
+		var currency string
+		err := rows.Scan(&occurrence.RecurringID, &occurrence.Date, &occurrence.Status, &amount, &currency, &occurrence.Memo, &occurrence.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Valid {
+			occurrence.Edited = true
+			occurrence.Amount, err = money.FromDecimal(money.Decimal(amount.String), currency)
+			if err != nil {
+				return nil, err
+			}
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, rows.Err()
+}
+
+// SaveOccurrence stores the status of one date, replacing what was stored
+// for it. The amount and memo are only kept for edited dates.
+func (r *recurringRepository) SaveOccurrence(occurrence models.RecurringOccurrence) error {
+	var amount any
+	memo := ""
+	if occurrence.Edited {
+		amount, memo = occurrence.Amount, occurrence.Memo
+	}
+
+	_, err := r.db.Exec("INSERT INTO recurring_occurrences (recurring_id, date, status, amount, memo, transaction_id) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (recurring_id, date) DO UPDATE SET status = EXCLUDED.status, amount = EXCLUDED.amount, memo = EXCLUDED.memo, transaction_id = EXCLUDED.transaction_id",
+		occurrence.RecurringID, occurrence.Date, occurrence.Status, amount, memo, occurrence.TransactionID)
+	return err
+}
+
+func (r *recurringRepository) DeleteOccurrence(recurringID int, date time.Time) error {
+	_, err := r.db.Exec("DELETE FROM recurring_occurrences WHERE recurring_id = $1 AND date = $2", recurringID, date)
+	return err
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// The services depend on these interfaces rather than on a particular
+// database. NewXRepository returns the implementation for the DB's backend.
+
+type UserRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) UserRepository
+	GetUser(id int) (models.User, error)
+	GetUserByUsername(username string) (models.User, error)
+	CreateUser(user models.User) error
+	UpdateUser(id int, user models.User) error
+	DeleteUser(id int) error
+	// DeleteUserData deletes everything the user owns but keeps the user
+	// and their sessions.
+	DeleteUserData(id int) error
+}
+
+type SessionRepository interface {
+	GetSession(id int) (models.Session, error)
+	GetSessionByTokenHash(tokenHash string) (models.Session, error)
+	CreateSession(session models.Session) (models.Session, error)
+	GetActiveSessionsByUserID(userID int, now time.Time) ([]models.Session, error)
+	MarkSessionUsed(id int, usedAt time.Time) (bool, error)
+	DeleteSession(id int) error
+	DeleteOtherSessions(userID int, keepFamilyID string) error
+	DeleteSessionFamily(familyID string) error
+	SessionFamilyActive(familyID string, now time.Time) (bool, error)
+}
+
+type AccountRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) AccountRepository
+	GetAccount(id int) (models.Account, error)
+	LockAccount(id int) (models.Account, error)
+	GetAccountsByUserID(userID int) ([]models.Account, error)
+	GetAccountBalancesByUserID(userID int) ([]models.AccountBalance, error)
+	CreateAccount(account models.Account) (models.Account, error)
+	UpdateAccount(id int, account models.Account) error
+	DeleteAccount(id int) error
+}
+
+type TransactionRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) TransactionRepository
+	GetTransaction(id int) (models.Transaction, error)
+	GetTransactionsByUserID(userID int, filter models.TransactionFilter) ([]models.Transaction, error)
+	GetTransactionsPage(userID int, filter models.TransactionFilter, sort models.TransactionSort, after *models.TransactionCursor, limit int) ([]models.Transaction, error)
+	GetTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) ([]models.Transaction, error)
+	CreateTransaction(transaction models.Transaction) (models.Transaction, error)
+	// CreateImportedTransaction is CreateTransaction for an entry read from
+	// a bank's file. It books nothing and returns false if the account
+	// already has an entry with the same import id.
+	CreateImportedTransaction(transaction models.Transaction) (models.Transaction, bool, error)
+	UpdateTransaction(id int, transaction models.Transaction) error
+	SetTransactionTags(userID int, transactionID int, names []string) error
+	SetTransactionSplits(transactionID int, splits []models.Split) error
+	GetTransactionsByTransferID(transferID int) ([]models.Transaction, error)
+	DeleteTransaction(id int) error
+	SumTransactionsByAccountID(accountID int) (money.Decimal, error)
+	SumTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) (money.Decimal, error)
+	SumTransactionsBefore(userID int, before time.Time) ([]money.Money, error)
+	CountTransactionsByAccountID(accountID int) (int, error)
+	// CountTransactionsByCategoryID counts transactions, split lines,
+	// recurring transactions and envelope assignments.
+	CountTransactionsByCategoryID(categoryID int) (int, error)
+	GetCategoryTotals(userID int, from time.Time, to time.Time) ([]models.CategoryTotal, error)
+	CountTransactionsByPayeeID(payeeID int) (int, error)
+	// ReassignPayee moves every transaction of one payee to another.
+	ReassignPayee(fromID int, toID int) error
+}
+
+type TransferRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) TransferRepository
+	CreateTransfer(transfer models.Transfer) (models.Transfer, error)
+	DeleteTransfer(id int) error
+}
+
+type RecurringRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) RecurringRepository
+	GetRecurringTransaction(id int) (models.RecurringTransaction, error)
+	// LockRecurringTransaction locks the template's row until the
+	// transaction ends.
+	LockRecurringTransaction(id int) (models.RecurringTransaction, error)
+	GetRecurringTransactionsByUserID(userID int) ([]models.RecurringTransaction, error)
+	GetDueRecurringTransactions(on time.Time) ([]models.RecurringTransaction, error)
+	CreateRecurringTransaction(recurring models.RecurringTransaction) (models.RecurringTransaction, error)
+	UpdateRecurringTransaction(id int, recurring models.RecurringTransaction) error
+	DeleteRecurringTransaction(id int) error
+	GetOccurrences(recurringID int, from time.Time, to time.Time) ([]models.RecurringOccurrence, error)
+	SaveOccurrence(occurrence models.RecurringOccurrence) error
+	DeleteOccurrence(recurringID int, date time.Time) error
+}
+
+type BudgetRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) BudgetRepository
+	GetBudget(id int) (models.Budget, error)
+	GetBudgetsByMonth(userID int, month time.Time) ([]models.Budget, error)
+	GetBudgetsByUserID(userID int) ([]models.Budget, error)
+	GetBudgetByCategory(categoryID int, month time.Time) (models.Budget, error)
+	CreateBudget(budget models.Budget) (models.Budget, error)
+	UpdateBudget(id int, budget models.Budget) error
+	DeleteBudget(id int) error
+}
+
+type EnvelopeRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) EnvelopeRepository
+	GetAssignments(userID int, from time.Time, to time.Time) ([]models.EnvelopeAssignment, error)
+	CreateAssignment(assignment models.EnvelopeAssignment) (models.EnvelopeAssignment, error)
+}
+
+type GoalRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) GoalRepository
+	GetGoal(id int) (models.Goal, error)
+	GetGoalsByUserID(userID int) ([]models.Goal, error)
+	CreateGoal(goal models.Goal) (models.Goal, error)
+	UpdateGoal(id int, goal models.Goal) error
+	DeleteGoal(id int) error
+}
+
+type ImportProfileRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) ImportProfileRepository
+	GetImportProfile(id int) (models.ImportProfile, error)
+	GetImportProfileByName(userID int, name string) (models.ImportProfile, error)
+	GetImportProfilesByUserID(userID int) ([]models.ImportProfile, error)
+	CreateImportProfile(profile models.ImportProfile) (models.ImportProfile, error)
+	UpdateImportProfile(id int, profile models.ImportProfile) error
+	DeleteImportProfile(id int) error
+}
+
+type CategoryRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) CategoryRepository
+	GetCategory(id int) (models.Category, error)
+	GetCategoriesByUserID(userID int) ([]models.Category, error)
+	CreateCategory(category models.Category) (models.Category, error)
+	UpdateCategory(id int, category models.Category) error
+	DeleteCategory(id int) error
+	CountChildCategories(id int) (int, error)
+}
+
+type BalanceRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) BalanceRepository
+	GetBalance(id int) (models.Balance, error)
+	CreateBalance(balance models.Balance) error
+	GetBalancesByUserID(userID int) ([]models.Balance, error)
+	GetLastBalanceByUserID(userID int) (models.Balance, error)
+	GetLastBalanceByAccountID(accountID int) (models.Balance, error)
+}
+
+type TagRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) TagRepository
+	GetTagsByUserID(userID int) ([]models.Tag, error)
+	// CreateTag creates the user's tag unless it exists already.
+	CreateTag(userID int, name string) error
+}
+
+type PayeeRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) PayeeRepository
+	GetPayee(id int) (models.Payee, error)
+	GetPayeeByAliasKey(userID int, key string) (models.Payee, error)
+	GetPayeesByUserID(userID int) ([]models.Payee, error)
+	CreatePayee(payee models.Payee) (models.Payee, error)
+	UpdatePayee(id int, payee models.Payee) error
+	DeletePayee(id int) error
+	AddPayeeAlias(userID int, payeeID int, alias string, key string) error
+	DeletePayeeAliases(payeeID int) error
+	MovePayeeAliases(fromID int, toID int) error
+}
+
+type ExchangeRateRepository interface {
+	// WithTx returns a copy of the repository that runs its queries in tx.
+	WithTx(tx *sql.Tx) ExchangeRateRepository
+	SaveExchangeRate(rate models.ExchangeRate) error
+	GetLatestExchangeRates(on time.Time) ([]models.ExchangeRate, error)
+	// GetExchangeRatesByCurrencies returns the rates dated on or after from
+	// that have one of the currencies on either side.
+	GetExchangeRatesByCurrencies(currencies []string, from time.Time) ([]models.ExchangeRate, error)
+}
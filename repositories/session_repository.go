@@ -8,19 +8,22 @@ import (
 	"balance-tracker/models"
 )
 
-type SessionRepository struct {
-	db *sql.DB
+type sessionRepository struct {
+	db querier
 }
 
-func NewSessionRepository(db *sql.DB) *SessionRepository {
-	return &SessionRepository{db}
+func NewSessionRepository(db *DB) SessionRepository {
+	if db.memory != nil {
+		return &memorySessionRepository{store: db.memory}
+	}
+	return &sessionRepository{newQuerier(db)}
 }
 
-func (r *SessionRepository) GetSession(id int) (models.Session, error) {
-	row := r.db.QueryRow("SELECT * FROM sessions WHERE id = $1", id)
+const sessionColumns = "id, user_id, family_id, token_hash, created_at, expires_at, used_at, deleted_at, user_agent, ip, last_seen_at"
 
+func scanSession(row interface{ Scan(...any) error }) (models.Session, error) {
 	session := models.Session{}
-	err := row.Scan(&session.ID, &session.CreatedAt, &session.DeletedAt, &session.Token)
+	err := row.Scan(&session.ID, &session.UserID, &session.FamilyID, &session.TokenHash, &session.CreatedAt, &session.ExpiresAt, &session.UsedAt, &session.DeletedAt, &session.UserAgent, &session.IP, &session.LastSeenAt)
 	if err != nil {
 		return models.Session{}, err
 	}
@@ -28,11 +31,15 @@ func (r *SessionRepository) GetSession(id int) (models.Session, error) {
 	return session, nil
 }
 
-func (r *SessionRepository) GetSessionByToken(token string) (models.Session, error) {
-	row := r.db.QueryRow("SELECT id, created_at, deleted_at, token FROM sessions WHERE token = $1", token)
+func (r *sessionRepository) GetSession(id int) (models.Session, error) {
+	row := r.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = $1", id)
+	return scanSession(row)
+}
 
-	session := models.Session{}
-	err := row.Scan(&session.ID, &session.CreatedAt, &session.DeletedAt, &session.Token)
+func (r *sessionRepository) GetSessionByTokenHash(tokenHash string) (models.Session, error) {
+	row := r.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE token_hash = $1", tokenHash)
+
+	session, err := scanSession(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Session{}, errors.New("session not found")
@@ -43,31 +50,69 @@ func (r *SessionRepository) GetSessionByToken(token string) (models.Session, err
 	return session, nil
 }
 
-func (r *SessionRepository) CreateSession(session models.Session) error {
-	_, err := r.db.Exec("INSERT INTO sessions (created_at, deleted_at, token) VALUES ($1, $2, $3)", session.CreatedAt, session.DeletedAt, session.Token)
-	return err
+func (r *sessionRepository) CreateSession(session models.Session) (models.Session, error) {
+	err := r.db.QueryRow("INSERT INTO sessions (user_id, family_id, token_hash, expires_at, user_agent, ip, last_seen_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at", session.UserID, session.FamilyID, session.TokenHash, session.ExpiresAt, session.UserAgent, session.IP, session.LastSeenAt).
+		Scan(&session.ID, &session.CreatedAt)
+	return session, err
+}
+
+// MarkSessionUsed records that the session's token was exchanged for a new
+// one. It reports false if the token had already been used, so that only one
+// of two concurrent refreshes wins.
+func (r *sessionRepository) MarkSessionUsed(id int, usedAt time.Time) (bool, error) {
+	result, err := r.db.Exec("UPDATE sessions SET used_at = $1 WHERE id = $2 AND used_at IS NULL", usedAt, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
 }
 
-func (r *SessionRepository) CreateSessionFromToken(token string) error {
-	_, err := r.db.Exec("INSERT INTO sessions (token) VALUES ($1)", token)
+// GetActiveSessionsByUserID returns the current token of each of the user's
+// logins that is neither revoked nor expired, most recently seen first.
+func (r *sessionRepository) GetActiveSessionsByUserID(userID int, now time.Time) ([]models.Session, error) {
+	rows, err := r.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND used_at IS NULL AND deleted_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC, id DESC", userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes the login that the session belongs to, including
+// tokens rotated from or into it.
+func (r *sessionRepository) DeleteSession(id int) error {
+	_, err := r.db.Exec("UPDATE sessions SET deleted_at = $1 WHERE family_id = (SELECT family_id FROM sessions WHERE id = $2) AND deleted_at IS NULL", time.Now(), id)
 	return err
 }
 
-func (r *SessionRepository) DeleteSession(id int) error {
-	_, err := r.db.Exec("UPDATE sessions SET deleted_at = $1 WHERE id = $2", time.Now(), id)
+// DeleteOtherSessions revokes all of the user's logins except one.
+func (r *sessionRepository) DeleteOtherSessions(userID int, keepFamilyID string) error {
+	_, err := r.db.Exec("UPDATE sessions SET deleted_at = $1 WHERE user_id = $2 AND family_id <> $3 AND deleted_at IS NULL", time.Now(), userID, keepFamilyID)
 	return err
 }
 
-func (r *SessionRepository) DeleteSessionByToken(token string) error {
-	_, err := r.db.Exec("UPDATE sessions SET deleted_at = $1 WHERE token = $2", time.Now(), token)
+// DeleteSessionFamily revokes every token descended from the same login.
+func (r *sessionRepository) DeleteSessionFamily(familyID string) error {
+	_, err := r.db.Exec("UPDATE sessions SET deleted_at = $1 WHERE family_id = $2 AND deleted_at IS NULL", time.Now(), familyID)
 	return err
 }
 
-func (r *SessionRepository) TokenExists(token string) bool {
+// SessionFamilyActive reports whether the login still has an unrevoked,
+// unexpired token.
+func (r *sessionRepository) SessionFamilyActive(familyID string, now time.Time) (bool, error) {
 	var exists bool
-	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sessions WHERE token = $1)", token).Scan(&exists)
-	if err != nil {
-		return false
-	}
-	return exists
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sessions WHERE family_id = $1 AND deleted_at IS NULL AND expires_at > $2)", familyID, now).Scan(&exists)
+	return exists, err
 }
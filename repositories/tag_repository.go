@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type tagRepository struct {
+	db querier
+}
+
+func NewTagRepository(db *DB) TagRepository {
+	if db.memory != nil {
+		return &memoryTagRepository{store: db.memory}
+	}
+	return &tagRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *tagRepository) WithTx(tx *sql.Tx) TagRepository {
+	return &tagRepository{r.db.withTx(tx)}
+}
+
+// GetTagsByUserID returns the user's tags, the most used first.
+func (r *tagRepository) GetTagsByUserID(userID int) ([]models.Tag, error) {
+	rows, err := r.db.Query("SELECT tg.id, tg.user_id, tg.name, tg.created_at, COUNT(tt.transaction_id) FROM tags tg LEFT JOIN transaction_tags tt ON tt.tag_id = tg.id WHERE tg.user_id = $1 GROUP BY tg.id, tg.user_id, tg.name, tg.created_at ORDER BY COUNT(tt.transaction_id) DESC, tg.name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		tag := models.Tag{}
+		err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (r *tagRepository) CreateTag(userID int, name string) error {
+	_, err := r.db.Exec("INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO NOTHING", userID, name)
+	return err
+}
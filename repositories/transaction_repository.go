@@ -0,0 +1,512 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+type transactionRepository struct {
+	db querier
+}
+
+func NewTransactionRepository(db *DB) TransactionRepository {
+	if db.memory != nil {
+		return &memoryTransactionRepository{store: db.memory}
+	}
+	return &transactionRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *transactionRepository) WithTx(tx *sql.Tx) TransactionRepository {
+	return &transactionRepository{r.db.withTx(tx)}
+}
+
+const transactionColumns = "t.id, t.user_id, t.account_id, a.name, t.category_id, COALESCE(c.name, ''), t.payee_id, COALESCE(p.name, ''), t.amount, t.currency, t.date, t.value_date, t.memo, COALESCE(t.import_id, ''), t.created_at, t.updated_at, t.transfer_id, tl.id, tl.account_id, COALESCE(ta.name, ''), tl.amount, COALESCE(tl.currency, ''), tr.rate"
+
+// transactionTables joins each transfer leg to the other leg of its transfer
+// (tl) and that leg's account (ta).
+const transactionTables = "transactions t JOIN accounts a ON a.id = t.account_id LEFT JOIN categories c ON c.id = t.category_id LEFT JOIN payees p ON p.id = t.payee_id" +
+	" LEFT JOIN transfers tr ON tr.id = t.transfer_id LEFT JOIN transactions tl ON tl.transfer_id = t.transfer_id AND tl.id <> t.id LEFT JOIN accounts ta ON ta.id = tl.account_id"
+
+func scanTransaction(row interface{ Scan(...any) error }) (models.Transaction, error) {
+	transaction := models.Transaction{Tags: []string{}, Splits: []models.Split{}}
+	var amount, otherAmount, rate money.Decimal
+	var currency, otherCurrency, otherAccountName string
+	var otherID, otherAccountID *int
+	err := row.Scan(&transaction.ID, &transaction.UserID, &transaction.AccountID, &transaction.AccountName, &transaction.CategoryID, &transaction.CategoryName, &transaction.PayeeID, &transaction.PayeeName, &amount, &currency, &transaction.Date, &transaction.ValueDate, &transaction.Memo, &transaction.ImportID, &transaction.CreatedAt, &transaction.UpdatedAt,
+		&transaction.TransferID, &otherID, &otherAccountID, &otherAccountName, &otherAmount, &otherCurrency, &rate)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	transaction.Amount, err = money.FromDecimal(amount, currency)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	if otherID != nil && otherAccountID != nil {
+		otherLeg, err := money.FromDecimal(otherAmount, otherCurrency)
+		if err != nil {
+			return models.Transaction{}, err
+		}
+		transaction.Transfer = &models.TransferLeg{
+			TransactionID: *otherID,
+			AccountID:     *otherAccountID,
+			AccountName:   otherAccountName,
+			Amount:        otherLeg,
+			Rate:          rate,
+		}
+	}
+
+	return transaction, nil
+}
+
+func (r *transactionRepository) GetTransaction(id int) (models.Transaction, error) {
+	row := r.db.QueryRow("SELECT "+transactionColumns+" FROM "+transactionTables+" WHERE t.id = $1", id)
+
+	transaction, err := scanTransaction(row)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	tags, err := r.loadTags("tt.transaction_id = $1", id)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	transaction.Tags = append(transaction.Tags, tags[id]...)
+
+	splits, err := r.loadSplits("s.transaction_id = $1", id)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	transaction.Splits = append(transaction.Splits, splits[id]...)
+
+	return transaction, nil
+}
+
+func (r *transactionRepository) GetTransactionsByUserID(userID int, filter models.TransactionFilter) ([]models.Transaction, error) {
+	where, args := transactionFilterWhere(userID, filter)
+	transactions, err := r.queryTransactions("SELECT "+transactionColumns+" FROM "+transactionTables+" WHERE "+where+" ORDER BY t.date DESC, t.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactions) == 0 {
+		return transactions, nil
+	}
+
+	// Tags and split lines are loaded for the listed entries only
+	listed := "SELECT t.id FROM " + transactionTables + " WHERE " + where
+	tags, err := r.loadTags("tt.transaction_id IN ("+listed+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := r.loadSplits("s.transaction_id IN ("+listed+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range transactions {
+		transactions[i].Tags = append(transactions[i].Tags, tags[transactions[i].ID]...)
+		transactions[i].Splits = append(transactions[i].Splits, splits[transactions[i].ID]...)
+	}
+
+	return transactions, nil
+}
+
+// GetTransactionsPage returns up to limit of the transactions matching the
+// filter in the given order, starting after the entry at the cursor if
+// there is one. Ties are broken by ID, so that every entry has a place of
+// its own to continue from.
+func (r *transactionRepository) GetTransactionsPage(userID int, filter models.TransactionFilter, sort models.TransactionSort, after *models.TransactionCursor, limit int) ([]models.Transaction, error) {
+	where, args := transactionFilterWhere(userID, filter)
+
+	column, direction, compare := "t.date", "DESC", "<"
+	switch sort {
+	case models.TransactionSortDateAsc:
+		direction, compare = "ASC", ">"
+	case models.TransactionSortAmountDesc:
+		column = "t.amount"
+	case models.TransactionSortAmountAsc:
+		column, direction, compare = "t.amount", "ASC", ">"
+	}
+
+	if after != nil {
+		var value any = after.Date
+		placeholder := fmt.Sprintf("$%d", len(args)+1)
+		if column == "t.amount" {
+			value = after.Amount
+			placeholder = fmt.Sprintf("CAST($%d AS NUMERIC)", len(args)+1)
+		}
+		args = append(args, value, after.ID)
+		where += fmt.Sprintf(" AND (%s %s %s OR (%s = %s AND t.id %s $%d))", column, compare, placeholder, column, placeholder, compare, len(args))
+	}
+
+	args = append(args, limit)
+	transactions, err := r.queryTransactions(fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s, t.id %s LIMIT $%d", transactionColumns, transactionTables, where, column, direction, direction, len(args)), args...)
+	if err != nil || len(transactions) == 0 {
+		return transactions, err
+	}
+
+	// Tags and split lines are loaded for the page only
+	ids := make([]any, len(transactions))
+	placeholders := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		ids[i] = transaction.ID
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	in := strings.Join(placeholders, ", ")
+	tags, err := r.loadTags("tt.transaction_id IN ("+in+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	splits, err := r.loadSplits("s.transaction_id IN ("+in+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range transactions {
+		transactions[i].Tags = append(transactions[i].Tags, tags[transactions[i].ID]...)
+		transactions[i].Splits = append(transactions[i].Splits, splits[transactions[i].ID]...)
+	}
+
+	return transactions, nil
+}
+
+// transactionFilterWhere builds the conditions of a transaction listing and
+// their arguments, starting with the user's ID as $1. A transfer is listed
+// once, by its outgoing leg.
+func transactionFilterWhere(userID int, filter models.TransactionFilter) (string, []any) {
+	where := []string{"t.user_id = $1", "(t.transfer_id IS NULL OR t.amount < 0)"}
+	args := []any{userID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Tags) > 0 {
+		placeholders := make([]string, len(filter.Tags))
+		for i, tag := range filter.Tags {
+			placeholders[i] = arg(tag)
+		}
+		where = append(where, fmt.Sprintf("t.id IN (SELECT tt.transaction_id FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE tg.name IN (%s) GROUP BY tt.transaction_id HAVING COUNT(*) = %s)", strings.Join(placeholders, ", "), arg(len(filter.Tags))))
+	}
+	if filter.From != nil {
+		where = append(where, "t.date >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "t.date < "+arg(filter.To.AddDate(0, 0, 1)))
+	}
+	if filter.AccountID != nil {
+		id := arg(*filter.AccountID)
+		where = append(where, fmt.Sprintf("(t.account_id = %s OR tl.account_id = %s)", id, id))
+	}
+	if filter.CategoryID != nil {
+		// The category and its subcategories
+		categories := fmt.Sprintf("WITH RECURSIVE tree(id) AS (SELECT CAST(%s AS INTEGER) UNION ALL SELECT sc.id FROM categories sc JOIN tree ON sc.parent_id = tree.id) SELECT id FROM tree", arg(*filter.CategoryID))
+		where = append(where, fmt.Sprintf("(t.category_id IN (%s) OR t.id IN (SELECT s.transaction_id FROM transaction_splits s WHERE s.category_id IN (%s)))", categories, categories))
+	}
+	if filter.PayeeID != nil {
+		where = append(where, "t.payee_id = "+arg(*filter.PayeeID))
+	}
+	if filter.MinAmount != nil {
+		where = append(where, fmt.Sprintf("ABS(t.amount) >= CAST(%s AS NUMERIC)", arg(*filter.MinAmount)))
+	}
+	if filter.MaxAmount != nil {
+		where = append(where, fmt.Sprintf("ABS(t.amount) <= CAST(%s AS NUMERIC)", arg(*filter.MaxAmount)))
+	}
+	if filter.Text != "" {
+		pattern := arg("%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(filter.Text)) + "%")
+		where = append(where, fmt.Sprintf(`(LOWER(t.memo) LIKE %s ESCAPE '\' OR LOWER(COALESCE(p.name, '')) LIKE %s ESCAPE '\')`, pattern, pattern))
+	}
+
+	return strings.Join(where, " AND "), args
+}
+
+func (r *transactionRepository) queryTransactions(query string, args ...any) ([]models.Transaction, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+// GetTransactionsByTransferID returns both legs of a transfer, the outgoing
+// one first.
+func (r *transactionRepository) GetTransactionsByTransferID(transferID int) ([]models.Transaction, error) {
+	rows, err := r.db.Query("SELECT "+transactionColumns+" FROM "+transactionTables+" WHERE t.transfer_id = $1 ORDER BY t.amount, t.id", transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+// loadTags returns the tag names of the transactions matching where, keyed
+// by transaction ID and sorted by name.
+func (r *transactionRepository) loadTags(where string, args ...any) (map[int][]string, error) {
+	rows, err := r.db.Query("SELECT tt.transaction_id, tg.name FROM transaction_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE "+where+" ORDER BY tg.name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var transactionID int
+		var name string
+		err := rows.Scan(&transactionID, &name)
+		if err != nil {
+			return nil, err
+		}
+		tags[transactionID] = append(tags[transactionID], name)
+	}
+
+	return tags, rows.Err()
+}
+
+// loadSplits returns the split lines of the transactions matching where,
+// keyed by transaction ID and in their original order.
+func (r *transactionRepository) loadSplits(where string, args ...any) (map[int][]models.Split, error) {
+	rows, err := r.db.Query("SELECT s.transaction_id, s.id, s.category_id, c.name, s.amount, t.currency, s.memo FROM transaction_splits s JOIN transactions t ON t.id = s.transaction_id JOIN categories c ON c.id = s.category_id WHERE "+where+" ORDER BY s.transaction_id, s.position", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	splits := map[int][]models.Split{}
+	for rows.Next() {
+		var transactionID int
+		var split models.Split
+		var amount money.Decimal
+		var currency string
+		err := rows.Scan(&transactionID, &split.ID, &split.CategoryID, &split.CategoryName, &amount, &currency, &split.Memo)
+		if err != nil {
+			return nil, err
+		}
+		split.Amount, err = money.FromDecimal(amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		splits[transactionID] = append(splits[transactionID], split)
+	}
+
+	return splits, rows.Err()
+}
+
+// GetTransactionsByAccountIDBetween returns the account's entries dated from
+// from up to, but not including, to, oldest first. Tags and split lines are
+// not loaded.
+func (r *transactionRepository) GetTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) ([]models.Transaction, error) {
+	rows, err := r.db.Query("SELECT "+transactionColumns+" FROM "+transactionTables+" WHERE t.account_id = $1 AND t.date >= $2 AND t.date < $3 ORDER BY t.date, t.id", accountID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (r *transactionRepository) CreateTransaction(transaction models.Transaction) (models.Transaction, error) {
+	err := r.db.QueryRow("INSERT INTO transactions (user_id, account_id, category_id, payee_id, amount, currency, date, value_date, memo, transfer_id, import_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')) RETURNING id, created_at, updated_at", transaction.UserID, transaction.AccountID, transaction.CategoryID, transaction.PayeeID, transaction.Amount, transaction.Amount.Currency(), transaction.Date, transaction.ValueDate, transaction.Memo, transaction.TransferID, transaction.ImportID).
+		Scan(&transaction.ID, &transaction.CreatedAt, &transaction.UpdatedAt)
+	return transaction, err
+}
+
+func (r *transactionRepository) CreateImportedTransaction(transaction models.Transaction) (models.Transaction, bool, error) {
+	err := r.db.QueryRow("INSERT INTO transactions (user_id, account_id, category_id, payee_id, amount, currency, date, value_date, memo, transfer_id, import_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')) ON CONFLICT (account_id, import_id) WHERE import_id IS NOT NULL DO NOTHING RETURNING id, created_at, updated_at", transaction.UserID, transaction.AccountID, transaction.CategoryID, transaction.PayeeID, transaction.Amount, transaction.Amount.Currency(), transaction.Date, transaction.ValueDate, transaction.Memo, transaction.TransferID, transaction.ImportID).
+		Scan(&transaction.ID, &transaction.CreatedAt, &transaction.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return models.Transaction{}, false, nil
+	}
+	if err != nil {
+		return models.Transaction{}, false, err
+	}
+	return transaction, true, nil
+}
+
+func (r *transactionRepository) UpdateTransaction(id int, transaction models.Transaction) error {
+	_, err := r.db.Exec("UPDATE transactions SET account_id = $1, category_id = $2, payee_id = $3, amount = $4, currency = $5, date = $6, memo = $7, updated_at = $8 WHERE id = $9", transaction.AccountID, transaction.CategoryID, transaction.PayeeID, transaction.Amount, transaction.Amount.Currency(), transaction.Date, transaction.Memo, transaction.UpdatedAt, id)
+	return err
+}
+
+// SetTransactionTags replaces the transaction's tags, creating any of the
+// user's tags that do not exist yet.
+func (r *transactionRepository) SetTransactionTags(userID int, transactionID int, names []string) error {
+	_, err := r.db.Exec("DELETE FROM transaction_tags WHERE transaction_id = $1", transactionID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		var tagID int
+		err := r.db.QueryRow("INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name RETURNING id", userID, name).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		_, err = r.db.Exec("INSERT INTO transaction_tags (transaction_id, tag_id) VALUES ($1, $2)", transactionID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetTransactionSplits replaces the transaction's split lines. The amounts
+// are stored in the transaction's currency.
+func (r *transactionRepository) SetTransactionSplits(transactionID int, splits []models.Split) error {
+	_, err := r.db.Exec("DELETE FROM transaction_splits WHERE transaction_id = $1", transactionID)
+	if err != nil {
+		return err
+	}
+
+	for i, split := range splits {
+		_, err = r.db.Exec("INSERT INTO transaction_splits (transaction_id, category_id, amount, memo, position) VALUES ($1, $2, $3, $4, $5)", transactionID, split.CategoryID, split.Amount, split.Memo, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *transactionRepository) DeleteTransaction(id int) error {
+	_, err := r.db.Exec("DELETE FROM transactions WHERE id = $1", id)
+	return err
+}
+
+// SumTransactionsByAccountID returns the total of the account's ledger
+// entries, excluding its opening balance.
+func (r *transactionRepository) SumTransactionsByAccountID(accountID int) (money.Decimal, error) {
+	var sum money.Decimal
+	err := r.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE account_id = $1", accountID).Scan(&sum)
+	return sum, err
+}
+
+// SumTransactionsByAccountIDBetween totals the account's entries dated from
+// from up to, but not including, to.
+func (r *transactionRepository) SumTransactionsByAccountIDBetween(accountID int, from time.Time, to time.Time) (money.Decimal, error) {
+	var sum money.Decimal
+	err := r.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE account_id = $1 AND date >= $2 AND date < $3", accountID, from, to).Scan(&sum)
+	return sum, err
+}
+
+// SumTransactionsBefore totals the user's entries dated before the given
+// time, per currency.
+func (r *transactionRepository) SumTransactionsBefore(userID int, before time.Time) ([]money.Money, error) {
+	rows, err := r.db.Query("SELECT currency, SUM(amount) FROM transactions WHERE user_id = $1 AND date < $2 GROUP BY currency ORDER BY currency", userID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := []money.Money{}
+	for rows.Next() {
+		var currency string
+		var amount money.Decimal
+		err := rows.Scan(&currency, &amount)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := money.FromDecimal(amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, sum)
+	}
+
+	return sums, rows.Err()
+}
+
+func (r *transactionRepository) CountTransactionsByAccountID(accountID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE account_id = $1", accountID).Scan(&count)
+	return count, err
+}
+
+func (r *transactionRepository) CountTransactionsByCategoryID(categoryID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT (SELECT COUNT(*) FROM transactions WHERE category_id = $1) + (SELECT COUNT(*) FROM transaction_splits WHERE category_id = $1) + (SELECT COUNT(*) FROM recurring_transactions WHERE category_id = $1) + (SELECT COUNT(*) FROM envelope_assignments WHERE category_id = $1)", categoryID).Scan(&count)
+	return count, err
+}
+
+// GetCategoryTotals sums the user's entries per category and currency for
+// dates in [from, to). Split transactions count by their split lines, while
+// transfers, which have no category, and balance adjustments are left out.
+func (r *transactionRepository) GetCategoryTotals(userID int, from time.Time, to time.Time) ([]models.CategoryTotal, error) {
+	rows, err := r.db.Query(`SELECT c.id, c.name, c.kind, l.currency, SUM(l.amount) FROM (
+		SELECT t.category_id, t.amount, t.currency FROM transactions t WHERE t.user_id = $1 AND t.category_id IS NOT NULL AND t.date >= $2 AND t.date < $3
+		UNION ALL
+		SELECT s.category_id, s.amount, t.currency FROM transaction_splits s JOIN transactions t ON t.id = s.transaction_id WHERE t.user_id = $1 AND t.date >= $2 AND t.date < $3
+	) l JOIN categories c ON c.id = l.category_id AND c.kind <> $4
+	GROUP BY c.id, c.name, c.kind, l.currency
+	ORDER BY c.kind, c.name, l.currency`, userID, from, to, models.CategoryKindAdjustment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []models.CategoryTotal{}
+	for rows.Next() {
+		var total models.CategoryTotal
+		var amount money.Decimal
+		var currency string
+		err := rows.Scan(&total.CategoryID, &total.CategoryName, &total.Kind, &currency, &amount)
+		if err != nil {
+			return nil, err
+		}
+		total.Total, err = money.FromDecimal(amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+
+	return totals, rows.Err()
+}
+
+func (r *transactionRepository) CountTransactionsByPayeeID(payeeID int) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE payee_id = $1", payeeID).Scan(&count)
+	return count, err
+}
+
+func (r *transactionRepository) ReassignPayee(fromID int, toID int) error {
+	_, err := r.db.Exec("UPDATE transactions SET payee_id = $1 WHERE payee_id = $2", toID, fromID)
+	return err
+}
@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"balance-tracker/models"
+)
+
+type transferRepository struct {
+	db querier
+}
+
+func NewTransferRepository(db *DB) TransferRepository {
+	if db.memory != nil {
+		return &memoryTransferRepository{store: db.memory}
+	}
+	return &transferRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *transferRepository) WithTx(tx *sql.Tx) TransferRepository {
+	return &transferRepository{r.db.withTx(tx)}
+}
+
+// CreateTransfer stores the transfer itself. Its two ledger entries are
+// written by the transaction repository with the returned ID.
+func (r *transferRepository) CreateTransfer(transfer models.Transfer) (models.Transfer, error) {
+	err := r.db.QueryRow("INSERT INTO transfers (user_id, rate) VALUES ($1, $2) RETURNING id, created_at", transfer.UserID, transfer.Rate).
+		Scan(&transfer.ID, &transfer.CreatedAt)
+	return transfer, err
+}
+
+func (r *transferRepository) DeleteTransfer(id int) error {
+	_, err := r.db.Exec("DELETE FROM transfers WHERE id = $1", id)
+	return err
+}
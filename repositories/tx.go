@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so repositories can run
+// their queries either directly or inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// maxTxAttempts bounds how often a transaction is retried after a
+// serialization failure or deadlock.
+const maxTxAttempts = 5
+
+type TxRunner struct {
+	db *DB
+}
+
+func NewTxRunner(db *DB) *TxRunner {
+	return &TxRunner{db}
+}
+
+// RunInTx runs fn inside a database transaction and commits it if fn
+// succeeds. Transactions that fail because they conflicted with a concurrent
+// one are rolled back and retried from the start, so fn must not have side
+// effects outside the transaction.
+//
+// On the in-memory backend fn is passed a nil tx, which the repositories'
+// WithTx accept.
+func (r *TxRunner) RunInTx(fn func(tx *sql.Tx) error) error {
+	if r.db.memory != nil {
+		return r.db.memory.runInTx(func() error { return fn(nil) })
+	}
+
+	return r.run(nil, fn)
+}
+
+// RunInReadTx is RunInTx for fn that only reads: on Postgres the
+// transaction is READ ONLY and REPEATABLE READ, so it sees one snapshot of
+// the database without locking any rows. SQLite takes its write lock for
+// every transaction.
+func (r *TxRunner) RunInReadTx(fn func(tx *sql.Tx) error) error {
+	if r.db.memory != nil {
+		return r.db.memory.runInTx(func() error { return fn(nil) })
+	}
+
+	return r.run(&sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, fn)
+}
+
+func (r *TxRunner) run(opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = r.runOnce(opts, fn)
+		if err == nil || !r.db.Dialect.IsRetryable(err) {
+			return err
+		}
+
+		log.Printf("retrying transaction after conflict (attempt %d): %v", attempt, err)
+		time.Sleep(time.Duration(attempt*attempt) * 10 * time.Millisecond)
+	}
+
+	return err
+}
+
+func (r *TxRunner) runOnce(opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
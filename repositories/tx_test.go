@@ -0,0 +1,221 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/repositories"
+)
+
+var errConflict = errors.New("conflict")
+
+// conflictDialect treats errConflict as retryable, standing in for the
+// serialization failures and deadlocks of a real backend.
+type conflictDialect struct {
+	repositories.Dialect
+}
+
+func (d conflictDialect) IsRetryable(err error) bool {
+	return errors.Is(err, errConflict) || d.Dialect.IsRetryable(err)
+}
+
+func TestRunInTxRetriesConflicts(t *testing.T) {
+	db, err := repositories.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Dialect = conflictDialect{db.Dialect}
+
+	_, err = db.Exec("CREATE TABLE attempts (attempt INTEGER)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err = repositories.NewTxRunner(db).RunInTx(func(tx *sql.Tx) error {
+		attempts++
+		_, err := tx.Exec("INSERT INTO attempts (attempt) VALUES (?)", attempts)
+		if err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return errConflict
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("ran %d times, want 3", attempts)
+	}
+
+	// The failed attempts were rolled back
+	var count, last int
+	err = db.QueryRow("SELECT COUNT(*), MAX(attempt) FROM attempts").Scan(&count, &last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || last != 3 {
+		t.Fatalf("%d rows, last from attempt %d, want only the third attempt's", count, last)
+	}
+
+	// Other errors are returned at once, and a conflict that persists is
+	// given up on eventually
+	attempts = 0
+	failure := errors.New("failure")
+	err = repositories.NewTxRunner(db).RunInTx(func(tx *sql.Tx) error {
+		attempts++
+		return failure
+	})
+	if err != failure || attempts != 1 {
+		t.Fatalf("err = %v after %d attempts, want %v after 1", err, attempts, failure)
+	}
+
+	attempts = 0
+	err = repositories.NewTxRunner(db).RunInTx(func(tx *sql.Tx) error {
+		attempts++
+		return errConflict
+	})
+	if err != errConflict || attempts < 2 {
+		t.Fatalf("err = %v after %d attempts, want %v after several", err, attempts, errConflict)
+	}
+}
+
+// TestRunInTxInMemory checks that the in-memory store undoes a failed
+// transaction and keeps a successful one.
+func TestRunInTxInMemory(t *testing.T) {
+	db, err := repositories.Open("memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := repositories.NewUserRepository(db)
+	runner := repositories.NewTxRunner(db)
+
+	failure := errors.New("failure")
+	err = runner.RunInTx(func(tx *sql.Tx) error {
+		err := users.WithTx(tx).CreateUser(models.User{Username: "rolled-back"})
+		if err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	_, err = users.GetUserByUsername("rolled-back")
+	if err != sql.ErrNoRows {
+		t.Fatalf("user of the failed transaction: err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	err = runner.RunInTx(func(tx *sql.Tx) error {
+		return users.WithTx(tx).CreateUser(models.User{Username: "committed"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := users.GetUserByUsername("committed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.BaseCurrency != "JPY" {
+		t.Fatalf("base currency %q, want the default JPY", user.BaseCurrency)
+	}
+
+	// Unique columns are enforced like in the database
+	err = users.CreateUser(models.User{Username: "committed"})
+	if err == nil {
+		t.Fatal("created a second user with the same name")
+	}
+}
+
+// TestRunInTxRetriesDeadlock makes two transactions lock the same rows in
+// opposite order. Postgres aborts one of them with a deadlock (40P01), which
+// must be retried rather than surface as an error.
+func TestRunInTxRetriesDeadlock(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set, SQLite has no row locks to deadlock on")
+	}
+
+	db, err := repositories.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	table := fmt.Sprintf("deadlock_test_%d", time.Now().UnixNano())
+	_, err = db.Exec("CREATE TABLE " + table + " (id INTEGER PRIMARY KEY, n INTEGER NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE " + table)
+	_, err = db.Exec("INSERT INTO " + table + " (id, n) VALUES (1, 0), (2, 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txRunner := repositories.NewTxRunner(db)
+	var attempts atomic.Int64
+	var locked sync.WaitGroup
+	locked.Add(2)
+	var once [2]sync.Once
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, order := range [][2]int{{1, 2}, {2, 1}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = txRunner.RunInTx(func(tx *sql.Tx) error {
+				attempts.Add(1)
+				_, err := tx.Exec("UPDATE "+table+" SET n = n + 1 WHERE id = $1", order[0])
+				if err != nil {
+					return err
+				}
+				// Only the first attempts wait for each other, so that
+				// they are sure to deadlock
+				once[i].Do(func() {
+					locked.Done()
+					locked.Wait()
+				})
+				_, err = tx.Exec("UPDATE "+table+" SET n = n + 1 WHERE id = $1", order[1])
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if attempts.Load() < 3 {
+		t.Fatalf("%d attempts, want a retry after the deadlock", attempts.Load())
+	}
+
+	rows, err := db.Query("SELECT n FROM " + table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Fatalf("row updated %d times, want 2", n)
+		}
+	}
+}
@@ -6,19 +6,27 @@ import (
 	"balance-tracker/models"
 )
 
-type UserRepository struct {
-	db *sql.DB
+type userRepository struct {
+	db querier
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db}
+func NewUserRepository(db *DB) UserRepository {
+	if db.memory != nil {
+		return &memoryUserRepository{store: db.memory}
+	}
+	return &userRepository{newQuerier(db)}
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *userRepository) WithTx(tx *sql.Tx) UserRepository {
+	return &userRepository{r.db.withTx(tx)}
 }
 
-func (r *UserRepository) GetUser(id int) (models.User, error) {
-	row := r.db.QueryRow("SELECT * FROM users WHERE id = $1", id)
+func (r *userRepository) GetUser(id int) (models.User, error) {
+	row := r.db.QueryRow("SELECT id, username, password, base_currency, envelope_start, created_at, updated_at FROM users WHERE id = $1", id)
 
 	user := models.User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.BaseCurrency, &user.EnvelopeStart, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -26,11 +34,11 @@ func (r *UserRepository) GetUser(id int) (models.User, error) {
 	return user, nil
 }
 
-func (r *UserRepository) GetUserByUsername(username string) (models.User, error) {
-	row := r.db.QueryRow("SELECT * FROM users WHERE username = $1", username)
+func (r *userRepository) GetUserByUsername(username string) (models.User, error) {
+	row := r.db.QueryRow("SELECT id, username, password, base_currency, envelope_start, created_at, updated_at FROM users WHERE username = $1", username)
 
 	user := models.User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.BaseCurrency, &user.EnvelopeStart, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -38,17 +46,45 @@ func (r *UserRepository) GetUserByUsername(username string) (models.User, error)
 	return user, nil
 }
 
-func (r *UserRepository) CreateUser(user models.User) error {
+func (r *userRepository) CreateUser(user models.User) error {
 	_, err := r.db.Exec("INSERT INTO users (username, password, created_at, updated_at) VALUES ($1, $2, $3, $4)", user.Username, user.Password, user.CreatedAt, user.UpdatedAt)
 	return err
 }
 
-func (r *UserRepository) UpdateUser(id int, user models.User) error {
-	_, err := r.db.Exec("UPDATE users SET username = $1, password = $2, updated_at = $3 WHERE id = $4", user.Username, user.Password, user.UpdatedAt, id)
+func (r *userRepository) UpdateUser(id int, user models.User) error {
+	_, err := r.db.Exec("UPDATE users SET username = $1, password = $2, base_currency = $3, envelope_start = $4, updated_at = $5 WHERE id = $6", user.Username, user.Password, user.BaseCurrency, user.EnvelopeStart, user.UpdatedAt, id)
 	return err
 }
 
-func (r *UserRepository) DeleteUser(id int) error {
+func (r *userRepository) DeleteUser(id int) error {
 	_, err := r.db.Exec("DELETE FROM users WHERE id = $1", id)
 	return err
 }
+
+// userDataTables are the tables holding a user's data, in an order that
+// deletes rows before the rows they reference.
+var userDataTables = []string{
+	"transactions",
+	"transfers",
+	"recurring_transactions",
+	"budgets",
+	"envelope_assignments",
+	"goals",
+	"import_profiles",
+	"payee_aliases",
+	"payees",
+	"tags",
+	"balances",
+	"accounts",
+	"categories",
+}
+
+func (r *userRepository) DeleteUserData(id int) error {
+	for _, table := range userDataTables {
+		_, err := r.db.Exec("DELETE FROM "+table+" WHERE user_id = $1", id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrAccountNotFound        = errors.New("account not found")
+	ErrAccountHasTransactions = errors.New("account still has transactions")
+)
+
+// DefaultCurrency is used for accounts created without an explicit currency.
+const DefaultCurrency = "JPY"
+
+type AccountService struct {
+	accountRepository     repositories.AccountRepository
+	transactionRepository repositories.TransactionRepository
+	balanceRepository     repositories.BalanceRepository
+	txRunner              repositories.TxRunner
+}
+
+func NewAccountService(accountRepository repositories.AccountRepository, transactionRepository repositories.TransactionRepository, balanceRepository repositories.BalanceRepository, txRunner *repositories.TxRunner) *AccountService {
+	return &AccountService{
+		accountRepository:     accountRepository,
+		transactionRepository: transactionRepository,
+		balanceRepository:     balanceRepository,
+		txRunner:              *txRunner,
+	}
+}
+
+func (s *AccountService) GetAccountsByUserID(userID int) ([]models.Account, error) {
+	accounts, err := s.accountRepository.GetAccountsByUserID(userID)
+	return accounts, err
+}
+
+// GetAccount returns the account only if it belongs to the user.
+func (s *AccountService) GetAccount(userID int, id int) (models.Account, error) {
+	return getOwnedAccount(s.accountRepository, userID, id)
+}
+
+func (s *AccountService) CreateAccount(account models.Account) (models.Account, error) {
+	err := normalizeAccount(&account)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	var created models.Account
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		created, err = s.accountRepository.WithTx(tx).CreateAccount(account)
+		if err != nil {
+			return err
+		}
+
+		_, err = recalculateBalance(s.transactionRepository.WithTx(tx), s.balanceRepository.WithTx(tx), created)
+		return err
+	})
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	return created, nil
+}
+
+func (s *AccountService) UpdateAccount(userID int, id int, account models.Account) (models.Account, error) {
+	err := normalizeAccount(&account)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	var updated models.Account
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		accounts := s.accountRepository.WithTx(tx)
+		transactions := s.transactionRepository.WithTx(tx)
+
+		existing, err := lockOwnedAccount(accounts, userID, id)
+		if err != nil {
+			return err
+		}
+
+		// Existing entries are recorded in the old currency
+		if account.Currency != existing.Currency {
+			count, err := transactions.CountTransactionsByAccountID(id)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrAccountHasTransactions
+			}
+		}
+
+		existing.Name = account.Name
+		existing.Type = account.Type
+		existing.Currency = account.Currency
+		existing.OpeningBalance = account.OpeningBalance
+		existing.UpdatedAt = time.Now()
+
+		err = accounts.UpdateAccount(id, existing)
+		if err != nil {
+			return err
+		}
+		updated = existing
+
+		// The opening balance feeds into every later balance
+		_, err = recalculateBalance(transactions, s.balanceRepository.WithTx(tx), existing)
+		return err
+	})
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	return updated, nil
+}
+
+// DeleteAccount removes an empty account. Accounts that still have ledger
+// entries are kept so that no history is lost.
+func (s *AccountService) DeleteAccount(userID int, id int) error {
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		accounts := s.accountRepository.WithTx(tx)
+
+		_, err := lockOwnedAccount(accounts, userID, id)
+		if err != nil {
+			return err
+		}
+
+		count, err := s.transactionRepository.WithTx(tx).CountTransactionsByAccountID(id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAccountHasTransactions
+		}
+
+		return accounts.DeleteAccount(id)
+	})
+}
+
+// CreateDefaultAccount gives a newly registered user a cash account to start
+// recording into.
+func (s *AccountService) CreateDefaultAccount(user models.User) error {
+	_, err := s.CreateAccount(models.Account{
+		UserID: user.ID,
+		Name:   "Cash",
+		Type:   models.AccountTypeCash,
+	})
+	return err
+}
+
+func normalizeAccount(account *models.Account) error {
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		return errors.New("account name is required")
+	}
+
+	if account.Type == "" {
+		account.Type = models.AccountTypeCash
+	}
+	if !account.Type.Valid() {
+		return errors.New("invalid account type")
+	}
+
+	if strings.TrimSpace(account.Currency) == "" {
+		account.Currency = DefaultCurrency
+	}
+	currency, err := money.LookupCurrency(account.Currency)
+	if err != nil {
+		return err
+	}
+	account.Currency = currency.Code
+
+	// The opening balance is kept in the account's currency
+	if account.OpeningBalance.Currency() != account.Currency {
+		if !account.OpeningBalance.IsZero() {
+			return money.ErrCurrencyMismatch
+		}
+		account.OpeningBalance = money.Zero(account.Currency)
+	}
+
+	return nil
+}
+
+func getOwnedAccount(accountRepository repositories.AccountRepository, userID int, id int) (models.Account, error) {
+	account, err := accountRepository.GetAccount(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Account{}, ErrAccountNotFound
+		}
+		return models.Account{}, err
+	}
+
+	if account.UserID != userID {
+		return models.Account{}, ErrAccountNotFound
+	}
+
+	return account, nil
+}
@@ -4,49 +4,79 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"time"
 
 	"balance-tracker/models"
 	"balance-tracker/repositories"
 	"balance-tracker/utils"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, session revoked")
+)
+
+// refreshReuseGrace is how long after a refresh token was rotated it may
+// still be presented without being treated as stolen. The web app refreshes
+// from the cookie on whatever request first finds the access token expired,
+// and a page fires several htmx requests at once, so the same refresh token
+// routinely arrives a few times within moments. Those late requests only get
+// an access token; a copy replayed after the window revokes the family. The
+// window is kept short because within it a stolen token is not detected.
+const refreshReuseGrace = 30 * time.Second
+
+// TokenPair is what a client holds after logging in: a short-lived access
+// token and the refresh token to get the next one with. RefreshToken is
+// empty if the client should keep the one it has.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token,omitempty"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Client describes the device a login or refresh comes from.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
 type AuthService struct {
 	userRepository    repositories.UserRepository
 	sessionRepository repositories.SessionRepository
+	tokenIssuer       *utils.TokenIssuer
+	registerHooks     []func(user models.User) error
 }
 
-func NewAuthService(userRepository *repositories.UserRepository, sessionRepository *repositories.SessionRepository) *AuthService {
+func NewAuthService(userRepository repositories.UserRepository, sessionRepository repositories.SessionRepository, tokenIssuer *utils.TokenIssuer) *AuthService {
 	return &AuthService{
-		userRepository:    *userRepository,
-		sessionRepository: *sessionRepository,
+		userRepository:    userRepository,
+		sessionRepository: sessionRepository,
+		tokenIssuer:       tokenIssuer,
 	}
 }
 
-func (s *AuthService) Login(username string, password string) (string, error) {
+func (s *AuthService) Login(username string, password string, client Client) (TokenPair, error) {
 	// Get the user
 	user, err := s.userRepository.GetUserByUsername(username)
 	if err != nil {
-		return "", err
+		return TokenPair{}, err
 	}
 
 	// Check the password
 	if !utils.ComparePasswords(user.Password, password) {
-		return "", errors.New("invalid password")
-	}
-
-	// Generate a token
-	token, err := utils.GenerateToken(user)
-	if err != nil {
-		return "", err
+		return TokenPair{}, errors.New("invalid password")
 	}
 
-	// Create a new session
-	err = s.sessionRepository.CreateSessionFromToken(token)
+	// Start a new token family
+	familyID, err := utils.NewOpaqueToken()
 	if err != nil {
-		return "", err
+		return TokenPair{}, err
 	}
 
-	return token, nil
+	return s.issueTokens(user, familyID, client)
 }
 
 func (s *AuthService) Register(user models.User) error {
@@ -72,29 +102,189 @@ func (s *AuthService) Register(user models.User) error {
 		return err
 	}
 
+	user, err = s.userRepository.GetUserByUsername(user.Username)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range s.registerHooks {
+		err = hook(user)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *AuthService) Logout(token string) error {
-	err := s.sessionRepository.DeleteSessionByToken(token)
+// OnRegister adds a hook that runs after a new user has been created, for
+// example to set up their default data.
+func (s *AuthService) OnRegister(hook func(user models.User) error) {
+	s.registerHooks = append(s.registerHooks, hook)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token can
+// be used once; presenting a used one again means it was copied, so the
+// whole family is revoked and both holders have to log in again.
+func (s *AuthService) Refresh(refreshToken string, client Client) (TokenPair, error) {
+	session, err := s.sessionRepository.GetSessionByTokenHash(utils.HashToken(refreshToken))
 	if err != nil {
-		return err
+		return TokenPair{}, ErrInvalidRefreshToken
 	}
 
-	return nil
+	now := time.Now()
+	if session.DeletedAt.Valid || !now.Before(session.ExpiresAt) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepository.GetUser(session.UserID)
+	if err != nil {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if !session.UsedAt.Valid {
+		won, err := s.sessionRepository.MarkSessionUsed(session.ID, now)
+		if err != nil {
+			return TokenPair{}, err
+		}
+		if won {
+			return s.issueTokens(user, session.FamilyID, client)
+		}
+
+		session, err = s.sessionRepository.GetSession(session.ID)
+		if err != nil {
+			return TokenPair{}, err
+		}
+	}
+
+	// Browsers send several requests at once when the access token expires,
+	// all with the same refresh token. The ones that lose the race get an
+	// access token, but no new refresh token.
+	if now.Sub(session.UsedAt.Time) <= refreshReuseGrace {
+		accessToken, accessExpiresAt, err := s.tokenIssuer.GenerateToken(user, session.FamilyID)
+		if err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{AccessToken: accessToken, AccessExpiresAt: accessExpiresAt}, nil
+	}
+
+	log.Printf("refresh token reuse detected for user %d, revoking session %s", session.UserID, session.FamilyID)
+	err = s.sessionRepository.DeleteSessionFamily(session.FamilyID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{}, ErrRefreshTokenReused
 }
 
-func (s *AuthService) TokenValid(token string) bool {
-	session, err := s.sessionRepository.GetSessionByToken(token)
+// issueTokens adds a refresh token to the family and pairs it with a new
+// access token.
+func (s *AuthService) issueTokens(user models.User, familyID string, client Client) (TokenPair, error) {
+	refreshToken, err := utils.NewOpaqueToken()
 	if err != nil {
-		log.Println(err)
-		return false
+		return TokenPair{}, err
 	}
 
-	if session.DeletedAt.Valid {
-		log.Println(err)
-		return false
+	session, err := s.sessionRepository.CreateSession(models.Session{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		TokenHash:  utils.HashToken(refreshToken),
+		ExpiresAt:  time.Now().Add(s.tokenIssuer.RefreshLifetime()),
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		LastSeenAt: time.Now(),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	accessToken, accessExpiresAt, err := s.tokenIssuer.GenerateToken(user, familyID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// Logout revokes the session that either token belongs to.
+func (s *AuthService) Logout(accessToken string, refreshToken string) error {
+	if claims, err := s.tokenIssuer.ParseToken(accessToken); err == nil {
+		return s.sessionRepository.DeleteSessionFamily(claims.SessionID)
+	}
+
+	session, err := s.sessionRepository.GetSessionByTokenHash(utils.HashToken(refreshToken))
+	if err != nil {
+		// Nothing to revoke
+		return nil
+	}
+
+	return s.sessionRepository.DeleteSessionFamily(session.FamilyID)
+}
+
+// Authenticate verifies an access token and checks that its session has not
+// been revoked.
+func (s *AuthService) Authenticate(accessToken string) (*utils.Claims, error) {
+	claims, err := s.tokenIssuer.ParseToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := s.sessionRepository.SessionFamilyActive(claims.SessionID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, errors.New("session has been revoked")
 	}
 
-	return true
+	return claims, nil
+}
+
+// GetSessions lists the user's signed-in devices. currentSessionID marks the
+// one making the request.
+func (s *AuthService) GetSessions(userID int, currentSessionID string) ([]models.Session, error) {
+	sessions, err := s.sessionRepository.GetActiveSessionsByUserID(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].FamilyID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out. It returns the revoked
+// session so callers can tell whether it was the current one.
+func (s *AuthService) RevokeSession(userID int, id int) (models.Session, error) {
+	session, err := s.sessionRepository.GetSession(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Session{}, ErrSessionNotFound
+		}
+		return models.Session{}, err
+	}
+
+	if session.UserID != userID {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	err = s.sessionRepository.DeleteSession(id)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current
+// device.
+func (s *AuthService) RevokeOtherSessions(userID int, currentSessionID string) error {
+	return s.sessionRepository.DeleteOtherSessions(userID, currentSessionID)
 }
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/utils"
+)
+
+// registerTestUser signs a user up through the auth service, running the
+// same hooks as main, and returns them with their password.
+func (s *testServices) registerTestUser(t *testing.T) (models.User, string) {
+	t.Helper()
+
+	username, password := fmt.Sprintf("auth-%d", time.Now().UnixNano()), "correct horse battery staple"
+	err := s.authService.Register(models.User{Username: username, Password: password, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.userRepository.GetUserByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.userRepository.DeleteUser(user.ID) })
+
+	return user, password
+}
+
+// login starts a new session for the user.
+func (s *testServices) login(t *testing.T, user models.User, password string) TokenPair {
+	t.Helper()
+
+	tokens, err := s.authService.Login(user.Username, password, Client{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login returned %+v, want both tokens", tokens)
+	}
+	return tokens
+}
+
+// sessionOf returns the stored session of a refresh token.
+func (s *testServices) sessionOf(t *testing.T, refreshToken string) models.Session {
+	t.Helper()
+
+	session, err := s.sessionRepository.GetSessionByTokenHash(utils.HashToken(refreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+	first := s.login(t, user, password)
+
+	second, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh returned refresh token %q, want a new one", second.RefreshToken)
+	}
+	claims, err := s.authService.Authenticate(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != user.ID {
+		t.Fatalf("access token of user %d, want %d", claims.UserID, user.ID)
+	}
+
+	// The new token belongs to the same login, and the old one is used up
+	if s.sessionOf(t, second.RefreshToken).FamilyID != s.sessionOf(t, first.RefreshToken).FamilyID {
+		t.Fatal("the rotated token started a new session family")
+	}
+	if !s.sessionOf(t, first.RefreshToken).UsedAt.Valid {
+		t.Fatal("the exchanged refresh token is not marked used")
+	}
+
+	// The new token rotates in turn
+	third, err := s.authService.Refresh(second.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.RefreshToken == "" || third.RefreshToken == second.RefreshToken {
+		t.Fatalf("second refresh returned refresh token %q, want a new one", third.RefreshToken)
+	}
+
+	_, err = s.authService.Refresh("not-a-token", Client{})
+	if err != ErrInvalidRefreshToken {
+		t.Fatalf("unknown refresh token: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestRefreshWithinGraceWindow(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+	first := s.login(t, user, password)
+
+	rotated, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A request that raced the rotation presents the old token moments
+	// later. It gets an access token, but no refresh token to fork the
+	// family with.
+	late, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("refresh within %v of the rotation: %v", refreshReuseGrace, err)
+	}
+	if late.AccessToken == "" || late.RefreshToken != "" {
+		t.Fatalf("late refresh returned %+v, want only an access token", late)
+	}
+	_, err = s.authService.Authenticate(late.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session goes on with the rotated token
+	_, err = s.authService.Refresh(rotated.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("rotated token after a late refresh: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+	first := s.login(t, user, password)
+	other := s.login(t, user, password)
+
+	current, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the current token as rotated longer ago than the grace
+	// window, then present it as a thief holding a copy would
+	won, err := s.sessionRepository.MarkSessionUsed(s.sessionOf(t, current.RefreshToken).ID, time.Now().Add(-refreshReuseGrace-time.Second))
+	if err != nil || !won {
+		t.Fatalf("marking the token used: %v, %v", won, err)
+	}
+
+	_, err = s.authService.Refresh(current.RefreshToken, Client{})
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("reused refresh token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// Every token of the family is revoked
+	for name, token := range map[string]string{"first": first.AccessToken, "current": current.AccessToken} {
+		_, err = s.authService.Authenticate(token)
+		if err == nil {
+			t.Fatalf("%s access token of a revoked family still authenticates", name)
+		}
+	}
+	for name, token := range map[string]string{"first": first.RefreshToken, "current": current.RefreshToken} {
+		_, err = s.authService.Refresh(token, Client{})
+		if err != ErrInvalidRefreshToken {
+			t.Fatalf("%s refresh token of a revoked family: err = %v, want %v", name, err, ErrInvalidRefreshToken)
+		}
+	}
+
+	// The user's other logins are not affected
+	_, err = s.authService.Authenticate(other.AccessToken)
+	if err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+	_, err = s.authService.Refresh(other.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+}
+
+func TestLogoutRevokesFamily(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+
+	t.Run("by access token", func(t *testing.T) {
+		first := s.login(t, user, password)
+		rotated, err := s.authService.Refresh(first.RefreshToken, Client{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.authService.Logout(rotated.AccessToken, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.authService.Authenticate(first.AccessToken)
+		if err == nil {
+			t.Fatal("access token issued before the rotation still authenticates")
+		}
+		_, err = s.authService.Authenticate(rotated.AccessToken)
+		if err == nil {
+			t.Fatal("access token still authenticates after logout")
+		}
+		_, err = s.authService.Refresh(rotated.RefreshToken, Client{})
+		if err != ErrInvalidRefreshToken {
+			t.Fatalf("refresh after logout: err = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+		// Not even within the grace window of the earlier rotation
+		_, err = s.authService.Refresh(first.RefreshToken, Client{})
+		if err != ErrInvalidRefreshToken {
+			t.Fatalf("rotated-out token after logout: err = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("by refresh token", func(t *testing.T) {
+		tokens := s.login(t, user, password)
+
+		err := s.authService.Logout("", tokens.RefreshToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.authService.Authenticate(tokens.AccessToken)
+		if err == nil {
+			t.Fatal("access token still authenticates after logout")
+		}
+		_, err = s.authService.Refresh(tokens.RefreshToken, Client{})
+		if err != ErrInvalidRefreshToken {
+			t.Fatalf("refresh after logout: err = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+	})
+
+	t.Run("by revoking the family", func(t *testing.T) {
+		tokens := s.login(t, user, password)
+
+		err := s.sessionRepository.DeleteSessionFamily(s.sessionOf(t, tokens.RefreshToken).FamilyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.authService.Authenticate(tokens.AccessToken)
+		if err == nil {
+			t.Fatal("access token of a revoked family still authenticates")
+		}
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+	intruder, intruderPassword := s.registerTestUser(t)
+
+	kept := s.login(t, user, password)
+	first := s.login(t, user, password)
+	revoked, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := s.login(t, intruder, intruderPassword)
+
+	// Another user's session is not found and stays signed in
+	foreignSession := s.sessionOf(t, foreign.RefreshToken)
+	_, err = s.authService.RevokeSession(user.ID, foreignSession.ID)
+	if err != ErrSessionNotFound {
+		t.Fatalf("revoking another user's session: err = %v, want %v", err, ErrSessionNotFound)
+	}
+	_, err = s.authService.Authenticate(foreign.AccessToken)
+	if err != nil {
+		t.Fatalf("another user's session was revoked: %v", err)
+	}
+	stored, err := s.sessionRepository.GetSession(foreignSession.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DeletedAt.Valid {
+		t.Fatal("another user's session was marked deleted")
+	}
+
+	_, err = s.authService.RevokeSession(user.ID, foreignSession.ID+1000)
+	if err != ErrSessionNotFound {
+		t.Fatalf("revoking a session that does not exist: err = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	// Revoking a token that was rotated away revokes its whole login
+	session, err := s.authService.RevokeSession(user.ID, s.sessionOf(t, first.RefreshToken).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.FamilyID != s.sessionOf(t, revoked.RefreshToken).FamilyID {
+		t.Fatalf("revoked session of family %q, want %q", session.FamilyID, s.sessionOf(t, revoked.RefreshToken).FamilyID)
+	}
+	_, err = s.authService.Authenticate(revoked.AccessToken)
+	if err == nil {
+		t.Fatal("access token of the revoked session still authenticates")
+	}
+	_, err = s.authService.Refresh(revoked.RefreshToken, Client{})
+	if err != ErrInvalidRefreshToken {
+		t.Fatalf("refresh of the revoked session: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	// The user's other login is untouched
+	_, err = s.authService.Authenticate(kept.AccessToken)
+	if err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	s := newTestServices(t)
+	user, password := s.registerTestUser(t)
+	bystander, bystanderPassword := s.registerTestUser(t)
+
+	first := s.login(t, user, password)
+	current, err := s.authService.Refresh(first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := []TokenPair{s.login(t, user, password), s.login(t, user, password)}
+	unrelated := s.login(t, bystander, bystanderPassword)
+
+	claims, err := s.authService.Authenticate(current.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.authService.RevokeOtherSessions(user.ID, claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The current login keeps working, including its rotated token's
+	// access token and its refresh token
+	for name, token := range map[string]string{"first": first.AccessToken, "current": current.AccessToken} {
+		_, err = s.authService.Authenticate(token)
+		if err != nil {
+			t.Fatalf("%s access token of the current session: %v", name, err)
+		}
+	}
+	_, err = s.authService.Refresh(current.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("refresh of the current session: %v", err)
+	}
+
+	for i, tokens := range others {
+		_, err = s.authService.Authenticate(tokens.AccessToken)
+		if err == nil {
+			t.Fatalf("other session %d still authenticates", i)
+		}
+		_, err = s.authService.Refresh(tokens.RefreshToken, Client{})
+		if err != ErrInvalidRefreshToken {
+			t.Fatalf("refresh of other session %d: err = %v, want %v", i, err, ErrInvalidRefreshToken)
+		}
+	}
+
+	_, err = s.authService.Authenticate(unrelated.AccessToken)
+	if err != nil {
+		t.Fatalf("another user's session was revoked: %v", err)
+	}
+
+	sessions, err := s.authService.GetSessions(user.ID, claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].FamilyID != claims.SessionID || !sessions[0].Current {
+		t.Fatalf("sessions = %+v, want only the current one", sessions)
+	}
+}
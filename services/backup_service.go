@@ -0,0 +1,1012 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// backupFrom and backupTo bound the queries that take a date range, so that
+// a backup covers all dates.
+var (
+	backupFrom = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	backupTo   = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// BackupService writes everything a user owns to a backup and restores it,
+// on the same instance or on another one. Both run in one database
+// transaction, so a backup is a consistent snapshot and a restore that fails
+// leaves nothing behind.
+type BackupService struct {
+	userRepository          repositories.UserRepository
+	accountRepository       repositories.AccountRepository
+	categoryRepository      repositories.CategoryRepository
+	tagRepository           repositories.TagRepository
+	payeeRepository         repositories.PayeeRepository
+	transactionRepository   repositories.TransactionRepository
+	transferRepository      repositories.TransferRepository
+	recurringRepository     repositories.RecurringRepository
+	budgetRepository        repositories.BudgetRepository
+	envelopeRepository      repositories.EnvelopeRepository
+	goalRepository          repositories.GoalRepository
+	importProfileRepository repositories.ImportProfileRepository
+	balanceRepository       repositories.BalanceRepository
+	txRunner                repositories.TxRunner
+}
+
+func NewBackupService(userRepository repositories.UserRepository, accountRepository repositories.AccountRepository, categoryRepository repositories.CategoryRepository, tagRepository repositories.TagRepository, payeeRepository repositories.PayeeRepository, transactionRepository repositories.TransactionRepository, transferRepository repositories.TransferRepository, recurringRepository repositories.RecurringRepository, budgetRepository repositories.BudgetRepository, envelopeRepository repositories.EnvelopeRepository, goalRepository repositories.GoalRepository, importProfileRepository repositories.ImportProfileRepository, balanceRepository repositories.BalanceRepository, txRunner *repositories.TxRunner) *BackupService {
+	return &BackupService{
+		userRepository:          userRepository,
+		accountRepository:       accountRepository,
+		categoryRepository:      categoryRepository,
+		tagRepository:           tagRepository,
+		payeeRepository:         payeeRepository,
+		transactionRepository:   transactionRepository,
+		transferRepository:      transferRepository,
+		recurringRepository:     recurringRepository,
+		budgetRepository:        budgetRepository,
+		envelopeRepository:      envelopeRepository,
+		goalRepository:          goalRepository,
+		importProfileRepository: importProfileRepository,
+		balanceRepository:       balanceRepository,
+		txRunner:                *txRunner,
+	}
+}
+
+// backupTx is the repositories bound to one database transaction.
+type backupTx struct {
+	users          repositories.UserRepository
+	accounts       repositories.AccountRepository
+	categories     repositories.CategoryRepository
+	tags           repositories.TagRepository
+	payees         repositories.PayeeRepository
+	transactions   repositories.TransactionRepository
+	transfers      repositories.TransferRepository
+	recurring      repositories.RecurringRepository
+	budgets        repositories.BudgetRepository
+	envelopes      repositories.EnvelopeRepository
+	goals          repositories.GoalRepository
+	importProfiles repositories.ImportProfileRepository
+	balances       repositories.BalanceRepository
+}
+
+func (s *BackupService) inBackupTx(fn func(b backupTx) error) error {
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		return fn(backupTx{
+			users:          s.userRepository.WithTx(tx),
+			accounts:       s.accountRepository.WithTx(tx),
+			categories:     s.categoryRepository.WithTx(tx),
+			tags:           s.tagRepository.WithTx(tx),
+			payees:         s.payeeRepository.WithTx(tx),
+			transactions:   s.transactionRepository.WithTx(tx),
+			transfers:      s.transferRepository.WithTx(tx),
+			recurring:      s.recurringRepository.WithTx(tx),
+			budgets:        s.budgetRepository.WithTx(tx),
+			envelopes:      s.envelopeRepository.WithTx(tx),
+			goals:          s.goalRepository.WithTx(tx),
+			importProfiles: s.importProfileRepository.WithTx(tx),
+			balances:       s.balanceRepository.WithTx(tx),
+		})
+	})
+}
+
+// Export returns everything the user owns as a backup made at now.
+func (s *BackupService) Export(userID int, now time.Time) (models.Backup, error) {
+	var backup models.Backup
+	err := s.inBackupTx(func(b backupTx) error {
+		backup = models.Backup{
+			Format:     models.BackupFormat,
+			Version:    models.BackupVersion,
+			ExportedAt: now,
+			Tags:       []string{},
+			Recurring:  []models.BackupRecurring{},
+		}
+
+		user, err := b.users.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		backup.Settings = models.BackupSettings{BaseCurrency: user.BaseCurrency, EnvelopeStart: user.EnvelopeStart}
+
+		backup.Accounts, err = b.accounts.GetAccountsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		backup.Categories, err = b.categories.GetCategoriesByUserID(userID)
+		if err != nil {
+			return err
+		}
+
+		tags, err := b.tags.GetTagsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			backup.Tags = append(backup.Tags, tag.Name)
+		}
+		sort.Strings(backup.Tags)
+
+		backup.Payees, err = b.payees.GetPayeesByUserID(userID)
+		if err != nil {
+			return err
+		}
+		backup.Transactions, err = b.transactions.GetTransactionsByUserID(userID, models.TransactionFilter{})
+		if err != nil {
+			return err
+		}
+
+		templates, err := b.recurring.GetRecurringTransactionsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		for _, template := range templates {
+			occurrences, err := b.recurring.GetOccurrences(template.ID, backupFrom, backupTo)
+			if err != nil {
+				return err
+			}
+			recurring := models.BackupRecurring{RecurringTransaction: template, Occurrences: []models.BackupOccurrence{}}
+			for _, occurrence := range occurrences {
+				saved := models.BackupOccurrence{
+					Date:          occurrence.Date,
+					Status:        occurrence.Status,
+					TransactionID: occurrence.TransactionID,
+				}
+				if occurrence.Edited {
+					saved.Amount, saved.Memo = &occurrence.Amount, occurrence.Memo
+				}
+				recurring.Occurrences = append(recurring.Occurrences, saved)
+			}
+			backup.Recurring = append(backup.Recurring, recurring)
+		}
+
+		backup.Budgets, err = b.budgets.GetBudgetsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		backup.EnvelopeAssignments, err = b.envelopes.GetAssignments(userID, backupFrom, backupTo)
+		if err != nil {
+			return err
+		}
+		backup.Goals, err = b.goals.GetGoalsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		backup.ImportProfiles, err = b.importProfiles.GetImportProfilesByUserID(userID)
+		return err
+	})
+	if err != nil {
+		return models.Backup{}, err
+	}
+
+	return backup, nil
+}
+
+// Restore loads a backup into the user's data. Replacing deletes their data
+// and settings first; merging keeps them and leaves out the records they
+// have already, matched by name or, for ledger entries, by account, date,
+// amount and memo, so that merging the same backup twice adds nothing. The
+// backup is checked in full before anything is written.
+func (s *BackupService) Restore(userID int, backup models.Backup, mode models.RestoreMode) (models.RestoreResult, error) {
+	if !mode.Valid() {
+		return models.RestoreResult{}, fmt.Errorf("%w: unknown restore mode %q", ErrInvalidBackup, mode)
+	}
+	err := validateBackup(&backup)
+	if err != nil {
+		return models.RestoreResult{}, err
+	}
+
+	var result models.RestoreResult
+	err = s.inBackupTx(func(b backupTx) error {
+		result = models.RestoreResult{Mode: mode}
+
+		if mode == models.RestoreReplace {
+			err := b.users.DeleteUserData(userID)
+			if err != nil {
+				return err
+			}
+
+			user, err := b.users.GetUser(userID)
+			if err != nil {
+				return err
+			}
+			user.BaseCurrency = backup.Settings.BaseCurrency
+			user.EnvelopeStart = backup.Settings.EnvelopeStart
+			user.UpdatedAt = time.Now()
+			err = b.users.UpdateUser(userID, user)
+			if err != nil {
+				return err
+			}
+		}
+
+		r := &restore{
+			backupTx:       b,
+			userID:         userID,
+			result:         &result,
+			accountIDs:     map[int]int{},
+			categoryIDs:    map[int]int{},
+			payeeIDs:       map[int]int{},
+			transactionIDs: map[int]int{},
+			touched:        map[int]bool{},
+		}
+		return r.run(backup)
+	})
+	if err != nil {
+		return models.RestoreResult{}, err
+	}
+
+	return result, nil
+}
+
+// restore writes a backup into one user's data. The maps take the IDs in the
+// backup to the IDs of the records restored or, when merging, of the
+// records the user had already.
+type restore struct {
+	backupTx
+	userID         int
+	result         *models.RestoreResult
+	accountIDs     map[int]int
+	categoryIDs    map[int]int
+	payeeIDs       map[int]int
+	transactionIDs map[int]int
+	// touched holds the accounts whose balance has to be recalculated.
+	touched map[int]bool
+}
+
+func (r *restore) run(backup models.Backup) error {
+	steps := []func(models.Backup) error{
+		r.restoreAccounts,
+		r.restoreCategories,
+		r.restorePayees,
+		r.restoreTags,
+		r.restoreTransactions,
+		r.restoreRecurring,
+		r.restoreBudgets,
+		r.restoreEnvelopeAssignments,
+		r.restoreGoals,
+		r.restoreImportProfiles,
+	}
+	for _, step := range steps {
+		err := step(backup)
+		if err != nil {
+			return err
+		}
+	}
+
+	accountIDs := []int{}
+	for id := range r.touched {
+		accountIDs = append(accountIDs, id)
+	}
+	sort.Ints(accountIDs)
+	for _, id := range accountIDs {
+		account, err := r.accounts.GetAccount(id)
+		if err != nil {
+			return err
+		}
+		_, err = recalculateBalance(r.transactions, r.balances, account)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *restore) restoreAccounts(backup models.Backup) error {
+	existing, err := r.accounts.GetAccountsByUserID(r.userID)
+	if err != nil {
+		return err
+	}
+	matches := map[string]int{}
+	for _, account := range existing {
+		matches[account.Name+"|"+account.Currency] = account.ID
+	}
+
+	for _, account := range backup.Accounts {
+		if id, ok := matches[account.Name+"|"+account.Currency]; ok {
+			r.accountIDs[account.ID] = id
+			r.result.Skipped++
+			continue
+		}
+
+		account.UserID = r.userID
+		created, err := r.accounts.CreateAccount(account)
+		if err != nil {
+			return err
+		}
+		r.accountIDs[account.ID] = created.ID
+		r.touched[created.ID] = true
+		r.result.Accounts++
+	}
+
+	return nil
+}
+
+// restoreCategories restores parents before their children. Categories are
+// matched by their path and kind.
+func (r *restore) restoreCategories(backup models.Backup) error {
+	existing, err := r.categories.GetCategoriesByUserID(r.userID)
+	if err != nil {
+		return err
+	}
+	existingPaths := categoryPaths(existing)
+	matches := map[string]int{}
+	for _, category := range existing {
+		matches[existingPaths[category.ID]+"|"+string(category.Kind)] = category.ID
+	}
+
+	paths := categoryPaths(backup.Categories)
+	byID := map[int]models.Category{}
+	for _, category := range backup.Categories {
+		byID[category.ID] = category
+	}
+
+	var restoreCategory func(category models.Category) (int, error)
+	restoreCategory = func(category models.Category) (int, error) {
+		if id, ok := r.categoryIDs[category.ID]; ok {
+			return id, nil
+		}
+		if id, ok := matches[paths[category.ID]+"|"+string(category.Kind)]; ok {
+			r.categoryIDs[category.ID] = id
+			r.result.Skipped++
+			return id, nil
+		}
+
+		backupID := category.ID
+		if category.ParentID != nil {
+			parentID, err := restoreCategory(byID[*category.ParentID])
+			if err != nil {
+				return 0, err
+			}
+			category.ParentID = &parentID
+		}
+		category.UserID = r.userID
+		created, err := r.categories.CreateCategory(category)
+		if err != nil {
+			return 0, err
+		}
+		r.categoryIDs[backupID] = created.ID
+		r.result.Categories++
+		return created.ID, nil
+	}
+
+	for _, category := range backup.Categories {
+		_, err := restoreCategory(category)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restorePayees matches payees by their name's alias. A restored payee
+// takes only the aliases no other payee has.
+func (r *restore) restorePayees(backup models.Backup) error {
+	for _, payee := range backup.Payees {
+		existing, err := r.payees.GetPayeeByAliasKey(r.userID, PayeeKey(payee.Name))
+		if err == nil {
+			r.payeeIDs[payee.ID] = existing.ID
+			r.result.Skipped++
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		payee.UserID = r.userID
+		payee.DefaultCategoryID = mapID(r.categoryIDs, payee.DefaultCategoryID)
+		created, err := r.payees.CreatePayee(payee)
+		if err != nil {
+			return err
+		}
+		for _, alias := range append([]string{payee.Name}, payee.Aliases...) {
+			_, err := r.payees.GetPayeeByAliasKey(r.userID, PayeeKey(alias))
+			if err == nil {
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+			err = r.payees.AddPayeeAlias(r.userID, created.ID, alias, PayeeKey(alias))
+			if err != nil {
+				return err
+			}
+		}
+		r.payeeIDs[payee.ID] = created.ID
+		r.result.Payees++
+	}
+
+	return nil
+}
+
+func (r *restore) restoreTags(backup models.Backup) error {
+	for _, name := range backup.Tags {
+		err := r.tags.CreateTag(r.userID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTransactions restores the oldest entries first, so that their new
+// IDs keep their order. An entry the user has already is matched at most
+// once, so entries that repeat are restored as often as the backup has them.
+func (r *restore) restoreTransactions(backup models.Backup) error {
+	existing, err := r.transactions.GetTransactionsByUserID(r.userID, models.TransactionFilter{})
+	if err != nil {
+		return err
+	}
+	matches := map[string][]int{}
+	for _, transaction := range existing {
+		key := transactionKey(transaction)
+		matches[key] = append(matches[key], transaction.ID)
+	}
+
+	for i := len(backup.Transactions) - 1; i >= 0; i-- {
+		transaction := backup.Transactions[i]
+		backupID := transaction.ID
+		transaction.AccountID = r.accountIDs[transaction.AccountID]
+		if transaction.Transfer != nil {
+			leg := *transaction.Transfer
+			leg.AccountID = r.accountIDs[leg.AccountID]
+			transaction.Transfer = &leg
+		}
+
+		key := transactionKey(transaction)
+		if ids := matches[key]; len(ids) > 0 {
+			r.transactionIDs[backupID] = ids[0]
+			matches[key] = ids[1:]
+			r.result.Skipped++
+			continue
+		}
+
+		id, err := r.createTransaction(transaction)
+		if err != nil {
+			return err
+		}
+		r.transactionIDs[backupID] = id
+		r.result.Transactions++
+	}
+
+	return nil
+}
+
+// createTransaction writes an entry whose account is mapped already. A
+// transfer's outgoing leg is written with its incoming leg.
+func (r *restore) createTransaction(transaction models.Transaction) (int, error) {
+	transaction.UserID = r.userID
+	transaction.CategoryID = mapID(r.categoryIDs, transaction.CategoryID)
+	transaction.PayeeID = mapID(r.payeeIDs, transaction.PayeeID)
+	splits := make([]models.Split, len(transaction.Splits))
+	for i, split := range transaction.Splits {
+		split.CategoryID = r.categoryIDs[split.CategoryID]
+		splits[i] = split
+	}
+
+	transaction.TransferID = nil
+	var incoming *models.Transaction
+	if transaction.Transfer != nil {
+		transfer, err := r.transfers.CreateTransfer(models.Transfer{UserID: r.userID, Rate: transaction.Transfer.Rate})
+		if err != nil {
+			return 0, err
+		}
+		transaction.TransferID = &transfer.ID
+		incoming = &models.Transaction{
+			UserID:     r.userID,
+			AccountID:  transaction.Transfer.AccountID,
+			Amount:     transaction.Transfer.Amount,
+			Date:       transaction.Date,
+			Memo:       transaction.Memo,
+			TransferID: &transfer.ID,
+		}
+	}
+
+	created, err := r.transactions.CreateTransaction(transaction)
+	if err != nil {
+		return 0, err
+	}
+	r.touched[created.AccountID] = true
+
+	if incoming != nil {
+		_, err = r.transactions.CreateTransaction(*incoming)
+		if err != nil {
+			return 0, err
+		}
+		r.touched[incoming.AccountID] = true
+	}
+
+	if len(transaction.Tags) > 0 {
+		err = r.transactions.SetTransactionTags(r.userID, created.ID, transaction.Tags)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(splits) > 0 {
+		err = r.transactions.SetTransactionSplits(created.ID, splits)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return created.ID, nil
+}
+
+// restoreRecurring restores templates with their occurrences, which keep
+// pointing at the entries they were posted as.
+func (r *restore) restoreRecurring(backup models.Backup) error {
+	existing, err := r.recurring.GetRecurringTransactionsByUserID(r.userID)
+	if err != nil {
+		return err
+	}
+	matches := map[string]bool{}
+	for _, template := range existing {
+		matches[recurringKey(template)] = true
+	}
+
+	for _, recurring := range backup.Recurring {
+		template := recurring.RecurringTransaction
+		template.UserID = r.userID
+		template.AccountID = r.accountIDs[template.AccountID]
+		template.CategoryID = r.categoryIDs[template.CategoryID]
+		if matches[recurringKey(template)] {
+			r.result.Skipped++
+			continue
+		}
+
+		created, err := r.recurring.CreateRecurringTransaction(template)
+		if err != nil {
+			return err
+		}
+		for _, saved := range recurring.Occurrences {
+			occurrence := models.RecurringOccurrence{
+				RecurringID:   created.ID,
+				Date:          saved.Date,
+				Status:        saved.Status,
+				TransactionID: mapID(r.transactionIDs, saved.TransactionID),
+			}
+			if saved.Amount != nil {
+				occurrence.Edited = true
+				occurrence.Amount, occurrence.Memo = *saved.Amount, saved.Memo
+			}
+			err := r.recurring.SaveOccurrence(occurrence)
+			if err != nil {
+				return err
+			}
+		}
+		r.result.Recurring++
+	}
+
+	return nil
+}
+
+// restoreBudgets keeps the user's own budget where both have one for a
+// category and month.
+func (r *restore) restoreBudgets(backup models.Backup) error {
+	existing, err := r.budgets.GetBudgetsByUserID(r.userID)
+	if err != nil {
+		return err
+	}
+	matches := map[string]bool{}
+	for _, budget := range existing {
+		matches[fmt.Sprintf("%d|%s", budget.CategoryID, monthStart(budget.Month).Format("2006-01"))] = true
+	}
+
+	for _, budget := range backup.Budgets {
+		budget.UserID = r.userID
+		budget.CategoryID = r.categoryIDs[budget.CategoryID]
+		if matches[fmt.Sprintf("%d|%s", budget.CategoryID, monthStart(budget.Month).Format("2006-01"))] {
+			r.result.Skipped++
+			continue
+		}
+
+		_, err := r.budgets.CreateBudget(budget)
+		if err != nil {
+			return err
+		}
+		r.result.Budgets++
+	}
+
+	return nil
+}
+
+func (r *restore) restoreEnvelopeAssignments(backup models.Backup) error {
+	existing, err := r.envelopes.GetAssignments(r.userID, backupFrom, backupTo)
+	if err != nil {
+		return err
+	}
+	matches := map[string]int{}
+	for _, assignment := range existing {
+		matches[assignmentKey(assignment)]++
+	}
+
+	for _, assignment := range backup.EnvelopeAssignments {
+		assignment.UserID = r.userID
+		assignment.CategoryID = r.categoryIDs[assignment.CategoryID]
+		if key := assignmentKey(assignment); matches[key] > 0 {
+			matches[key]--
+			r.result.Skipped++
+			continue
+		}
+
+		_, err := r.envelopes.CreateAssignment(assignment)
+		if err != nil {
+			return err
+		}
+		r.result.EnvelopeAssignments++
+	}
+
+	return nil
+}
+
+func (r *restore) restoreGoals(backup models.Backup) error {
+	existing, err := r.goals.GetGoalsByUserID(r.userID)
+	if err != nil {
+		return err
+	}
+	matches := map[string]bool{}
+	for _, goal := range existing {
+		matches[goal.Name] = true
+	}
+
+	for _, goal := range backup.Goals {
+		if matches[goal.Name] {
+			r.result.Skipped++
+			continue
+		}
+
+		goal.UserID = r.userID
+		goal.AccountID = mapID(r.accountIDs, goal.AccountID)
+		goal.CategoryID = mapID(r.categoryIDs, goal.CategoryID)
+		_, err := r.goals.CreateGoal(goal)
+		if err != nil {
+			return err
+		}
+		r.result.Goals++
+	}
+
+	return nil
+}
+
+func (r *restore) restoreImportProfiles(backup models.Backup) error {
+	for _, profile := range backup.ImportProfiles {
+		_, err := r.importProfiles.GetImportProfileByName(r.userID, profile.Name)
+		if err == nil {
+			r.result.Skipped++
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		profile.UserID = r.userID
+		_, err = r.importProfiles.CreateImportProfile(profile)
+		if err != nil {
+			return err
+		}
+		r.result.ImportProfiles++
+	}
+
+	return nil
+}
+
+// validateBackup checks a backup before it is restored: that it is a backup
+// this version can read, that every reference between its records resolves
+// and that its records would be accepted if they were entered by hand.
+// Names, memos and tags are normalized on the way.
+func validateBackup(backup *models.Backup) error {
+	if backup.Format != models.BackupFormat {
+		return fmt.Errorf("%w: the file is not a balance tracker backup", ErrInvalidBackup)
+	}
+	if backup.Version < 1 || backup.Version > models.BackupVersion {
+		return fmt.Errorf("%w: backup version %d is not supported, the newest is %d", ErrInvalidBackup, backup.Version, models.BackupVersion)
+	}
+
+	currency, err := money.LookupCurrency(backup.Settings.BaseCurrency)
+	if err != nil {
+		return fmt.Errorf("%w: base currency: %v", ErrInvalidBackup, err)
+	}
+	backup.Settings.BaseCurrency = currency.Code
+	if backup.Settings.EnvelopeStart != nil {
+		start := monthStart(*backup.Settings.EnvelopeStart)
+		backup.Settings.EnvelopeStart = &start
+	}
+
+	accounts := map[int]models.Account{}
+	for i := range backup.Accounts {
+		account := &backup.Accounts[i]
+		if _, ok := accounts[account.ID]; ok {
+			return fmt.Errorf("%w: account %d is listed twice", ErrInvalidBackup, account.ID)
+		}
+		err := normalizeAccount(account)
+		if err != nil {
+			return fmt.Errorf("%w: account %d: %v", ErrInvalidBackup, account.ID, err)
+		}
+		accounts[account.ID] = *account
+	}
+
+	categories := map[int]models.Category{}
+	for i := range backup.Categories {
+		category := &backup.Categories[i]
+		if _, ok := categories[category.ID]; ok {
+			return fmt.Errorf("%w: category %d is listed twice", ErrInvalidBackup, category.ID)
+		}
+		category.Name = strings.TrimSpace(category.Name)
+		if category.Name == "" || !(category.Kind.Valid() || category.Kind == models.CategoryKindAdjustment) {
+			return fmt.Errorf("%w: category %d needs a name and a kind of income, expense or adjustment", ErrInvalidBackup, category.ID)
+		}
+		categories[category.ID] = *category
+	}
+	for _, category := range backup.Categories {
+		// Walking up from any category reaches a root in fewer steps than
+		// there are categories, unless the parents go round in a cycle
+		current := category
+		for steps := 0; current.ParentID != nil; steps++ {
+			parent, ok := categories[*current.ParentID]
+			if !ok {
+				return fmt.Errorf("%w: category %d: parent %d is missing", ErrInvalidBackup, current.ID, *current.ParentID)
+			}
+			if parent.Kind != current.Kind {
+				return fmt.Errorf("%w: category %d has another kind than its parent", ErrInvalidBackup, current.ID)
+			}
+			if steps == len(categories) {
+				return fmt.Errorf("%w: category %d is its own ancestor", ErrInvalidBackup, category.ID)
+			}
+			current = parent
+		}
+	}
+	hasCategory := func(id *int) bool {
+		if id == nil {
+			return true
+		}
+		_, ok := categories[*id]
+		return ok
+	}
+
+	payees := map[int]bool{}
+	aliases := map[string]int{}
+	for i := range backup.Payees {
+		payee := &backup.Payees[i]
+		if payees[payee.ID] {
+			return fmt.Errorf("%w: payee %d is listed twice", ErrInvalidBackup, payee.ID)
+		}
+		payee.Name = strings.TrimSpace(payee.Name)
+		if PayeeKey(payee.Name) == "" {
+			return fmt.Errorf("%w: payee %d needs a name", ErrInvalidBackup, payee.ID)
+		}
+		if !hasCategory(payee.DefaultCategoryID) {
+			return fmt.Errorf("%w: payee %d: default category %d is missing", ErrInvalidBackup, payee.ID, *payee.DefaultCategoryID)
+		}
+		for _, alias := range append([]string{payee.Name}, payee.Aliases...) {
+			key := PayeeKey(alias)
+			if owner, ok := aliases[key]; ok && owner != payee.ID {
+				return fmt.Errorf("%w: %q is an alias of payees %d and %d", ErrInvalidBackup, alias, owner, payee.ID)
+			}
+			aliases[key] = payee.ID
+		}
+		payees[payee.ID] = true
+	}
+
+	backup.Tags, err = NormalizeTags(backup.Tags)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	transactions := map[int]bool{}
+	for i := range backup.Transactions {
+		transaction := &backup.Transactions[i]
+		err := validateBackupTransaction(transaction, accounts, hasCategory, payees)
+		if err != nil {
+			return fmt.Errorf("%w: transaction %d: %v", ErrInvalidBackup, transaction.ID, err)
+		}
+		if transactions[transaction.ID] {
+			return fmt.Errorf("%w: transaction %d is listed twice", ErrInvalidBackup, transaction.ID)
+		}
+		transactions[transaction.ID] = true
+	}
+
+	for _, recurring := range backup.Recurring {
+		account, ok := accounts[recurring.AccountID]
+		if !ok || !hasCategory(&recurring.CategoryID) {
+			return fmt.Errorf("%w: recurring transaction %d: its account or category is missing", ErrInvalidBackup, recurring.ID)
+		}
+		err := checkCurrency(recurring.Amount, account)
+		if err != nil {
+			return fmt.Errorf("%w: recurring transaction %d: %v", ErrInvalidBackup, recurring.ID, err)
+		}
+		_, err = ParseRecurrence(recurring.Rule)
+		if err != nil {
+			return fmt.Errorf("%w: recurring transaction %d: %v", ErrInvalidBackup, recurring.ID, err)
+		}
+
+		dates := map[string]bool{}
+		for _, occurrence := range recurring.Occurrences {
+			date := occurrence.Date.Format("2006-01-02")
+			switch {
+			case dates[date]:
+				return fmt.Errorf("%w: recurring transaction %d: %s is listed twice", ErrInvalidBackup, recurring.ID, date)
+			case occurrence.Status != models.OccurrenceScheduled && occurrence.Status != models.OccurrenceSkipped && occurrence.Status != models.OccurrencePosted:
+				return fmt.Errorf("%w: recurring transaction %d: unknown status %q", ErrInvalidBackup, recurring.ID, occurrence.Status)
+			case occurrence.TransactionID != nil && !transactions[*occurrence.TransactionID]:
+				return fmt.Errorf("%w: recurring transaction %d: transaction %d is missing", ErrInvalidBackup, recurring.ID, *occurrence.TransactionID)
+			case occurrence.Amount != nil && occurrence.Amount.Currency() != account.Currency:
+				return fmt.Errorf("%w: recurring transaction %d: %s amount for %s account", ErrInvalidBackup, recurring.ID, occurrence.Amount.Currency(), account.Currency)
+			}
+			dates[date] = true
+		}
+	}
+
+	budgets := map[string]bool{}
+	for _, budget := range backup.Budgets {
+		key := fmt.Sprintf("%d|%s", budget.CategoryID, monthStart(budget.Month).Format("2006-01"))
+		if !hasCategory(&budget.CategoryID) || budgets[key] {
+			return fmt.Errorf("%w: budget %d: its category is missing or already has a budget for the month", ErrInvalidBackup, budget.ID)
+		}
+		budgets[key] = true
+	}
+
+	for _, assignment := range backup.EnvelopeAssignments {
+		if !hasCategory(&assignment.CategoryID) {
+			return fmt.Errorf("%w: envelope assignment %d: category %d is missing", ErrInvalidBackup, assignment.ID, assignment.CategoryID)
+		}
+	}
+
+	for i := range backup.Goals {
+		goal := &backup.Goals[i]
+		goal.Name = strings.TrimSpace(goal.Name)
+		if goal.Name == "" {
+			return fmt.Errorf("%w: goal %d needs a name", ErrInvalidBackup, goal.ID)
+		}
+		if (goal.AccountID == nil) == (goal.CategoryID == nil) {
+			return fmt.Errorf("%w: goal %d needs either an account or a category", ErrInvalidBackup, goal.ID)
+		}
+		if goal.AccountID != nil {
+			if _, ok := accounts[*goal.AccountID]; !ok {
+				return fmt.Errorf("%w: goal %d: account %d is missing", ErrInvalidBackup, goal.ID, *goal.AccountID)
+			}
+		}
+		if !hasCategory(goal.CategoryID) {
+			return fmt.Errorf("%w: goal %d: category %d is missing", ErrInvalidBackup, goal.ID, *goal.CategoryID)
+		}
+	}
+
+	profiles := map[string]bool{}
+	for i := range backup.ImportProfiles {
+		profile := &backup.ImportProfiles[i]
+		profile.Name = strings.TrimSpace(profile.Name)
+		if profile.Name == "" || profiles[profile.Name] {
+			return fmt.Errorf("%w: import profile %d needs a name of its own", ErrInvalidBackup, profile.ID)
+		}
+		err := normalizeImportProfile(profile)
+		if err != nil {
+			return fmt.Errorf("%w: import profile %q: %v", ErrInvalidBackup, profile.Name, err)
+		}
+		profiles[profile.Name] = true
+	}
+
+	return nil
+}
+
+// validateBackupTransaction checks one ledger entry of a backup. A transfer
+// has to be given by its outgoing leg.
+func validateBackupTransaction(transaction *models.Transaction, accounts map[int]models.Account, hasCategory func(*int) bool, payees map[int]bool) error {
+	account, ok := accounts[transaction.AccountID]
+	if !ok {
+		return fmt.Errorf("account %d is missing", transaction.AccountID)
+	}
+	err := checkCurrency(transaction.Amount, account)
+	if err != nil {
+		return err
+	}
+	err = normalizeDescription(transaction)
+	if err != nil {
+		return err
+	}
+	if !hasCategory(transaction.CategoryID) {
+		return fmt.Errorf("category %d is missing", *transaction.CategoryID)
+	}
+	if transaction.PayeeID != nil && !payees[*transaction.PayeeID] {
+		return fmt.Errorf("payee %d is missing", *transaction.PayeeID)
+	}
+
+	if leg := transaction.Transfer; leg != nil {
+		other, ok := accounts[leg.AccountID]
+		if !ok || other.ID == account.ID {
+			return fmt.Errorf("the transfer needs two different accounts")
+		}
+		if !transaction.Amount.IsNegative() || !leg.Amount.IsPositive() {
+			return fmt.Errorf("a transfer is given by its outgoing leg")
+		}
+		err := checkCurrency(leg.Amount, other)
+		if err != nil {
+			return err
+		}
+		leg.Rate, _, err = transferRate(leg.Rate, account.Currency, other.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(transaction.Splits) > 0 {
+		total := money.Zero(account.Currency)
+		for _, split := range transaction.Splits {
+			if !hasCategory(&split.CategoryID) {
+				return fmt.Errorf("category %d is missing", split.CategoryID)
+			}
+			total, err = total.Add(split.Amount)
+			if err != nil {
+				return err
+			}
+		}
+		if total.Minor() != transaction.Amount.Minor() {
+			return fmt.Errorf("the split lines add up to %s, not %s", total, transaction.Amount)
+		}
+	}
+
+	return nil
+}
+
+// categoryPaths names each category by its path, like "Food > Groceries".
+func categoryPaths(categories []models.Category) map[int]string {
+	byID := map[int]models.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	paths := map[int]string{}
+	var path func(category models.Category) string
+	path = func(category models.Category) string {
+		if p, ok := paths[category.ID]; ok {
+			return p
+		}
+		p := category.Name
+		if category.ParentID != nil {
+			if parent, ok := byID[*category.ParentID]; ok {
+				p = path(parent) + categoryPathSeparator + category.Name
+			}
+		}
+		paths[category.ID] = p
+		return p
+	}
+	for _, category := range categories {
+		path(category)
+	}
+
+	return paths
+}
+
+// transactionKey identifies a ledger entry for merging by its account, date,
+// amount and memo, and for a transfer the account on its other side.
+func transactionKey(transaction models.Transaction) string {
+	key := fmt.Sprintf("%d|%s|%s|%s|%s", transaction.AccountID, dateOnly(transaction.Date).Format("2006-01-02"), transaction.Amount.Decimal(), transaction.Amount.Currency(), transaction.Memo)
+	if transaction.Transfer != nil {
+		key += fmt.Sprintf("|%d", transaction.Transfer.AccountID)
+	}
+	return key
+}
+
+func recurringKey(recurring models.RecurringTransaction) string {
+	return fmt.Sprintf("%d|%d|%s|%s|%s|%s|%s", recurring.AccountID, recurring.CategoryID, recurring.PayeeName, recurring.Amount.Decimal(), recurring.Amount.Currency(), recurring.Rule, dateOnly(recurring.StartDate).Format("2006-01-02"))
+}
+
+func assignmentKey(assignment models.EnvelopeAssignment) string {
+	return fmt.Sprintf("%d|%s|%s|%s|%s", assignment.CategoryID, monthStart(assignment.Month).Format("2006-01"), assignment.Amount.Decimal(), assignment.Amount.Currency(), assignment.Note)
+}
+
+// mapID maps an optional ID from a backup to the ID it was restored as.
+func mapID(ids map[int]int, id *int) *int {
+	if id == nil {
+		return nil
+	}
+	mapped := ids[*id]
+	return &mapped
+}
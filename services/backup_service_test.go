@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestBackupRestore(t *testing.T) {
+	s := newTestServices(t)
+	from := s.createUser(t).ID
+	to := s.createUser(t).ID
+
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: from, Name: "Cash", Currency: "JPY", OpeningBalance: money.New(10000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savings, err := s.accountService.CreateAccount(models.Account{UserID: from, Name: "Savings", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, ParentID: &food.ID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, Name: "Gifts", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = s.transactionService.CreateTransaction(models.Transaction{
+		UserID:    from,
+		AccountID: cash.ID,
+		PayeeName: "Farm market",
+		Amount:    money.New(-3000, "JPY"),
+		Date:      time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Tags:      []string{"trip"},
+		Splits: []models.Split{
+			{CategoryID: groceries.ID, Amount: money.New(-2000, "JPY")},
+			{CategoryID: gifts.ID, Amount: money.New(-1000, "JPY"), Memo: "birthday card"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.transactionService.CreateTransfer(models.Transfer{UserID: from, FromAccountID: cash.ID, ToAccountID: savings.ID, Amount: money.New(1000, "JPY"), Rate: "0.0065", Date: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.budgetRepository.CreateBudget(models.Budget{UserID: from, CategoryID: food.ID, Month: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Amount: money.New(30000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := s.backupService.Export(from, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup models.Backup
+	err = json.Unmarshal(data, &backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A backup whose references do not resolve is refused as a whole
+	broken := backup
+	broken.Transactions = append([]models.Transaction{}, backup.Transactions...)
+	broken.Transactions[0].AccountID = 0
+	_, err = s.backupService.Restore(to, broken, models.RestoreMerge)
+	if !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("restoring a broken backup: err = %v, want %v", err, ErrInvalidBackup)
+	}
+
+	// Replacing drops what the other user had and remaps every ID
+	_, err = s.accountService.CreateAccount(models.Account{UserID: to, Name: "Wallet", Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.backupService.Restore(to, backup, models.RestoreReplace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Accounts != 2 || result.Categories != 3 || result.Transactions != 2 || result.Budgets != 1 || result.Payees != 1 {
+		t.Fatalf("replace restored %+v", result)
+	}
+
+	accounts, err := s.accountService.GetAccountsByUserID(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]money.Money{"Cash": money.New(6000, "JPY"), "Savings": money.MustParse("6.50", "USD")}
+	if len(accounts) != len(want) {
+		t.Fatalf("restored %d accounts, want %d", len(accounts), len(want))
+	}
+	for _, account := range accounts {
+		balance, err := s.transactionService.GetCurrentBalance(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != want[account.Name] {
+			t.Fatalf("%s balance = %s, want %s", account.Name, balance, want[account.Name])
+		}
+	}
+
+	restored, err := s.backupService.Export(to, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := restored.Transactions[1]
+	if receipt.PayeeName != "Farm market" || len(receipt.Tags) != 1 || receipt.Tags[0] != "trip" || len(receipt.Splits) != 2 || receipt.Splits[0].CategoryName != "Groceries" {
+		t.Fatalf("restored receipt = %+v", receipt)
+	}
+	if transfer := restored.Transactions[0].Transfer; transfer == nil || transfer.Amount != money.MustParse("6.50", "USD") {
+		t.Fatalf("restored transfer leg = %+v, want $6.50", transfer)
+	}
+
+	// Merging the same backup again finds everything in place
+	result, err = s.backupService.Restore(to, backup, models.RestoreMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Accounts+result.Categories+result.Payees+result.Transactions+result.Budgets != 0 || result.Skipped == 0 {
+		t.Fatalf("merging again restored %+v", result)
+	}
+}
@@ -1,47 +1,43 @@
 package services
 
 import (
+	"database/sql"
+	"errors"
+	"time"
+
 	"balance-tracker/models"
+	"balance-tracker/money"
 	"balance-tracker/repositories"
-	"log"
 )
 
+var ErrBalanceNotFound = errors.New("balance not found")
+
 type BalanceService struct {
-	balanceRepository repositories.BalanceRepository
+	balanceRepository      repositories.BalanceRepository
+	accountRepository      repositories.AccountRepository
+	userRepository         repositories.UserRepository
+	exchangeRateRepository repositories.ExchangeRateRepository
 }
 
-func NewBalanceService(balanceRepository *repositories.BalanceRepository) *BalanceService {
-	return &BalanceService{*balanceRepository}
+func NewBalanceService(balanceRepository repositories.BalanceRepository, accountRepository repositories.AccountRepository, userRepository repositories.UserRepository, exchangeRateRepository repositories.ExchangeRateRepository) *BalanceService {
+	return &BalanceService{balanceRepository, accountRepository, userRepository, exchangeRateRepository}
 }
 
-func (s *BalanceService) GetBalances() ([]models.Balance, error) {
-	balances, err := s.balanceRepository.GetBalances()
-	return balances, err
-}
-
-func (s *BalanceService) GetBalance(id string) (models.Balance, error) {
+// GetBalance returns one of the user's balance snapshots.
+func (s *BalanceService) GetBalance(userID int, id int) (models.Balance, error) {
 	balance, err := s.balanceRepository.GetBalance(id)
-	return balance, err
-}
-
-func (s *BalanceService) CreateBalance(balance models.Balance) error {
-	err := s.balanceRepository.CreateBalance(balance)
-	return err
-}
-
-func (s *BalanceService) UpdateBalance(id string, balance models.Balance) error {
-	err := s.balanceRepository.UpdateBalance(id, balance)
-	return err
-}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Balance{}, ErrBalanceNotFound
+		}
+		return models.Balance{}, err
+	}
 
-func (s *BalanceService) DeleteBalance(id int) error {
-	err := s.balanceRepository.DeleteBalance(id)
-	return err
-}
+	if balance.UserID != userID {
+		return models.Balance{}, ErrBalanceNotFound
+	}
 
-func (s *BalanceService) GetLastBalance() (models.Balance, error) {
-	balance, err := s.balanceRepository.GetLastBalance()
-	return balance, err
+	return balance, nil
 }
 
 func (s *BalanceService) GetLastBalanceByUserID(userID int) (models.Balance, error) {
@@ -54,24 +50,66 @@ func (s *BalanceService) GetBalancesByUserID(userID int) ([]models.Balance, erro
 	return balances, err
 }
 
-func (s *BalanceService) CreateNewTransactionByID(userID int, amount int) (models.Balance, error) {
-	lastBalance, err := s.balanceRepository.GetLastBalanceByUserID(userID)
+// GetAccountBalances returns the current balance of each of the user's
+// accounts, derived from the ledger.
+func (s *BalanceService) GetAccountBalances(userID int) ([]models.AccountBalance, error) {
+	balances, err := s.accountRepository.GetAccountBalancesByUserID(userID)
+	return balances, err
+}
+
+// GetNetWorth combines the balances of all of the user's accounts. Balances
+// in different currencies are totalled separately and then converted into
+// the user's base currency at today's rates.
+func (s *BalanceService) GetNetWorth(userID int) (models.NetWorth, error) {
+	balances, err := s.accountRepository.GetAccountBalancesByUserID(userID)
 	if err != nil {
-		log.Println(err)
-		return models.Balance{}, err
+		return models.NetWorth{}, err
 	}
 
-	newBalance := models.Balance{
-		UserID:    lastBalance.UserID,
-		Amount:    lastBalance.Amount + float64(amount),
-		CreatedAt: lastBalance.CreatedAt,
+	user, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return models.NetWorth{}, err
 	}
 
-	err = s.CreateBalance(newBalance)
+	converter, err := loadConverter(s.exchangeRateRepository, time.Now())
 	if err != nil {
-		log.Println(err)
-		return models.Balance{}, err
+		return models.NetWorth{}, err
+	}
+
+	totals := []money.Money{}
+	for _, balance := range balances {
+		found := false
+		for i := range totals {
+			if totals[i].Currency() == balance.Currency {
+				totals[i], err = totals[i].Add(balance.Balance)
+				if err != nil {
+					return models.NetWorth{}, err
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			totals = append(totals, balance.Balance)
+		}
+	}
+
+	netWorth := models.NetWorth{
+		Total:        money.Zero(user.BaseCurrency),
+		ByCurrency:   totals,
+		MissingRates: []string{},
+	}
+	for _, total := range totals {
+		converted, err := converter.Convert(total, user.BaseCurrency)
+		if err != nil {
+			netWorth.MissingRates = append(netWorth.MissingRates, total.Currency())
+			continue
+		}
+		netWorth.Total, err = netWorth.Total.Add(converted)
+		if err != nil {
+			return models.NetWorth{}, err
+		}
 	}
 
-	return newBalance, nil
+	return netWorth, nil
 }
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestGetBalancesAreScopedToTheUser(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+	otherID := s.createUser(t).ID
+
+	for _, id := range []int{userID, otherID} {
+		_, err := s.accountService.CreateAccount(models.Account{UserID: id, Name: "Cash", Currency: "JPY", OpeningBalance: money.New(1000, "JPY")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balances, err := s.balanceService.GetBalancesByUserID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].UserID != userID {
+		t.Fatalf("balances = %+v, want the user's one snapshot", balances)
+	}
+
+	others, err := s.balanceService.GetBalancesByUserID(otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.balanceService.GetBalance(userID, others[0].ID)
+	if err != ErrBalanceNotFound {
+		t.Fatalf("other user's snapshot: err = %v, want %v", err, ErrBalanceNotFound)
+	}
+
+	balance, err := s.balanceService.GetBalance(userID, balances[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Amount != money.New(1000, "JPY") {
+		t.Fatalf("snapshot = %s, want 1000 JPY", balance.Amount)
+	}
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrBudgetNotFound = errors.New("budget not found")
+	ErrInvalidBudget  = errors.New("invalid budget")
+)
+
+// maxRolloverMonths bounds how many months back unspent amounts are carried
+// forward from.
+const maxRolloverMonths = 24
+
+type BudgetService struct {
+	budgetRepository       repositories.BudgetRepository
+	userRepository         repositories.UserRepository
+	exchangeRateRepository repositories.ExchangeRateRepository
+	categoryService        *CategoryService
+	txRunner               repositories.TxRunner
+}
+
+func NewBudgetService(budgetRepository repositories.BudgetRepository, userRepository repositories.UserRepository, exchangeRateRepository repositories.ExchangeRateRepository, categoryService *CategoryService, txRunner *repositories.TxRunner) *BudgetService {
+	return &BudgetService{
+		budgetRepository:       budgetRepository,
+		userRepository:         userRepository,
+		exchangeRateRepository: exchangeRateRepository,
+		categoryService:        categoryService,
+		txRunner:               *txRunner,
+	}
+}
+
+// GetBudgets returns the user's budgets for the month containing month.
+func (s *BudgetService) GetBudgets(userID int, month time.Time) ([]models.Budget, error) {
+	return s.budgetRepository.GetBudgetsByMonth(userID, monthStart(month))
+}
+
+// GetBudget returns the budget only if it belongs to the user.
+func (s *BudgetService) GetBudget(userID int, id int) (models.Budget, error) {
+	return getOwnedBudget(s.budgetRepository, userID, id)
+}
+
+// SetBudget sets the category's limit for the month containing
+// budget.Month, replacing any limit it already had.
+func (s *BudgetService) SetBudget(budget models.Budget) (models.Budget, error) {
+	err := s.normalizeBudget(&budget)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	var id int
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		budgets := s.budgetRepository.WithTx(tx)
+
+		existing, err := budgets.GetBudgetByCategory(budget.CategoryID, budget.Month)
+		if err == sql.ErrNoRows {
+			created, err := budgets.CreateBudget(budget)
+			id = created.ID
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		id = existing.ID
+		budget.UpdatedAt = time.Now()
+		return budgets.UpdateBudget(id, budget)
+	})
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	return s.budgetRepository.GetBudget(id)
+}
+
+// UpdateBudget changes a budget's limit and rollover. Its category and month
+// stay the same.
+func (s *BudgetService) UpdateBudget(userID int, id int, budget models.Budget) (models.Budget, error) {
+	existing, err := getOwnedBudget(s.budgetRepository, userID, id)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	budget.UserID = userID
+	budget.CategoryID = existing.CategoryID
+	budget.Month = existing.Month
+	err = s.normalizeBudget(&budget)
+	if err != nil {
+		return models.Budget{}, err
+	}
+	budget.UpdatedAt = time.Now()
+
+	err = s.budgetRepository.UpdateBudget(id, budget)
+	if err != nil {
+		return models.Budget{}, err
+	}
+
+	return s.budgetRepository.GetBudget(id)
+}
+
+func (s *BudgetService) DeleteBudget(userID int, id int) error {
+	_, err := getOwnedBudget(s.budgetRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.budgetRepository.DeleteBudget(id)
+}
+
+// CopyPreviousMonth copies the budgets of the month before the one
+// containing month into it. Categories that already have a budget for the
+// month keep it. It returns the number of budgets copied.
+func (s *BudgetService) CopyPreviousMonth(userID int, month time.Time) (int, error) {
+	month = monthStart(month)
+
+	copied := 0
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		copied = 0
+		budgets := s.budgetRepository.WithTx(tx)
+
+		previous, err := budgets.GetBudgetsByMonth(userID, month.AddDate(0, -1, 0))
+		if err != nil {
+			return err
+		}
+
+		for _, budget := range previous {
+			_, err := budgets.GetBudgetByCategory(budget.CategoryID, month)
+			if err == nil {
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+
+			budget.Month = month
+			_, err = budgets.CreateBudget(budget)
+			if err != nil {
+				return err
+			}
+			copied++
+		}
+		return nil
+	})
+	return copied, err
+}
+
+// GetBudgetStatuses returns how far each of the user's budgets for the month
+// containing month has been used. Spending in other currencies is converted
+// at the rates as of the end of the month, or today for the current month.
+func (s *BudgetService) GetBudgetStatuses(userID int, month time.Time) ([]models.BudgetStatus, error) {
+	month = monthStart(month)
+
+	budgets, err := s.budgetRepository.GetBudgetsByMonth(userID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoryService.GetCategories(userID)
+	if err != nil {
+		return nil, err
+	}
+	children := map[int][]int{}
+	paths := map[int]string{}
+	for _, category := range categories {
+		paths[category.ID] = category.Path
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	tracker := budgetTracker{
+		service:  s,
+		userID:   userID,
+		children: children,
+		totals:   map[time.Time][]models.CategoryTotal{},
+	}
+	statuses := []models.BudgetStatus{}
+	for _, budget := range budgets {
+		if path, ok := paths[budget.CategoryID]; ok {
+			budget.CategoryName = path
+		}
+
+		status, err := tracker.status(budget, 0)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// budgetTracker computes budget statuses, remembering the category totals
+// of each month it has looked at.
+type budgetTracker struct {
+	service  *BudgetService
+	userID   int
+	children map[int][]int
+	totals   map[time.Time][]models.CategoryTotal
+}
+
+func (t *budgetTracker) status(budget models.Budget, depth int) (models.BudgetStatus, error) {
+	currency := budget.Amount.Currency()
+	status := models.BudgetStatus{
+		Budget:       budget,
+		Carried:      money.Zero(currency),
+		Spent:        money.Zero(currency),
+		MissingRates: []string{},
+	}
+
+	converter, err := loadConverter(t.service.exchangeRateRepository, ratesDate(budget.Month))
+	if err != nil {
+		return models.BudgetStatus{}, err
+	}
+
+	if budget.Rollover && depth < maxRolloverMonths {
+		previous, err := t.service.budgetRepository.GetBudgetByCategory(budget.CategoryID, budget.Month.AddDate(0, -1, 0))
+		if err != nil && err != sql.ErrNoRows {
+			return models.BudgetStatus{}, err
+		}
+		if err == nil {
+			previousStatus, err := t.status(previous, depth+1)
+			if err != nil {
+				return models.BudgetStatus{}, err
+			}
+			if previousStatus.Remaining.IsPositive() {
+				status.Carried, err = converter.Convert(previousStatus.Remaining, currency)
+				if err != nil {
+					status.Carried = money.Zero(currency)
+					status.MissingRates = append(status.MissingRates, previousStatus.Remaining.Currency())
+				}
+			}
+		}
+	}
+
+	totals, err := t.monthTotals(budget.Month)
+	if err != nil {
+		return models.BudgetStatus{}, err
+	}
+	included := t.subtree(budget.CategoryID)
+	for _, total := range totals {
+		if !included[total.CategoryID] {
+			continue
+		}
+		converted, err := converter.Convert(total.Total, currency)
+		if err != nil {
+			status.MissingRates = append(status.MissingRates, total.Total.Currency())
+			continue
+		}
+		// Expenses are booked as negative amounts
+		status.Spent, err = status.Spent.Sub(converted)
+		if err != nil {
+			return models.BudgetStatus{}, err
+		}
+	}
+
+	status.Available, err = budget.Amount.Add(status.Carried)
+	if err != nil {
+		return models.BudgetStatus{}, err
+	}
+	status.Remaining, err = status.Available.Sub(status.Spent)
+	if err != nil {
+		return models.BudgetStatus{}, err
+	}
+	status.PercentUsed = percentUsed(status.Spent, status.Available)
+
+	return status, nil
+}
+
+func (t *budgetTracker) monthTotals(month time.Time) ([]models.CategoryTotal, error) {
+	if totals, ok := t.totals[month]; ok {
+		return totals, nil
+	}
+
+	totals, err := t.service.categoryService.GetCategoryTotals(t.userID, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	t.totals[month] = totals
+	return totals, nil
+}
+
+// subtree returns the category and all of its subcategories.
+func (t *budgetTracker) subtree(categoryID int) map[int]bool {
+	included := map[int]bool{}
+	queue := []int{categoryID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if included[id] {
+			continue
+		}
+		included[id] = true
+		queue = append(queue, t.children[id]...)
+	}
+	return included
+}
+
+// normalizeBudget validates a budget before it is stored. Budgets are kept
+// in the user's base currency.
+func (s *BudgetService) normalizeBudget(budget *models.Budget) error {
+	category, err := s.categoryService.GetCategory(budget.UserID, budget.CategoryID)
+	if err != nil {
+		return err
+	}
+	if category.Kind != models.CategoryKindExpense {
+		return fmt.Errorf("%w: budgets are for expense categories", ErrInvalidBudget)
+	}
+
+	user, err := s.userRepository.GetUser(budget.UserID)
+	if err != nil {
+		return err
+	}
+	if budget.Amount.Currency() != user.BaseCurrency {
+		return fmt.Errorf("%w: budgets are in your base currency, %s", money.ErrCurrencyMismatch, user.BaseCurrency)
+	}
+	if budget.Amount.IsNegative() {
+		return fmt.Errorf("%w: amount must not be negative", ErrInvalidBudget)
+	}
+
+	if budget.Month.IsZero() {
+		budget.Month = time.Now()
+	}
+	budget.Month = monthStart(budget.Month)
+
+	return nil
+}
+
+// percentUsed returns spent as a whole percentage of available, rounded
+// down. It goes past 100 once a budget is overspent.
+func percentUsed(spent money.Money, available money.Money) int {
+	if !available.IsPositive() {
+		if spent.IsPositive() {
+			return 100
+		}
+		return 0
+	}
+
+	ratio := new(big.Rat).Quo(spent.Rat(), available.Rat())
+	ratio.Mul(ratio, big.NewRat(100, 1))
+	return int(new(big.Int).Quo(ratio.Num(), ratio.Denom()).Int64())
+}
+
+// ratesDate is the day whose exchange rates apply to the month starting on
+// month: its last day, or today while it is still running.
+func ratesDate(month time.Time) time.Time {
+	last := month.AddDate(0, 1, -1)
+	if today := dateOnly(time.Now()); today.Before(last) {
+		return today
+	}
+	return last
+}
+
+// monthStart returns the first day of t's month in UTC.
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func getOwnedBudget(budgetRepository repositories.BudgetRepository, userID int, id int) (models.Budget, error) {
+	budget, err := budgetRepository.GetBudget(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Budget{}, ErrBudgetNotFound
+		}
+		return models.Budget{}, err
+	}
+
+	if budget.UserID != userID {
+		return models.Budget{}, ErrBudgetNotFound
+	}
+
+	return budget, nil
+}
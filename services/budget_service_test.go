@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestBudgetStatus(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, ParentID: &food.ID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thisMonth := monthStart(time.Now())
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	for _, entry := range []struct {
+		date   time.Time
+		amount int64
+	}{
+		{lastMonth, -30000},
+		{thisMonth, -25000},
+		{thisMonth, -15000},
+	} {
+		_, _, err := s.transactionService.CreateTransaction(models.Transaction{
+			UserID:     userID,
+			AccountID:  account.ID,
+			CategoryID: &groceries.ID,
+			Amount:     money.New(entry.amount, "JPY"),
+			Date:       entry.date,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = s.budgetService.SetBudget(models.Budget{UserID: userID, CategoryID: food.ID, Month: lastMonth, Amount: money.New(50000, "JPY"), Rollover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := s.budgetService.CopyPreviousMonth(userID, thisMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 1 {
+		t.Fatalf("copied %d budgets, want 1", copied)
+	}
+
+	// Groceries count towards Food, and last month's unspent 20,000 rolls
+	// over
+	statuses, err := s.budgetService.GetBudgetStatuses(userID, thisMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("got %d budget statuses, want 1", len(statuses))
+	}
+	status := statuses[0]
+	if status.Carried != money.New(20000, "JPY") || status.Spent != money.New(40000, "JPY") || status.Remaining != money.New(30000, "JPY") || status.PercentUsed != 57 {
+		t.Fatalf("carried %s, spent %s, remaining %s, %d%% used; want 20000, 40000, 30000, 57%%", status.Carried, status.Spent, status.Remaining, status.PercentUsed)
+	}
+
+	_, err = s.budgetService.SetBudget(models.Budget{UserID: userID, CategoryID: food.ID, Amount: money.New(100, "USD")})
+	if err == nil {
+		t.Fatal("budget outside the base currency was accepted")
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryInUse    = errors.New("category still has subcategories or transactions")
+	ErrInvalidCategory  = errors.New("invalid category")
+)
+
+// categoryPathSeparator joins category names into a path like
+// "Food > Groceries".
+const categoryPathSeparator = " > "
+
+// adjustmentCategoryName names the category balance adjustments are booked to.
+const adjustmentCategoryName = "Balance adjustment"
+
+// defaultCategories are created for every new user, each with optional
+// subcategories, along with the category for balance adjustments.
+var defaultCategories = []struct {
+	Kind     models.CategoryKind
+	Name     string
+	Children []string
+}{
+	{models.CategoryKindExpense, "Food", []string{"Groceries", "Dining Out"}},
+	{models.CategoryKindExpense, "Housing", []string{"Rent", "Utilities"}},
+	{models.CategoryKindExpense, "Transportation", nil},
+	{models.CategoryKindExpense, "Health", nil},
+	{models.CategoryKindExpense, "Entertainment", nil},
+	{models.CategoryKindExpense, "Shopping", nil},
+	{models.CategoryKindExpense, "Other Expenses", nil},
+	{models.CategoryKindIncome, "Salary", nil},
+	{models.CategoryKindIncome, "Bonus", nil},
+	{models.CategoryKindIncome, "Interest", nil},
+	{models.CategoryKindIncome, "Other Income", nil},
+	{models.CategoryKindAdjustment, adjustmentCategoryName, nil},
+}
+
+type CategoryService struct {
+	categoryRepository    repositories.CategoryRepository
+	transactionRepository repositories.TransactionRepository
+}
+
+func NewCategoryService(categoryRepository repositories.CategoryRepository, transactionRepository repositories.TransactionRepository) *CategoryService {
+	return &CategoryService{
+		categoryRepository:    categoryRepository,
+		transactionRepository: transactionRepository,
+	}
+}
+
+// GetCategories returns the user's categories in tree order, each parent
+// followed by its children, with Path and Depth filled in.
+func (s *CategoryService) GetCategories(userID int) ([]models.Category, error) {
+	categories, err := s.categoryRepository.GetCategoriesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return categoryTree(categories), nil
+}
+
+// categoryTree orders categories with each parent followed by its children,
+// filling in Path and Depth.
+func categoryTree(categories []models.Category) []models.Category {
+	children := map[int][]models.Category{}
+	roots := []models.Category{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	ordered := []models.Category{}
+	var walk func(category models.Category, path string, depth int)
+	walk = func(category models.Category, path string, depth int) {
+		category.Path = path + category.Name
+		category.Depth = depth
+		ordered = append(ordered, category)
+		for _, child := range children[category.ID] {
+			walk(child, category.Path+categoryPathSeparator, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, "", 0)
+	}
+
+	return ordered
+}
+
+// GetCategoryTotals returns what was booked to each of the user's categories
+// on dates in [from, to), per currency, named by their path. Split
+// transactions count by their split lines.
+func (s *CategoryService) GetCategoryTotals(userID int, from time.Time, to time.Time) ([]models.CategoryTotal, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: the period must end after it starts", ErrInvalidCategory)
+	}
+
+	totals, err := s.transactionRepository.GetCategoryTotals(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.GetCategories(userID)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[int]string{}
+	for _, category := range categories {
+		paths[category.ID] = category.Path
+	}
+	for i := range totals {
+		totals[i].CategoryName = paths[totals[i].CategoryID]
+	}
+
+	return totals, nil
+}
+
+// GetCategory returns the category only if it belongs to the user.
+func (s *CategoryService) GetCategory(userID int, id int) (models.Category, error) {
+	return getOwnedCategory(s.categoryRepository, userID, id)
+}
+
+func (s *CategoryService) CreateCategory(category models.Category) (models.Category, error) {
+	err := s.normalizeCategory(&category, 0)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return s.categoryRepository.CreateCategory(category)
+}
+
+func (s *CategoryService) UpdateCategory(userID int, id int, category models.Category) (models.Category, error) {
+	existing, err := getOwnedCategory(s.categoryRepository, userID, id)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	if existing.Kind == models.CategoryKindAdjustment {
+		return models.Category{}, fmt.Errorf("%w: %s is kept for balance adjustments and cannot be changed", ErrInvalidCategory, existing.Name)
+	}
+
+	category.UserID = userID
+	err = s.normalizeCategory(&category, id)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	// Subcategories share their parent's kind
+	if category.Kind != existing.Kind {
+		count, err := s.categoryRepository.CountChildCategories(id)
+		if err != nil {
+			return models.Category{}, err
+		}
+		if count > 0 {
+			return models.Category{}, fmt.Errorf("%w: change the kind of its subcategories first", ErrCategoryInUse)
+		}
+	}
+
+	existing.ParentID = category.ParentID
+	existing.Name = category.Name
+	existing.Kind = category.Kind
+	existing.UpdatedAt = time.Now()
+
+	err = s.categoryRepository.UpdateCategory(id, existing)
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return existing, nil
+}
+
+// DeleteCategory removes a category that has no subcategories and no
+// transactions.
+func (s *CategoryService) DeleteCategory(userID int, id int) error {
+	_, err := getOwnedCategory(s.categoryRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	children, err := s.categoryRepository.CountChildCategories(id)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := s.transactionRepository.CountTransactionsByCategoryID(id)
+	if err != nil {
+		return err
+	}
+
+	if children > 0 || transactions > 0 {
+		return ErrCategoryInUse
+	}
+
+	return s.categoryRepository.DeleteCategory(id)
+}
+
+// CreateDefaultCategories gives a newly registered user a starting set of
+// income and expense categories.
+func (s *CategoryService) CreateDefaultCategories(user models.User) error {
+	for _, defaults := range defaultCategories {
+		parent, err := s.categoryRepository.CreateCategory(models.Category{
+			UserID: user.ID,
+			Name:   defaults.Name,
+			Kind:   defaults.Kind,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range defaults.Children {
+			_, err := s.categoryRepository.CreateCategory(models.Category{
+				UserID:   user.ID,
+				ParentID: &parent.ID,
+				Name:     name,
+				Kind:     defaults.Kind,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeCategory validates a category before it is stored as id, or as a
+// new category if id is 0. Subcategories take their parent's kind.
+func (s *CategoryService) normalizeCategory(category *models.Category, id int) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCategory)
+	}
+	if strings.Contains(category.Name, categoryPathSeparator) {
+		return fmt.Errorf("%w: name cannot contain %q", ErrInvalidCategory, strings.TrimSpace(categoryPathSeparator))
+	}
+
+	categories, err := s.categoryRepository.GetCategoriesByUserID(category.UserID)
+	if err != nil {
+		return err
+	}
+	byID := map[int]models.Category{}
+	for _, other := range categories {
+		byID[other.ID] = other
+	}
+
+	if category.ParentID != nil {
+		parent, ok := byID[*category.ParentID]
+		if !ok {
+			return ErrCategoryNotFound
+		}
+		if parent.Kind == models.CategoryKindAdjustment {
+			return fmt.Errorf("%w: %s cannot have subcategories", ErrInvalidCategory, parent.Name)
+		}
+		category.Kind = parent.Kind
+
+		// Walk up from the new parent to make sure the category would not
+		// become its own ancestor
+		ancestor := parent
+		for {
+			if ancestor.ID == id {
+				return fmt.Errorf("%w: a category cannot be moved under itself", ErrInvalidCategory)
+			}
+			if ancestor.ParentID == nil {
+				break
+			}
+			ancestor = byID[*ancestor.ParentID]
+		}
+	}
+
+	if !category.Kind.Valid() {
+		return fmt.Errorf("%w: kind must be income or expense", ErrInvalidCategory)
+	}
+
+	for _, sibling := range categories {
+		if sibling.ID != id && sameParent(sibling.ParentID, category.ParentID) && strings.EqualFold(sibling.Name, category.Name) {
+			return fmt.Errorf("%w: %s already exists", ErrInvalidCategory, category.Name)
+		}
+	}
+
+	return nil
+}
+
+// adjustmentCategory returns the category the user's balance adjustments are
+// booked to, creating it again if the user has deleted it.
+func adjustmentCategory(categoryRepository repositories.CategoryRepository, userID int) (models.Category, error) {
+	categories, err := categoryRepository.GetCategoriesByUserID(userID)
+	if err != nil {
+		return models.Category{}, err
+	}
+	for _, category := range categories {
+		if category.Kind == models.CategoryKindAdjustment {
+			return category, nil
+		}
+	}
+
+	return categoryRepository.CreateCategory(models.Category{
+		UserID: userID,
+		Name:   adjustmentCategoryName,
+		Kind:   models.CategoryKindAdjustment,
+	})
+}
+
+// checkCategoryKind makes sure an amount goes the way its category's kind
+// says: income comes in and expenses go out. Balance adjustments can go
+// either way.
+func checkCategoryKind(amount money.Money, category models.Category) error {
+	switch {
+	case category.Kind == models.CategoryKindIncome && amount.IsNegative():
+		return fmt.Errorf("%w: %s is an income category, the amount cannot be negative", ErrInvalidTransaction, category.Name)
+	case category.Kind == models.CategoryKindExpense && amount.IsPositive():
+		return fmt.Errorf("%w: %s is an expense category, the amount cannot be positive", ErrInvalidTransaction, category.Name)
+	}
+	return nil
+}
+
+func sameParent(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func getOwnedCategory(categoryRepository repositories.CategoryRepository, userID int, id int) (models.Category, error) {
+	category, err := categoryRepository.GetCategory(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Category{}, ErrCategoryNotFound
+		}
+		return models.Category{}, err
+	}
+
+	if category.UserID != userID {
+		return models.Category{}, ErrCategoryNotFound
+	}
+
+	return category, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"balance-tracker/models"
+)
+
+func TestDefaultCategoriesOnRegister(t *testing.T) {
+	s := newTestServices(t)
+	user, _ := s.registerTestUser(t)
+
+	categories, err := s.categoryService.GetCategories(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byPath := map[string]models.Category{}
+	for _, category := range categories {
+		byPath[category.Path] = category
+	}
+	want := 0
+	for _, defaults := range defaultCategories {
+		want += 1 + len(defaults.Children)
+	}
+	if len(categories) != want || len(byPath) != want {
+		t.Fatalf("got %d categories with %d paths, want %d", len(categories), len(byPath), want)
+	}
+
+	for path, kind := range map[string]models.CategoryKind{
+		"Food":               models.CategoryKindExpense,
+		"Food > Groceries":   models.CategoryKindExpense,
+		"Housing > Rent":     models.CategoryKindExpense,
+		"Salary":             models.CategoryKindIncome,
+		"Balance adjustment": models.CategoryKindAdjustment,
+	} {
+		category, ok := byPath[path]
+		if !ok {
+			t.Fatalf("%s was not created", path)
+		}
+		if category.Kind != kind {
+			t.Fatalf("%s is an %s category, want %s", path, category.Kind, kind)
+		}
+	}
+	if groceries := byPath["Food > Groceries"]; groceries.Depth != 1 || *groceries.ParentID != byPath["Food"].ID {
+		t.Fatalf("Groceries at depth %d under %v, want depth 1 under Food", groceries.Depth, groceries.ParentID)
+	}
+
+	// Each user gets their own set
+	other, _ := s.registerTestUser(t)
+	otherCategories, err := s.categoryService.GetCategories(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, category := range otherCategories {
+		if category.ID == byPath["Food"].ID {
+			t.Fatal("both users share the Food category")
+		}
+	}
+}
+
+func TestCategoryHierarchy(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	create := func(name string, kind models.CategoryKind, parent *models.Category) (models.Category, error) {
+		category := models.Category{UserID: userID, Name: name, Kind: kind}
+		if parent != nil {
+			category.ParentID = &parent.ID
+		}
+		return s.categoryService.CreateCategory(category)
+	}
+	food, err := create("Food", models.CategoryKindExpense, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := create("Groceries", models.CategoryKindIncome, &food)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fruit, err := create("Fruit", "", &groceries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Subcategories take their parent's kind, whatever they were given
+	if groceries.Kind != models.CategoryKindExpense || fruit.Kind != models.CategoryKindExpense {
+		t.Fatalf("subcategories are %s and %s, want the parent's expense", groceries.Kind, fruit.Kind)
+	}
+
+	// Names are unique among siblings only, ignoring case
+	_, err = create("groceries", models.CategoryKindExpense, &food)
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("second Groceries under Food: err = %v, want %v", err, ErrInvalidCategory)
+	}
+	_, err = create("Groceries", models.CategoryKindExpense, nil)
+	if err != nil {
+		t.Fatalf("Groceries at the top level: %v", err)
+	}
+	_, err = create("Food > Snacks", models.CategoryKindExpense, nil)
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("name with the path separator: err = %v, want %v", err, ErrInvalidCategory)
+	}
+	_, err = create("Other", "transfer", nil)
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("unknown kind: err = %v, want %v", err, ErrInvalidCategory)
+	}
+	_, err = create("Corrections", models.CategoryKindAdjustment, nil)
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("second adjustment category: err = %v, want %v", err, ErrInvalidCategory)
+	}
+
+	// A category cannot be moved under itself or one of its descendants
+	for _, parent := range []models.Category{food, fruit} {
+		_, err = s.categoryService.UpdateCategory(userID, food.ID, models.Category{Name: "Food", ParentID: &parent.ID})
+		if !errors.Is(err, ErrInvalidCategory) {
+			t.Fatalf("Food moved under %s: err = %v, want %v", parent.Name, err, ErrInvalidCategory)
+		}
+	}
+
+	// A parent keeps its kind and stays in place while it has subcategories
+	_, err = s.categoryService.UpdateCategory(userID, food.ID, models.Category{Name: "Food", Kind: models.CategoryKindIncome})
+	if !errors.Is(err, ErrCategoryInUse) {
+		t.Fatalf("kind of Food changed: err = %v, want %v", err, ErrCategoryInUse)
+	}
+	err = s.categoryService.DeleteCategory(userID, groceries.ID)
+	if !errors.Is(err, ErrCategoryInUse) {
+		t.Fatalf("Groceries deleted: err = %v, want %v", err, ErrCategoryInUse)
+	}
+
+	// Moving a subcategory up makes it a root, with its own subtree
+	moved, err := s.categoryService.UpdateCategory(userID, fruit.ID, models.Category{Name: "Fruit", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.ParentID != nil {
+		t.Fatalf("Fruit is still under %d", *moved.ParentID)
+	}
+	err = s.categoryService.DeleteCategory(userID, groceries.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := s.categoryService.GetCategories(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, category := range categories {
+		paths = append(paths, category.Path)
+	}
+	if len(paths) != 3 || paths[0] != "Food" || paths[1] != "Fruit" || paths[2] != "Groceries" {
+		t.Fatalf("categories %q, want Food, Fruit and Groceries", paths)
+	}
+
+	// Another user's categories cannot be used as a parent or changed
+	other := s.createUser(t).ID
+	_, err = s.categoryService.CreateCategory(models.Category{UserID: other, Name: "Snacks", ParentID: &food.ID})
+	if !errors.Is(err, ErrCategoryNotFound) {
+		t.Fatalf("subcategory of another user's category: err = %v, want %v", err, ErrCategoryNotFound)
+	}
+	_, err = s.categoryService.UpdateCategory(other, food.ID, models.Category{Name: "Mine", Kind: models.CategoryKindExpense})
+	if !errors.Is(err, ErrCategoryNotFound) {
+		t.Fatalf("another user's category renamed: err = %v, want %v", err, ErrCategoryNotFound)
+	}
+}
+
+func TestAdjustmentCategoryIsKept(t *testing.T) {
+	s := newTestServices(t)
+	user, _ := s.registerTestUser(t)
+
+	adjustment, err := adjustmentCategory(s.categoryRepository, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment.Name != adjustmentCategoryName {
+		t.Fatalf("adjustments are booked to %q, want the seeded %q", adjustment.Name, adjustmentCategoryName)
+	}
+
+	_, err = s.categoryService.UpdateCategory(user.ID, adjustment.ID, models.Category{Name: "Corrections", Kind: models.CategoryKindExpense})
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("adjustment category changed: err = %v, want %v", err, ErrInvalidCategory)
+	}
+	_, err = s.categoryService.CreateCategory(models.Category{UserID: user.ID, Name: "Cash counts", ParentID: &adjustment.ID})
+	if !errors.Is(err, ErrInvalidCategory) {
+		t.Fatalf("subcategory of the adjustment category: err = %v, want %v", err, ErrInvalidCategory)
+	}
+}
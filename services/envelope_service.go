@@ -0,0 +1,419 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrEnvelopesOff    = errors.New("envelope budgeting is not turned on")
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+)
+
+// EnvelopeService runs zero-based budgeting: the money in the user's
+// accounts when they start, and all income after, is assigned to envelopes,
+// which spending in their categories draws down. Top-level expense
+// categories are always envelopes. A subcategory becomes one once money is
+// assigned to it; until then its spending draws on the nearest envelope
+// above it.
+type EnvelopeService struct {
+	envelopeRepository     repositories.EnvelopeRepository
+	userRepository         repositories.UserRepository
+	accountRepository      repositories.AccountRepository
+	transactionRepository  repositories.TransactionRepository
+	exchangeRateRepository repositories.ExchangeRateRepository
+	categoryService        *CategoryService
+	txRunner               repositories.TxRunner
+}
+
+func NewEnvelopeService(envelopeRepository repositories.EnvelopeRepository, userRepository repositories.UserRepository, accountRepository repositories.AccountRepository, transactionRepository repositories.TransactionRepository, exchangeRateRepository repositories.ExchangeRateRepository, categoryService *CategoryService, txRunner *repositories.TxRunner) *EnvelopeService {
+	return &EnvelopeService{
+		envelopeRepository:     envelopeRepository,
+		userRepository:         userRepository,
+		accountRepository:      accountRepository,
+		transactionRepository:  transactionRepository,
+		exchangeRateRepository: exchangeRateRepository,
+		categoryService:        categoryService,
+		txRunner:               *txRunner,
+	}
+}
+
+// SetStart turns envelope budgeting on from the month containing start, or
+// off if start is nil. Assignments are kept while it is off.
+func (s *EnvelopeService) SetStart(userID int, start *time.Time) (models.User, error) {
+	user, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if start != nil {
+		month := monthStart(*start)
+		start = &month
+	}
+	user.EnvelopeStart = start
+	user.UpdatedAt = time.Now()
+
+	err = s.userRepository.UpdateUser(userID, user)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetMonth works out the envelopes and the money to be assigned for the
+// month containing month. Each month's amounts are converted into the base
+// currency at the rates as of its end, or today for the current month.
+func (s *EnvelopeService) GetMonth(userID int, month time.Time) (models.EnvelopeMonth, error) {
+	user, start, err := s.envelopeUser(userID, month)
+	if err != nil {
+		return models.EnvelopeMonth{}, err
+	}
+	month = monthStart(month)
+	currency := user.BaseCurrency
+
+	categories, err := s.categoryService.GetCategories(userID)
+	if err != nil {
+		return models.EnvelopeMonth{}, err
+	}
+	assignments, err := s.envelopeRepository.GetAssignments(userID, start, month)
+	if err != nil {
+		return models.EnvelopeMonth{}, err
+	}
+
+	// Envelopes in category tree order
+	isEnvelope := map[int]bool{}
+	for _, assignment := range assignments {
+		isEnvelope[assignment.CategoryID] = true
+	}
+	parents := map[int]int{}
+	paths := map[int]string{}
+	envelopes := []models.Category{}
+	for _, category := range categories {
+		paths[category.ID] = category.Path
+		if category.ParentID != nil {
+			parents[category.ID] = *category.ParentID
+		}
+		if category.Kind != models.CategoryKindExpense {
+			continue
+		}
+		if category.ParentID == nil {
+			isEnvelope[category.ID] = true
+		}
+		if isEnvelope[category.ID] {
+			envelopes = append(envelopes, category)
+		}
+	}
+	envelopeOf := func(categoryID int) int {
+		for !isEnvelope[categoryID] {
+			parent, ok := parents[categoryID]
+			if !ok {
+				break
+			}
+			categoryID = parent
+		}
+		return categoryID
+	}
+
+	result := models.EnvelopeMonth{
+		Month:        month,
+		Start:        start,
+		History:      []models.EnvelopeAssignment{},
+		MissingRates: []string{},
+	}
+	missing := map[string]bool{}
+	convert := func(c *converter, amount money.Money) money.Money {
+		converted, err := c.Convert(amount, currency)
+		if err != nil {
+			missing[amount.Currency()] = true
+			return money.Zero(currency)
+		}
+		return converted
+	}
+
+	toBeAssigned, err := s.startingFunds(userID, start, currency, convert)
+	if err != nil {
+		return models.EnvelopeMonth{}, err
+	}
+
+	// Every amount below has been converted into the base currency, so adding
+	// them up cannot fail
+	carried := map[int]money.Money{}
+	overspent := money.Zero(currency)
+	for m := start; !m.After(month); m = m.AddDate(0, 1, 0) {
+		c, err := loadConverter(s.exchangeRateRepository, ratesDate(m))
+		if err != nil {
+			return models.EnvelopeMonth{}, err
+		}
+
+		totals, err := s.categoryService.GetCategoryTotals(userID, m, m.AddDate(0, 1, 0))
+		if err != nil {
+			return models.EnvelopeMonth{}, err
+		}
+		income := money.Zero(currency)
+		spent := map[int]money.Money{}
+		for _, total := range totals {
+			amount := convert(c, total.Total)
+			if total.Kind == models.CategoryKindIncome {
+				income, _ = income.Add(amount)
+				continue
+			}
+			// Expenses are booked as negative amounts
+			envelope := envelopeOf(total.CategoryID)
+			spent[envelope], _ = valueOrZero(spent[envelope], currency).Sub(amount)
+		}
+
+		assigned := map[int]money.Money{}
+		assignedTotal := money.Zero(currency)
+		for _, assignment := range assignments {
+			if !assignment.Month.Equal(m) {
+				continue
+			}
+			amount := convert(c, assignment.Amount)
+			assigned[assignment.CategoryID], _ = valueOrZero(assigned[assignment.CategoryID], currency).Add(amount)
+			assignedTotal, _ = assignedTotal.Add(amount)
+			if m.Equal(month) {
+				assignment.CategoryName = paths[assignment.CategoryID]
+				result.History = append(result.History, assignment)
+			}
+		}
+
+		toBeAssigned, _ = toBeAssigned.Add(income)
+		toBeAssigned, _ = toBeAssigned.Sub(assignedTotal)
+		toBeAssigned, _ = toBeAssigned.Sub(overspent)
+
+		if m.Equal(month) {
+			result.Income = income
+			result.Assigned = assignedTotal
+			result.Overspent = overspent
+			result.ToBeAssigned = toBeAssigned
+		}
+
+		// Unspent money stays in its envelope, while overspending is taken
+		// out of the next month's money to be assigned
+		overspent = money.Zero(currency)
+		monthEnvelopes := []models.Envelope{}
+		for _, category := range envelopes {
+			envelope := models.Envelope{
+				CategoryID:   category.ID,
+				CategoryName: category.Path,
+				Carried:      valueOrZero(carried[category.ID], currency),
+				Assigned:     valueOrZero(assigned[category.ID], currency),
+				Spent:        valueOrZero(spent[category.ID], currency),
+			}
+			envelope.Available, _ = envelope.Carried.Add(envelope.Assigned)
+			envelope.Available, _ = envelope.Available.Sub(envelope.Spent)
+			monthEnvelopes = append(monthEnvelopes, envelope)
+
+			carried[category.ID] = envelope.Available
+			if envelope.Available.IsNegative() {
+				overspent, _ = overspent.Sub(envelope.Available)
+				carried[category.ID] = money.Zero(currency)
+			}
+		}
+		result.Envelopes = monthEnvelopes
+	}
+
+	for currency := range missing {
+		result.MissingRates = append(result.MissingRates, currency)
+	}
+	sort.Strings(result.MissingRates)
+
+	return result, nil
+}
+
+// Assign sets the money assigned to the category's envelope for the month
+// containing month, recording the change in the month's history.
+func (s *EnvelopeService) Assign(userID int, categoryID int, month time.Time, amount money.Money, note string) error {
+	user, _, err := s.envelopeUser(userID, month)
+	if err != nil {
+		return err
+	}
+	month = monthStart(month)
+
+	_, err = s.envelopeCategory(userID, categoryID)
+	if err != nil {
+		return err
+	}
+	if amount.Currency() != user.BaseCurrency {
+		return fmt.Errorf("%w: envelopes are in your base currency, %s", money.ErrCurrencyMismatch, user.BaseCurrency)
+	}
+	if amount.IsNegative() {
+		return fmt.Errorf("%w: assigned amount must not be negative", ErrInvalidEnvelope)
+	}
+	note = strings.TrimSpace(note)
+	if len(note) > maxMemoLength {
+		return fmt.Errorf("%w: note is longer than %d characters", ErrInvalidEnvelope, maxMemoLength)
+	}
+	if note == "" {
+		note = "Assigned"
+	}
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		envelopes := s.envelopeRepository.WithTx(tx)
+
+		assignments, err := envelopes.GetAssignments(userID, month, month)
+		if err != nil {
+			return err
+		}
+		c, err := loadConverter(s.exchangeRateRepository.WithTx(tx), ratesDate(month))
+		if err != nil {
+			return err
+		}
+		change := amount
+		for _, assignment := range assignments {
+			if assignment.CategoryID != categoryID {
+				continue
+			}
+			converted, err := c.Convert(assignment.Amount, amount.Currency())
+			if err != nil {
+				return err
+			}
+			change, err = change.Sub(converted)
+			if err != nil {
+				return err
+			}
+		}
+		if change.IsZero() {
+			return nil
+		}
+
+		_, err = envelopes.CreateAssignment(models.EnvelopeAssignment{
+			UserID:     userID,
+			CategoryID: categoryID,
+			Month:      month,
+			Amount:     change,
+			Note:       note,
+		})
+		return err
+	})
+}
+
+// Move moves money between two envelopes for the month containing month.
+func (s *EnvelopeService) Move(userID int, fromID int, toID int, month time.Time, amount money.Money, note string) error {
+	user, _, err := s.envelopeUser(userID, month)
+	if err != nil {
+		return err
+	}
+	month = monthStart(month)
+
+	if fromID == toID {
+		return fmt.Errorf("%w: money must move to another envelope", ErrInvalidEnvelope)
+	}
+	from, err := s.envelopeCategory(userID, fromID)
+	if err != nil {
+		return err
+	}
+	to, err := s.envelopeCategory(userID, toID)
+	if err != nil {
+		return err
+	}
+	if amount.Currency() != user.BaseCurrency {
+		return fmt.Errorf("%w: envelopes are in your base currency, %s", money.ErrCurrencyMismatch, user.BaseCurrency)
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidEnvelope)
+	}
+	note = strings.TrimSpace(note)
+	if len(note) > maxMemoLength {
+		return fmt.Errorf("%w: note is longer than %d characters", ErrInvalidEnvelope, maxMemoLength)
+	}
+
+	outNote, inNote := "Moved to "+to.Name, "Moved from "+from.Name
+	if note != "" {
+		outNote, inNote = outNote+": "+note, inNote+": "+note
+	}
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		envelopes := s.envelopeRepository.WithTx(tx)
+
+		_, err := envelopes.CreateAssignment(models.EnvelopeAssignment{UserID: userID, CategoryID: fromID, Month: month, Amount: amount.Neg(), Note: outNote})
+		if err != nil {
+			return err
+		}
+
+		_, err = envelopes.CreateAssignment(models.EnvelopeAssignment{UserID: userID, CategoryID: toID, Month: month, Amount: amount, Note: inNote})
+		return err
+	})
+}
+
+// envelopeUser returns the user and the month their envelope budgeting
+// starts, checking that month is not before it.
+func (s *EnvelopeService) envelopeUser(userID int, month time.Time) (models.User, time.Time, error) {
+	user, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return models.User{}, time.Time{}, err
+	}
+	if user.EnvelopeStart == nil {
+		return models.User{}, time.Time{}, ErrEnvelopesOff
+	}
+
+	start := monthStart(*user.EnvelopeStart)
+	if monthStart(month).Before(start) {
+		return models.User{}, time.Time{}, fmt.Errorf("%w: envelope budgeting starts in %s", ErrInvalidEnvelope, start.Format("2006-01"))
+	}
+
+	return user, start, nil
+}
+
+func (s *EnvelopeService) envelopeCategory(userID int, categoryID int) (models.Category, error) {
+	category, err := s.categoryService.GetCategory(userID, categoryID)
+	if err != nil {
+		return models.Category{}, err
+	}
+	if category.Kind != models.CategoryKindExpense {
+		return models.Category{}, fmt.Errorf("%w: envelopes are for expense categories", ErrInvalidEnvelope)
+	}
+
+	return category, nil
+}
+
+// startingFunds is the money in the user's accounts when envelope budgeting
+// starts, converted at the rates as of then.
+func (s *EnvelopeService) startingFunds(userID int, start time.Time, currency string, convert func(c *converter, amount money.Money) money.Money) (money.Money, error) {
+	c, err := loadConverter(s.exchangeRateRepository, start)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	accounts, err := s.accountRepository.GetAccountsByUserID(userID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	sums, err := s.transactionRepository.SumTransactionsBefore(userID, start)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	funds := money.Zero(currency)
+	for _, account := range accounts {
+		funds, err = funds.Add(convert(c, account.OpeningBalance))
+		if err != nil {
+			return money.Money{}, err
+		}
+	}
+	for _, sum := range sums {
+		funds, err = funds.Add(convert(c, sum))
+		if err != nil {
+			return money.Money{}, err
+		}
+	}
+
+	return funds, nil
+}
+
+// valueOrZero returns amount, or zero in the currency if it was never set.
+func valueOrZero(amount money.Money, currency string) money.Money {
+	if amount.Currency() == "" {
+		return money.Zero(currency)
+	}
+	return amount
+}
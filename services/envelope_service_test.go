@@ -0,0 +1,134 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestEnvelopeBudgeting(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY", OpeningBalance: money.New(100000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, ParentID: &food.ID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fun, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Fun", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thisMonth := monthStart(time.Now())
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	for _, entry := range []struct {
+		date       time.Time
+		categoryID int
+		amount     int64
+	}{
+		{lastMonth.AddDate(0, -1, 0), groceries.ID, -10000},
+		{lastMonth, salary.ID, 50000},
+		{lastMonth, groceries.ID, -30000},
+	} {
+		_, _, err := s.transactionService.CreateTransaction(models.Transaction{
+			UserID:     userID,
+			AccountID:  account.ID,
+			CategoryID: &entry.categoryID,
+			Amount:     money.New(entry.amount, "JPY"),
+			Date:       entry.date,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = s.envelopeService.GetMonth(userID, thisMonth)
+	if err != ErrEnvelopesOff {
+		t.Fatalf("got %v before turning envelopes on, want ErrEnvelopesOff", err)
+	}
+	_, err = s.envelopeService.SetStart(userID, &lastMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.envelopeService.Assign(userID, food.ID, lastMonth, money.New(20000, "JPY"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.envelopeService.Assign(userID, fun.ID, lastMonth, money.New(10000, "JPY"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.envelopeService.Move(userID, fun.ID, food.ID, lastMonth, money.New(5000, "JPY"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The 90,000 there was at the start plus the salary, less what was
+	// assigned. Groceries draw on Food, overspending it by 5,000
+	month, err := s.envelopeService.GetMonth(userID, lastMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.ToBeAssigned != money.New(110000, "JPY") || len(month.History) != 4 {
+		t.Fatalf("to be assigned %s with %d history entries, want 110000 with 4", month.ToBeAssigned, len(month.History))
+	}
+	available := map[int]money.Money{}
+	for _, envelope := range month.Envelopes {
+		available[envelope.CategoryID] = envelope.Available
+	}
+	if available[food.ID] != money.New(-5000, "JPY") || available[fun.ID] != money.New(5000, "JPY") {
+		t.Fatalf("food has %s and fun %s available, want -5000 and 5000", available[food.ID], available[fun.ID])
+	}
+
+	// Fun's leftover carries over, and Food's overspending comes out of this
+	// month's money to be assigned
+	month, err = s.envelopeService.GetMonth(userID, thisMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.ToBeAssigned != money.New(105000, "JPY") || month.Overspent != money.New(5000, "JPY") {
+		t.Fatalf("to be assigned %s after %s overspent, want 105000 after 5000", month.ToBeAssigned, month.Overspent)
+	}
+	for _, envelope := range month.Envelopes {
+		if envelope.CategoryID == food.ID && !envelope.Carried.IsZero() || envelope.CategoryID == fun.ID && envelope.Carried != money.New(5000, "JPY") {
+			t.Fatalf("%s carried %s into this month", envelope.CategoryName, envelope.Carried)
+		}
+	}
+
+	// Assigning sets the month's total rather than adding to it
+	err = s.envelopeService.Assign(userID, fun.ID, thisMonth, money.New(3000, "JPY"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.envelopeService.Assign(userID, fun.ID, thisMonth, money.New(2000, "JPY"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	month, err = s.envelopeService.GetMonth(userID, thisMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.Assigned != money.New(2000, "JPY") || month.ToBeAssigned != money.New(103000, "JPY") {
+		t.Fatalf("assigned %s leaving %s, want 2000 leaving 103000", month.Assigned, month.ToBeAssigned)
+	}
+
+	err = s.envelopeService.Assign(userID, salary.ID, thisMonth, money.New(1000, "JPY"), "")
+	if err == nil {
+		t.Fatal("money was assigned to an income category")
+	}
+}
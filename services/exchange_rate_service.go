@@ -0,0 +1,301 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrNoExchangeRate       = errors.New("no exchange rate")
+	ErrInvalidExchangeRates = errors.New("invalid exchange rate file")
+)
+
+// ecbBase is the currency the European Central Bank quotes its reference
+// rates against.
+const ecbBase = "EUR"
+
+type ExchangeRateService struct {
+	exchangeRateRepository repositories.ExchangeRateRepository
+	txRunner               repositories.TxRunner
+}
+
+func NewExchangeRateService(exchangeRateRepository repositories.ExchangeRateRepository, txRunner *repositories.TxRunner) *ExchangeRateService {
+	return &ExchangeRateService{
+		exchangeRateRepository: exchangeRateRepository,
+		txRunner:               *txRunner,
+	}
+}
+
+// GetExchangeRates returns the latest rate of every pair as of the date.
+func (s *ExchangeRateService) GetExchangeRates(on time.Time) ([]models.ExchangeRate, error) {
+	return s.exchangeRateRepository.GetLatestExchangeRates(dateOnly(on))
+}
+
+// Convert converts the amount into another currency at the latest rates as
+// of the date.
+func (s *ExchangeRateService) Convert(amount money.Money, currency string, on time.Time) (money.Money, error) {
+	converter, err := loadConverter(s.exchangeRateRepository, on)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return converter.Convert(amount, currency)
+}
+
+// ImportRates reads reference rates in one of the formats the European
+// Central Bank publishes them in, the eurofxref XML or CSV files, and stores
+// them. Rates already stored for the same day are replaced. It returns the
+// number of rates read.
+func (s *ExchangeRateService) ImportRates(r io.Reader, source string) (int, error) {
+	reader := bufio.NewReader(r)
+	start, err := reader.Peek(64)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	var rates []models.ExchangeRate
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("<")) {
+		rates, err = parseECBXML(reader)
+	} else {
+		rates, err = parseECBCSV(reader)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, fmt.Errorf("%w: no rates found", ErrInvalidExchangeRates)
+	}
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		exchangeRates := s.exchangeRateRepository.WithTx(tx)
+		for _, rate := range rates {
+			rate.Source = source
+			err := exchangeRates.SaveExchangeRate(rate)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+// parseECBXML reads the eurofxref-daily.xml and eurofxref-hist.xml format:
+//
+//	<Cube><Cube time="2024-06-03"><Cube currency="USD" rate="1.0842"/>...</Cube></Cube>
+func parseECBXML(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube>Cube"`
+	}
+	err := xml.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeRates, err)
+	}
+
+	rates := []models.ExchangeRate{}
+	for _, day := range envelope.Days {
+		date, err := parseRateDate(day.Time)
+		if err != nil {
+			return nil, err
+		}
+		for _, quote := range day.Rates {
+			rate, err := newExchangeRate(date, quote.Currency, quote.Rate)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+// parseECBCSV reads the eurofxref.csv and eurofxref-hist.csv format, a Date
+// column followed by one column per currency:
+//
+//	Date, USD, JPY, ...
+//	03 June 2024, 1.0842, 169.67, ...
+//
+// Cells marked N/A are skipped.
+func parseECBCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExchangeRates, err)
+	}
+	if len(records) == 0 || !strings.EqualFold(strings.TrimSpace(records[0][0]), "Date") {
+		return nil, fmt.Errorf("%w: expected a Date column first", ErrInvalidExchangeRates)
+	}
+	header := records[0]
+
+	rates := []models.ExchangeRate{}
+	for _, record := range records[1:] {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		date, err := parseRateDate(record[0])
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency, value := strings.TrimSpace(header[i]), strings.TrimSpace(record[i])
+			if currency == "" || value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := newExchangeRate(date, currency, value)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+func newExchangeRate(date time.Time, currency string, value string) (models.ExchangeRate, error) {
+	c, err := money.LookupCurrency(currency)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("%w: %q: %v", ErrInvalidExchangeRates, currency, err)
+	}
+
+	rate := money.Decimal(strings.TrimSpace(value))
+	r, err := rate.Rat()
+	if err != nil || r.Sign() <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("%w: %s rate %q on %s", ErrInvalidExchangeRates, c.Code, value, date.Format("2006-01-02"))
+	}
+
+	return models.ExchangeRate{Date: date, Base: ecbBase, Quote: c.Code, Rate: rate}, nil
+}
+
+// parseRateDate accepts the ISO dates of the historical files and the
+// "3 June 2024" style of the daily CSV.
+func parseRateDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "02 January 2006", "2 January 2006"} {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrInvalidExchangeRates, value)
+}
+
+// dateOnly strips the time of day, as rates are stored per day in UTC.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// converter converts between currencies with the rates as of one day. Rates
+// can be used in either direction and chained, so that with the ECB's EUR
+// rates JPY converts to USD through EUR.
+type converter struct {
+	rates map[string]map[string]*big.Rat
+}
+
+func loadConverter(exchangeRateRepository repositories.ExchangeRateRepository, on time.Time) (*converter, error) {
+	rates, err := exchangeRateRepository.GetLatestExchangeRates(dateOnly(on))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &converter{rates: map[string]map[string]*big.Rat{}}
+	for _, rate := range rates {
+		r, err := rate.Rate.Rat()
+		if err != nil || r.Sign() <= 0 {
+			continue
+		}
+		c.set(rate.Base, rate.Quote, r)
+	}
+	// A stored rate wins over the inverse of the opposite pair
+	for _, rate := range rates {
+		r, ok := c.rates[rate.Base][rate.Quote]
+		if _, exists := c.rates[rate.Quote][rate.Base]; ok && !exists {
+			c.set(rate.Quote, rate.Base, new(big.Rat).Inv(r))
+		}
+	}
+
+	return c, nil
+}
+
+func (c *converter) set(from string, to string, rate *big.Rat) {
+	if c.rates[from] == nil {
+		c.rates[from] = map[string]*big.Rat{}
+	}
+	c.rates[from][to] = rate
+}
+
+// Rate returns how many units of to one unit of from is worth, following
+// the fewest rates needed.
+func (c *converter) Rate(from string, to string) (*big.Rat, bool) {
+	if from == to {
+		return big.NewRat(1, 1), true
+	}
+
+	found := map[string]*big.Rat{from: big.NewRat(1, 1)}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		// Visit neighbours in a fixed order so that the same rates always
+		// give the same result
+		neighbours := make([]string, 0, len(c.rates[current]))
+		for next := range c.rates[current] {
+			neighbours = append(neighbours, next)
+		}
+		sort.Strings(neighbours)
+
+		for _, next := range neighbours {
+			if _, seen := found[next]; seen {
+				continue
+			}
+			found[next] = new(big.Rat).Mul(found[current], c.rates[current][next])
+			if next == to {
+				return found[next], true
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	return nil, false
+}
+
+func (c *converter) Convert(amount money.Money, currency string) (money.Money, error) {
+	if amount.Currency() == currency {
+		return amount, nil
+	}
+
+	rate, ok := c.Rate(amount.Currency(), currency)
+	if !ok {
+		return money.Money{}, fmt.Errorf("%w from %s to %s", ErrNoExchangeRate, amount.Currency(), currency)
+	}
+
+	return amount.Convert(rate, currency)
+}
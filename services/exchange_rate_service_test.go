@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// ecbDailyXML is laid out like eurofxref-daily.xml, with a second day as in
+// eurofxref-hist.xml.
+const ecbDailyXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time='2024-06-04'>
+			<Cube currency='USD' rate='1.0888'/>
+		</Cube>
+		<Cube time='2024-06-03'>
+			<Cube currency='USD' rate='1.0842'/>
+			<Cube currency='JPY' rate='169.67'/>
+			<Cube currency='KWD' rate='0.3325'/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>
+`
+
+// formatRates lists rates one per line, like "2024-06-03 EUR/USD 1.0842".
+func formatRates(rates []models.ExchangeRate) string {
+	lines := []string{}
+	for _, rate := range rates {
+		lines = append(lines, fmt.Sprintf("%s %s/%s %s", rate.Date.Format("2006-01-02"), rate.Base, rate.Quote, rate.Rate))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseECBXML(t *testing.T) {
+	rates, err := parseECBXML(strings.NewReader(ecbDailyXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2024-06-04 EUR/USD 1.0888\n2024-06-03 EUR/USD 1.0842\n2024-06-03 EUR/JPY 169.67\n2024-06-03 EUR/KWD 0.3325"
+	if got := formatRates(rates); got != want {
+		t.Fatalf("parsed\n%s\nwant\n%s", got, want)
+	}
+
+	for name, file := range map[string]string{
+		"not XML":          "Date, USD\n",
+		"invalid date":     `<Envelope><Cube><Cube time="June 3rd"><Cube currency="USD" rate="1.08"/></Cube></Cube></Envelope>`,
+		"invalid currency": `<Envelope><Cube><Cube time="2024-06-03"><Cube currency="US$" rate="1.08"/></Cube></Cube></Envelope>`,
+		"zero rate":        `<Envelope><Cube><Cube time="2024-06-03"><Cube currency="USD" rate="0"/></Cube></Cube></Envelope>`,
+		"rate with comma":  `<Envelope><Cube><Cube time="2024-06-03"><Cube currency="USD" rate="1,08"/></Cube></Cube></Envelope>`,
+	} {
+		_, err := parseECBXML(strings.NewReader(file))
+		if !errors.Is(err, ErrInvalidExchangeRates) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidExchangeRates)
+		}
+	}
+}
+
+func TestParseECBCSV(t *testing.T) {
+	for name, c := range map[string]struct {
+		file string
+		want string
+	}{
+		// eurofxref.csv ends every line with a comma
+		"daily": {
+			"Date, USD, JPY, BGN, \n03 June 2024, 1.0842, 169.67, 1.9558, \n",
+			"2024-06-03 EUR/USD 1.0842\n2024-06-03 EUR/JPY 169.67\n2024-06-03 EUR/BGN 1.9558",
+		},
+		// eurofxref-hist.csv has ISO dates and N/A for currencies that
+		// were not quoted yet
+		"history": {
+			"Date,USD,JPY,ISK,\n2024-06-04,1.0888,170.21,N/A,\n2024-06-03,1.0842,169.67,149.9,\n\n",
+			"2024-06-04 EUR/USD 1.0888\n2024-06-04 EUR/JPY 170.21\n2024-06-03 EUR/USD 1.0842\n2024-06-03 EUR/JPY 169.67\n2024-06-03 EUR/ISK 149.9",
+		},
+		"single digit day": {
+			"Date, USD\n3 June 2024, 1.0842\n",
+			"2024-06-03 EUR/USD 1.0842",
+		},
+	} {
+		rates, err := parseECBCSV(strings.NewReader(c.file))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := formatRates(rates); got != c.want {
+			t.Fatalf("%s: parsed\n%s\nwant\n%s", name, got, c.want)
+		}
+	}
+
+	for name, file := range map[string]string{
+		"empty":            "",
+		"no date column":   "USD, JPY\n1.0842, 169.67\n",
+		"invalid date":     "Date, USD\n2024/06/03, 1.0842\n",
+		"invalid currency": "Date, US$\n2024-06-03, 1.0842\n",
+		"negative rate":    "Date, USD\n2024-06-03, -1.0842\n",
+		"unquoted comma":   "Date, USD\n2024-06-03, \"1.08\"42\n",
+	} {
+		_, err := parseECBCSV(strings.NewReader(file))
+		if !errors.Is(err, ErrInvalidExchangeRates) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidExchangeRates)
+		}
+	}
+}
+
+func TestImportRatesAndConvert(t *testing.T) {
+	s := newTestServices(t)
+
+	count, err := s.exchangeRateService.ImportRates(strings.NewReader(ecbDailyXML), "ecb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Fatalf("imported %d rates from the XML, want 4", count)
+	}
+	_, err = s.exchangeRateService.ImportRates(strings.NewReader("Date, USD\n"), "ecb")
+	if !errors.Is(err, ErrInvalidExchangeRates) {
+		t.Fatalf("importing a file without rates: err = %v, want %v", err, ErrInvalidExchangeRates)
+	}
+
+	june := func(day int) time.Time {
+		return time.Date(2024, 6, day, 15, 30, 0, 0, time.UTC)
+	}
+	convert := func(amount money.Money, currency string, on time.Time) money.Money {
+		t.Helper()
+		converted, err := s.exchangeRateService.Convert(amount, currency, on)
+		if err != nil {
+			t.Fatalf("converting %s to %s: %v", amount, currency, err)
+		}
+		return converted
+	}
+
+	// Every pair converts through the euro in either direction, rounded to
+	// the target currency's minor unit
+	for _, c := range []struct {
+		amount   money.Money
+		currency string
+		day      int
+		want     money.Money
+	}{
+		{money.New(10000, "JPY"), "EUR", 3, money.New(5894, "EUR")},
+		{money.New(10000, "JPY"), "USD", 3, money.New(6390, "USD")},
+		{money.New(100, "USD"), "JPY", 3, money.New(156, "JPY")},
+		{money.New(-100, "USD"), "JPY", 3, money.New(-156, "JPY")},
+		{money.New(10000, "USD"), "KWD", 3, money.New(30668, "KWD")},
+		{money.New(1000, "KWD"), "JPY", 3, money.New(510, "JPY")},
+		// The USD rate of the 4th is used with the JPY rate of the 3rd
+		{money.New(10000, "JPY"), "USD", 4, money.New(6417, "USD")},
+		{money.New(10000, "JPY"), "USD", 10, money.New(6417, "USD")},
+	} {
+		if got := convert(c.amount, c.currency, june(c.day)); got != c.want {
+			t.Errorf("%s in %s on June %d = %s, want %s", c.amount, c.currency, c.day, got, c.want)
+		}
+	}
+
+	_, err = s.exchangeRateService.Convert(money.New(100, "USD"), "JPY", june(2))
+	if !errors.Is(err, ErrNoExchangeRate) {
+		t.Fatalf("converting before the first rate: err = %v, want %v", err, ErrNoExchangeRate)
+	}
+	_, err = s.exchangeRateService.Convert(money.New(100, "USD"), "GBP", june(3))
+	if !errors.Is(err, ErrNoExchangeRate) {
+		t.Fatalf("converting to a currency without rates: err = %v, want %v", err, ErrNoExchangeRate)
+	}
+
+	// Round rates make the exact halves round away from zero between
+	// currencies with 0, 2 and 3 decimals. Importing the same day again
+	// replaces its rates.
+	for _, file := range []string{"Date, USD, JPY, KWD\n05 June 2024, 2, 200, 0.8\n", "Date, USD, JPY, KWD\n05 June 2024, 1, 125, 0.4\n"} {
+		count, err = s.exchangeRateService.ImportRates(strings.NewReader(file), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Fatalf("imported %d rates from the CSV, want 3", count)
+		}
+	}
+	for _, c := range []struct {
+		amount   money.Money
+		currency string
+		want     money.Money
+	}{
+		{money.New(2, "USD"), "JPY", money.New(3, "JPY")},
+		{money.New(-2, "USD"), "JPY", money.New(-3, "JPY")},
+		{money.New(1, "USD"), "JPY", money.New(1, "JPY")},
+		{money.New(1, "JPY"), "USD", money.New(1, "USD")},
+		{money.New(8, "KWD"), "JPY", money.New(3, "JPY")},
+		{money.New(-8, "KWD"), "JPY", money.New(-3, "JPY")},
+		{money.New(3, "JPY"), "KWD", money.New(10, "KWD")},
+		{money.New(2, "KWD"), "USD", money.New(1, "USD")},
+		{money.New(-2, "KWD"), "USD", money.New(-1, "USD")},
+		{money.New(1, "KWD"), "USD", money.New(0, "USD")},
+	} {
+		if got := convert(c.amount, c.currency, june(5)); got != c.want {
+			t.Errorf("%s in %s = %s, want %s", c.amount, c.currency, got, c.want)
+		}
+	}
+
+	rates, err := s.exchangeRateService.GetExchangeRates(june(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rate := range rates {
+		if rate.Quote == "JPY" && (rate.Rate != "125" || rate.Source != "test") {
+			t.Fatalf("EUR/JPY is %s from %q, want the second import's 125", rate.Rate, rate.Source)
+		}
+	}
+}
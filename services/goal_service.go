@@ -0,0 +1,395 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrGoalNotFound = errors.New("goal not found")
+	ErrInvalidGoal  = errors.New("invalid goal")
+)
+
+// goalRateMonths is how many months back the recent saving rate of a goal
+// is averaged over.
+const goalRateMonths = 3
+
+// maxProjectionYears bounds how far ahead a goal's completion is projected.
+// A rate that would take longer than this never reaches the goal.
+const maxProjectionYears = 100
+
+type GoalService struct {
+	goalRepository         repositories.GoalRepository
+	accountRepository      repositories.AccountRepository
+	transactionRepository  repositories.TransactionRepository
+	exchangeRateRepository repositories.ExchangeRateRepository
+	categoryService        *CategoryService
+}
+
+func NewGoalService(goalRepository repositories.GoalRepository, accountRepository repositories.AccountRepository, transactionRepository repositories.TransactionRepository, exchangeRateRepository repositories.ExchangeRateRepository, categoryService *CategoryService) *GoalService {
+	return &GoalService{
+		goalRepository:         goalRepository,
+		accountRepository:      accountRepository,
+		transactionRepository:  transactionRepository,
+		exchangeRateRepository: exchangeRateRepository,
+		categoryService:        categoryService,
+	}
+}
+
+func (s *GoalService) GetGoals(userID int) ([]models.Goal, error) {
+	return s.goalRepository.GetGoalsByUserID(userID)
+}
+
+// GetGoal returns the goal only if it belongs to the user.
+func (s *GoalService) GetGoal(userID int, id int) (models.Goal, error) {
+	return getOwnedGoal(s.goalRepository, userID, id)
+}
+
+func (s *GoalService) CreateGoal(goal models.Goal) (models.Goal, error) {
+	err := s.normalizeGoal(&goal)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	created, err := s.goalRepository.CreateGoal(goal)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	return s.goalRepository.GetGoal(created.ID)
+}
+
+func (s *GoalService) UpdateGoal(userID int, id int, goal models.Goal) (models.Goal, error) {
+	_, err := getOwnedGoal(s.goalRepository, userID, id)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	goal.UserID = userID
+	err = s.normalizeGoal(&goal)
+	if err != nil {
+		return models.Goal{}, err
+	}
+	goal.UpdatedAt = time.Now()
+
+	err = s.goalRepository.UpdateGoal(id, goal)
+	if err != nil {
+		return models.Goal{}, err
+	}
+
+	return s.goalRepository.GetGoal(id)
+}
+
+func (s *GoalService) DeleteGoal(userID int, id int) error {
+	_, err := getOwnedGoal(s.goalRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.goalRepository.DeleteGoal(id)
+}
+
+// GetGoalProgress returns how far one of the user's goals has come as of
+// now.
+func (s *GoalService) GetGoalProgress(userID int, id int, now time.Time) (models.GoalProgress, error) {
+	goal, err := getOwnedGoal(s.goalRepository, userID, id)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+
+	tracker, err := s.newGoalTracker(userID, now)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+
+	return tracker.progress(goal)
+}
+
+// GetGoalsProgress returns how far each of the user's goals has come as of
+// now. Amounts in other currencies are converted at today's rates.
+func (s *GoalService) GetGoalsProgress(userID int, now time.Time) ([]models.GoalProgress, error) {
+	goals, err := s.goalRepository.GetGoalsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker, err := s.newGoalTracker(userID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []models.GoalProgress{}
+	for _, goal := range goals {
+		progress, err := tracker.progress(goal)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, progress)
+	}
+
+	return results, nil
+}
+
+// goalTracker computes goal progress, loading the category totals the first
+// time a goal linked to a category needs them.
+type goalTracker struct {
+	service    *GoalService
+	userID     int
+	today      time.Time
+	converter  *converter
+	balances   map[int]models.AccountBalance
+	categories map[int]models.Category
+	totals     []models.CategoryTotal
+	recent     []models.CategoryTotal
+}
+
+func (s *GoalService) newGoalTracker(userID int, now time.Time) (*goalTracker, error) {
+	today := dateOnly(now)
+
+	c, err := loadConverter(s.exchangeRateRepository, today)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := s.accountRepository.GetAccountBalancesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	tracker := &goalTracker{
+		service:   s,
+		userID:    userID,
+		today:     today,
+		converter: c,
+		balances:  map[int]models.AccountBalance{},
+	}
+	for _, balance := range balances {
+		tracker.balances[balance.ID] = balance
+	}
+
+	return tracker, nil
+}
+
+func (t *goalTracker) progress(goal models.Goal) (models.GoalProgress, error) {
+	currency := goal.Target.Currency()
+	progress := models.GoalProgress{
+		Goal:         goal,
+		MissingRates: []string{},
+	}
+
+	missing := map[string]bool{}
+	convert := func(amount money.Money) money.Money {
+		converted, err := t.converter.Convert(amount, currency)
+		if err != nil {
+			missing[amount.Currency()] = true
+			return money.Zero(currency)
+		}
+		return converted
+	}
+
+	saved, recent, err := t.saved(goal, convert)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+	for currency := range missing {
+		progress.MissingRates = append(progress.MissingRates, currency)
+	}
+	sort.Strings(progress.MissingRates)
+
+	progress.Saved = saved
+	progress.PercentComplete = percentUsed(saved, goal.Target)
+	progress.Remaining, err = goal.Target.Sub(saved)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+	if !progress.Remaining.IsPositive() {
+		progress.Remaining = money.Zero(currency)
+		progress.Reached = true
+	}
+
+	// Months left count the current one through the target month; once the
+	// target month has passed, everything remaining is due now
+	monthsLeft := monthsBetween(monthStart(t.today), goal.TargetMonth) + 1
+	if monthsLeft < 1 {
+		monthsLeft = 1
+	}
+	progress.RequiredMonthly, err = money.FromRat(new(big.Rat).Quo(progress.Remaining.Rat(), big.NewRat(int64(monthsLeft), 1)), currency)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+	progress.MonthlyRate, err = money.FromRat(new(big.Rat).Quo(recent.Rat(), big.NewRat(goalRateMonths, 1)), currency)
+	if err != nil {
+		return models.GoalProgress{}, err
+	}
+
+	if !progress.Reached && progress.MonthlyRate.IsPositive() {
+		months, _ := new(big.Rat).Quo(progress.Remaining.Rat(), progress.MonthlyRate.Rat()).Float64()
+		if days := math.Ceil(months * 365.25 / 12); days <= maxProjectionYears*365.25 {
+			projected := t.today.AddDate(0, 0, int(days))
+			progress.ProjectedDate = &projected
+		}
+	}
+
+	due := goal.TargetMonth.AddDate(0, 1, 0)
+	progress.OnTrack = progress.Reached || progress.ProjectedDate != nil && progress.ProjectedDate.Before(due)
+
+	return progress, nil
+}
+
+// saved returns what has been saved towards the goal in all, and over the
+// last goalRateMonths months.
+func (t *goalTracker) saved(goal models.Goal, convert func(money.Money) money.Money) (money.Money, money.Money, error) {
+	currency := goal.Target.Currency()
+	from := t.today.AddDate(0, -goalRateMonths, 0)
+	to := t.today.AddDate(0, 0, 1)
+
+	if goal.AccountID != nil {
+		balance, ok := t.balances[*goal.AccountID]
+		if !ok {
+			return money.Money{}, money.Money{}, ErrAccountNotFound
+		}
+
+		sum, err := t.service.transactionRepository.SumTransactionsByAccountIDBetween(balance.ID, from, to)
+		if err != nil {
+			return money.Money{}, money.Money{}, err
+		}
+		recent, err := money.FromDecimal(sum, balance.Currency)
+		if err != nil {
+			return money.Money{}, money.Money{}, err
+		}
+
+		return convert(balance.Balance), convert(recent), nil
+	}
+
+	err := t.loadCategoryTotals(from, to)
+	if err != nil {
+		return money.Money{}, money.Money{}, err
+	}
+	category, ok := t.categories[*goal.CategoryID]
+	if !ok {
+		return money.Money{}, money.Money{}, ErrCategoryNotFound
+	}
+
+	// Money put aside under an expense category is booked as negative
+	// amounts, while income towards the goal is positive
+	sum := func(totals []models.CategoryTotal) money.Money {
+		saved := money.Zero(currency)
+		for _, total := range totals {
+			if !t.inCategory(total.CategoryID, category.ID) {
+				continue
+			}
+			amount := convert(total.Total)
+			if category.Kind == models.CategoryKindExpense {
+				amount = amount.Neg()
+			}
+			saved, _ = saved.Add(amount)
+		}
+		return saved
+	}
+
+	return sum(t.totals), sum(t.recent), nil
+}
+
+func (t *goalTracker) loadCategoryTotals(from time.Time, to time.Time) error {
+	if t.categories != nil {
+		return nil
+	}
+
+	categories, err := t.service.categoryService.GetCategories(t.userID)
+	if err != nil {
+		return err
+	}
+	totals, err := t.service.categoryService.GetCategoryTotals(t.userID, time.Time{}, to)
+	if err != nil {
+		return err
+	}
+	recent, err := t.service.categoryService.GetCategoryTotals(t.userID, from, to)
+	if err != nil {
+		return err
+	}
+
+	t.categories = map[int]models.Category{}
+	for _, category := range categories {
+		t.categories[category.ID] = category
+	}
+	t.totals = totals
+	t.recent = recent
+	return nil
+}
+
+// inCategory reports whether the category is ancestorID or one of its
+// subcategories.
+func (t *goalTracker) inCategory(categoryID int, ancestorID int) bool {
+	for {
+		if categoryID == ancestorID {
+			return true
+		}
+		category, ok := t.categories[categoryID]
+		if !ok || category.ParentID == nil {
+			return false
+		}
+		categoryID = *category.ParentID
+	}
+}
+
+// normalizeGoal validates a goal before it is stored.
+func (s *GoalService) normalizeGoal(goal *models.Goal) error {
+	goal.Name = strings.TrimSpace(goal.Name)
+	if goal.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidGoal)
+	}
+	if !goal.Target.IsPositive() {
+		return fmt.Errorf("%w: target must be positive", ErrInvalidGoal)
+	}
+	if goal.TargetMonth.IsZero() {
+		return fmt.Errorf("%w: target month is required", ErrInvalidGoal)
+	}
+	goal.TargetMonth = monthStart(goal.TargetMonth)
+
+	if (goal.AccountID == nil) == (goal.CategoryID == nil) {
+		return fmt.Errorf("%w: link the goal to either an account or a category", ErrInvalidGoal)
+	}
+	if goal.AccountID != nil {
+		_, err := getOwnedAccount(s.accountRepository, goal.UserID, *goal.AccountID)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := s.categoryService.GetCategory(goal.UserID, *goal.CategoryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// monthsBetween returns how many calendar months from is before to.
+func monthsBetween(from time.Time, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+func getOwnedGoal(goalRepository repositories.GoalRepository, userID int, id int) (models.Goal, error) {
+	goal, err := goalRepository.GetGoal(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Goal{}, ErrGoalNotFound
+		}
+		return models.Goal{}, err
+	}
+
+	if goal.UserID != userID {
+		return models.Goal{}, ErrGoalNotFound
+	}
+
+	return goal, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestGoalProgress(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	savings, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Savings", Currency: "JPY", OpeningBalance: money.New(100000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fund, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Holiday fund", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, entry := range []struct {
+		accountID  int
+		categoryID int
+		daysAgo    int
+		amount     int64
+	}{
+		{savings.ID, salary.ID, 200, 40000},
+		{savings.ID, salary.ID, 60, 30000},
+		{savings.ID, salary.ID, 20, 30000},
+		{cash.ID, fund.ID, 10, -12000},
+	} {
+		_, _, err := s.transactionService.CreateTransaction(models.Transaction{
+			UserID:     userID,
+			AccountID:  entry.accountID,
+			CategoryID: &entry.categoryID,
+			Amount:     money.New(entry.amount, "JPY"),
+			Date:       now.AddDate(0, 0, -entry.daysAgo),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	emergency, err := s.goalService.CreateGoal(models.Goal{UserID: userID, Name: "Emergency fund", Target: money.New(1000000, "JPY"), TargetMonth: monthStart(now).AddDate(0, 9, 0), AccountID: &savings.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	holiday, err := s.goalService.CreateGoal(models.Goal{UserID: userID, Name: "Holiday", Target: money.New(10000, "JPY"), TargetMonth: now, CategoryID: &fund.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The account holds 200,000; the last three months brought 60,000, or
+	// 20,000 a month, while 800,000 over the 10 months left needs 80,000
+	progress, err := s.goalService.GetGoalProgress(userID, emergency.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Saved != money.New(200000, "JPY") || progress.PercentComplete != 20 || progress.RequiredMonthly != money.New(80000, "JPY") || progress.MonthlyRate != money.New(20000, "JPY") {
+		t.Fatalf("saved %s, %d%%, %s needed and %s saved a month; want 200000, 20%%, 80000 and 20000", progress.Saved, progress.PercentComplete, progress.RequiredMonthly, progress.MonthlyRate)
+	}
+	if progress.ProjectedDate == nil || progress.ProjectedDate.Before(now.AddDate(0, 39, 0)) || progress.ProjectedDate.After(now.AddDate(0, 41, 0)) || progress.OnTrack {
+		t.Fatalf("projected %v, on track %v; want about 40 months out and off track", progress.ProjectedDate, progress.OnTrack)
+	}
+
+	// Money put aside under an expense category counts towards the goal
+	progress, err = s.goalService.GetGoalProgress(userID, holiday.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Reached || !progress.OnTrack || progress.Saved != money.New(12000, "JPY") || !progress.Remaining.IsZero() || progress.ProjectedDate != nil {
+		t.Fatalf("saved %s with %s remaining, reached %v; want 12000 with nothing remaining, reached", progress.Saved, progress.Remaining, progress.Reached)
+	}
+
+	_, err = s.goalService.CreateGoal(models.Goal{UserID: userID, Name: "Both", Target: money.New(1, "JPY"), TargetMonth: now, AccountID: &savings.ID, CategoryID: &fund.ID})
+	if err == nil {
+		t.Fatal("goal linked to both an account and a category was accepted")
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// isCamt053 reports whether an import file looks like an ISO 20022
+// camt.053 bank statement.
+func isCamt053(data []byte) bool {
+	head := data[:min(len(data), 4096)]
+	return bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("<BkToCstmrStmt"))
+}
+
+// camtAmount is an unsigned amount with its currency. The element next to
+// it says whether it is a credit (CRDT) or a debit (DBIT).
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+// camtDate is a date given either as a date or as a date and time.
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtParty is a debtor or creditor, whose name moved into Pty in later
+// versions of the message.
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+// camtStatus is an entry's status, whose code moved into Cd in later
+// versions of the message.
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+type camtEntry struct {
+	Reference      string     `xml:"NtryRef"`
+	Amount         camtAmount `xml:"Amt"`
+	Indicator      string     `xml:"CdtDbtInd"`
+	Status         camtStatus `xml:"Sts"`
+	BookingDate    camtDate   `xml:"BookgDt"`
+	ValueDate      camtDate   `xml:"ValDt"`
+	ServicerRef    string     `xml:"AcctSvcrRef"`
+	AdditionalInfo string     `xml:"AddtlNtryInf"`
+	Details        []struct {
+		ServicerRef    string    `xml:"Refs>AcctSvcrRef"`
+		Debtor         camtParty `xml:"RltdPties>Dbtr"`
+		Creditor       camtParty `xml:"RltdPties>Cdtr"`
+		Unstructured   []string  `xml:"RmtInf>Ustrd"`
+		Structured     []string  `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+		AdditionalInfo string    `xml:"AddtlTxInf"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// parseCamt053 reads the booked entries of a camt.053 statement, with the
+// account servicer's reference as their import id. The opening balance is
+// the first OPBD or PRCD balance and the closing balance the last CLBD.
+func parseCamt053(data []byte, currency string) (models.ImportPreview, error) {
+	preview := models.ImportPreview{
+		Format:   "camt.053",
+		Encoding: "utf-8",
+		Header:   []string{},
+		Sample:   [][]string{},
+		Rows:     []models.ImportRow{},
+	}
+
+	var opening, closing *camtBalance
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := decoder.InputPos()
+
+		switch start.Name.Local {
+		case "Acct":
+			var account struct {
+				Currency string `xml:"Ccy"`
+			}
+			err = decoder.DecodeElement(&account, &start)
+			if err != nil {
+				return models.ImportPreview{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+			}
+			if account.Currency != "" && account.Currency != currency {
+				return models.ImportPreview{}, fmt.Errorf("%w: the statement is in %s but the account is in %s", ErrInvalidImport, account.Currency, currency)
+			}
+		case "Bal":
+			var balance camtBalance
+			err = decoder.DecodeElement(&balance, &start)
+			if err != nil {
+				return models.ImportPreview{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+			}
+			switch balance.Code {
+			case "OPBD", "PRCD":
+				if opening == nil {
+					opening = &balance
+				}
+			case "CLBD":
+				closing = &balance
+			}
+		case "Ntry":
+			var entry camtEntry
+			err = decoder.DecodeElement(&entry, &start)
+			if err != nil {
+				return models.ImportPreview{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+			}
+			status := strings.TrimSpace(entry.Status.Value + entry.Status.Code)
+			if status != "" && status != "BOOK" {
+				continue
+			}
+			preview.Rows = append(preview.Rows, camtRow(line, entry, currency))
+		}
+	}
+
+	if opening != nil && closing != nil {
+		statement := models.StatementCheck{}
+		var err error
+		statement.Opening, err = camtMoney(opening.Amount, opening.Indicator, currency)
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: opening balance: %v", ErrInvalidImport, err)
+		}
+		statement.Closing, err = camtMoney(closing.Amount, closing.Indicator, currency)
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: closing balance: %v", ErrInvalidImport, err)
+		}
+		statement.ClosingDate, err = closing.Date.parse()
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: closing balance: %v", ErrInvalidImport, err)
+		}
+		preview.Statement = &statement
+	}
+
+	return preview, nil
+}
+
+// camtRow turns an entry into a row. The counterparty is the creditor of
+// money going out and the debtor of money coming in.
+func camtRow(line int, entry camtEntry, currency string) models.ImportRow {
+	row := models.ImportRow{
+		Line:     line,
+		ImportID: entry.ServicerRef,
+		Memo:     entry.AdditionalInfo,
+	}
+	if row.ImportID == "" {
+		row.ImportID = entry.Reference
+	}
+
+	var err error
+	row.Amount, err = camtMoney(entry.Amount, entry.Indicator, currency)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+
+	date := entry.BookingDate
+	if date.Date == "" && date.DateTime == "" {
+		date = entry.ValueDate
+	}
+	row.Date, err = date.parse()
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	if valueDate, err := entry.ValueDate.parse(); err == nil && !valueDate.Equal(row.Date) {
+		row.ValueDate = &valueDate
+	}
+
+	if len(entry.Details) > 0 {
+		details := entry.Details[0]
+		if row.ImportID == "" {
+			row.ImportID = details.ServicerRef
+		}
+		party := details.Debtor
+		if row.Amount.IsNegative() {
+			party = details.Creditor
+		}
+		row.Payee = strings.TrimSpace(party.Name + party.PartyName)
+
+		remittance := append(append([]string{}, details.Unstructured...), details.Structured...)
+		if len(remittance) == 0 && details.AdditionalInfo != "" {
+			remittance = []string{details.AdditionalInfo}
+		}
+		if len(remittance) > 0 {
+			row.Memo = strings.Join(remittance, " ")
+		}
+	}
+	row.Memo = strings.Join(strings.Fields(row.Memo), " ")
+
+	return row
+}
+
+// camtMoney reads an amount, negative for a debit.
+func camtMoney(amount camtAmount, indicator string, currency string) (money.Money, error) {
+	if amount.Currency != "" && amount.Currency != currency {
+		return money.Money{}, fmt.Errorf("amount in %s", amount.Currency)
+	}
+	value, err := money.Parse(amount.Value, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("invalid amount %q", amount.Value)
+	}
+	if indicator == "DBIT" {
+		value = value.Neg()
+	}
+	return value, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	value := d.Date
+	if value == "" {
+		value = d.DateTime
+	}
+	if len(value) < len("2006-01-02") {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("2006-01-02", value[:len("2006-01-02")])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
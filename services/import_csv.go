@@ -0,0 +1,329 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/width"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// importEncodings are the text encodings import files can be in. Detection
+// tries them in order, skipping EUC-JP, which is hard to tell apart from
+// Shift-JIS; Windows-1252 accepts any bytes, so it comes last.
+var importEncodings = []struct {
+	name     string
+	encoding encoding.Encoding
+	detect   bool
+}{
+	{"utf-8", nil, true},
+	{"shift_jis", japanese.ShiftJIS, true},
+	{"euc-jp", japanese.EUCJP, false},
+	{"windows-1252", charmap.Windows1252, true},
+}
+
+// csvDelimiters are the delimiters a CSV file can use.
+var csvDelimiters = []string{",", ";", "\t", "|"}
+
+// importDateFormats are the date layouts tried when a profile has none.
+// Month-first comes before day-first, so dates that fit both are read the
+// US way.
+var importDateFormats = []string{
+	"2006-01-02",
+	"2006/1/2",
+	"2006.1.2",
+	"20060102",
+	"2006年1月2日",
+	"1/2/2006",
+	"2/1/2006",
+	"2.1.2006",
+	"02-01-2006",
+	"2006-01-02 15:04:05",
+	"2006/1/2 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// csvSampleRows is how many of a file's first records a preview shows for
+// mapping its columns.
+const csvSampleRows = 5
+
+// decodeImport converts an import file into UTF-8 text from the named
+// encoding, or from the first one it is valid in if name is empty. It
+// returns the text and the encoding used.
+func decodeImport(data []byte, name string) (string, string, error) {
+	for _, candidate := range importEncodings {
+		if name != "" && name != candidate.name || name == "" && !candidate.detect {
+			continue
+		}
+
+		if candidate.encoding == nil {
+			data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+			if !utf8.Valid(data) {
+				if name != "" {
+					return "", "", fmt.Errorf("%w: the file is not valid UTF-8", ErrInvalidImport)
+				}
+				continue
+			}
+			return string(data), candidate.name, nil
+		}
+
+		text, err := candidate.encoding.NewDecoder().Bytes(data)
+		if err != nil || bytes.ContainsRune(text, utf8.RuneError) {
+			if name != "" {
+				return "", "", fmt.Errorf("%w: the file is not valid %s", ErrInvalidImport, candidate.name)
+			}
+			continue
+		}
+		return string(text), candidate.name, nil
+	}
+
+	return "", "", fmt.Errorf("%w: unknown encoding %q", ErrInvalidImport, name)
+}
+
+// detectDelimiter picks the delimiter that splits the most of the text's
+// first lines into the same number of fields, two or more.
+func detectDelimiter(text string) string {
+	best, bestScore, bestFields := ",", 0, 0
+	for _, delimiter := range csvDelimiters {
+		reader := newCSVReader(text, delimiter)
+		counts := map[int]int{}
+		for i := 0; i < 20; i++ {
+			record, err := reader.Read()
+			if err != nil {
+				break
+			}
+			counts[len(record)]++
+		}
+
+		for fields, score := range counts {
+			if fields < 2 {
+				continue
+			}
+			if score > bestScore || score == bestScore && fields > bestFields {
+				best, bestScore, bestFields = delimiter, score, fields
+			}
+		}
+	}
+	return best
+}
+
+func newCSVReader(text string, delimiter string) *csv.Reader {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma, _ = utf8.DecodeRuneInString(delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+// parseCSV reads an import file the way the profile says, into a preview
+// whose rows are not yet checked against the ledger.
+func parseCSV(data []byte, profile models.ImportProfile, currency string) (models.ImportPreview, error) {
+	text, encodingName, err := decodeImport(data, profile.Encoding)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	delimiter := profile.Delimiter
+	if delimiter == "" {
+		delimiter = detectDelimiter(text)
+	}
+	preview := models.ImportPreview{
+		Format:    "csv",
+		Encoding:  encodingName,
+		Delimiter: delimiter,
+		Header:    []string{},
+		Sample:    [][]string{},
+		Rows:      []models.ImportRow{},
+	}
+
+	type record struct {
+		line   int
+		fields []string
+	}
+	reader := newCSVReader(text, delimiter)
+	records := []record{}
+	for index := 0; ; index++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		if index < profile.SkipRows {
+			continue
+		}
+		if len(preview.Sample) < csvSampleRows {
+			preview.Sample = append(preview.Sample, fields)
+		}
+		if profile.HasHeader && index == profile.SkipRows {
+			preview.Header = fields
+			continue
+		}
+		if strings.TrimSpace(strings.Join(fields, "")) == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record{line, fields})
+	}
+
+	preview.DateFormat = profile.DateFormat
+	if preview.DateFormat == "" {
+		dates := []string{}
+		for _, record := range records {
+			if profile.DateColumn < len(record.fields) {
+				dates = append(dates, record.fields[profile.DateColumn])
+			}
+		}
+		preview.DateFormat = detectDateFormat(dates, importDateFormats)
+	}
+
+	column := func(fields []string, index *int) string {
+		if index == nil || *index >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[*index])
+	}
+	for _, record := range records {
+		row := models.ImportRow{
+			Line:  record.line,
+			Payee: column(record.fields, profile.PayeeColumn),
+			Memo:  column(record.fields, profile.MemoColumn),
+		}
+
+		row.Date, row.Amount, err = parseCSVEntry(record.fields, profile, preview.DateFormat, currency)
+		if err != nil {
+			row.Error = err.Error()
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	return preview, nil
+}
+
+// parseCSVEntry reads the date and signed amount of one record.
+func parseCSVEntry(fields []string, profile models.ImportProfile, dateFormat string, currency string) (time.Time, money.Money, error) {
+	if profile.DateColumn >= len(fields) || profile.AmountColumn >= len(fields) || profile.CreditColumn != nil && *profile.CreditColumn >= len(fields) {
+		return time.Time{}, money.Money{}, fmt.Errorf("only %d columns", len(fields))
+	}
+
+	value := strings.TrimSpace(fields[profile.DateColumn])
+	if dateFormat == "" {
+		return time.Time{}, money.Money{}, fmt.Errorf("unrecognized date %q", value)
+	}
+	date, err := time.Parse(dateFormat, width.Narrow.String(value))
+	if err != nil {
+		return time.Time{}, money.Money{}, fmt.Errorf("date %q does not match %s", value, dateFormat)
+	}
+	date = dateOnly(date)
+
+	if profile.CreditColumn == nil {
+		amount, err := parseImportAmount(fields[profile.AmountColumn], currency, profile.DecimalComma)
+		if err != nil {
+			return time.Time{}, money.Money{}, err
+		}
+		if profile.Negate {
+			amount = amount.Neg()
+		}
+		return date, amount, nil
+	}
+
+	// Separate columns for money going out and coming in, one of them
+	// usually empty
+	debit, credit := strings.TrimSpace(fields[profile.AmountColumn]), strings.TrimSpace(fields[*profile.CreditColumn])
+	if debit == "" && credit == "" {
+		return time.Time{}, money.Money{}, fmt.Errorf("no amount")
+	}
+	amount := money.Zero(currency)
+	if credit != "" {
+		amount, err = parseImportAmount(credit, currency, profile.DecimalComma)
+		if err != nil {
+			return time.Time{}, money.Money{}, err
+		}
+	}
+	if debit != "" {
+		out, err := parseImportAmount(debit, currency, profile.DecimalComma)
+		if err != nil {
+			return time.Time{}, money.Money{}, err
+		}
+		amount, err = amount.Sub(out.Abs())
+		if err != nil {
+			return time.Time{}, money.Money{}, err
+		}
+	}
+	return date, amount, nil
+}
+
+// detectDateFormat returns the first of layouts that every value parses
+// with, or "" if none does.
+func detectDateFormat(values []string, layouts []string) string {
+	for _, layout := range layouts {
+		matched := false
+		for _, value := range values {
+			value = width.Narrow.String(strings.TrimSpace(value))
+			if value == "" {
+				continue
+			}
+			if _, err := time.Parse(layout, value); err != nil {
+				matched = false
+				break
+			}
+			matched = true
+		}
+		if matched {
+			return layout
+		}
+	}
+	return ""
+}
+
+// parseImportAmount reads an amount the way banks write them: with currency
+// signs and thousands separators, in full-width digits, or negative as
+// (12.00), 12.00-, or with the Japanese △ and ▲ marks.
+func parseImportAmount(value string, currency string, decimalComma bool) (money.Money, error) {
+	original := strings.TrimSpace(value)
+	value = width.Narrow.String(original)
+
+	negative := false
+	var digits strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '-' || r == '(' || r == '△' || r == '▲' || r == '−':
+			negative = true
+		case unicode.IsDigit(r), r == '.', r == ',':
+			digits.WriteRune(r)
+		}
+	}
+
+	number := digits.String()
+	if decimalComma {
+		number = strings.ReplaceAll(number, ".", "")
+		number = strings.ReplaceAll(number, ",", ".")
+	} else {
+		number = strings.ReplaceAll(number, ",", "")
+	}
+	if number == "" {
+		return money.Money{}, fmt.Errorf("no amount in %q", original)
+	}
+	if negative {
+		number = "-" + number
+	}
+
+	amount, err := money.Parse(number, currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("invalid amount %q", original)
+	}
+	return amount, nil
+}
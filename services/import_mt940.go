@@ -0,0 +1,227 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+var (
+	// mt940Tag starts a field, like :61: or :60F:.
+	mt940Tag = regexp.MustCompile(`^:(\d\d[A-Z]?):`)
+
+	// mt940Entry is the start of a :61: statement line: the value date, an
+	// optional booking date, the debit or credit mark with an optional
+	// funds code, the amount, the transaction type, the customer's
+	// reference and the bank's reference after //.
+	mt940Entry = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d[\d,]*)([NFS][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+
+	// mt940Balance is a :60F:, :60M:, :62F: or :62M: balance: the debit or
+	// credit mark, the date, the currency and the amount.
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d[\d,]*)$`)
+
+	// mt940Name and mt940Remittance find the counterparty and remittance
+	// information in an :86: field written with /NAME/ and /REMI/ codes. The
+	// remittance information may itself contain slashes, so it runs to the
+	// next code.
+	mt940Name       = regexp.MustCompile(`/NAME/([^/]*)`)
+	mt940Remittance = regexp.MustCompile(`/REMI/(.*?)(?:/(?:ADDR|BENM|BIC|CSID|EREF|IBAN|MARF|NAME|ORDP|PREF|RTRN|TRTP)/|$)`)
+)
+
+// isMT940 reports whether an import file looks like a SWIFT MT940
+// statement.
+func isMT940(data []byte) bool {
+	head := string(data[:min(len(data), 4096)])
+	return strings.Contains(head, ":20:") && (strings.Contains(head, ":60F:") || strings.Contains(head, ":60M:"))
+}
+
+// mt940Field is a field's tag and value, starting at line. Values that go on
+// over several lines keep their line breaks.
+type mt940Field struct {
+	line  int
+	tag   string
+	value string
+}
+
+// parseMT940 reads the entries of an MT940 statement, with the bank's
+// reference as their import id. The opening balance is the first :60: and
+// the closing balance the last :62:, across the statement's pages.
+func parseMT940(data []byte, currency string) (models.ImportPreview, error) {
+	text, encodingName, err := decodeImport(data, "")
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	preview := models.ImportPreview{
+		Format:   "mt940",
+		Encoding: encodingName,
+		Header:   []string{},
+		Sample:   [][]string{},
+		Rows:     []models.ImportRow{},
+	}
+
+	fields := []mt940Field{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if match := mt940Tag.FindStringSubmatch(line); match != nil {
+			fields = append(fields, mt940Field{i + 1, match[1], line[len(match[0]):]})
+			continue
+		}
+		// SWIFT message blocks and the end of a message are not fields
+		if line == "" || line == "-" || strings.HasPrefix(line, "{") || strings.HasPrefix(line, "-}") {
+			continue
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+
+	var opening, closing string
+	for i, field := range fields {
+		switch field.tag {
+		case "60F", "60M":
+			if opening == "" {
+				opening = field.value
+			}
+		case "62F", "62M":
+			closing = field.value
+		case "61":
+			row := models.ImportRow{Line: field.line}
+			if i+1 < len(fields) && fields[i+1].tag == "86" {
+				row.Payee, row.Memo = parseMT940Information(fields[i+1].value)
+			}
+			row.ImportID, row.Date, row.ValueDate, row.Amount, err = parseMT940Entry(field.value, currency)
+			if err != nil {
+				row.Error = err.Error()
+			}
+			preview.Rows = append(preview.Rows, row)
+		}
+	}
+
+	if opening != "" && closing != "" {
+		statement := models.StatementCheck{}
+		statement.Opening, _, err = parseMT940Balance(opening, currency)
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: opening balance: %v", ErrInvalidImport, err)
+		}
+		statement.Closing, statement.ClosingDate, err = parseMT940Balance(closing, currency)
+		if err != nil {
+			return models.ImportPreview{}, fmt.Errorf("%w: closing balance: %v", ErrInvalidImport, err)
+		}
+		preview.Statement = &statement
+	}
+
+	return preview, nil
+}
+
+// parseMT940Entry reads a :61: statement line. The booking date has no
+// year, so it takes the value date's, moved a year when the two fall either
+// side of New Year.
+func parseMT940Entry(value string, currency string) (string, time.Time, *time.Time, money.Money, error) {
+	first, _, _ := strings.Cut(value, "\n")
+	match := mt940Entry.FindStringSubmatch(first)
+	if match == nil {
+		return "", time.Time{}, nil, money.Money{}, fmt.Errorf("invalid statement line %q", first)
+	}
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return "", time.Time{}, nil, money.Money{}, fmt.Errorf("invalid value date %q", match[1])
+	}
+	date := valueDate
+	if match[2] != "" {
+		date, err = time.Parse("20060102", valueDate.Format("2006")+match[2])
+		if err != nil {
+			return "", time.Time{}, nil, money.Money{}, fmt.Errorf("invalid booking date %q", match[2])
+		}
+		switch {
+		case date.Sub(valueDate) > 180*24*time.Hour:
+			date = date.AddDate(-1, 0, 0)
+		case valueDate.Sub(date) > 180*24*time.Hour:
+			date = date.AddDate(1, 0, 0)
+		}
+	}
+
+	amount, err := parseImportAmount(match[5], currency, true)
+	if err != nil {
+		return "", time.Time{}, nil, money.Money{}, err
+	}
+	// RC reverses a credit and RD a debit
+	if match[3] == "D" || match[3] == "RC" {
+		amount = amount.Neg()
+	}
+
+	importID := strings.TrimSpace(match[8])
+	if reference := strings.TrimSpace(match[7]); importID == "" && reference != "NONREF" {
+		importID = reference
+	}
+
+	if valueDate.Equal(date) {
+		return importID, date, nil, amount, nil
+	}
+	return importID, date, &valueDate, amount, nil
+}
+
+// parseMT940Balance reads a :60: or :62: balance and its date.
+func parseMT940Balance(value string, currency string) (money.Money, time.Time, error) {
+	match := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return money.Money{}, time.Time{}, fmt.Errorf("invalid balance %q", value)
+	}
+	if match[3] != currency {
+		return money.Money{}, time.Time{}, fmt.Errorf("the statement is in %s but the account is in %s", match[3], currency)
+	}
+
+	date, err := time.Parse("060102", match[2])
+	if err != nil {
+		return money.Money{}, time.Time{}, fmt.Errorf("invalid date %q", match[2])
+	}
+	amount, err := parseImportAmount(match[4], currency, true)
+	if err != nil {
+		return money.Money{}, time.Time{}, err
+	}
+	if match[1] == "D" {
+		amount = amount.Neg()
+	}
+	return amount, date, nil
+}
+
+// parseMT940Information reads the counterparty and remittance information
+// of an :86: field. German banks structure it as a transaction code and ?NN
+// subfields, ?20 to ?29 and ?60 to ?63 for the remittance information and
+// ?32 and ?33 for the counterparty; others use /NAME/ and /REMI/ codes. Anything else is all remittance
+// information.
+func parseMT940Information(value string) (string, string) {
+	switch {
+	case len(value) > 3 && value[3] == '?':
+		value = strings.ReplaceAll(value, "\n", "")
+		var payee, memo strings.Builder
+		for _, subfield := range strings.Split(value, "?")[1:] {
+			if len(subfield) < 2 {
+				continue
+			}
+			switch code := subfield[:2]; {
+			case code >= "20" && code <= "29" || code >= "60" && code <= "63":
+				memo.WriteString(subfield[2:])
+			case code == "32" || code == "33":
+				payee.WriteString(subfield[2:])
+			}
+		}
+		return strings.TrimSpace(payee.String()), strings.TrimSpace(memo.String())
+	case strings.HasPrefix(value, "/"):
+		value = strings.ReplaceAll(value, "\n", "")
+		var payee, memo string
+		if match := mt940Name.FindStringSubmatch(value); match != nil {
+			payee = match[1]
+		}
+		if match := mt940Remittance.FindStringSubmatch(value); match != nil {
+			memo = strings.Trim(strings.TrimPrefix(match[1], "USTD//"), "/")
+		}
+		return strings.TrimSpace(payee), strings.TrimSpace(memo)
+	}
+	return "", strings.Join(strings.Fields(value), " ")
+}
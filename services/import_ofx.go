@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// ofxDateFormat is the date part of OFX dates, which may go on with a time
+// and a time zone, as in 20240601120000.000[+9:JST].
+const ofxDateFormat = "20060102"
+
+// isOFX reports whether an import file looks like an OFX or QFX statement.
+func isOFX(data []byte) bool {
+	head := strings.ToUpper(string(data[:min(len(data), 4096)]))
+	return strings.Contains(head, "OFXHEADER") || strings.Contains(head, "<OFX>")
+}
+
+// ofxEncoding returns the encoding an OFX file declares, or "" to detect it.
+// OFX 1 headers say CHARSET:1252 for Windows-1252 text; OFX 2 files are
+// XML, which is UTF-8 unless declared otherwise.
+func ofxEncoding(data []byte) string {
+	head := strings.ToUpper(string(data[:min(len(data), 1024)]))
+	switch {
+	case strings.Contains(head, "ENCODING:UTF-8"), strings.Contains(head, `ENCODING="UTF-8"`):
+		return "utf-8"
+	case strings.Contains(head, "CHARSET:1252"), strings.Contains(head, `ENCODING="WINDOWS-1252"`):
+		return "windows-1252"
+	}
+	return ""
+}
+
+// ofxTransaction is the fields of one STMTTRN aggregate, by tag, starting
+// at line.
+type ofxTransaction struct {
+	line   int
+	fields map[string]string
+}
+
+// parseOFX reads the entries of a bank or card statement in an OFX or QFX
+// file, either SGML OFX 1, whose elements need not be closed, or XML OFX 2.
+// A statement in another currency than the account's is refused.
+func parseOFX(data []byte, currency string) (models.ImportPreview, error) {
+	text, encodingName, err := decodeImport(data, ofxEncoding(data))
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	preview := models.ImportPreview{
+		Format:     "ofx",
+		Version:    "1",
+		Encoding:   encodingName,
+		DateFormat: ofxDateFormat,
+		Header:     []string{},
+		Sample:     [][]string{},
+		Rows:       []models.ImportRow{},
+	}
+	start := strings.Index(strings.ToUpper(text), "<OFX>")
+	if start < 0 {
+		return models.ImportPreview{}, fmt.Errorf("%w: the file has no OFX statement", ErrInvalidImport)
+	}
+	if strings.Contains(text[:start], "<?OFX") || strings.HasPrefix(strings.TrimSpace(text), "<?xml") {
+		preview.Version = "2"
+	}
+
+	transactions := []ofxTransaction{}
+	var current *ofxTransaction
+	statementCurrency, tag := "", ""
+	line := strings.Count(text[:start], "\n") + 1
+	for pos := start; pos < len(text); {
+		open := strings.IndexByte(text[pos:], '<')
+		if open < 0 {
+			break
+		}
+		open += pos
+
+		// The text before a tag is the value of the element opened last
+		if value := strings.TrimSpace(text[pos:open]); value != "" && tag != "" {
+			value = html.UnescapeString(value)
+			if current != nil {
+				if _, ok := current.fields[tag]; !ok {
+					current.fields[tag] = value
+				}
+			} else if tag == "CURDEF" {
+				statementCurrency = strings.ToUpper(value)
+			}
+		}
+		line += strings.Count(text[pos:open], "\n")
+
+		end := strings.IndexByte(text[open:], '>')
+		if end < 0 {
+			return models.ImportPreview{}, fmt.Errorf("%w: line %d: unterminated tag", ErrInvalidImport, line)
+		}
+		end += open
+		name := strings.ToUpper(strings.TrimSpace(text[open+1 : end]))
+		line += strings.Count(text[open:end], "\n")
+		pos = end + 1
+
+		tag = ""
+		switch {
+		case name == "STMTTRN":
+			current = &ofxTransaction{line: line, fields: map[string]string{}}
+		case name == "/STMTTRN":
+			if current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+		case strings.HasPrefix(name, "/"), strings.HasPrefix(name, "?"), strings.HasPrefix(name, "!"):
+		default:
+			tag = name
+		}
+	}
+
+	if statementCurrency != "" && statementCurrency != currency {
+		return models.ImportPreview{}, fmt.Errorf("%w: the statement is in %s but the account is in %s", ErrInvalidImport, statementCurrency, currency)
+	}
+
+	for _, transaction := range transactions {
+		row := models.ImportRow{
+			Line:     transaction.line,
+			ImportID: transaction.fields["FITID"],
+			Payee:    transaction.fields["NAME"],
+			Memo:     transaction.fields["MEMO"],
+		}
+		if row.Payee == "" {
+			row.Payee, row.Memo = row.Memo, ""
+		}
+
+		row.Date, row.Amount, err = parseOFXEntry(transaction.fields, currency)
+		if err != nil {
+			row.Error = err.Error()
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	return preview, nil
+}
+
+// parseOFXEntry reads the posting date and signed amount of an entry.
+func parseOFXEntry(fields map[string]string, currency string) (time.Time, money.Money, error) {
+	value := fields["DTPOSTED"]
+	if len(value) < len(ofxDateFormat) {
+		return time.Time{}, money.Money{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse(ofxDateFormat, value[:len(ofxDateFormat)])
+	if err != nil {
+		return time.Time{}, money.Money{}, fmt.Errorf("invalid date %q", value)
+	}
+
+	// OFX allows a comma as the decimal mark
+	value = fields["TRNAMT"]
+	number := strings.TrimPrefix(value, "+")
+	if !strings.Contains(number, ".") {
+		number = strings.ReplaceAll(number, ",", ".")
+	}
+	amount, err := money.Parse(number, currency)
+	if err != nil {
+		return time.Time{}, money.Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	return date, amount, nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+
+	"balance-tracker/models"
+)
+
+// qifDateFormats are the date layouts QIF files use, once the apostrophe
+// Quicken puts before years after 1999 is read as a slash. Month-first comes
+// before day-first, as in importDateFormats.
+var qifDateFormats = []string{
+	"1/2/2006",
+	"1/2/06",
+	"2/1/2006",
+	"2/1/06",
+	"2006-01-02",
+	"2006/1/2",
+	"2.1.2006",
+	"2.1.06",
+}
+
+// qifSections are the QIF sections that hold account entries. Investment,
+// category and memorized sections are skipped.
+var qifSections = []string{"!TYPE:BANK", "!TYPE:CASH", "!TYPE:CCARD", "!TYPE:OTH A", "!TYPE:OTH L"}
+
+// isQIF reports whether an import file looks like a QIF file.
+func isQIF(data []byte) bool {
+	head := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(string(data[:min(len(data), 256)]), "\ufeff")))
+	return strings.HasPrefix(head, "!TYPE:") || strings.HasPrefix(head, "!ACCOUNT") || strings.HasPrefix(head, "!OPTION")
+}
+
+// qifRecord is the fields of one entry by their one-letter code, starting
+// at line. Split lines repeat codes, so only the first of each is kept.
+type qifRecord struct {
+	line   int
+	fields map[byte]string
+}
+
+// parseQIF reads the entries of a QIF file. Its L fields name categories
+// like Food:Groceries, which are matched to the user's category paths;
+// transfers to other accounts, written [Account], are not.
+func parseQIF(data []byte, currency string) (models.ImportPreview, error) {
+	text, encodingName, err := decodeImport(data, "")
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	preview := models.ImportPreview{
+		Format:   "qif",
+		Encoding: encodingName,
+		Header:   []string{},
+		Sample:   [][]string{},
+		Rows:     []models.ImportRow{},
+	}
+
+	records := []qifRecord{}
+	current := qifRecord{}
+	entries := false
+	for i, value := range strings.Split(text, "\n") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if value[0] == '!' {
+			section := strings.ToUpper(value)
+			if strings.HasPrefix(section, "!TYPE:") || strings.HasPrefix(section, "!ACCOUNT") {
+				entries = false
+				for _, name := range qifSections {
+					entries = entries || section == name
+				}
+			}
+			continue
+		}
+		if !entries {
+			continue
+		}
+		if value == "^" {
+			if current.fields != nil {
+				records = append(records, current)
+			}
+			current = qifRecord{}
+			continue
+		}
+
+		if current.fields == nil {
+			current = qifRecord{line: i + 1, fields: map[byte]string{}}
+		}
+		if _, ok := current.fields[value[0]]; !ok {
+			current.fields[value[0]] = strings.TrimSpace(value[1:])
+		}
+	}
+	if current.fields != nil {
+		records = append(records, current)
+	}
+
+	dates := []string{}
+	for _, record := range records {
+		dates = append(dates, qifDate(record.fields['D']))
+	}
+	preview.DateFormat = detectDateFormat(dates, qifDateFormats)
+
+	for _, record := range records {
+		row := models.ImportRow{
+			Line:  record.line,
+			Payee: record.fields['P'],
+			Memo:  record.fields['M'],
+		}
+		if category, _, _ := strings.Cut(record.fields['L'], "/"); category != "" && !strings.HasPrefix(category, "[") {
+			row.Category = strings.ReplaceAll(category, ":", categoryPathSeparator)
+		}
+
+		row.Date, err = time.Parse(preview.DateFormat, qifDate(record.fields['D']))
+		if preview.DateFormat == "" || err != nil {
+			row.Error = fmt.Sprintf("unrecognized date %q", record.fields['D'])
+			preview.Rows = append(preview.Rows, row)
+			continue
+		}
+
+		amount := record.fields['T']
+		if amount == "" {
+			amount = record.fields['U']
+		}
+		row.Amount, err = parseImportAmount(amount, currency, false)
+		if err != nil {
+			row.Error = err.Error()
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	return preview, nil
+}
+
+// qifDate rewrites a QIF date like 6/ 1'24 as 6/1/24.
+func qifDate(value string) string {
+	return strings.NewReplacer("'", "/", " ", "").Replace(width.Narrow.String(value))
+}
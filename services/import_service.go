@@ -0,0 +1,568 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrImportProfileNotFound = errors.New("import profile not found")
+	ErrInvalidImport         = errors.New("invalid import")
+)
+
+// maxImportRows bounds how many entries one file can import.
+const maxImportRows = 50000
+
+// ImportService reads bank exports into an account. Each file format turns
+// its file into rows; previewing them marks the duplicates and picks their
+// categories, and importing books them in one database transaction.
+type ImportService struct {
+	importProfileRepository repositories.ImportProfileRepository
+	transactionService      *TransactionService
+}
+
+func NewImportService(importProfileRepository repositories.ImportProfileRepository, transactionService *TransactionService) *ImportService {
+	return &ImportService{
+		importProfileRepository: importProfileRepository,
+		transactionService:      transactionService,
+	}
+}
+
+func (s *ImportService) GetProfiles(userID int) ([]models.ImportProfile, error) {
+	return s.importProfileRepository.GetImportProfilesByUserID(userID)
+}
+
+// GetProfile returns the profile only if it belongs to the user.
+func (s *ImportService) GetProfile(userID int, id int) (models.ImportProfile, error) {
+	return getOwnedImportProfile(s.importProfileRepository, userID, id)
+}
+
+// SaveProfile stores a CSV mapping under its name, replacing the user's
+// profile of that name if there is one.
+func (s *ImportService) SaveProfile(profile models.ImportProfile) (models.ImportProfile, error) {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return models.ImportProfile{}, fmt.Errorf("%w: a profile name is required", ErrInvalidImport)
+	}
+	err := normalizeImportProfile(&profile)
+	if err != nil {
+		return models.ImportProfile{}, err
+	}
+
+	existing, err := s.importProfileRepository.GetImportProfileByName(profile.UserID, profile.Name)
+	if err == sql.ErrNoRows {
+		return s.importProfileRepository.CreateImportProfile(profile)
+	}
+	if err != nil {
+		return models.ImportProfile{}, err
+	}
+
+	profile.UpdatedAt = time.Now()
+	err = s.importProfileRepository.UpdateImportProfile(existing.ID, profile)
+	if err != nil {
+		return models.ImportProfile{}, err
+	}
+
+	return s.importProfileRepository.GetImportProfile(existing.ID)
+}
+
+func (s *ImportService) DeleteProfile(userID int, id int) error {
+	_, err := getOwnedImportProfile(s.importProfileRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.importProfileRepository.DeleteImportProfile(id)
+}
+
+// Preview shows what importing a statement file would do, without booking
+// anything. OFX, QFX, QIF, camt.053 and MT940 files are recognized by their
+// contents; any other file is read as CSV with the profile, which may then
+// not be nil. Statements that give their opening and closing balances are
+// checked against the account.
+func (s *ImportService) Preview(userID int, options models.ImportOptions, profile *models.ImportProfile, data []byte) (models.ImportPreview, error) {
+	var preview models.ImportPreview
+	err := s.inAccountReadTx(userID, options.AccountID, func(l ledgerTx, account models.Account) error {
+		var err error
+		preview, err = readImportFile(l, account, options, profile, data)
+		return err
+	})
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	return preview, nil
+}
+
+// Import books the entries of a statement file, read as Preview reads it,
+// and checks the account against the statement's balances afterwards.
+func (s *ImportService) Import(userID int, options models.ImportOptions, profile *models.ImportProfile, data []byte) (models.ImportResult, error) {
+	var result models.ImportResult
+	err := s.inAccountTx(userID, options.AccountID, func(l ledgerTx, account models.Account) error {
+		preview, err := readImportFile(l, account, options, profile, data)
+		if err != nil {
+			return err
+		}
+
+		result, err = commitImport(l, account, options, preview)
+		if err != nil {
+			return err
+		}
+
+		if preview.Statement != nil {
+			statement := *preview.Statement
+			err = checkStatement(l.transactions, account, &statement, preview.Rows, money.Zero(account.Currency))
+			if err != nil {
+				return err
+			}
+			result.Statement = &statement
+		}
+		return nil
+	})
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+
+	return result, nil
+}
+
+// PreviewCSV shows what importing a CSV file read with the profile would do,
+// without booking anything.
+func (s *ImportService) PreviewCSV(userID int, options models.ImportOptions, profile models.ImportProfile, data []byte) (models.ImportPreview, error) {
+	var preview models.ImportPreview
+	err := s.inAccountReadTx(userID, options.AccountID, func(l ledgerTx, account models.Account) error {
+		var err error
+		preview, err = readImportCSV(l, account, options, profile, data)
+		return err
+	})
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	return preview, nil
+}
+
+// ImportCSV books the entries of a CSV file read with the profile.
+func (s *ImportService) ImportCSV(userID int, options models.ImportOptions, profile models.ImportProfile, data []byte) (models.ImportResult, error) {
+	var result models.ImportResult
+	err := s.inAccountTx(userID, options.AccountID, func(l ledgerTx, account models.Account) error {
+		preview, err := readImportCSV(l, account, options, profile, data)
+		if err != nil {
+			return err
+		}
+
+		result, err = commitImport(l, account, options, preview)
+		return err
+	})
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+
+	return result, nil
+}
+
+// inAccountTx runs fn in one database transaction with the import's account
+// locked first, so that no other request can book an entry between looking
+// for duplicates and booking the new rows.
+func (s *ImportService) inAccountTx(userID int, accountID int, fn func(l ledgerTx, account models.Account) error) error {
+	return s.transactionService.inLedgerTx(func(l ledgerTx) error {
+		account, err := lockOwnedAccount(l.accounts, userID, accountID)
+		if err != nil {
+			return err
+		}
+
+		return fn(l, account)
+	})
+}
+
+// inAccountReadTx runs fn in one read-only database transaction, without
+// locking the account, for previews that book nothing.
+func (s *ImportService) inAccountReadTx(userID int, accountID int, fn func(l ledgerTx, account models.Account) error) error {
+	return s.transactionService.txRunner.RunInReadTx(func(tx *sql.Tx) error {
+		l := s.transactionService.ledger(tx)
+		account, err := getOwnedAccount(l.accounts, userID, accountID)
+		if err != nil {
+			return err
+		}
+
+		return fn(l, account)
+	})
+}
+
+// readImportFile reads a statement file as Preview describes and previews
+// its rows.
+func readImportFile(l ledgerTx, account models.Account, options models.ImportOptions, profile *models.ImportProfile, data []byte) (models.ImportPreview, error) {
+	var parse func([]byte, string) (models.ImportPreview, error)
+	switch {
+	case isOFX(data):
+		parse = parseOFX
+	case isQIF(data):
+		parse = parseQIF
+	case isCamt053(data):
+		parse = parseCamt053
+	case isMT940(data):
+		parse = parseMT940
+	case profile == nil:
+		return models.ImportPreview{}, fmt.Errorf("%w: map the columns of the CSV file", ErrInvalidImport)
+	default:
+		return readImportCSV(l, account, options, *profile, data)
+	}
+
+	preview, err := parse(data, account.Currency)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	preview, err = previewRows(l, account, options, preview)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	if preview.Statement != nil {
+		pending := money.Zero(account.Currency)
+		for _, row := range preview.Rows {
+			if row.Error == "" && (!row.Duplicate || options.IncludeDuplicates) {
+				pending, err = pending.Add(row.Amount)
+				if err != nil {
+					return models.ImportPreview{}, err
+				}
+			}
+		}
+		err = checkStatement(l.transactions, account, preview.Statement, preview.Rows, pending)
+		if err != nil {
+			return models.ImportPreview{}, err
+		}
+	}
+
+	return preview, nil
+}
+
+// readImportCSV reads a CSV file with the profile and previews its rows.
+func readImportCSV(l ledgerTx, account models.Account, options models.ImportOptions, profile models.ImportProfile, data []byte) (models.ImportPreview, error) {
+	err := normalizeImportProfile(&profile)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	preview, err := parseCSV(data, profile, account.Currency)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	return previewRows(l, account, options, preview)
+}
+
+// checkStatement fills in the account's side of a statement check. Pending
+// is what is about to be booked and not yet in the ledger.
+func checkStatement(transactionRepository repositories.TransactionRepository, account models.Account, statement *models.StatementCheck, rows []models.ImportRow, pending money.Money) error {
+	sum, err := transactionRepository.SumTransactionsByAccountIDBetween(account.ID, time.Time{}, statement.ClosingDate.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	ledger, err := money.FromDecimal(sum, account.Currency)
+	if err != nil {
+		return err
+	}
+
+	closing, err := account.OpeningBalance.Add(ledger)
+	if err != nil {
+		return err
+	}
+	closing, err = closing.Add(pending)
+	if err != nil {
+		return err
+	}
+	opening := closing
+	for _, row := range rows {
+		if row.Error == "" {
+			opening, err = opening.Sub(row.Amount)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	statement.TrackerOpening, statement.TrackerClosing = opening, closing
+	statement.OpeningDifference, err = opening.Sub(statement.Opening)
+	if err != nil {
+		return err
+	}
+	statement.ClosingDifference, err = closing.Sub(statement.Closing)
+	if err != nil {
+		return err
+	}
+	statement.Matches = statement.OpeningDifference.IsZero() && statement.ClosingDifference.IsZero()
+
+	return nil
+}
+
+// previewRows checks a file's rows against the account: it marks the rows
+// already booked and picks a category for the rest.
+func previewRows(l ledgerTx, account models.Account, options models.ImportOptions, preview models.ImportPreview) (models.ImportPreview, error) {
+	if len(preview.Rows) > maxImportRows {
+		return models.ImportPreview{}, fmt.Errorf("%w: more than %d entries", ErrInvalidImport, maxImportRows)
+	}
+
+	categories, err := l.categories.GetCategoriesByUserID(account.UserID)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+	categories = categoryTree(categories)
+	byID, byPath := map[int]models.Category{}, map[string]int{}
+	for _, category := range categories {
+		byID[category.ID] = category
+		byPath[strings.ToLower(category.Path)] = category.ID
+	}
+	for _, fallback := range []struct {
+		id   *int
+		kind models.CategoryKind
+	}{
+		{options.ExpenseCategoryID, models.CategoryKindExpense},
+		{options.IncomeCategoryID, models.CategoryKindIncome},
+	} {
+		if fallback.id == nil {
+			continue
+		}
+		category, ok := byID[*fallback.id]
+		if !ok {
+			return models.ImportPreview{}, ErrCategoryNotFound
+		}
+		if category.Kind != fallback.kind {
+			return models.ImportPreview{}, fmt.Errorf("%w: %s is not an %s category", ErrInvalidImport, category.Name, fallback.kind)
+		}
+	}
+
+	duplicates, imported, importIDs, err := existingEntries(l.transactions, account.ID, preview.Rows)
+	if err != nil {
+		return models.ImportPreview{}, err
+	}
+
+	payeeCategories := map[string]*int{}
+	for i := range preview.Rows {
+		row := &preview.Rows[i]
+		if row.Error != "" {
+			preview.Errors++
+			continue
+		}
+
+		// An entry the bank gave an id matches the entry imported with that
+		// id or one booked without any; other entries match any entry
+		key := duplicateKey(row.Date, row.Amount.Minor())
+		switch {
+		case row.ImportID != "" && importIDs[row.ImportID]:
+			row.Duplicate = true
+		case duplicates[key] > 0:
+			duplicates[key]--
+			row.Duplicate = true
+		case row.ImportID == "" && imported[key] > 0:
+			imported[key]--
+			row.Duplicate = true
+		}
+		if row.ImportID != "" {
+			importIDs[row.ImportID] = true
+		}
+		if row.Duplicate {
+			preview.Duplicates++
+		} else {
+			preview.New++
+		}
+
+		// The category the file names or the payee's default is only used
+		// if money goes its way, as the fallbacks always do
+		fits := func(categoryID *int) bool {
+			if categoryID == nil {
+				return false
+			}
+			category, ok := byID[*categoryID]
+			return ok && category.Kind != models.CategoryKindAdjustment && checkCategoryKind(row.Amount, category) == nil
+		}
+		if categoryID, ok := byPath[strings.ToLower(row.Category)]; ok && row.Category != "" && fits(&categoryID) {
+			row.CategoryID = &categoryID
+		}
+		if payeeKey := PayeeKey(row.Payee); payeeKey != "" {
+			categoryID, ok := payeeCategories[payeeKey]
+			if !ok {
+				payee, err := l.payees.GetPayeeByAliasKey(account.UserID, payeeKey)
+				if err != nil && err != sql.ErrNoRows {
+					return models.ImportPreview{}, err
+				}
+				categoryID = payee.DefaultCategoryID
+				payeeCategories[payeeKey] = categoryID
+			}
+			if row.CategoryID == nil && fits(categoryID) {
+				row.CategoryID = categoryID
+			}
+		}
+		if row.CategoryID == nil {
+			row.CategoryID = options.IncomeCategoryID
+			if row.Amount.IsNegative() {
+				row.CategoryID = options.ExpenseCategoryID
+			}
+		}
+		if row.CategoryID != nil {
+			row.CategoryName = byID[*row.CategoryID].Path
+		}
+	}
+
+	return preview, nil
+}
+
+// existingEntries looks up the account's entries over the dates of rows. It
+// counts those booked without an import id and those imported with one by
+// date and amount, and returns the import ids.
+func existingEntries(transactionRepository repositories.TransactionRepository, accountID int, rows []models.ImportRow) (map[string]int, map[string]int, map[string]bool, error) {
+	var from, to time.Time
+	for _, row := range rows {
+		if row.Error != "" {
+			continue
+		}
+		if from.IsZero() || row.Date.Before(from) {
+			from = row.Date
+		}
+		if row.Date.After(to) {
+			to = row.Date
+		}
+	}
+	counts, imported, importIDs := map[string]int{}, map[string]int{}, map[string]bool{}
+	if from.IsZero() {
+		return counts, imported, importIDs, nil
+	}
+
+	existing, err := transactionRepository.GetTransactionsByAccountIDBetween(accountID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, transaction := range existing {
+		key := duplicateKey(transaction.Date, transaction.Amount.Minor())
+		if transaction.ImportID != "" {
+			imported[key]++
+			importIDs[transaction.ImportID] = true
+			continue
+		}
+		counts[key]++
+	}
+
+	return counts, imported, importIDs, nil
+}
+
+// commitImport books the new rows of a preview, and the duplicates if asked
+// to. Nothing is booked if any row could not be read or has no category.
+func commitImport(l ledgerTx, account models.Account, options models.ImportOptions, preview models.ImportPreview) (models.ImportResult, error) {
+	result := models.ImportResult{}
+	transactions := []models.Transaction{}
+	for _, row := range preview.Rows {
+		if row.Error != "" {
+			return models.ImportResult{}, fmt.Errorf("%w: line %d: %s", ErrInvalidImport, row.Line, row.Error)
+		}
+		if row.Duplicate && !options.IncludeDuplicates {
+			result.Duplicates++
+			continue
+		}
+		if row.CategoryID == nil {
+			return models.ImportResult{}, fmt.Errorf("%w: line %d: choose a category for entries whose payee has none", ErrInvalidImport, row.Line)
+		}
+
+		transactions = append(transactions, models.Transaction{
+			CategoryID: row.CategoryID,
+			PayeeName:  truncateRunes(row.Payee, maxMemoLength),
+			Amount:     row.Amount,
+			Date:       row.Date,
+			Memo:       truncateRunes(row.Memo, maxMemoLength),
+			ImportID:   row.ImportID,
+			ValueDate:  row.ValueDate,
+		})
+	}
+
+	if len(transactions) > 0 {
+		imported, err := importTransactions(l, account, transactions)
+		if err != nil {
+			return models.ImportResult{}, err
+		}
+		// Rows whose import id the account already has are skipped even
+		// when duplicates are asked for
+		result.Imported = imported
+		result.Duplicates += len(transactions) - imported
+	}
+
+	return result, nil
+}
+
+// normalizeImportProfile checks a CSV mapping before it is used or stored.
+func normalizeImportProfile(profile *models.ImportProfile) error {
+	if profile.Delimiter == "tab" {
+		profile.Delimiter = "\t"
+	}
+	if profile.Delimiter != "" {
+		valid := false
+		for _, delimiter := range csvDelimiters {
+			valid = valid || profile.Delimiter == delimiter
+		}
+		if !valid {
+			return fmt.Errorf("%w: unsupported delimiter %q", ErrInvalidImport, profile.Delimiter)
+		}
+	}
+
+	profile.Encoding = strings.ToLower(strings.TrimSpace(profile.Encoding))
+	if profile.Encoding != "" {
+		valid := false
+		for _, encoding := range importEncodings {
+			valid = valid || profile.Encoding == encoding.name
+		}
+		if !valid {
+			return fmt.Errorf("%w: unsupported encoding %q", ErrInvalidImport, profile.Encoding)
+		}
+	}
+
+	if profile.SkipRows < 0 {
+		return fmt.Errorf("%w: rows to skip must not be negative", ErrInvalidImport)
+	}
+	for _, column := range []*int{&profile.DateColumn, &profile.AmountColumn, profile.CreditColumn, profile.PayeeColumn, profile.MemoColumn} {
+		if column != nil && *column < 0 {
+			return fmt.Errorf("%w: columns are counted from 0", ErrInvalidImport)
+		}
+	}
+
+	return nil
+}
+
+// duplicateKey identifies an entry by its date and amount in minor units.
+func duplicateKey(date time.Time, minor int64) string {
+	return fmt.Sprintf("%s %d", dateOnly(date).Format("2006-01-02"), minor)
+}
+
+// truncateRunes shortens s to at most max bytes without splitting a UTF-8
+// sequence.
+func truncateRunes(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func getOwnedImportProfile(importProfileRepository repositories.ImportProfileRepository, userID int, id int) (models.ImportProfile, error) {
+	profile, err := importProfileRepository.GetImportProfile(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ImportProfile{}, ErrImportProfileNotFound
+		}
+		return models.ImportProfile{}, err
+	}
+
+	if profile.UserID != userID {
+		return models.ImportProfile{}, ErrImportProfileNotFound
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestImportCSV(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Bank", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A Shift-JIS export with separate columns for withdrawals and deposits
+	text := "日付;摘要;お引出し;お預入れ\n" +
+		"2024/6/1;スーパー;\"1,200\";\n" +
+		"2024/6/1;スーパー;\"1,200\";\n" +
+		"2024/6/25;給与;;\"250,000\"\n"
+	data, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payeeColumn, creditColumn := 1, 3
+	profile, err := s.importService.SaveProfile(models.ImportProfile{UserID: userID, Name: "Bank", HasHeader: true, DateColumn: 0, AmountColumn: 2, CreditColumn: &creditColumn, PayeeColumn: &payeeColumn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &groceries.ID, IncomeCategoryID: &salary.ID}
+
+	preview, err := s.importService.PreviewCSV(userID, options, profile, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Encoding != "shift_jis" || preview.Delimiter != ";" || preview.New != 3 || preview.Errors != 0 {
+		t.Fatalf("preview read as %s %q with %d new and %d errors", preview.Encoding, preview.Delimiter, preview.New, preview.Errors)
+	}
+	if preview.Rows[0].Amount.Minor() != -1200 || preview.Rows[2].Amount.Minor() != 250000 || *preview.Rows[2].CategoryID != salary.ID {
+		t.Fatalf("rows read as %v and %v", preview.Rows[0].Amount, preview.Rows[2].Amount)
+	}
+
+	// One of the two identical entries is already booked
+	_, _, err = s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &groceries.ID, Amount: money.New(-1200, "JPY"), Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.importService.ImportCSV(userID, options, profile, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 || result.Duplicates != 1 {
+		t.Fatalf("imported %d and skipped %d, want 2 and 1", result.Imported, result.Duplicates)
+	}
+
+	preview, err = s.importService.PreviewCSV(userID, options, profile, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.New != 0 || preview.Duplicates != 3 {
+		t.Fatalf("second preview has %d new and %d duplicates, want 0 and 3", preview.New, preview.Duplicates)
+	}
+
+	// A row that cannot be read stops the whole import
+	bad, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(text + "2024/6/30;銀行;abc;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.importService.ImportCSV(userID, models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &groceries.ID, IncomeCategoryID: &salary.ID, IncludeDuplicates: true}, profile, bad)
+	if err == nil {
+		t.Fatal("import with an unreadable row was accepted")
+	}
+	transactions, err := s.transactionRepository.GetTransactionsByAccountIDBetween(account.ID, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 3 {
+		t.Fatalf("account has %d entries after a failed import, want 3", len(transactions))
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Checking", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Groceries", Kind: models.CategoryKindExpense, ParentID: &food.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &food.ID, IncomeCategoryID: &salary.ID}
+
+	sgml := "OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\nENCODING:USASCII\nCHARSET:1252\n\n" +
+		"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>USD<BANKTRANLIST>\n" +
+		"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240601120000[-5:EST]<TRNAMT>-42.10<FITID>A1<NAME>CORNER STORE &amp; DELI</STMTTRN>\n" +
+		"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240601<TRNAMT>-42.10<FITID>A2<NAME>CORNER STORE &amp; DELI</STMTTRN>\n" +
+		"<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240625<TRNAMT>3000.00<FITID>A3<NAME>PAYROLL<MEMO>June</STMTTRN>\n" +
+		"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n"
+
+	preview, err := s.importService.Preview(userID, options, nil, []byte(sgml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Format != "ofx" || preview.Version != "1" || preview.New != 3 || preview.Errors != 0 {
+		t.Fatalf("OFX 1 read as %s %s with %d new and %d errors", preview.Format, preview.Version, preview.New, preview.Errors)
+	}
+	if row := preview.Rows[0]; row.Payee != "CORNER STORE & DELI" || row.ImportID != "A1" || row.Amount.Minor() != -4210 || row.Date.Day() != 1 {
+		t.Fatalf("first entry read as %+v", row)
+	}
+
+	result, err := s.importService.Import(userID, options, nil, []byte(sgml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 3 {
+		t.Fatalf("imported %d entries, want 3", result.Imported)
+	}
+
+	// The same statement as OFX 2, with one new entry, matches by FITID
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>USD</CURDEF><BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240601</DTPOSTED><TRNAMT>-42.10</TRNAMT><FITID>A1</FITID><NAME>CORNER STORE</NAME></STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240601</DTPOSTED><TRNAMT>-42.10</TRNAMT><FITID>A2</FITID><NAME>CORNER STORE</NAME></STMTTRN>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240601</DTPOSTED><TRNAMT>-42.10</TRNAMT><FITID>A4</FITID><NAME>CORNER STORE</NAME></STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+	preview, err = s.importService.Preview(userID, options, nil, []byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Version != "2" || preview.New != 1 || preview.Duplicates != 2 || !preview.Rows[0].Duplicate || preview.Rows[2].Duplicate {
+		t.Fatalf("OFX 2 read as version %s with %d new and %d duplicates", preview.Version, preview.New, preview.Duplicates)
+	}
+
+	// Entries with a known FITID are never booked twice, even when
+	// duplicates are asked for
+	result, err = s.importService.Import(userID, models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &food.ID, IncomeCategoryID: &salary.ID, IncludeDuplicates: true}, nil, []byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 || result.Duplicates != 2 {
+		t.Fatalf("imported %d and skipped %d with duplicates, want 1 and 2", result.Imported, result.Duplicates)
+	}
+	transactions, err := s.transactionRepository.GetTransactionsByAccountIDBetween(account.ID, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 4 {
+		t.Fatalf("account has %d entries after importing duplicates, want 4", len(transactions))
+	}
+	_, created, err := s.transactionRepository.CreateImportedTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &food.ID, Amount: money.New(-100, "USD"), Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("entry without an import id was taken for a duplicate")
+	}
+	_, err = s.transactionRepository.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &food.ID, Amount: money.New(-4210, "USD"), Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), ImportID: "A1"})
+	if err == nil {
+		t.Fatal("second entry with the FITID A1 was booked")
+	}
+
+	_, err = s.importService.Preview(userID, options, nil, []byte(strings.Replace(xml, "<CURDEF>USD", "<CURDEF>EUR", 1)))
+	if err == nil {
+		t.Fatal("statement in another currency was accepted")
+	}
+
+	qif := "!Type:Bank\nD7/ 2'24\nT-1,250.00\nPFarm market\nLFood:Groceries\n^\nD7/3'24\nT-9.99\nPStreaming\n^\nD7/4'24\nT500.00\nL[Savings]\n^\n"
+	preview, err = s.importService.Preview(userID, options, nil, []byte(qif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Format != "qif" || preview.New != 3 || preview.Errors != 0 {
+		t.Fatalf("QIF read as %s with %d new and %d errors", preview.Format, preview.New, preview.Errors)
+	}
+	if row := preview.Rows[0]; row.Amount.Minor() != -125000 || row.Date.Month() != time.July || row.Date.Day() != 2 || *row.CategoryID != groceries.ID {
+		t.Fatalf("first QIF entry read as %+v", row)
+	}
+	if *preview.Rows[1].CategoryID != food.ID || *preview.Rows[2].CategoryID != salary.ID {
+		t.Fatal("QIF entries without a known category did not fall back")
+	}
+
+	// A category that money does not go the way of falls back too, whether
+	// the file names it or it is the payee's default
+	_, err = s.payeeService.CreatePayee(models.Payee{UserID: userID, Name: "Employer", DefaultCategoryID: &salary.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qif = "!Type:Bank\nD8/1'24\nT-5.00\nPEmployer\n^\nD8/2'24\nT-7.00\nPCorner store\nLSalary\n^\n"
+	result, err = s.importService.Import(userID, options, nil, []byte(qif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 {
+		t.Fatalf("imported %d entries, want 2", result.Imported)
+	}
+	transactions, err = s.transactionRepository.GetTransactionsByAccountIDBetween(account.ID, time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, transaction := range transactions {
+		if *transaction.CategoryID != food.ID {
+			t.Fatalf("%s to %s booked to %s, want Food", transaction.Amount, transaction.PayeeName, transaction.CategoryName)
+		}
+	}
+
+	_, err = s.importService.Preview(userID, options, nil, []byte("date,amount\n2024-07-01,1\n"))
+	if err == nil {
+		t.Fatal("CSV file without a column mapping was accepted")
+	}
+}
+
+func TestImportBankStatements(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Girokonto", Currency: "EUR", OpeningBalance: money.New(100000, "EUR")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &food.ID, IncomeCategoryID: &salary.ID}
+
+	camt := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+<Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+<Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">1000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-06-01</Dt></Dt></Bal>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">3957.90</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-06-30</Dt></Dt></Bal>
+<Ntry><Amt Ccy="EUR">42.10</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-06-03</Dt></BookgDt><ValDt><Dt>2024-06-01</Dt></ValDt><AcctSvcrRef>R1</AcctSvcrRef>
+<NtryDtls><TxDtls><RltdPties><Dbtr><Nm>Max Mustermann</Nm></Dbtr><Cdtr><Nm>Eckladen</Nm></Cdtr></RltdPties><RmtInf><Ustrd>Einkauf Juni</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>
+<Ntry><Amt Ccy="EUR">3000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts><BookgDt><DtTm>2024-06-25T08:00:00+02:00</DtTm></BookgDt><ValDt><Dt>2024-06-25</Dt></ValDt><AcctSvcrRef>R2</AcctSvcrRef>
+<NtryDtls><TxDtls><RltdPties><Dbtr><Pty><Nm>ACME GmbH</Nm></Pty></Dbtr></RltdPties><RmtInf><Ustrd>Gehalt</Ustrd><Ustrd>Juni</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>
+<Ntry><Amt Ccy="EUR">9.99</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2024-06-30</Dt></BookgDt><AcctSvcrRef>R3</AcctSvcrRef></Ntry>
+</Stmt></BkToCstmrStmt></Document>`
+
+	preview, err := s.importService.Preview(userID, options, nil, []byte(camt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Format != "camt.053" || preview.New != 2 || preview.Errors != 0 {
+		t.Fatalf("camt.053 read as %s with %d new and %d errors", preview.Format, preview.New, preview.Errors)
+	}
+	row := preview.Rows[0]
+	if row.Payee != "Eckladen" || row.Memo != "Einkauf Juni" || row.Amount.Minor() != -4210 || row.Date.Day() != 3 || row.ValueDate == nil || row.ValueDate.Day() != 1 || row.ImportID != "R1" {
+		t.Fatalf("first camt.053 entry read as %+v", row)
+	}
+	if preview.Rows[1].Payee != "ACME GmbH" || preview.Rows[1].Memo != "Gehalt Juni" || preview.Rows[1].ValueDate != nil {
+		t.Fatalf("second camt.053 entry read as %+v", preview.Rows[1])
+	}
+	if preview.Statement == nil || !preview.Statement.Matches {
+		t.Fatalf("camt.053 balances did not match: %+v", preview.Statement)
+	}
+
+	result, err := s.importService.Import(userID, options, nil, []byte(camt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 2 || result.Statement == nil || !result.Statement.Matches || result.Statement.TrackerClosing.Minor() != 395790 {
+		t.Fatalf("camt.053 import gave %+v", result)
+	}
+
+	// The next month's MT940 statement closes 100.00 lower than its entries
+	// add up to
+	mt940 := ":20:STARTUMSE\n:25:37040044/0532013000\n:28C:00002/001\n:60F:C240630EUR3957,90\n" +
+		":61:2407020701DR57,90NDDTNONREF//B1\n:86:105?00SEPA-LASTSCHRIFT?20Strom Juli?21Kunde 4711?32Stadtwerke?33Musterstadt\n" +
+		":61:240715C12,00NTRFKREF123\n:86:/TRTP/SEPA CREDIT/NAME/Erika Muster/REMI/USTD//Pizza/geteilt/\n" +
+		":62F:C240731EUR3812,00\n-\n"
+
+	preview, err = s.importService.Preview(userID, options, nil, []byte(mt940))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Format != "mt940" || preview.New != 2 || preview.Errors != 0 {
+		t.Fatalf("MT940 read as %s with %d new and %d errors", preview.Format, preview.New, preview.Errors)
+	}
+	row = preview.Rows[0]
+	if row.Payee != "StadtwerkeMusterstadt" || row.Memo != "Strom JuliKunde 4711" || row.Amount.Minor() != -5790 || row.Date.Day() != 1 || row.ValueDate.Day() != 2 || row.ImportID != "B1" {
+		t.Fatalf("first MT940 entry read as %+v", row)
+	}
+	if row := preview.Rows[1]; row.Payee != "Erika Muster" || row.Memo != "Pizza/geteilt" || row.Amount.Minor() != 1200 || row.ImportID != "KREF123" {
+		t.Fatalf("second MT940 entry read as %+v", row)
+	}
+	statement := preview.Statement
+	if statement == nil || statement.Matches || !statement.OpeningDifference.IsZero() || statement.ClosingDifference.Minor() != 10000 {
+		t.Fatalf("MT940 balance check gave %+v", statement)
+	}
+}
+
+// TestImportConcurrently imports the same statements from many goroutines
+// at once. As in TestCreateTransactionConcurrently, it needs a database that
+// takes writes on several connections.
+func TestImportConcurrently(t *testing.T) {
+	s := newTestServicesOn(t, openConcurrentTestDB(t))
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Checking", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := models.ImportOptions{AccountID: account.ID, ExpenseCategoryID: &food.ID}
+
+	const workers = 10
+	const statements = 5
+
+	// Later rounds find the connections of the earlier ones open, so the
+	// imports are not lined up by connecting to the database
+	for day := 1; day <= statements; day++ {
+		ofx := fmt.Sprintf("OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\n\n"+
+			"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>USD<BANKTRANLIST>\n"+
+			"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>202406%02d<TRNAMT>-42.10<FITID>A%d<NAME>CORNER STORE</STMTTRN>\n"+
+			"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>202406%02d<TRNAMT>-8.00<FITID>B%d<NAME>BAKERY</STMTTRN>\n"+
+			"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\n", day, day, day, day)
+
+		var wg sync.WaitGroup
+		results := make(chan models.ImportResult, workers)
+		errs := make(chan error, workers)
+		start := make(chan struct{})
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				result, err := s.importService.Import(userID, options, nil, []byte(ofx))
+				results <- result
+				errs <- err
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(results)
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Each import sees the ones before it, so only the first books
+		// anything
+		imported, duplicates := 0, 0
+		for result := range results {
+			imported += result.Imported
+			duplicates += result.Duplicates
+		}
+		if imported != 2 || duplicates != 2*(workers-1) {
+			t.Fatalf("June %d: imported %d and skipped %d, want 2 and %d", day, imported, duplicates, 2*(workers-1))
+		}
+	}
+
+	transactions, err := s.transactionRepository.GetTransactionsByAccountIDBetween(account.ID, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2*statements {
+		t.Fatalf("account has %d entries, want %d", len(transactions), 2*statements)
+	}
+}
@@ -0,0 +1,590 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// beancountOpen is an open directive with its metadata.
+type beancountOpen struct {
+	date     time.Time
+	currency string
+	meta     map[string]string
+}
+
+// beancountPosting is one posting of a transaction. Amount is nil for the
+// posting whose amount is left out, and Price is the total value of the
+// posting in another currency.
+type beancountPosting struct {
+	account string
+	amount  *money.Money
+	price   *money.Money
+	meta    map[string]string
+}
+
+type beancountTransaction struct {
+	line      int
+	date      time.Time
+	payee     string
+	narration string
+	tags      []string
+	meta      map[string]string
+	postings  []beancountPosting
+}
+
+// beancountToken is a word of a line, or a string when Quoted.
+type beancountToken struct {
+	text   string
+	quoted bool
+}
+
+// beancountFile is what parseBeancount reads from a file before it becomes
+// a backup. Accounts lists the open directives in order of appearance.
+type beancountFile struct {
+	baseCurrency string
+	accounts     []string
+	opens        map[string]*beancountOpen
+	transactions []*beancountTransaction
+	prices       []models.ExchangeRate
+}
+
+// parseBeancount reads a Beancount file into a backup to merge and the
+// prices it lists. It reads the directives that have a place in the ledger:
+// open, price and transactions, with pushtag and poptag; other directives
+// are left out. Transactions need to post to one account and categories, to
+// two accounts for a transfer, or to one account and an equity account,
+// which sets the opening balance of an account whose name starts with
+// Opening. Amounts are plain numbers; costs in braces are not supported.
+func parseBeancount(data []byte, baseCurrency string) (models.Backup, []models.ExchangeRate, error) {
+	file := beancountFile{baseCurrency: baseCurrency, opens: map[string]*beancountOpen{}}
+	pushed := []string{}
+
+	// The directive the indented lines below belong to
+	var open *beancountOpen
+	var transaction *beancountTransaction
+	var posting *beancountPosting
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	for i, line := range strings.Split(string(data), "\n") {
+		number := i + 1
+		line = strings.TrimRight(line, "\r")
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidJournal, number, fmt.Sprintf(format, args...))
+		}
+
+		tokens, err := beancountTokens(line)
+		if err != nil {
+			return models.Backup{}, nil, fail("%v", err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			key, value, ok := beancountMeta(tokens)
+			switch {
+			case ok && posting != nil:
+				posting.meta[key] = value
+			case ok && transaction != nil:
+				transaction.meta[key] = value
+			case ok && open != nil:
+				open.meta[key] = value
+			case transaction != nil:
+				p, err := parseBeancountPosting(tokens)
+				if err != nil {
+					return models.Backup{}, nil, fail("%v", err)
+				}
+				transaction.postings = append(transaction.postings, p)
+				posting = &transaction.postings[len(transaction.postings)-1]
+			}
+			continue
+		}
+
+		open, transaction, posting = nil, nil, nil
+		switch first := tokens[0].text; {
+		case first == "option" && len(tokens) == 3 && tokens[1].text == "operating_currency":
+			file.baseCurrency = tokens[2].text
+			continue
+		case first == "pushtag" && len(tokens) == 2:
+			pushed = append(pushed, strings.TrimPrefix(tokens[1].text, "#"))
+			continue
+		case first == "poptag" && len(tokens) == 2:
+			tag := strings.TrimPrefix(tokens[1].text, "#")
+			for j := len(pushed) - 1; j >= 0; j-- {
+				if pushed[j] == tag {
+					pushed = append(pushed[:j], pushed[j+1:]...)
+					break
+				}
+			}
+			continue
+		}
+
+		date, err := time.Parse("2006-01-02", tokens[0].text)
+		if err != nil || len(tokens) < 2 {
+			// Options, plugins, includes and the like
+			continue
+		}
+
+		switch directive := tokens[1].text; {
+		case directive == "open":
+			if len(tokens) < 3 {
+				return models.Backup{}, nil, fail("open needs an account")
+			}
+			account := tokens[2].text
+			if _, ok := file.opens[account]; ok {
+				return models.Backup{}, nil, fail("%s is opened twice", account)
+			}
+			open = &beancountOpen{date: date, meta: map[string]string{}}
+			if len(tokens) > 3 && !tokens[3].quoted {
+				if strings.Contains(tokens[3].text, ",") {
+					return models.Backup{}, nil, fail("%s may only hold one currency", account)
+				}
+				open.currency = tokens[3].text
+			}
+			file.opens[account] = open
+			file.accounts = append(file.accounts, account)
+		case directive == "price":
+			if len(tokens) != 5 {
+				return models.Backup{}, nil, fail("price needs a currency, a number and a currency")
+			}
+			rate, err := parseBeancountPrice(date, tokens[2].text, tokens[3].text, tokens[4].text)
+			if err != nil {
+				return models.Backup{}, nil, fail("%v", err)
+			}
+			file.prices = append(file.prices, rate)
+		case directive == "txn" || (len(directive) == 1 && !unicode.IsLetter(rune(directive[0]))):
+			transaction = &beancountTransaction{line: number, date: date, meta: map[string]string{}}
+			transaction.tags = append(transaction.tags, pushed...)
+			strs := []string{}
+			for _, token := range tokens[2:] {
+				switch {
+				case token.quoted:
+					strs = append(strs, token.text)
+				case strings.HasPrefix(token.text, "#"):
+					transaction.tags = append(transaction.tags, token.text[1:])
+				}
+			}
+			switch len(strs) {
+			case 0:
+			case 1:
+				transaction.narration = strs[0]
+			case 2:
+				transaction.payee, transaction.narration = strs[0], strs[1]
+			default:
+				return models.Backup{}, nil, fail("a transaction has at most a payee and a narration")
+			}
+			file.transactions = append(file.transactions, transaction)
+		}
+	}
+
+	backup, err := file.backup()
+	if err != nil {
+		return models.Backup{}, nil, err
+	}
+	return backup, file.prices, nil
+}
+
+// beancountTokens splits a line into words and strings, up to a comment.
+func beancountTokens(line string) ([]beancountToken, error) {
+	tokens := []beancountToken{}
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == ';':
+			return tokens, nil
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				b.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, fmt.Errorf("a string is not closed")
+			}
+			i++
+			tokens = append(tokens, beancountToken{text: b.String(), quoted: true})
+		default:
+			end := strings.IndexAny(line[i:], " \t;\"")
+			if end < 0 {
+				end = len(line) - i
+			}
+			tokens = append(tokens, beancountToken{text: line[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// beancountMeta reads a metadata line, "key: value" with a key that starts
+// with a lowercase letter.
+func beancountMeta(tokens []beancountToken) (string, string, bool) {
+	key := tokens[0].text
+	if tokens[0].quoted || !strings.HasSuffix(key, ":") || key[0] < 'a' || key[0] > 'z' {
+		return "", "", false
+	}
+	value := ""
+	if len(tokens) > 1 {
+		value = tokens[1].text
+	}
+	return strings.TrimSuffix(key, ":"), value, true
+}
+
+// parseBeancountPosting reads "Account [amount currency [@ or @@ price
+// currency]]", after an optional flag.
+func parseBeancountPosting(tokens []beancountToken) (beancountPosting, error) {
+	if len(tokens[0].text) == 1 && len(tokens) > 1 {
+		tokens = tokens[1:]
+	}
+	posting := beancountPosting{account: tokens[0].text, meta: map[string]string{}}
+	if !strings.Contains(posting.account, ":") {
+		return beancountPosting{}, fmt.Errorf("%q is not an account", posting.account)
+	}
+	for _, token := range tokens {
+		if strings.HasPrefix(token.text, "{") {
+			return beancountPosting{}, fmt.Errorf("costs are not supported")
+		}
+	}
+
+	switch len(tokens) {
+	case 1:
+		return posting, nil
+	case 3, 6:
+	default:
+		return beancountPosting{}, fmt.Errorf("a posting needs an amount and a currency, and a price and a currency after @ or @@")
+	}
+
+	amount, err := money.Parse(tokens[1].text, tokens[2].text)
+	if err != nil {
+		return beancountPosting{}, err
+	}
+	posting.amount = &amount
+	if len(tokens) == 3 {
+		return posting, nil
+	}
+
+	price, err := money.Parse(tokens[4].text, tokens[5].text)
+	if err != nil {
+		return beancountPosting{}, err
+	}
+	switch tokens[3].text {
+	case "@":
+		price, err = amount.Abs().Convert(price.Rat(), price.Currency())
+		if err != nil {
+			return beancountPosting{}, err
+		}
+	case "@@":
+		price = price.Abs()
+	default:
+		return beancountPosting{}, fmt.Errorf("a price follows @ or @@, not %s", tokens[3].text)
+	}
+	posting.price = &price
+
+	return posting, nil
+}
+
+func parseBeancountPrice(date time.Time, base string, rate string, quote string) (models.ExchangeRate, error) {
+	b, err := money.LookupCurrency(base)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	q, err := money.LookupCurrency(quote)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	r, err := money.Decimal(rate).Rat()
+	if err != nil || r.Sign() <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("invalid price %q", rate)
+	}
+	return models.ExchangeRate{Date: date, Base: b.Code, Quote: q.Code, Rate: money.Decimal(rate), Source: "beancount"}, nil
+}
+
+// weight is what a posting adds to its transaction's balance: its price if
+// it has one, its amount otherwise.
+func (p beancountPosting) weight() money.Money {
+	if p.price == nil {
+		return *p.amount
+	}
+	if p.amount.IsNegative() {
+		return p.price.Neg()
+	}
+	return *p.price
+}
+
+// balance fills in the amount left out of a posting, which is what
+// balances the others, and checks that the transaction balances.
+func (t *beancountTransaction) balance() error {
+	totals := map[string]money.Money{}
+	elided := -1
+	for i, posting := range t.postings {
+		if posting.amount == nil {
+			if elided >= 0 {
+				return fmt.Errorf("only one posting may leave out its amount")
+			}
+			elided = i
+			continue
+		}
+		weight := posting.weight()
+		total, ok := totals[weight.Currency()]
+		if !ok {
+			total = money.Zero(weight.Currency())
+		}
+		total, err := total.Add(weight)
+		if err != nil {
+			return err
+		}
+		totals[weight.Currency()] = total
+	}
+
+	left := []money.Money{}
+	for _, total := range totals {
+		if !total.IsZero() {
+			left = append(left, total)
+		}
+	}
+	switch {
+	case elided >= 0 && len(left) == 1:
+		amount := left[0].Neg()
+		t.postings[elided].amount = &amount
+	case elided >= 0 && len(left) == 0:
+		return fmt.Errorf("the posting without an amount is left with nothing")
+	case elided >= 0:
+		return fmt.Errorf("the posting without an amount would hold more than one currency")
+	case len(left) > 0:
+		return fmt.Errorf("the transaction is off by %s", left[0])
+	}
+
+	return nil
+}
+
+// backup turns the file's accounts and transactions into a backup. Asset
+// and liability accounts become accounts, income and expense accounts
+// become categories, and equity accounts balance opening balances and
+// entries without a category.
+func (f *beancountFile) backup() (models.Backup, error) {
+	backup := models.Backup{
+		Format:     models.BackupFormat,
+		Version:    models.BackupVersion,
+		ExportedAt: time.Now(),
+		Settings:   models.BackupSettings{BaseCurrency: f.baseCurrency},
+		Accounts:   []models.Account{},
+		Categories: []models.Category{},
+		Tags:       []string{},
+		Payees:     []models.Payee{},
+	}
+
+	accounts := map[string]int{}
+	accountIndex := func(name string, currency string) int {
+		if i, ok := accounts[name]; ok {
+			return i
+		}
+		account := models.Account{ID: len(backup.Accounts) + 1, Name: journalName(name), Type: beancountAccountType(name)}
+		if open := f.opens[name]; open != nil {
+			account.CreatedAt = open.date
+			if open.currency != "" {
+				currency = open.currency
+			}
+			if open.meta["name"] != "" {
+				account.Name = open.meta["name"]
+			}
+			if open.meta["type"] != "" {
+				account.Type = models.AccountType(open.meta["type"])
+			}
+		}
+		account.Currency = currency
+		account.OpeningBalance = money.Zero(currency)
+		backup.Accounts = append(backup.Accounts, account)
+		accounts[name] = len(backup.Accounts) - 1
+		return len(backup.Accounts) - 1
+	}
+
+	categories := map[string]int{}
+	var categoryID func(name string) int
+	categoryID = func(name string) int {
+		if id, ok := categories[name]; ok {
+			return id
+		}
+		category := models.Category{ID: len(backup.Categories) + 1, Name: journalName(name), Kind: models.CategoryKindExpense}
+		if strings.HasPrefix(name, "Income:") {
+			category.Kind = models.CategoryKindIncome
+		}
+		if open := f.opens[name]; open != nil && open.meta["name"] != "" {
+			category.Name = open.meta["name"]
+		}
+		if parent := name[:strings.LastIndex(name, ":")]; strings.Contains(parent, ":") {
+			parentID := categoryID(parent)
+			category.ParentID = &parentID
+		}
+		backup.Categories = append(backup.Categories, category)
+		categories[name] = category.ID
+		return category.ID
+	}
+
+	// Balance adjustments are booked against equity, and the restore
+	// matches their category with the user's own
+	adjustment := 0
+	adjustmentID := func() *int {
+		if adjustment == 0 {
+			adjustment = len(backup.Categories) + 1
+			backup.Categories = append(backup.Categories, models.Category{ID: adjustment, Name: adjustmentCategoryName, Kind: models.CategoryKindAdjustment})
+		}
+		return &adjustment
+	}
+
+	// Accounts and categories are listed in the order they were opened
+	for _, name := range f.accounts {
+		switch journalRoot(name) {
+		case "Assets", "Liabilities":
+			if f.opens[name].currency != "" {
+				accountIndex(name, "")
+			}
+		case "Income", "Expenses":
+			categoryID(name)
+		}
+	}
+
+	payees := map[string]int{}
+	tags := []string{}
+	for i, t := range f.transactions {
+		fail := func(err error) error {
+			return fmt.Errorf("%w: line %d: %v", ErrInvalidJournal, t.line, err)
+		}
+		err := t.balance()
+		if err != nil {
+			return models.Backup{}, fail(err)
+		}
+
+		var held, categorized, equity []beancountPosting
+		for _, posting := range t.postings {
+			switch journalRoot(posting.account) {
+			case "Assets", "Liabilities":
+				held = append(held, posting)
+			case "Income", "Expenses":
+				categorized = append(categorized, posting)
+			case "Equity":
+				equity = append(equity, posting)
+			default:
+				return models.Backup{}, fail(fmt.Errorf("%s is not an Assets, Liabilities, Income, Expenses or Equity account", posting.account))
+			}
+		}
+
+		opening := len(held) > 0 && len(categorized) == 0 && len(equity) > 0
+		for _, posting := range equity {
+			opening = opening && strings.HasPrefix(posting.account[len("Equity:"):], "Opening")
+		}
+		if opening {
+			for _, posting := range held {
+				account := &backup.Accounts[accountIndex(posting.account, posting.amount.Currency())]
+				balance, err := account.OpeningBalance.Add(*posting.amount)
+				if err != nil {
+					return models.Backup{}, fail(err)
+				}
+				account.OpeningBalance = balance
+			}
+			continue
+		}
+
+		transaction := models.Transaction{ID: i + 1, Date: t.date, Memo: t.narration, Tags: t.tags, Splits: []models.Split{}}
+		transaction.Tags = append(transaction.Tags, SplitTags(t.meta["tags"])...)
+		tags = append(tags, transaction.Tags...)
+		if key := PayeeKey(t.payee); key != "" {
+			id, ok := payees[key]
+			if !ok {
+				id = len(backup.Payees) + 1
+				backup.Payees = append(backup.Payees, models.Payee{ID: id, Name: strings.TrimSpace(t.payee), Aliases: []string{}})
+				payees[key] = id
+			}
+			transaction.PayeeID = &id
+			transaction.PayeeName = t.payee
+		}
+
+		switch {
+		case len(held) == 1 && len(categorized) > 0 && len(equity) == 0:
+			transaction.AccountID = backup.Accounts[accountIndex(held[0].account, held[0].amount.Currency())].ID
+			transaction.Amount = *held[0].amount
+			for _, posting := range categorized {
+				if posting.amount.Currency() != transaction.Amount.Currency() {
+					return models.Backup{}, fail(fmt.Errorf("%s is not in %s like the account", posting.account, transaction.Amount.Currency()))
+				}
+				transaction.Splits = append(transaction.Splits, models.Split{CategoryID: categoryID(posting.account), Amount: posting.amount.Neg(), Memo: posting.meta["memo"]})
+			}
+			if len(transaction.Splits) == 1 {
+				transaction.CategoryID = &transaction.Splits[0].CategoryID
+				transaction.Splits = []models.Split{}
+			}
+		case len(held) == 2 && len(categorized) == 0 && len(equity) == 0:
+			from, to := held[0], held[1]
+			if to.amount.IsNegative() {
+				from, to = to, from
+			}
+			if !from.amount.IsNegative() || !to.amount.IsPositive() {
+				return models.Backup{}, fail(fmt.Errorf("a transfer takes from one account and pays into the other"))
+			}
+			transaction.AccountID = backup.Accounts[accountIndex(from.account, from.amount.Currency())].ID
+			transaction.Amount = *from.amount
+			transaction.Transfer = &models.TransferLeg{
+				AccountID: backup.Accounts[accountIndex(to.account, to.amount.Currency())].ID,
+				Amount:    *to.amount,
+				Rate:      money.Decimal(t.meta["rate"]),
+			}
+			if transaction.Transfer.Rate == "" && from.amount.Currency() != to.amount.Currency() {
+				rate := new(big.Rat).Quo(to.amount.Rat(), from.amount.Abs().Rat())
+				transaction.Transfer.Rate = money.Decimal(strings.TrimRight(strings.TrimRight(rate.FloatString(10), "0"), "."))
+			}
+		case len(held) == 1 && len(categorized) == 0 && len(equity) > 0:
+			transaction.AccountID = backup.Accounts[accountIndex(held[0].account, held[0].amount.Currency())].ID
+			transaction.Amount = *held[0].amount
+			transaction.CategoryID = adjustmentID()
+		default:
+			return models.Backup{}, fail(fmt.Errorf("a transaction needs one account and its categories, or two accounts for a transfer"))
+		}
+		backup.Transactions = append(backup.Transactions, transaction)
+	}
+	backup.Tags = tags
+
+	// The backup lists the newest entries first
+	sort.SliceStable(backup.Transactions, func(a, b int) bool {
+		return backup.Transactions[a].Date.Before(backup.Transactions[b].Date)
+	})
+	for a, b := 0, len(backup.Transactions)-1; a < b; a, b = a+1, b-1 {
+		backup.Transactions[a], backup.Transactions[b] = backup.Transactions[b], backup.Transactions[a]
+	}
+
+	return backup, nil
+}
+
+// beancountAccountType guesses an account's type from its name when the
+// file does not say.
+func beancountAccountType(name string) models.AccountType {
+	switch {
+	case journalRoot(name) == "Liabilities":
+		return models.AccountTypeCreditCard
+	case strings.Contains(name, ":Checking"):
+		return models.AccountTypeChecking
+	case strings.Contains(name, ":Savings"):
+		return models.AccountTypeSavings
+	}
+	return models.AccountTypeCash
+}
+
+func journalRoot(name string) string {
+	root, _, _ := strings.Cut(name, ":")
+	return root
+}
+
+// journalName names an account or category after the last component of
+// its journal account, with dashes read as spaces.
+func journalName(name string) string {
+	return strings.ReplaceAll(name[strings.LastIndex(name, ":")+1:], "-", " ")
+}
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var ErrInvalidJournal = errors.New("invalid journal")
+
+// The equity accounts that balance opening balances and entries without a
+// category.
+const (
+	openingBalancesAccount = "Equity:Opening-Balances"
+	adjustmentsAccount     = "Equity:Adjustments"
+)
+
+// JournalService writes a user's ledger as a plain text accounting journal,
+// for Beancount or for Ledger and hledger, and reads Beancount files back.
+// Accounts become Assets or Liabilities accounts and categories Income or
+// Expenses accounts; entries are balanced against them.
+type JournalService struct {
+	userRepository         repositories.UserRepository
+	exchangeRateRepository repositories.ExchangeRateRepository
+	backupService          *BackupService
+	txRunner               repositories.TxRunner
+}
+
+func NewJournalService(userRepository repositories.UserRepository, exchangeRateRepository repositories.ExchangeRateRepository, backupService *BackupService, txRunner *repositories.TxRunner) *JournalService {
+	return &JournalService{
+		userRepository:         userRepository,
+		exchangeRateRepository: exchangeRateRepository,
+		backupService:          backupService,
+		txRunner:               *txRunner,
+	}
+}
+
+// journalOpen opens a journal account. Accounts are restricted to their
+// currency; Meta keeps the names that account names cannot spell.
+type journalOpen struct {
+	account  string
+	currency string
+	meta     []journalMeta
+}
+
+type journalMeta struct {
+	key   string
+	value string
+}
+
+// journalPosting is one leg of an entry. Price is the total value of a leg
+// in another currency, for transfers between currencies.
+type journalPosting struct {
+	account string
+	amount  money.Money
+	price   *money.Money
+	memo    string
+}
+
+type journalEntry struct {
+	date     time.Time
+	payee    string
+	memo     string
+	tags     []string
+	meta     []journalMeta
+	postings []journalPosting
+}
+
+// journal is a user's ledger as double-entry bookkeeping. Everything is
+// opened on start, the date of the first entry.
+type journal struct {
+	baseCurrency string
+	start        time.Time
+	currencies   []string
+	opens        []journalOpen
+	prices       []models.ExchangeRate
+	entries      []journalEntry
+}
+
+// ExportBeancount writes the user's ledger as a Beancount file.
+func (s *JournalService) ExportBeancount(userID int, w io.Writer, now time.Time) error {
+	j, err := s.journal(userID, now)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "; Exported from Balance Tracker on %s.\n", now.Format("2006-01-02"))
+	fmt.Fprintf(out, "option \"operating_currency\" %s\n\n", beancountString(j.baseCurrency))
+
+	start := j.start.Format("2006-01-02")
+	for _, currency := range j.currencies {
+		fmt.Fprintf(out, "%s commodity %s\n", start, currency)
+	}
+	out.WriteString("\n")
+	for _, open := range j.opens {
+		fmt.Fprintf(out, "%s open %s", start, open.account)
+		if open.currency != "" {
+			fmt.Fprintf(out, " %s", open.currency)
+		}
+		out.WriteString("\n")
+		for _, meta := range open.meta {
+			fmt.Fprintf(out, "  %s: %s\n", meta.key, beancountString(meta.value))
+		}
+	}
+	out.WriteString("\n")
+	for _, price := range j.prices {
+		fmt.Fprintf(out, "%s price %s %s %s\n", price.Date.Format("2006-01-02"), price.Base, price.Rate, price.Quote)
+	}
+	if len(j.prices) > 0 {
+		out.WriteString("\n")
+	}
+
+	for _, entry := range j.entries {
+		fmt.Fprintf(out, "%s *", entry.date.Format("2006-01-02"))
+		if entry.payee != "" {
+			fmt.Fprintf(out, " %s", beancountString(entry.payee))
+		}
+		fmt.Fprintf(out, " %s", beancountString(entry.memo))
+
+		// Tags Beancount cannot spell, with letters outside ASCII, are kept
+		// as metadata instead
+		other := []string{}
+		for _, tag := range entry.tags {
+			if beancountTag(tag) {
+				fmt.Fprintf(out, " #%s", tag)
+			} else {
+				other = append(other, tag)
+			}
+		}
+		out.WriteString("\n")
+		if len(other) > 0 {
+			fmt.Fprintf(out, "  tags: %s\n", beancountString(strings.Join(other, " ")))
+		}
+		for _, meta := range entry.meta {
+			fmt.Fprintf(out, "  %s: %s\n", meta.key, beancountString(meta.value))
+		}
+
+		for _, posting := range entry.postings {
+			fmt.Fprintf(out, "  %s  %s %s", posting.account, posting.amount.Decimal(), posting.amount.Currency())
+			if posting.price != nil {
+				fmt.Fprintf(out, " @@ %s %s", posting.price.Decimal(), posting.price.Currency())
+			}
+			out.WriteString("\n")
+			if posting.memo != "" {
+				fmt.Fprintf(out, "    memo: %s\n", beancountString(posting.memo))
+			}
+		}
+		out.WriteString("\n")
+	}
+
+	return out.Flush()
+}
+
+// ExportLedger writes the user's ledger as a journal for Ledger and
+// hledger. The payee and memo share the description, split by " | " as
+// hledger reads it, and tags are written in Ledger's :tag: comments.
+func (s *JournalService) ExportLedger(userID int, w io.Writer, now time.Time) error {
+	j, err := s.journal(userID, now)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "; Exported from Balance Tracker on %s.\n\n", now.Format("2006-01-02"))
+
+	for _, currency := range j.currencies {
+		fmt.Fprintf(out, "commodity %s\n", currency)
+	}
+	out.WriteString("\n")
+	for _, open := range j.opens {
+		fmt.Fprintf(out, "account %s\n", open.account)
+	}
+	out.WriteString("\n")
+	for _, price := range j.prices {
+		fmt.Fprintf(out, "P %s %s %s %s\n", price.Date.Format("2006-01-02"), price.Base, price.Rate, price.Quote)
+	}
+	if len(j.prices) > 0 {
+		out.WriteString("\n")
+	}
+
+	for _, entry := range j.entries {
+		description := entry.payee
+		switch {
+		case description == "":
+			description = entry.memo
+		case entry.memo != "":
+			description += " | " + entry.memo
+		}
+		fmt.Fprintf(out, "%s *", entry.date.Format("2006-01-02"))
+		if description != "" {
+			fmt.Fprintf(out, " %s", ledgerText(description))
+		}
+		out.WriteString("\n")
+		if len(entry.tags) > 0 {
+			fmt.Fprintf(out, "    ; :%s:\n", strings.Join(entry.tags, ":"))
+		}
+		for _, meta := range entry.meta {
+			fmt.Fprintf(out, "    ; %s: %s\n", meta.key, ledgerText(meta.value))
+		}
+
+		for _, posting := range entry.postings {
+			fmt.Fprintf(out, "    %s  %s %s", posting.account, posting.amount.Decimal(), posting.amount.Currency())
+			if posting.price != nil {
+				fmt.Fprintf(out, " @@ %s %s", posting.price.Decimal(), posting.price.Currency())
+			}
+			if posting.memo != "" {
+				fmt.Fprintf(out, "  ; %s", ledgerText(posting.memo))
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString("\n")
+	}
+
+	return out.Flush()
+}
+
+// ImportBeancount merges the accounts, categories, payees, tags and entries
+// of a Beancount file into the user's data, as merging a backup would, so
+// that importing an export again adds nothing. Opening balances set the
+// opening balance of accounts the user does not have yet. With prices, the
+// file's prices are stored as exchange rates; they are shared by all users,
+// so only the command line imports them.
+func (s *JournalService) ImportBeancount(userID int, data []byte, prices bool) (models.JournalImportResult, error) {
+	user, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return models.JournalImportResult{}, err
+	}
+
+	backup, rates, err := parseBeancount(data, user.BaseCurrency)
+	if err != nil {
+		return models.JournalImportResult{}, err
+	}
+
+	result := models.JournalImportResult{}
+	result.RestoreResult, err = s.backupService.Restore(userID, backup, models.RestoreMerge)
+	if err != nil {
+		return models.JournalImportResult{}, err
+	}
+
+	if prices && len(rates) > 0 {
+		err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+			exchangeRates := s.exchangeRateRepository.WithTx(tx)
+			for _, rate := range rates {
+				err := exchangeRates.SaveExchangeRate(rate)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return models.JournalImportResult{}, err
+		}
+		result.Prices = len(rates)
+	}
+
+	return result, nil
+}
+
+// journal turns the user's data into a journal.
+func (s *JournalService) journal(userID int, now time.Time) (journal, error) {
+	backup, err := s.backupService.Export(userID, now)
+	if err != nil {
+		return journal{}, err
+	}
+
+	j := journal{baseCurrency: backup.Settings.BaseCurrency, start: dateOnly(now)}
+	for _, account := range backup.Accounts {
+		if created := dateOnly(account.CreatedAt); created.Before(j.start) {
+			j.start = created
+		}
+	}
+	for _, transaction := range backup.Transactions {
+		if date := dateOnly(transaction.Date); date.Before(j.start) {
+			j.start = date
+		}
+	}
+
+	taken := map[string]bool{openingBalancesAccount: true, adjustmentsAccount: true}
+	currencies := map[string]bool{j.baseCurrency: true}
+
+	accountNames := map[int]string{}
+	for _, account := range backup.Accounts {
+		name := uniqueJournalAccount(taken, journalAccountRoot(account.Type)+":"+journalComponent(account.Name))
+		accountNames[account.ID] = name
+		currencies[account.Currency] = true
+		j.opens = append(j.opens, journalOpen{
+			account:  name,
+			currency: account.Currency,
+			meta:     []journalMeta{{"name", account.Name}, {"type", string(account.Type)}},
+		})
+	}
+
+	categoryNames := journalCategoryNames(backup.Categories, taken)
+	for _, category := range backup.Categories {
+		if category.Kind == models.CategoryKindAdjustment {
+			continue
+		}
+		j.opens = append(j.opens, journalOpen{account: categoryNames[category.ID], meta: []journalMeta{{"name", category.Name}}})
+	}
+	j.opens = append(j.opens, journalOpen{account: openingBalancesAccount}, journalOpen{account: adjustmentsAccount})
+	sort.Slice(j.opens, func(a, b int) bool { return j.opens[a].account < j.opens[b].account })
+
+	// Opening balances go in the order of the accounts' names, so that they
+	// come back in the same order after an import
+	accounts := append([]models.Account{}, backup.Accounts...)
+	sort.Slice(accounts, func(a, b int) bool { return accountNames[accounts[a].ID] < accountNames[accounts[b].ID] })
+	for _, account := range accounts {
+		if account.OpeningBalance.IsZero() {
+			continue
+		}
+		j.entries = append(j.entries, journalEntry{
+			date: j.start,
+			memo: "Opening balance",
+			postings: []journalPosting{
+				{account: accountNames[account.ID], amount: account.OpeningBalance},
+				{account: openingBalancesAccount, amount: account.OpeningBalance.Neg()},
+			},
+		})
+	}
+
+	// The backup lists the newest entries first
+	for i := len(backup.Transactions) - 1; i >= 0; i-- {
+		transaction := backup.Transactions[i]
+		entry := journalEntry{
+			date:     dateOnly(transaction.Date),
+			payee:    transaction.PayeeName,
+			memo:     transaction.Memo,
+			tags:     transaction.Tags,
+			postings: []journalPosting{{account: accountNames[transaction.AccountID], amount: transaction.Amount}},
+		}
+
+		switch {
+		case transaction.Transfer != nil:
+			leg := transaction.Transfer
+			if leg.Amount.Currency() != transaction.Amount.Currency() {
+				received := leg.Amount
+				entry.postings[0].price = &received
+				entry.meta = []journalMeta{{"rate", string(leg.Rate)}}
+			}
+			entry.postings = append(entry.postings, journalPosting{account: accountNames[leg.AccountID], amount: leg.Amount})
+		case len(transaction.Splits) > 0:
+			for _, split := range transaction.Splits {
+				entry.postings = append(entry.postings, journalPosting{account: categoryNames[split.CategoryID], amount: split.Amount.Neg(), memo: split.Memo})
+			}
+		case transaction.CategoryID != nil:
+			entry.postings = append(entry.postings, journalPosting{account: categoryNames[*transaction.CategoryID], amount: transaction.Amount.Neg()})
+		default:
+			entry.postings = append(entry.postings, journalPosting{account: adjustmentsAccount, amount: transaction.Amount.Neg()})
+		}
+		j.entries = append(j.entries, entry)
+	}
+
+	held := []string{}
+	for currency := range currencies {
+		held = append(held, currency)
+	}
+	j.prices, err = s.exchangeRateRepository.GetExchangeRatesByCurrencies(held, j.start)
+	if err != nil {
+		return journal{}, err
+	}
+	for _, price := range j.prices {
+		currencies[price.Base] = true
+		currencies[price.Quote] = true
+	}
+	for currency := range currencies {
+		j.currencies = append(j.currencies, currency)
+	}
+	sort.Strings(j.currencies)
+
+	return j, nil
+}
+
+func journalAccountRoot(accountType models.AccountType) string {
+	switch accountType {
+	case models.AccountTypeChecking:
+		return "Assets:Checking"
+	case models.AccountTypeSavings:
+		return "Assets:Savings"
+	case models.AccountTypeCreditCard:
+		return "Liabilities:CreditCard"
+	}
+	return "Assets:Cash"
+}
+
+// journalCategoryNames names each category's journal account after its
+// path, like Expenses:Food:Groceries. Balance adjustments are booked against
+// equity instead.
+func journalCategoryNames(categories []models.Category, taken map[string]bool) map[int]string {
+	byID := map[int]models.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	names := map[int]string{}
+	var name func(category models.Category) string
+	name = func(category models.Category) string {
+		if n, ok := names[category.ID]; ok {
+			return n
+		}
+		if category.Kind == models.CategoryKindAdjustment {
+			names[category.ID] = adjustmentsAccount
+			return adjustmentsAccount
+		}
+		prefix := "Expenses"
+		if category.Kind == models.CategoryKindIncome {
+			prefix = "Income"
+		}
+		if category.ParentID != nil {
+			if parent, ok := byID[*category.ParentID]; ok {
+				prefix = name(parent)
+			}
+		}
+		n := uniqueJournalAccount(taken, prefix+":"+journalComponent(category.Name))
+		names[category.ID] = n
+		return n
+	}
+	for _, category := range categories {
+		name(category)
+	}
+
+	return names
+}
+
+// journalComponent turns a name into one component of an account name,
+// which starts with a capital letter or a digit and goes on with letters,
+// digits and dashes.
+func journalComponent(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+
+	component := strings.TrimSuffix(b.String(), "-")
+	if component == "" {
+		return "X"
+	}
+	first, size := utf8.DecodeRuneInString(component)
+	return string(unicode.ToUpper(first)) + component[size:]
+}
+
+// uniqueJournalAccount numbers an account name that is taken already.
+func uniqueJournalAccount(taken map[string]bool, name string) string {
+	unique := name
+	for n := 2; taken[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// beancountTag reports whether Beancount can spell a tag.
+func beancountTag(tag string) bool {
+	for _, r := range tag {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_/", r)) {
+			return false
+		}
+	}
+	return tag != ""
+}
+
+func beancountString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ").Replace(s) + `"`
+}
+
+// ledgerText keeps text on one line and away from the two spaces that end
+// an account name.
+func ledgerText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestJournalExport(t *testing.T) {
+	s := newTestServices(t)
+	from := s.createUser(t).ID
+	to := s.createUser(t).ID
+
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: from, Name: "Cash", Currency: "JPY", OpeningBalance: money.New(10000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savings, err := s.accountService.CreateAccount(models.Account{UserID: from, Name: "Travel savings", Type: models.AccountTypeSavings, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, ParentID: &food.ID, Name: "Groceries & drinks", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, Name: "Gifts", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: from, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = s.transactionService.CreateTransaction(models.Transaction{UserID: from, AccountID: cash.ID, CategoryID: &salary.ID, Amount: money.New(5000, "JPY"), Date: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), Memo: `Bonus "May"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.transactionService.CreateTransaction(models.Transaction{
+		UserID:    from,
+		AccountID: cash.ID,
+		PayeeName: "Farm market",
+		Amount:    money.New(-3000, "JPY"),
+		Date:      time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Tags:      []string{"trip", "旅行"},
+		Splits: []models.Split{
+			{CategoryID: groceries.ID, Amount: money.New(-2000, "JPY")},
+			{CategoryID: gifts.ID, Amount: money.New(-1000, "JPY"), Memo: "birthday card"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.transactionService.CreateTransfer(models.Transfer{UserID: from, FromAccountID: cash.ID, ToAccountID: savings.ID, Amount: money.New(1000, "JPY"), Rate: "0.0065", Date: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.transactionService.SetBalance(from, cash.ID, money.New(10500, "JPY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	var exported strings.Builder
+	err = s.journalService.ExportBeancount(from, &exported, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"open Assets:Savings:Travel-savings USD",
+		"open Expenses:Food:Groceries-drinks",
+		`  name: "Groceries & drinks"`,
+		`2024-05-31 * "Bonus \"May\""`,
+		`2024-06-01 * "Farm market" "" #trip`,
+		`  tags: "旅行"`,
+		"  Expenses:Gifts  1000 JPY\n    memo: \"birthday card\"",
+		"  Assets:Cash:Cash  -1000 JPY @@ 6.50 USD",
+		"  Equity:Adjustments  500 JPY",
+	} {
+		if !strings.Contains(exported.String(), line) {
+			t.Fatalf("the Beancount export is missing %q:\n%s", line, exported.String())
+		}
+	}
+
+	// The export comes back the same after importing it for another user
+	result, err := s.journalService.ImportBeancount(to, []byte(exported.String()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Accounts != 2 || result.Categories != 5 || result.Payees != 1 || result.Transactions != 4 {
+		t.Fatalf("import created %+v", result)
+	}
+	var reexported strings.Builder
+	err = s.journalService.ExportBeancount(to, &reexported, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reexported.String() != exported.String() {
+		t.Fatalf("the export did not round-trip:\n%s\nbecame\n%s", exported.String(), reexported.String())
+	}
+	result, err = s.journalService.ImportBeancount(to, []byte(exported.String()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transactions != 0 {
+		t.Fatalf("importing again created %d transactions", result.Transactions)
+	}
+
+	_, err = s.journalService.ImportBeancount(to, []byte("2024-01-01 * \"Lunch\"\n  Assets:Cash  -5 USD\n  Expenses:Food  4 USD\n"), false)
+	if !errors.Is(err, ErrInvalidJournal) {
+		t.Fatalf("importing an unbalanced entry: err = %v, want %v", err, ErrInvalidJournal)
+	}
+
+	var ledger strings.Builder
+	err = s.journalService.ExportLedger(from, &ledger, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"account Expenses:Food:Groceries-drinks\n",
+		"2024-06-02 *\n    ; rate: 0.0065\n",
+		"2024-06-01 * Farm market\n    ; :trip:旅行:\n    Assets:Cash:Cash  -3000 JPY\n",
+		"    Expenses:Gifts  1000 JPY  ; birthday card\n",
+		"    Assets:Cash:Cash  -1000 JPY @@ 6.50 USD\n    Assets:Savings:Travel-savings  6.50 USD\n",
+	} {
+		if !strings.Contains(ledger.String(), line) {
+			t.Fatalf("the Ledger export is missing %q:\n%s", line, ledger.String())
+		}
+	}
+}
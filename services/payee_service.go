@@ -0,0 +1,352 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"balance-tracker/models"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrPayeeNotFound = errors.New("payee not found")
+	ErrPayeeInUse    = errors.New("payee still has transactions, merge it into another payee instead")
+	ErrInvalidPayee  = errors.New("invalid payee")
+)
+
+type PayeeService struct {
+	payeeRepository       repositories.PayeeRepository
+	transactionRepository repositories.TransactionRepository
+	categoryRepository    repositories.CategoryRepository
+	txRunner              repositories.TxRunner
+}
+
+func NewPayeeService(payeeRepository repositories.PayeeRepository, transactionRepository repositories.TransactionRepository, categoryRepository repositories.CategoryRepository, txRunner *repositories.TxRunner) *PayeeService {
+	return &PayeeService{
+		payeeRepository:       payeeRepository,
+		transactionRepository: transactionRepository,
+		categoryRepository:    categoryRepository,
+		txRunner:              *txRunner,
+	}
+}
+
+// PayeeKey normalizes a spelling of a payee for matching: case, punctuation
+// and spacing are ignored, so "Amazon.co.jp" and "AMAZON CO JP" are the same.
+func PayeeKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+func (s *PayeeService) GetPayees(userID int) ([]models.Payee, error) {
+	payees, err := s.payeeRepository.GetPayeesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range payees {
+		payees[i].Aliases = aliasesWithoutName(payees[i])
+	}
+
+	return payees, nil
+}
+
+// GetPayee returns the payee only if it belongs to the user.
+func (s *PayeeService) GetPayee(userID int, id int) (models.Payee, error) {
+	payee, err := getOwnedPayee(s.payeeRepository, userID, id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	payee.Aliases = aliasesWithoutName(payee)
+	return payee, nil
+}
+
+// FindPayee returns the user's payee known by name or one of its aliases.
+func (s *PayeeService) FindPayee(userID int, name string) (models.Payee, error) {
+	payee, err := s.payeeRepository.GetPayeeByAliasKey(userID, PayeeKey(name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Payee{}, ErrPayeeNotFound
+		}
+		return models.Payee{}, err
+	}
+
+	payee.Aliases = aliasesWithoutName(payee)
+	return payee, nil
+}
+
+// SuggestPayees returns up to limit of the user's payees whose name or an
+// alias starts with what has been typed so far.
+func (s *PayeeService) SuggestPayees(userID int, typed string, limit int) ([]models.Payee, error) {
+	payees, err := s.GetPayees(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := PayeeKey(typed)
+	suggestions := []models.Payee{}
+	for _, payee := range payees {
+		if len(suggestions) == limit {
+			break
+		}
+		for _, spelling := range append([]string{payee.Name}, payee.Aliases...) {
+			if strings.HasPrefix(PayeeKey(spelling), prefix) {
+				suggestions = append(suggestions, payee)
+				break
+			}
+		}
+	}
+
+	return suggestions, nil
+}
+
+func (s *PayeeService) CreatePayee(payee models.Payee) (models.Payee, error) {
+	err := s.normalizePayee(&payee, 0)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	var created models.Payee
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		payees := s.payeeRepository.WithTx(tx)
+
+		created, err = payees.CreatePayee(payee)
+		if err != nil {
+			return err
+		}
+
+		return addPayeeAliases(payees, created.UserID, created.ID, payee.Name, payee.Aliases)
+	})
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	return s.GetPayee(created.UserID, created.ID)
+}
+
+// UpdatePayee renames the payee, sets its default category and replaces its
+// aliases.
+func (s *PayeeService) UpdatePayee(userID int, id int, payee models.Payee) (models.Payee, error) {
+	existing, err := getOwnedPayee(s.payeeRepository, userID, id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	payee.UserID = userID
+	err = s.normalizePayee(&payee, id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	existing.Name = payee.Name
+	existing.DefaultCategoryID = payee.DefaultCategoryID
+	existing.UpdatedAt = time.Now()
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		payees := s.payeeRepository.WithTx(tx)
+
+		err := payees.UpdatePayee(id, existing)
+		if err != nil {
+			return err
+		}
+
+		err = payees.DeletePayeeAliases(id)
+		if err != nil {
+			return err
+		}
+
+		return addPayeeAliases(payees, userID, id, payee.Name, payee.Aliases)
+	})
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	return s.GetPayee(userID, id)
+}
+
+// DeletePayee removes a payee that no transaction refers to.
+func (s *PayeeService) DeletePayee(userID int, id int) error {
+	_, err := getOwnedPayee(s.payeeRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.transactionRepository.CountTransactionsByPayeeID(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPayeeInUse
+	}
+
+	return s.payeeRepository.DeletePayee(id)
+}
+
+// MergePayees folds one payee into another: its transactions and aliases,
+// including its name, move to the target and the payee is deleted. The
+// target keeps its default category unless it has none.
+func (s *PayeeService) MergePayees(userID int, id int, intoID int) (models.Payee, error) {
+	if id == intoID {
+		return models.Payee{}, fmt.Errorf("%w: a payee cannot be merged into itself", ErrInvalidPayee)
+	}
+
+	source, err := getOwnedPayee(s.payeeRepository, userID, id)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	target, err := getOwnedPayee(s.payeeRepository, userID, intoID)
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		payees := s.payeeRepository.WithTx(tx)
+
+		err := s.transactionRepository.WithTx(tx).ReassignPayee(source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		err = payees.MovePayeeAliases(source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		if target.DefaultCategoryID == nil && source.DefaultCategoryID != nil {
+			target.DefaultCategoryID = source.DefaultCategoryID
+			target.UpdatedAt = time.Now()
+			err = payees.UpdatePayee(target.ID, target)
+			if err != nil {
+				return err
+			}
+		}
+
+		return payees.DeletePayee(source.ID)
+	})
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	return s.GetPayee(userID, intoID)
+}
+
+// normalizePayee validates a payee before it is stored as id, or as a new
+// payee if id is 0. None of its spellings may belong to another payee.
+func (s *PayeeService) normalizePayee(payee *models.Payee, id int) error {
+	payee.Name = strings.TrimSpace(payee.Name)
+	if PayeeKey(payee.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPayee)
+	}
+
+	if payee.DefaultCategoryID != nil {
+		_, err := getOwnedCategory(s.categoryRepository, payee.UserID, *payee.DefaultCategoryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := map[string]bool{PayeeKey(payee.Name): true}
+	aliases := []string{}
+	for _, alias := range payee.Aliases {
+		alias = strings.TrimSpace(alias)
+		key := PayeeKey(alias)
+		if key == "" || keys[key] {
+			continue
+		}
+		keys[key] = true
+		aliases = append(aliases, alias)
+	}
+	payee.Aliases = aliases
+
+	for key := range keys {
+		other, err := s.payeeRepository.GetPayeeByAliasKey(payee.UserID, key)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if other.ID != id {
+			return fmt.Errorf("%w: %q is already known as %s", ErrInvalidPayee, key, other.Name)
+		}
+	}
+
+	return nil
+}
+
+// resolvePayee finds the user's payee known by name, creating it if there is
+// none. A new payee remembers categoryID as its default category, and so
+// does an existing payee that has no default yet.
+func resolvePayee(payeeRepository repositories.PayeeRepository, userID int, name string, categoryID *int) (models.Payee, error) {
+	payee, err := payeeRepository.GetPayeeByAliasKey(userID, PayeeKey(name))
+	if err == sql.ErrNoRows {
+		payee, err = payeeRepository.CreatePayee(models.Payee{
+			UserID:            userID,
+			Name:              strings.TrimSpace(name),
+			DefaultCategoryID: categoryID,
+		})
+		if err != nil {
+			return models.Payee{}, err
+		}
+		return payee, addPayeeAliases(payeeRepository, userID, payee.ID, payee.Name, nil)
+	}
+	if err != nil {
+		return models.Payee{}, err
+	}
+
+	if payee.DefaultCategoryID == nil && categoryID != nil {
+		payee.DefaultCategoryID = categoryID
+		payee.UpdatedAt = time.Now()
+		err = payeeRepository.UpdatePayee(payee.ID, payee)
+		if err != nil {
+			return models.Payee{}, err
+		}
+	}
+
+	return payee, nil
+}
+
+func addPayeeAliases(payeeRepository repositories.PayeeRepository, userID int, payeeID int, name string, aliases []string) error {
+	for _, alias := range append([]string{name}, aliases...) {
+		err := payeeRepository.AddPayeeAlias(userID, payeeID, alias, PayeeKey(alias))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aliasesWithoutName leaves out the alias that only repeats the payee's
+// own name.
+func aliasesWithoutName(payee models.Payee) []string {
+	aliases := []string{}
+	for _, alias := range payee.Aliases {
+		if PayeeKey(alias) != PayeeKey(payee.Name) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+func getOwnedPayee(payeeRepository repositories.PayeeRepository, userID int, id int) (models.Payee, error) {
+	payee, err := payeeRepository.GetPayee(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Payee{}, ErrPayeeNotFound
+		}
+		return models.Payee{}, err
+	}
+
+	if payee.UserID != userID {
+		return models.Payee{}, ErrPayeeNotFound
+	}
+
+	return payee, nil
+}
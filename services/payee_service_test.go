@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestMergePayees(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dining, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Dining Out", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := s.payeeService.CreatePayee(models.Payee{UserID: userID, Name: "Seven Eleven", DefaultCategoryID: &dining.ID, Aliases: []string{"7-11"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := s.payeeService.CreatePayee(models.Payee{UserID: userID, Name: "7-Eleven", DefaultCategoryID: &groceries.ID, Aliases: []string{"SEJ"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(payeeID int) models.Transaction {
+		t.Helper()
+		transaction, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &groceries.ID, PayeeID: &payeeID, Amount: money.New(-500, "JPY")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transaction
+	}
+	moved := []models.Transaction{create(source.ID), create(source.ID)}
+	kept := create(target.ID)
+
+	_, err = s.payeeService.MergePayees(userID, source.ID, source.ID)
+	if !errors.Is(err, ErrInvalidPayee) {
+		t.Fatalf("merging a payee into itself: err = %v, want %v", err, ErrInvalidPayee)
+	}
+	other := s.createUser(t).ID
+	_, err = s.payeeService.MergePayees(other, source.ID, target.ID)
+	if !errors.Is(err, ErrPayeeNotFound) {
+		t.Fatalf("merging another user's payees: err = %v, want %v", err, ErrPayeeNotFound)
+	}
+
+	merged, err := s.payeeService.MergePayees(userID, source.ID, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The target keeps its name and default category, and takes over the
+	// source's name and aliases
+	if merged.ID != target.ID || merged.Name != "7-Eleven" {
+		t.Fatalf("merged into %d %q, want %d %q", merged.ID, merged.Name, target.ID, "7-Eleven")
+	}
+	if merged.DefaultCategoryID == nil || *merged.DefaultCategoryID != groceries.ID {
+		t.Fatalf("merged default category %v, want the target's %d", merged.DefaultCategoryID, groceries.ID)
+	}
+	aliases := append([]string{}, merged.Aliases...)
+	sort.Strings(aliases)
+	if len(aliases) != 3 || aliases[0] != "7-11" || aliases[1] != "SEJ" || aliases[2] != "Seven Eleven" {
+		t.Fatalf("merged aliases %q, want 7-11, SEJ and Seven Eleven", aliases)
+	}
+	for _, name := range []string{"seven eleven", "7 11", "7-Eleven"} {
+		found, err := s.payeeService.FindPayee(userID, name)
+		if err != nil {
+			t.Fatalf("finding %q: %v", name, err)
+		}
+		if found.ID != target.ID {
+			t.Fatalf("%q is known as payee %d, want %d", name, found.ID, target.ID)
+		}
+	}
+
+	// The source is gone, and all of its transactions moved
+	_, err = s.payeeService.GetPayee(userID, source.ID)
+	if !errors.Is(err, ErrPayeeNotFound) {
+		t.Fatalf("merged payee: err = %v, want %v", err, ErrPayeeNotFound)
+	}
+	for _, transaction := range append(moved, kept) {
+		got, err := s.transactionService.GetTransaction(userID, transaction.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PayeeID == nil || *got.PayeeID != target.ID || got.PayeeName != "7-Eleven" {
+			t.Fatalf("transaction %d is with %v %q, want %d %q", transaction.ID, got.PayeeID, got.PayeeName, target.ID, "7-Eleven")
+		}
+	}
+
+	// New entries under the source's name go to the target
+	typed, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, PayeeName: "SEVEN-ELEVEN", Amount: money.New(-300, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typed.PayeeID == nil || *typed.PayeeID != target.ID || typed.CategoryID == nil || *typed.CategoryID != groceries.ID {
+		t.Fatalf("new entry with payee %v in category %v, want payee %d in %d", typed.PayeeID, typed.CategoryID, target.ID, groceries.ID)
+	}
+
+	// Picking the payee by id uses its default category as well
+	picked, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, PayeeID: &target.ID, Amount: money.New(-200, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if picked.CategoryID == nil || *picked.CategoryID != groceries.ID {
+		t.Fatalf("entry picked by payee id in category %v, want %d", picked.CategoryID, groceries.ID)
+	}
+	_, _, err = s.transactionService.CreateTransaction(models.Transaction{UserID: other, AccountID: account.ID, PayeeID: &target.ID, Amount: money.New(-200, "JPY")})
+	if !errors.Is(err, ErrPayeeNotFound) {
+		t.Fatalf("entry with another user's payee: err = %v, want %v", err, ErrPayeeNotFound)
+	}
+
+	// A target without a default category takes the source's
+	bakery, err := s.payeeService.CreatePayee(models.Payee{UserID: userID, Name: "Bakery", DefaultCategoryID: &dining.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bread, err := s.payeeService.CreatePayee(models.Payee{UserID: userID, Name: "Bread shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err = s.payeeService.MergePayees(userID, bakery.ID, bread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.DefaultCategoryID == nil || *merged.DefaultCategoryID != dining.ID {
+		t.Fatalf("merged default category %v, want the source's %d", merged.DefaultCategoryID, dining.ID)
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+// maxRecurrencePeriods bounds how far a schedule is followed, so that a rule
+// that never matches, such as the 31st of every February, cannot loop
+// forever.
+const maxRecurrencePeriods = 100000
+
+// Recurrence is a schedule in a subset of the iCalendar RRULE syntax of
+// RFC 5545, counted from a start date:
+//
+//	FREQ=MONTHLY;BYMONTHDAY=25                     monthly on the 25th
+//	FREQ=MONTHLY;BYMONTHDAY=-1                     on the last day of the month
+//	FREQ=WEEKLY;INTERVAL=2                         every two weeks
+//	FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1  on the last business day
+//
+// FREQ is DAILY, WEEKLY, MONTHLY or YEARLY. INTERVAL, BYDAY, BYMONTHDAY,
+// BYMONTH, BYSETPOS, COUNT and UNTIL work as in RFC 5545, except that in
+// yearly rules BYDAY and BYMONTHDAY apply within the months of BYMONTH,
+// which defaults to the start's month. BYDAY takes an ordinal such as 1MO or
+// -1FR only in monthly and yearly rules. Weeks start on Monday. As in the
+// RFC, a monthly rule without BYDAY or BYMONTHDAY repeats on the start's day
+// and skips months that are too short for it.
+type Recurrence struct {
+	Rule       string
+	freq       string
+	interval   int
+	byDay      []weekdayRule
+	byMonthDay []int
+	byMonth    []int
+	bySetPos   []int
+	count      int
+	until      time.Time
+}
+
+// weekdayRule is one BYDAY entry: a weekday, optionally the nth of the month
+// counted from the end if negative.
+type weekdayRule struct {
+	weekday time.Weekday
+	ordinal int
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// ParseRecurrence reads an RRULE, with or without its "RRULE:" prefix.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	rule = strings.ToUpper(strings.Join(strings.Fields(rule), ""))
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	r := Recurrence{Rule: rule, interval: 1}
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Recurrence{}, fmt.Errorf("%w: %q", ErrInvalidRecurrence, part)
+		}
+
+		var err error
+		switch key {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" && value != "MONTHLY" && value != "YEARLY" {
+				return Recurrence{}, fmt.Errorf("%w: unsupported FREQ %s", ErrInvalidRecurrence, value)
+			}
+			r.freq = value
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err == nil && r.interval < 1 {
+				err = errors.New("out of range")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+			if err == nil && r.count < 1 {
+				err = errors.New("out of range")
+			}
+		case "UNTIL":
+			r.until, err = parseUntil(value)
+		case "BYDAY":
+			r.byDay, err = parseWeekdayRules(value)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseNumbers(value, 31)
+		case "BYMONTH":
+			r.byMonth, err = parseNumbers(value, 12)
+			for _, month := range r.byMonth {
+				if month < 0 {
+					err = errors.New("out of range")
+				}
+			}
+		case "BYSETPOS":
+			r.bySetPos, err = parseNumbers(value, 366)
+		case "WKST":
+			if value != "MO" {
+				err = errors.New("only weeks starting on Monday are supported")
+			}
+		default:
+			return Recurrence{}, fmt.Errorf("%w: unsupported %s", ErrInvalidRecurrence, key)
+		}
+		if err != nil {
+			return Recurrence{}, fmt.Errorf("%w: %s=%s: %v", ErrInvalidRecurrence, key, value, err)
+		}
+	}
+
+	if r.freq == "" {
+		return Recurrence{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return Recurrence{}, fmt.Errorf("%w: COUNT and UNTIL cannot be combined", ErrInvalidRecurrence)
+	}
+	for _, day := range r.byDay {
+		if day.ordinal != 0 && r.freq != "MONTHLY" && r.freq != "YEARLY" {
+			return Recurrence{}, fmt.Errorf("%w: BYDAY ordinals need a monthly or yearly FREQ", ErrInvalidRecurrence)
+		}
+	}
+
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "20060102T150405Z", "2006-01-02"} {
+		until, err := time.Parse(layout, value)
+		if err == nil {
+			return dateOnly(until), nil
+		}
+	}
+	return time.Time{}, errors.New("expected a date like 20241231")
+}
+
+func parseWeekdayRules(value string) ([]weekdayRule, error) {
+	rules := []weekdayRule{}
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+		weekday, ok := weekdays[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", item)
+		}
+
+		rule := weekdayRule{weekday: weekday}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			ordinal, err := strconv.Atoi(prefix)
+			if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+				return nil, fmt.Errorf("invalid day %q", item)
+			}
+			rule.ordinal = ordinal
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseNumbers reads a list of non-zero numbers from -max to max.
+func parseNumbers(value string, max int) ([]int, error) {
+	numbers := []int{}
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < -max || n > max {
+			return nil, fmt.Errorf("invalid number %q", item)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+// Between returns the dates of a schedule starting on start that fall from
+// from to to, both included.
+func (r Recurrence) Between(start time.Time, from time.Time, to time.Time) []time.Time {
+	from, to = dateOnly(from), dateOnly(to)
+
+	dates := []time.Time{}
+	r.each(start, func(date time.Time) bool {
+		if date.After(to) {
+			return false
+		}
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+		return true
+	})
+	return dates
+}
+
+// Next returns the first date of a schedule starting on start that is on or
+// after from. It reports false if the schedule has ended by then.
+func (r Recurrence) Next(start time.Time, from time.Time) (time.Time, bool) {
+	from = dateOnly(from)
+
+	var next time.Time
+	r.each(start, func(date time.Time) bool {
+		if date.Before(from) {
+			return true
+		}
+		next = date
+		return false
+	})
+	return next, !next.IsZero()
+}
+
+// Includes reports whether the date is one of the schedule's.
+func (r Recurrence) Includes(start time.Time, date time.Time) bool {
+	next, ok := r.Next(start, date)
+	return ok && next.Equal(dateOnly(date))
+}
+
+// each calls fn with the schedule's dates in order until fn returns false or
+// the schedule ends.
+func (r Recurrence) each(start time.Time, fn func(date time.Time) bool) {
+	start = dateOnly(start)
+
+	n := 0
+	for k := 0; k < maxRecurrencePeriods; k++ {
+		for _, date := range r.period(start, k) {
+			if date.Before(start) {
+				continue
+			}
+			if !r.until.IsZero() && date.After(r.until) {
+				return
+			}
+			n++
+			if r.count > 0 && n > r.count {
+				return
+			}
+			if !fn(date) {
+				return
+			}
+		}
+	}
+}
+
+// period returns the dates of the kth day, week, month or year of the
+// schedule, in order.
+func (r Recurrence) period(start time.Time, k int) []time.Time {
+	step := k * r.interval
+
+	var dates []time.Time
+	switch r.freq {
+	case "DAILY":
+		date := start.AddDate(0, 0, step)
+		if r.matchesMonthDay(date) && r.matchesWeekday(date) {
+			dates = append(dates, date)
+		}
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			dates = append(dates, start.AddDate(0, 0, 7*step))
+			break
+		}
+		monday := start.AddDate(0, 0, 7*step-(int(start.Weekday())+6)%7)
+		for i := 0; i < 7; i++ {
+			date := monday.AddDate(0, 0, i)
+			if r.matchesWeekday(date) {
+				dates = append(dates, date)
+			}
+		}
+	case "MONTHLY":
+		dates = r.monthDates(start, time.Date(start.Year(), start.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC))
+	case "YEARLY":
+		months := append([]int{}, r.byMonth...)
+		if len(months) == 0 {
+			months = []int{int(start.Month())}
+		}
+		sort.Ints(months)
+		for _, month := range months {
+			dates = append(dates, r.monthDates(start, time.Date(start.Year()+step, time.Month(month), 1, 0, 0, 0, 0, time.UTC))...)
+		}
+	}
+
+	if len(r.byMonth) > 0 && r.freq != "YEARLY" {
+		kept := dates[:0]
+		for _, date := range dates {
+			if containsInt(r.byMonth, int(date.Month())) {
+				kept = append(kept, date)
+			}
+		}
+		dates = kept
+	}
+
+	return r.selectPositions(dates)
+}
+
+// monthDates returns the dates in the month starting on first that match
+// BYMONTHDAY and BYDAY, or the start's day of the month without either.
+func (r Recurrence) monthDates(start time.Time, first time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		if start.Day() > last {
+			return nil
+		}
+		return []time.Time{first.AddDate(0, 0, start.Day()-1)}
+	}
+
+	dates := []time.Time{}
+	for day := 1; day <= last; day++ {
+		date := first.AddDate(0, 0, day-1)
+		if r.matchesMonthDay(date) && r.matchesWeekday(date) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+func (r Recurrence) matchesMonthDay(date time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+
+	last := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, day := range r.byMonthDay {
+		if day == date.Day() || (day < 0 && last+day+1 == date.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Recurrence) matchesWeekday(date time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+
+	last := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, rule := range r.byDay {
+		if rule.weekday != date.Weekday() {
+			continue
+		}
+		switch {
+		case rule.ordinal == 0,
+			rule.ordinal > 0 && (date.Day()-1)/7+1 == rule.ordinal,
+			rule.ordinal < 0 && (last-date.Day())/7+1 == -rule.ordinal:
+			return true
+		}
+	}
+	return false
+}
+
+// selectPositions applies BYSETPOS to the dates of one period.
+func (r Recurrence) selectPositions(dates []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 {
+		return dates
+	}
+
+	selected := []time.Time{}
+	for i, date := range dates {
+		for _, position := range r.bySetPos {
+			if position == i+1 || position == i-len(dates) {
+				selected = append(selected, date)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
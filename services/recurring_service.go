@@ -0,0 +1,468 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrRecurringNotFound   = errors.New("recurring transaction not found")
+	ErrInvalidRecurring    = errors.New("invalid recurring transaction")
+	ErrOccurrenceNotFound  = errors.New("no such date in the schedule")
+	ErrOccurrenceIsHistory = errors.New("the date has already been posted")
+)
+
+type RecurringService struct {
+	recurringRepository repositories.RecurringRepository
+	accountRepository   repositories.AccountRepository
+	categoryRepository  repositories.CategoryRepository
+	transactionService  *TransactionService
+	txRunner            repositories.TxRunner
+}
+
+func NewRecurringService(recurringRepository repositories.RecurringRepository, accountRepository repositories.AccountRepository, categoryRepository repositories.CategoryRepository, transactionService *TransactionService, txRunner *repositories.TxRunner) *RecurringService {
+	return &RecurringService{
+		recurringRepository: recurringRepository,
+		accountRepository:   accountRepository,
+		categoryRepository:  categoryRepository,
+		transactionService:  transactionService,
+		txRunner:            *txRunner,
+	}
+}
+
+func (s *RecurringService) GetRecurringTransactions(userID int) ([]models.RecurringTransaction, error) {
+	return s.recurringRepository.GetRecurringTransactionsByUserID(userID)
+}
+
+// GetRecurringTransaction returns the template only if it belongs to the
+// user.
+func (s *RecurringService) GetRecurringTransaction(userID int, id int) (models.RecurringTransaction, error) {
+	return getOwnedRecurring(s.recurringRepository, userID, id)
+}
+
+// CreateRecurringTransaction stores a template. Its schedule starts on
+// StartDate, today if not given, but dates before today are not posted.
+func (s *RecurringService) CreateRecurringTransaction(recurring models.RecurringTransaction) (models.RecurringTransaction, error) {
+	rule, err := s.normalizeRecurring(&recurring)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+	recurring.NextDate = firstUnposted(rule, recurring.StartDate, time.Now())
+
+	created, err := s.recurringRepository.CreateRecurringTransaction(recurring)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	return s.GetRecurringTransaction(created.UserID, created.ID)
+}
+
+// UpdateRecurringTransaction replaces a template. Dates not posted yet take
+// the new amount and memo. If the schedule changes, it resumes from today
+// and edits and skips of the old schedule's dates are kept only where the
+// dates still match.
+func (s *RecurringService) UpdateRecurringTransaction(userID int, id int, recurring models.RecurringTransaction) (models.RecurringTransaction, error) {
+	recurring.UserID = userID
+	rule, err := s.normalizeRecurring(&recurring)
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		templates := s.recurringRepository.WithTx(tx)
+
+		existing, err := templates.LockRecurringTransaction(id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrRecurringNotFound
+			}
+			return err
+		}
+		if existing.UserID != userID {
+			return ErrRecurringNotFound
+		}
+
+		recurring.NextDate = existing.NextDate
+		if recurring.Rule != existing.Rule || !recurring.StartDate.Equal(dateOnly(existing.StartDate)) {
+			recurring.NextDate = firstUnposted(rule, recurring.StartDate, time.Now())
+		}
+		recurring.UpdatedAt = time.Now()
+
+		return templates.UpdateRecurringTransaction(id, recurring)
+	})
+	if err != nil {
+		return models.RecurringTransaction{}, err
+	}
+
+	return s.GetRecurringTransaction(userID, id)
+}
+
+// DeleteRecurringTransaction stops a schedule. Entries already posted stay
+// in the ledger.
+func (s *RecurringService) DeleteRecurringTransaction(userID int, id int) error {
+	_, err := getOwnedRecurring(s.recurringRepository, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.recurringRepository.DeleteRecurringTransaction(id)
+}
+
+// GetUpcoming returns the dates of the user's schedules that have not been
+// posted yet, up to days from today, in date order. Skipped dates are
+// included so that they can be restored.
+func (s *RecurringService) GetUpcoming(userID int, days int) ([]models.RecurringOccurrence, error) {
+	templates, err := s.recurringRepository.GetRecurringTransactionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	to := dateOnly(time.Now()).AddDate(0, 0, days)
+	upcoming := []models.RecurringOccurrence{}
+	for _, template := range templates {
+		occurrences, err := s.occurrences(s.recurringRepository, template, to)
+		if err != nil {
+			return nil, err
+		}
+		upcoming = append(upcoming, occurrences...)
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].Date.Before(upcoming[j].Date)
+	})
+
+	return upcoming, nil
+}
+
+// SkipOccurrence keeps one upcoming date from being posted.
+func (s *RecurringService) SkipOccurrence(userID int, id int, date time.Time) error {
+	return s.changeOccurrence(userID, id, date, func(tx *sql.Tx, template models.RecurringTransaction, occurrence models.RecurringOccurrence) error {
+		occurrence.Status = models.OccurrenceSkipped
+		return s.recurringRepository.WithTx(tx).SaveOccurrence(occurrence)
+	})
+}
+
+// EditOccurrence changes the amount and memo one upcoming date is posted
+// with. The amount is in the currency of the template's account.
+func (s *RecurringService) EditOccurrence(userID int, id int, date time.Time, amount money.Money, memo string) error {
+	memo = strings.TrimSpace(memo)
+	if len(memo) > maxMemoLength {
+		return fmt.Errorf("%w: memo is longer than %d characters", ErrInvalidRecurring, maxMemoLength)
+	}
+
+	return s.changeOccurrence(userID, id, date, func(tx *sql.Tx, template models.RecurringTransaction, occurrence models.RecurringOccurrence) error {
+		if amount.Currency() != occurrence.Amount.Currency() {
+			return fmt.Errorf("%w: %s amount for a %s recurring transaction", money.ErrCurrencyMismatch, amount.Currency(), occurrence.Amount.Currency())
+		}
+		if amount.IsZero() {
+			return fmt.Errorf("%w: amount must not be zero", ErrInvalidRecurring)
+		}
+		category, err := getOwnedCategory(s.categoryRepository.WithTx(tx), userID, template.CategoryID)
+		if err != nil {
+			return err
+		}
+		err = checkCategoryKind(amount, category)
+		if err != nil {
+			return err
+		}
+
+		occurrence.Status = models.OccurrenceScheduled
+		occurrence.Amount = amount
+		occurrence.Memo = memo
+		occurrence.Edited = true
+		return s.recurringRepository.WithTx(tx).SaveOccurrence(occurrence)
+	})
+}
+
+// ResetOccurrence undoes skipping or editing an upcoming date.
+func (s *RecurringService) ResetOccurrence(userID int, id int, date time.Time) error {
+	return s.changeOccurrence(userID, id, date, func(tx *sql.Tx, template models.RecurringTransaction, occurrence models.RecurringOccurrence) error {
+		return s.recurringRepository.WithTx(tx).DeleteOccurrence(id, occurrence.Date)
+	})
+}
+
+// changeOccurrence runs change on an upcoming date of the user's template,
+// with the template locked against the scheduler.
+func (s *RecurringService) changeOccurrence(userID int, id int, date time.Time, change func(tx *sql.Tx, template models.RecurringTransaction, occurrence models.RecurringOccurrence) error) error {
+	date = dateOnly(date)
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		templates := s.recurringRepository.WithTx(tx)
+
+		template, err := templates.LockRecurringTransaction(id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrRecurringNotFound
+			}
+			return err
+		}
+		if template.UserID != userID {
+			return ErrRecurringNotFound
+		}
+
+		rule, err := ParseRecurrence(template.Rule)
+		if err != nil {
+			return err
+		}
+		if !rule.Includes(template.StartDate, date) {
+			return ErrOccurrenceNotFound
+		}
+		if template.NextDate == nil || date.Before(dateOnly(*template.NextDate)) {
+			return ErrOccurrenceIsHistory
+		}
+
+		occurrences, err := s.occurrences(templates, template, date)
+		if err != nil {
+			return err
+		}
+		for _, occurrence := range occurrences {
+			if occurrence.Date.Equal(date) {
+				return change(tx, template, occurrence)
+			}
+		}
+		return ErrOccurrenceNotFound
+	})
+}
+
+// PostDue posts every date of every user's schedules that has come by now,
+// including dates missed while the server was down. Each template is posted
+// in a database transaction of its own, and a date is never posted twice,
+// even by several servers at once. It returns the number of entries posted.
+func (s *RecurringService) PostDue(now time.Time) (int, error) {
+	today := dateOnly(now)
+
+	due, err := s.recurringRepository.GetDueRecurringTransactions(today)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var errs []error
+	for _, template := range due {
+		posted, err := s.postRecurring(template.ID, today)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recurring transaction %d: %w", template.ID, err))
+			continue
+		}
+		total += posted
+	}
+
+	return total, errors.Join(errs...)
+}
+
+func (s *RecurringService) postRecurring(id int, today time.Time) (int, error) {
+	var posted int
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		posted = 0
+		templates := s.recurringRepository.WithTx(tx)
+		ledger := s.transactionService.ledger(tx)
+
+		template, err := templates.LockRecurringTransaction(id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Another server may have posted it in the meantime
+		if template.NextDate == nil || template.NextDate.After(today) {
+			return nil
+		}
+
+		rule, err := ParseRecurrence(template.Rule)
+		if err != nil {
+			return err
+		}
+
+		occurrences, err := s.occurrences(templates, template, today)
+		if err != nil {
+			return err
+		}
+		for _, occurrence := range occurrences {
+			if occurrence.Status != models.OccurrenceScheduled {
+				continue
+			}
+
+			created, _, err := postTransaction(ledger, models.Transaction{
+				UserID:     template.UserID,
+				AccountID:  template.AccountID,
+				CategoryID: &template.CategoryID,
+				PayeeName:  template.PayeeName,
+				Amount:     occurrence.Amount,
+				Date:       occurrence.Date,
+				Memo:       occurrence.Memo,
+				Tags:       []string{},
+			})
+			if err != nil {
+				return err
+			}
+
+			occurrence.Status = models.OccurrencePosted
+			occurrence.TransactionID = &created.ID
+			err = templates.SaveOccurrence(occurrence)
+			if err != nil {
+				return err
+			}
+			posted++
+		}
+
+		template.NextDate = firstUnposted(rule, template.StartDate, today.AddDate(0, 0, 1))
+		template.UpdatedAt = time.Now()
+		return templates.UpdateRecurringTransaction(id, template)
+	})
+	return posted, err
+}
+
+// RunScheduler posts due entries right away, catching up on any missed while
+// the server was down, and then every interval until ctx is done.
+func (s *RecurringService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		posted, err := s.PostDue(time.Now())
+		if err != nil {
+			log.Println("posting recurring transactions:", err)
+		}
+		if posted > 0 {
+			log.Printf("posted %d recurring transactions", posted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// occurrences returns the template's dates from its next date to to, with
+// any skips and edits applied.
+func (s *RecurringService) occurrences(templates repositories.RecurringRepository, template models.RecurringTransaction, to time.Time) ([]models.RecurringOccurrence, error) {
+	if template.NextDate == nil {
+		return nil, nil
+	}
+	from := dateOnly(*template.NextDate)
+
+	rule, err := ParseRecurrence(template.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := templates.GetOccurrences(template.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	byDate := map[string]models.RecurringOccurrence{}
+	for _, occurrence := range stored {
+		byDate[occurrence.Date.Format("2006-01-02")] = occurrence
+	}
+
+	occurrences := []models.RecurringOccurrence{}
+	for _, date := range rule.Between(template.StartDate, from, to) {
+		occurrence := models.RecurringOccurrence{
+			RecurringID:  template.ID,
+			Date:         date,
+			Status:       models.OccurrenceScheduled,
+			Amount:       template.Amount,
+			Memo:         template.Memo,
+			AccountName:  template.AccountName,
+			CategoryName: template.CategoryName,
+			PayeeName:    template.PayeeName,
+		}
+		if saved, ok := byDate[date.Format("2006-01-02")]; ok {
+			occurrence.Status = saved.Status
+			occurrence.TransactionID = saved.TransactionID
+			if saved.Edited {
+				occurrence.Amount = saved.Amount
+				occurrence.Memo = saved.Memo
+				occurrence.Edited = true
+			}
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, nil
+}
+
+// normalizeRecurring validates a template before it is stored and returns
+// its parsed schedule.
+func (s *RecurringService) normalizeRecurring(recurring *models.RecurringTransaction) (Recurrence, error) {
+	account, err := getOwnedAccount(s.accountRepository, recurring.UserID, recurring.AccountID)
+	if err != nil {
+		return Recurrence{}, err
+	}
+
+	category, err := getOwnedCategory(s.categoryRepository, recurring.UserID, recurring.CategoryID)
+	if err != nil {
+		return Recurrence{}, err
+	}
+	recurring.CategoryName = category.Name
+
+	err = checkCurrency(recurring.Amount, account)
+	if err != nil {
+		return Recurrence{}, err
+	}
+	err = checkCategoryKind(recurring.Amount, category)
+	if err != nil {
+		return Recurrence{}, err
+	}
+	if recurring.Amount.IsZero() {
+		return Recurrence{}, fmt.Errorf("%w: amount must not be zero", ErrInvalidRecurring)
+	}
+
+	rule, err := ParseRecurrence(recurring.Rule)
+	if err != nil {
+		return Recurrence{}, err
+	}
+	recurring.Rule = rule.Rule
+
+	if recurring.StartDate.IsZero() {
+		recurring.StartDate = time.Now()
+	}
+	recurring.StartDate = dateOnly(recurring.StartDate)
+
+	recurring.PayeeName = strings.TrimSpace(recurring.PayeeName)
+	recurring.Memo = strings.TrimSpace(recurring.Memo)
+	if len(recurring.Memo) > maxMemoLength {
+		return Recurrence{}, fmt.Errorf("%w: memo is longer than %d characters", ErrInvalidRecurring, maxMemoLength)
+	}
+
+	return rule, nil
+}
+
+// firstUnposted returns the first date of a schedule on or after from, or
+// nil if it has ended.
+func firstUnposted(rule Recurrence, start time.Time, from time.Time) *time.Time {
+	next, ok := rule.Next(start, from)
+	if !ok {
+		return nil
+	}
+	return &next
+}
+
+func getOwnedRecurring(recurringRepository repositories.RecurringRepository, userID int, id int) (models.RecurringTransaction, error) {
+	recurring, err := recurringRepository.GetRecurringTransaction(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.RecurringTransaction{}, ErrRecurringNotFound
+		}
+		return models.RecurringTransaction{}, err
+	}
+
+	if recurring.UserID != userID {
+		return models.RecurringTransaction{}, ErrRecurringNotFound
+	}
+
+	return recurring, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+func TestRecurrence(t *testing.T) {
+	date := func(value string) time.Time {
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		rule  string
+		start string
+		want  []string
+	}{
+		{"FREQ=MONTHLY;BYMONTHDAY=25", "2024-01-10", []string{"2024-01-25", "2024-02-25", "2024-03-25"}},
+		{"FREQ=MONTHLY", "2024-01-31", []string{"2024-01-31", "2024-03-31", "2024-05-31"}},
+		{"FREQ=WEEKLY;INTERVAL=2", "2024-01-05", []string{"2024-01-05", "2024-01-19", "2024-02-02"}},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "2024-01-01", []string{"2024-01-31", "2024-02-29", "2024-03-29"}},
+		{"RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1;COUNT=2", "2023-01-01", []string{"2023-02-28", "2024-02-29"}},
+	}
+	for _, test := range tests {
+		rule, err := ParseRecurrence(test.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", test.rule, err)
+		}
+
+		got := rule.Between(date(test.start), date(test.start), date(test.start).AddDate(2, 0, 0))
+		if len(got) > len(test.want) {
+			got = got[:len(test.want)]
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: got %d dates, want %d", test.rule, len(got), len(test.want))
+		}
+		for i := range got {
+			if got[i].Format("2006-01-02") != test.want[i] {
+				t.Fatalf("%s: date %d = %s, want %s", test.rule, i, got[i].Format("2006-01-02"), test.want[i])
+			}
+		}
+	}
+
+	for _, rule := range []string{"", "FREQ=HOURLY", "FREQ=WEEKLY;BYDAY=1MO", "FREQ=DAILY;COUNT=2;UNTIL=20240101"} {
+		_, err := ParseRecurrence(rule)
+		if err == nil {
+			t.Fatalf("%q was accepted", rule)
+		}
+	}
+}
+
+func TestPostRecurringTransactions(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptions, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Subscriptions", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := dateOnly(time.Now())
+	recurring, err := s.recurringService.CreateRecurringTransaction(models.RecurringTransaction{
+		UserID:     userID,
+		AccountID:  account.ID,
+		CategoryID: subscriptions.ID,
+		PayeeName:  "Streaming",
+		Amount:     money.New(-1000, "JPY"),
+		Rule:       "FREQ=WEEKLY",
+		StartDate:  today,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.recurringService.SkipOccurrence(userID, recurring.ID, today.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.recurringService.EditOccurrence(userID, recurring.ID, today.AddDate(0, 0, 14), money.New(-1500, "JPY"), "price rise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.recurringService.EditOccurrence(userID, recurring.ID, today.AddDate(0, 0, 21), money.New(1500, "JPY"), "refund")
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("positive amount for an expense: err = %v, want %v", err, ErrInvalidTransaction)
+	}
+	err = s.recurringService.SkipOccurrence(userID, recurring.ID, today.AddDate(0, 0, 1))
+	if err == nil {
+		t.Fatal("skipping a date outside the schedule was accepted")
+	}
+
+	// Three weeks of downtime are caught up on in one run, and running again
+	// posts nothing
+	posted, err := s.recurringService.PostDue(today.AddDate(0, 0, 21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 3 {
+		t.Fatalf("posted %d entries, want 3", posted)
+	}
+	posted, err = s.recurringService.PostDue(today.AddDate(0, 0, 21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 0 {
+		t.Fatalf("posted %d entries again, want 0", posted)
+	}
+
+	balance, err := s.transactionService.GetCurrentBalance(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(-3500, "JPY"); balance != want {
+		t.Fatalf("balance = %s, want %s", balance, want)
+	}
+
+	recurring, err = s.recurringService.GetRecurringTransaction(userID, recurring.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := today.AddDate(0, 0, 28); recurring.NextDate == nil || !recurring.NextDate.Equal(want) {
+		t.Fatalf("next date = %v, want %s", recurring.NextDate, want)
+	}
+	err = s.recurringService.SkipOccurrence(userID, recurring.ID, today.AddDate(0, 0, 14))
+	if err == nil {
+		t.Fatal("skipping a posted date was accepted")
+	}
+}
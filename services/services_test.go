@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"balance-tracker/migrations"
+	"balance-tracker/models"
+	"balance-tracker/repositories"
+	"balance-tracker/utils"
+)
+
+// openTestDB returns an in-memory database, a migrated SQLite file if
+// TEST_DB_BACKEND is "sqlite", or the Postgres database named by
+// TEST_DATABASE_URL if it is set.
+func openTestDB(t *testing.T) *repositories.DB {
+	t.Helper()
+
+	backend, dsn := "memory", ""
+	if os.Getenv("TEST_DB_BACKEND") == "sqlite" {
+		backend, dsn = "sqlite", filepath.Join(t.TempDir(), "test.db")
+	}
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		backend, dsn = "postgres", url
+	}
+
+	return openMigratedDB(t, backend, dsn)
+}
+
+// openConcurrentTestDB is like openTestDB, but instead of the in-memory
+// store, which runs one transaction at a time, it falls back to a SQLite file
+// that several connections write to at once.
+func openConcurrentTestDB(t *testing.T) *repositories.DB {
+	t.Helper()
+
+	backend, dsn := "sqlite", filepath.Join(t.TempDir(), "test.db")
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		backend, dsn = "postgres", url
+	}
+
+	return openMigratedDB(t, backend, dsn)
+}
+
+func openMigratedDB(t *testing.T, backend string, dsn string) *repositories.DB {
+	t.Helper()
+
+	db, err := repositories.Open(backend, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// createTestUser registers a user that is removed, with all of their data,
+// when the test ends.
+func createTestUser(t *testing.T, db *repositories.DB) models.User {
+	t.Helper()
+
+	userRepository := repositories.NewUserRepository(db)
+	username := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	err := userRepository.CreateUser(models.User{Username: username, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := userRepository.GetUserByUsername(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userRepository.DeleteUser(user.ID) })
+
+	return user
+}
+
+// testServices holds the repositories and services of one test database,
+// wired together the way main does it.
+type testServices struct {
+	db *repositories.DB
+
+	userRepository          repositories.UserRepository
+	sessionRepository       repositories.SessionRepository
+	accountRepository       repositories.AccountRepository
+	transactionRepository   repositories.TransactionRepository
+	balanceRepository       repositories.BalanceRepository
+	categoryRepository      repositories.CategoryRepository
+	tagRepository           repositories.TagRepository
+	payeeRepository         repositories.PayeeRepository
+	transferRepository      repositories.TransferRepository
+	recurringRepository     repositories.RecurringRepository
+	budgetRepository        repositories.BudgetRepository
+	envelopeRepository      repositories.EnvelopeRepository
+	goalRepository          repositories.GoalRepository
+	importProfileRepository repositories.ImportProfileRepository
+	exchangeRateRepository  repositories.ExchangeRateRepository
+	txRunner                *repositories.TxRunner
+	tokenIssuer             *utils.TokenIssuer
+
+	authService         *AuthService
+	balanceService      *BalanceService
+	accountService      *AccountService
+	transactionService  *TransactionService
+	categoryService     *CategoryService
+	payeeService        *PayeeService
+	exchangeRateService *ExchangeRateService
+	recurringService    *RecurringService
+	budgetService       *BudgetService
+	envelopeService     *EnvelopeService
+	goalService         *GoalService
+	importService       *ImportService
+	backupService       *BackupService
+	journalService      *JournalService
+}
+
+// newTestServices opens a test database and builds every service on it.
+func newTestServices(t *testing.T) *testServices {
+	t.Helper()
+	return newTestServicesOn(t, openTestDB(t))
+}
+
+// newTestServicesOn builds every service on the given database.
+func newTestServicesOn(t *testing.T, db *repositories.DB) *testServices {
+	t.Helper()
+
+	tokenIssuer, err := utils.NewTokenIssuer(map[string][]byte{"test": []byte("a-test-signing-key-of-32-bytes!!")}, "test", time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServices{
+		db:                      db,
+		userRepository:          repositories.NewUserRepository(db),
+		sessionRepository:       repositories.NewSessionRepository(db),
+		accountRepository:       repositories.NewAccountRepository(db),
+		transactionRepository:   repositories.NewTransactionRepository(db),
+		balanceRepository:       repositories.NewBalanceRepository(db),
+		categoryRepository:      repositories.NewCategoryRepository(db),
+		tagRepository:           repositories.NewTagRepository(db),
+		payeeRepository:         repositories.NewPayeeRepository(db),
+		transferRepository:      repositories.NewTransferRepository(db),
+		recurringRepository:     repositories.NewRecurringRepository(db),
+		budgetRepository:        repositories.NewBudgetRepository(db),
+		envelopeRepository:      repositories.NewEnvelopeRepository(db),
+		goalRepository:          repositories.NewGoalRepository(db),
+		importProfileRepository: repositories.NewImportProfileRepository(db),
+		exchangeRateRepository:  repositories.NewExchangeRateRepository(db),
+		txRunner:                repositories.NewTxRunner(db),
+		tokenIssuer:             tokenIssuer,
+	}
+
+	s.authService = NewAuthService(s.userRepository, s.sessionRepository, s.tokenIssuer)
+	s.balanceService = NewBalanceService(s.balanceRepository, s.accountRepository, s.userRepository, s.exchangeRateRepository)
+	s.accountService = NewAccountService(s.accountRepository, s.transactionRepository, s.balanceRepository, s.txRunner)
+	s.transactionService = NewTransactionService(s.transactionRepository, s.balanceRepository, s.accountRepository, s.categoryRepository, s.payeeRepository, s.transferRepository, s.txRunner)
+	s.categoryService = NewCategoryService(s.categoryRepository, s.transactionRepository)
+	s.payeeService = NewPayeeService(s.payeeRepository, s.transactionRepository, s.categoryRepository, s.txRunner)
+	s.exchangeRateService = NewExchangeRateService(s.exchangeRateRepository, s.txRunner)
+	s.recurringService = NewRecurringService(s.recurringRepository, s.accountRepository, s.categoryRepository, s.transactionService, s.txRunner)
+	s.budgetService = NewBudgetService(s.budgetRepository, s.userRepository, s.exchangeRateRepository, s.categoryService, s.txRunner)
+	s.envelopeService = NewEnvelopeService(s.envelopeRepository, s.userRepository, s.accountRepository, s.transactionRepository, s.exchangeRateRepository, s.categoryService, s.txRunner)
+	s.goalService = NewGoalService(s.goalRepository, s.accountRepository, s.transactionRepository, s.exchangeRateRepository, s.categoryService)
+	s.importService = NewImportService(s.importProfileRepository, s.transactionService)
+	s.backupService = NewBackupService(s.userRepository, s.accountRepository, s.categoryRepository, s.tagRepository, s.payeeRepository, s.transactionRepository, s.transferRepository, s.recurringRepository, s.budgetRepository, s.envelopeRepository, s.goalRepository, s.importProfileRepository, s.balanceRepository, s.txRunner)
+	s.journalService = NewJournalService(s.userRepository, s.exchangeRateRepository, s.backupService, s.txRunner)
+
+	s.authService.OnRegister(s.accountService.CreateDefaultAccount)
+	s.authService.OnRegister(s.categoryService.CreateDefaultCategories)
+
+	return s
+}
+
+// createUser registers a test user, see createTestUser.
+func (s *testServices) createUser(t *testing.T) models.User {
+	t.Helper()
+	return createTestUser(t, s.db)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"balance-tracker/models"
+	"balance-tracker/repositories"
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+const maxTagLength = 50
+
+type TagService struct {
+	tagRepository repositories.TagRepository
+}
+
+func NewTagService(tagRepository repositories.TagRepository) *TagService {
+	return &TagService{tagRepository: tagRepository}
+}
+
+func (s *TagService) GetTags(userID int) ([]models.Tag, error) {
+	return s.tagRepository.GetTagsByUserID(userID)
+}
+
+// SuggestTags returns up to limit of the user's tags starting with prefix,
+// the most used first.
+func (s *TagService) SuggestTags(userID int, prefix string, limit int) ([]models.Tag, error) {
+	tags, err := s.tagRepository.GetTagsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(prefix), "#"))
+	suggestions := []models.Tag{}
+	for _, tag := range tags {
+		if len(suggestions) == limit {
+			break
+		}
+		if strings.HasPrefix(tag.Name, prefix) {
+			suggestions = append(suggestions, tag)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// ParseTags splits user input like "#trip-kyoto, reimbursable" into
+// normalized tag names.
+func ParseTags(value string) ([]string, error) {
+	return NormalizeTags(SplitTags(value))
+}
+
+// SplitTags splits user input at commas and whitespace without validating
+// the names.
+func SplitTags(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// NormalizeTags lowercases tag names, strips a leading '#' and removes
+// duplicates. Names may contain letters, digits, '-', '_' and '/'.
+func NormalizeTags(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidTag, name, maxTagLength)
+		}
+		for _, r := range name {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '/' {
+				return nil, fmt.Errorf("%w: %s may only contain letters, digits, '-', '_' and '/'", ErrInvalidTag, name)
+			}
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	sort.Strings(tags)
+
+	return tags, nil
+}
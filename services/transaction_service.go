@@ -0,0 +1,986 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+var (
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidTransaction  = errors.New("invalid transaction")
+)
+
+const maxMemoLength = 1000
+
+// The number of entries on a page of a transaction listing, unless asked
+// otherwise, and the most a page may hold.
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 200
+)
+
+type TransactionService struct {
+	transactionRepository repositories.TransactionRepository
+	balanceRepository     repositories.BalanceRepository
+	accountRepository     repositories.AccountRepository
+	categoryRepository    repositories.CategoryRepository
+	payeeRepository       repositories.PayeeRepository
+	transferRepository    repositories.TransferRepository
+	txRunner              repositories.TxRunner
+}
+
+func NewTransactionService(transactionRepository repositories.TransactionRepository, balanceRepository repositories.BalanceRepository, accountRepository repositories.AccountRepository, categoryRepository repositories.CategoryRepository, payeeRepository repositories.PayeeRepository, transferRepository repositories.TransferRepository, txRunner *repositories.TxRunner) *TransactionService {
+	return &TransactionService{
+		transactionRepository: transactionRepository,
+		balanceRepository:     balanceRepository,
+		accountRepository:     accountRepository,
+		categoryRepository:    categoryRepository,
+		payeeRepository:       payeeRepository,
+		transferRepository:    transferRepository,
+		txRunner:              *txRunner,
+	}
+}
+
+// ledgerTx bundles the repositories needed to change the ledger, all bound to
+// the same database transaction.
+type ledgerTx struct {
+	transactions repositories.TransactionRepository
+	balances     repositories.BalanceRepository
+	accounts     repositories.AccountRepository
+	categories   repositories.CategoryRepository
+	payees       repositories.PayeeRepository
+	transfers    repositories.TransferRepository
+}
+
+// inLedgerTx runs fn in a database transaction. Every ledger write goes
+// through here so that reading the current balance and writing the new one
+// cannot interleave with another request.
+func (s *TransactionService) inLedgerTx(fn func(l ledgerTx) error) error {
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		return fn(s.ledger(tx))
+	})
+}
+
+// ledger binds the ledger's repositories to tx, for callers that write to
+// the ledger as part of a larger database transaction.
+func (s *TransactionService) ledger(tx *sql.Tx) ledgerTx {
+	return ledgerTx{
+		transactions: s.transactionRepository.WithTx(tx),
+		balances:     s.balanceRepository.WithTx(tx),
+		accounts:     s.accountRepository.WithTx(tx),
+		categories:   s.categoryRepository.WithTx(tx),
+		payees:       s.payeeRepository.WithTx(tx),
+		transfers:    s.transferRepository.WithTx(tx),
+	}
+}
+
+func (s *TransactionService) GetTransactionsByUserID(userID int, filter models.TransactionFilter) ([]models.Transaction, error) {
+	filter, err := normalizeTransactionFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.transactionRepository.GetTransactionsByUserID(userID, filter)
+	return transactions, err
+}
+
+// ListTransactions returns one page of the user's transactions. The listing
+// is newest first unless the query sorts it otherwise, and pages hold 50
+// entries unless the query asks for up to 200.
+func (s *TransactionService) ListTransactions(userID int, query models.TransactionQuery) (models.TransactionPage, error) {
+	filter, err := normalizeTransactionFilter(query.Filter)
+	if err != nil {
+		return models.TransactionPage{}, err
+	}
+
+	if query.Sort == "" {
+		query.Sort = models.TransactionSortDateDesc
+	}
+	if !query.Sort.Valid() {
+		return models.TransactionPage{}, fmt.Errorf("%w: unknown sort %q", ErrInvalidTransaction, query.Sort)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultTransactionPageSize
+	}
+	limit = min(limit, maxTransactionPageSize)
+
+	var after *models.TransactionCursor
+	if query.Cursor != "" {
+		cursor, err := decodeTransactionCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return models.TransactionPage{}, err
+		}
+		after = &cursor
+	}
+
+	// One entry more than the page holds tells whether another page follows
+	transactions, err := s.transactionRepository.GetTransactionsPage(userID, filter, query.Sort, after, limit+1)
+	if err != nil {
+		return models.TransactionPage{}, err
+	}
+
+	page := models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeTransactionCursor(transactions[limit-1], query.Sort)
+	}
+
+	return page, nil
+}
+
+// GetTransaction returns the transaction only if it belongs to the user.
+func (s *TransactionService) GetTransaction(userID int, id int) (models.Transaction, error) {
+	return getOwnedTransaction(s.transactionRepository, userID, id)
+}
+
+// CreateTransaction records a ledger entry and returns it together with the
+// recalculated balance of its account. The payee may be given by PayeeID or
+// by PayeeName, which is resolved through the payee's aliases or creates a
+// new payee, and the payee's default category is used if no category is
+// given. A split transaction gives its categories on its split lines
+// instead.
+func (s *TransactionService) CreateTransaction(transaction models.Transaction) (models.Transaction, models.Balance, error) {
+	if transaction.Date.IsZero() {
+		transaction.Date = time.Now()
+	}
+
+	var category models.Category
+	var err error
+	if len(transaction.Splits) > 0 {
+		err = normalizeSplits(s.categoryRepository, transaction.UserID, &transaction)
+		if err != nil {
+			return models.Transaction{}, models.Balance{}, err
+		}
+	} else {
+		switch {
+		case transaction.CategoryID != nil:
+		case transaction.PayeeID != nil:
+			payee, err := getOwnedPayee(s.payeeRepository, transaction.UserID, *transaction.PayeeID)
+			if err != nil {
+				return models.Transaction{}, models.Balance{}, err
+			}
+			transaction.CategoryID = payee.DefaultCategoryID
+		case PayeeKey(transaction.PayeeName) != "":
+			payee, err := s.payeeRepository.GetPayeeByAliasKey(transaction.UserID, PayeeKey(transaction.PayeeName))
+			if err != nil && err != sql.ErrNoRows {
+				return models.Transaction{}, models.Balance{}, err
+			}
+			transaction.CategoryID = payee.DefaultCategoryID
+		}
+
+		if transaction.CategoryID == nil {
+			return models.Transaction{}, models.Balance{}, fmt.Errorf("%w: a category is required", ErrInvalidCategory)
+		}
+		category, err = getOwnedCategory(s.categoryRepository, transaction.UserID, *transaction.CategoryID)
+		if err != nil {
+			return models.Transaction{}, models.Balance{}, err
+		}
+		err = checkCategoryKind(transaction.Amount, category)
+		if err != nil {
+			return models.Transaction{}, models.Balance{}, err
+		}
+	}
+
+	err = normalizeDescription(&transaction)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	var created models.Transaction
+	var balance models.Balance
+	err = s.inLedgerTx(func(l ledgerTx) error {
+		created, balance, err = postTransaction(l, transaction)
+		return err
+	})
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+	created.CategoryName = category.Name
+
+	return created, balance, nil
+}
+
+// postTransaction writes a checked ledger entry with its payee, tags and
+// split lines, and recalculates its account's balance.
+func postTransaction(l ledgerTx, transaction models.Transaction) (models.Transaction, models.Balance, error) {
+	account, err := lockOwnedAccount(l.accounts, transaction.UserID, transaction.AccountID)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	err = checkCurrency(transaction.Amount, account)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	err = setPayee(l.payees, &transaction, transaction.UserID)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	created, err := l.transactions.CreateTransaction(transaction)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+	err = l.transactions.SetTransactionTags(created.UserID, created.ID, created.Tags)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+	err = l.transactions.SetTransactionSplits(created.ID, created.Splits)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+	if created.Tags == nil {
+		created.Tags = []string{}
+	}
+	if created.Splits == nil {
+		created.Splits = []models.Split{}
+	}
+	created.AccountName = account.Name
+
+	balance, err := recalculateBalance(l.transactions, l.balances, account)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	return created, balance, nil
+}
+
+// importTransactions books a batch of categorized entries into an account
+// locked in the same database transaction, so that either all of them are
+// booked or none are, and returns how many were. Entries whose import id the
+// account already has are skipped. The account's balance is recalculated
+// once, after the last.
+func importTransactions(l ledgerTx, account models.Account, transactions []models.Transaction) (int, error) {
+	categories, imported := map[int]models.Category{}, 0
+	for _, transaction := range transactions {
+		transaction.UserID = account.UserID
+		transaction.AccountID = account.ID
+
+		if transaction.CategoryID == nil {
+			return 0, fmt.Errorf("%w: a category is required", ErrInvalidCategory)
+		}
+		category, ok := categories[*transaction.CategoryID]
+		if !ok {
+			var err error
+			category, err = getOwnedCategory(l.categories, account.UserID, *transaction.CategoryID)
+			if err != nil {
+				return 0, err
+			}
+			categories[*transaction.CategoryID] = category
+		}
+
+		err := checkCategoryKind(transaction.Amount, category)
+		if err != nil {
+			return 0, err
+		}
+		err = normalizeDescription(&transaction)
+		if err != nil {
+			return 0, err
+		}
+		err = checkCurrency(transaction.Amount, account)
+		if err != nil {
+			return 0, err
+		}
+		err = setPayee(l.payees, &transaction, account.UserID)
+		if err != nil {
+			return 0, err
+		}
+		_, created, err := l.transactions.CreateImportedTransaction(transaction)
+		if err != nil {
+			return 0, err
+		}
+		if created {
+			imported++
+		}
+	}
+
+	_, err := recalculateBalance(l.transactions, l.balances, account)
+	if err != nil {
+		return 0, err
+	}
+
+	return imported, nil
+}
+
+// UpdateTransaction edits a ledger entry. If the entry moves to another
+// account, both accounts are recalculated and the new account's balance is
+// returned. The memo and payee are always replaced, while the category and
+// tags are kept unless new ones are given. New split lines replace the
+// category, a new category replaces the split lines, and without either the
+// existing split lines are kept and must still add up. Transfer legs cannot be
+// edited.
+func (s *TransactionService) UpdateTransaction(userID int, id int, transaction models.Transaction) (models.Transaction, models.Balance, error) {
+	if len(transaction.Splits) > 0 {
+		err := normalizeSplits(s.categoryRepository, userID, &transaction)
+		if err != nil {
+			return models.Transaction{}, models.Balance{}, err
+		}
+	}
+
+	var category *models.Category
+	if transaction.CategoryID != nil {
+		owned, err := getOwnedCategory(s.categoryRepository, userID, *transaction.CategoryID)
+		if err != nil {
+			return models.Transaction{}, models.Balance{}, err
+		}
+		category = &owned
+	}
+
+	keepTags := transaction.Tags == nil
+	err := normalizeDescription(&transaction)
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	var updated models.Transaction
+	var balance models.Balance
+	err = s.inLedgerTx(func(l ledgerTx) error {
+		existing, err := getOwnedTransaction(l.transactions, userID, id)
+		if err != nil {
+			return err
+		}
+		if existing.TransferID != nil {
+			return fmt.Errorf("%w: a transfer cannot be edited, delete it and enter it again", ErrInvalidTransaction)
+		}
+
+		accountID := existing.AccountID
+		if transaction.AccountID != 0 {
+			accountID = transaction.AccountID
+		}
+
+		locked, err := lockOwnedAccounts(l.accounts, userID, existing.AccountID, accountID)
+		if err != nil {
+			return err
+		}
+		account := locked[accountID]
+
+		err = checkCurrency(transaction.Amount, account)
+		if err != nil {
+			return err
+		}
+
+		existing.AccountID = account.ID
+		existing.AccountName = account.Name
+		booked := category
+		switch {
+		case len(transaction.Splits) > 0:
+			existing.CategoryID = nil
+			existing.CategoryName = ""
+			existing.Splits = transaction.Splits
+		case category != nil:
+			existing.CategoryID = &category.ID
+			existing.CategoryName = category.Name
+			existing.Splits = []models.Split{}
+		case len(existing.Splits) > 0:
+			err = checkSplitTotal(transaction.Amount, existing.Splits)
+			if err != nil {
+				return err
+			}
+		case existing.CategoryID != nil:
+			kept, err := getOwnedCategory(l.categories, userID, *existing.CategoryID)
+			if err != nil {
+				return err
+			}
+			booked = &kept
+		}
+		if booked != nil {
+			err = checkCategoryKind(transaction.Amount, *booked)
+			if err != nil {
+				return err
+			}
+		}
+		existing.Amount = transaction.Amount
+		if !transaction.Date.IsZero() {
+			existing.Date = transaction.Date
+		}
+		existing.Memo = transaction.Memo
+		transaction.CategoryID = existing.CategoryID
+		err = setPayee(l.payees, &transaction, userID)
+		if err != nil {
+			return err
+		}
+		existing.PayeeID = transaction.PayeeID
+		existing.PayeeName = transaction.PayeeName
+		existing.UpdatedAt = time.Now()
+
+		err = l.transactions.UpdateTransaction(id, existing)
+		if err != nil {
+			return err
+		}
+		err = l.transactions.SetTransactionSplits(id, existing.Splits)
+		if err != nil {
+			return err
+		}
+		if !keepTags {
+			existing.Tags = transaction.Tags
+			err = l.transactions.SetTransactionTags(userID, id, existing.Tags)
+			if err != nil {
+				return err
+			}
+		}
+		updated = existing
+
+		for _, lockedAccount := range locked {
+			if lockedAccount.ID == account.ID {
+				continue
+			}
+			_, err = recalculateBalance(l.transactions, l.balances, lockedAccount)
+			if err != nil {
+				return err
+			}
+		}
+
+		balance, err = recalculateBalance(l.transactions, l.balances, account)
+		return err
+	})
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	return updated, balance, nil
+}
+
+// DeleteTransaction removes a ledger entry and returns the recalculated
+// balance of its account. Deleting either leg of a transfer deletes the whole
+// transfer.
+func (s *TransactionService) DeleteTransaction(userID int, id int) (models.Balance, error) {
+	var balance models.Balance
+	err := s.inLedgerTx(func(l ledgerTx) error {
+		transaction, err := getOwnedTransaction(l.transactions, userID, id)
+		if err != nil {
+			return err
+		}
+
+		legs := []models.Transaction{transaction}
+		if transaction.TransferID != nil {
+			legs, err = l.transactions.GetTransactionsByTransferID(*transaction.TransferID)
+			if err != nil {
+				return err
+			}
+		}
+
+		accountIDs := make([]int, len(legs))
+		for i, leg := range legs {
+			accountIDs[i] = leg.AccountID
+		}
+		locked, err := lockOwnedAccounts(l.accounts, userID, accountIDs...)
+		if err != nil {
+			return err
+		}
+
+		for _, leg := range legs {
+			err = l.transactions.DeleteTransaction(leg.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if transaction.TransferID != nil {
+			err = l.transfers.DeleteTransfer(*transaction.TransferID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, leg := range legs {
+			recalculated, err := recalculateBalance(l.transactions, l.balances, locked[leg.AccountID])
+			if err != nil {
+				return err
+			}
+			if leg.ID == id {
+				balance = recalculated
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Balance{}, err
+	}
+
+	return balance, nil
+}
+
+// CreateTransfer moves money between two of the user's accounts. Amount is
+// taken out of the source account and its value at Rate, the number of
+// destination units per source unit, is put into the destination account.
+// The rate is required between accounts in different currencies and is 1
+// otherwise. Both entries are written in one database transaction. The
+// outgoing entry is returned, with the incoming one as its Transfer.
+func (s *TransactionService) CreateTransfer(transfer models.Transfer) (models.Transaction, error) {
+	if transfer.FromAccountID == transfer.ToAccountID {
+		return models.Transaction{}, fmt.Errorf("%w: a transfer needs two different accounts", ErrInvalidTransaction)
+	}
+	if !transfer.Amount.IsPositive() {
+		return models.Transaction{}, fmt.Errorf("%w: a transfer amount must be positive", ErrInvalidTransaction)
+	}
+	if transfer.Date.IsZero() {
+		transfer.Date = time.Now()
+	}
+
+	description := models.Transaction{Memo: transfer.Memo}
+	err := normalizeDescription(&description)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	transfer.Memo = description.Memo
+
+	var outgoing models.Transaction
+	err = s.inLedgerTx(func(l ledgerTx) error {
+		locked, err := lockOwnedAccounts(l.accounts, transfer.UserID, transfer.FromAccountID, transfer.ToAccountID)
+		if err != nil {
+			return err
+		}
+		from, to := locked[transfer.FromAccountID], locked[transfer.ToAccountID]
+
+		err = checkCurrency(transfer.Amount, from)
+		if err != nil {
+			return err
+		}
+
+		var rate *big.Rat
+		transfer.Rate, rate, err = transferRate(transfer.Rate, from.Currency, to.Currency)
+		if err != nil {
+			return err
+		}
+
+		received, err := transfer.Amount.Convert(rate, to.Currency)
+		if err != nil {
+			return err
+		}
+		if !received.IsPositive() {
+			return fmt.Errorf("%w: %s is nothing at a rate of %s", ErrInvalidTransaction, transfer.Amount, transfer.Rate)
+		}
+
+		created, err := l.transfers.CreateTransfer(transfer)
+		if err != nil {
+			return err
+		}
+
+		outgoing, err = l.transactions.CreateTransaction(models.Transaction{
+			UserID:     transfer.UserID,
+			AccountID:  from.ID,
+			Amount:     transfer.Amount.Neg(),
+			Date:       transfer.Date,
+			Memo:       transfer.Memo,
+			TransferID: &created.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		incoming, err := l.transactions.CreateTransaction(models.Transaction{
+			UserID:     transfer.UserID,
+			AccountID:  to.ID,
+			Amount:     received,
+			Date:       transfer.Date,
+			Memo:       transfer.Memo,
+			TransferID: &created.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		outgoing.AccountName = from.Name
+		outgoing.Tags = []string{}
+		outgoing.Transfer = &models.TransferLeg{
+			TransactionID: incoming.ID,
+			AccountID:     to.ID,
+			AccountName:   to.Name,
+			Amount:        received,
+			Rate:          transfer.Rate,
+		}
+
+		_, err = recalculateBalance(l.transactions, l.balances, from)
+		if err != nil {
+			return err
+		}
+		_, err = recalculateBalance(l.transactions, l.balances, to)
+		return err
+	})
+	if err != nil {
+		return models.Transaction{}, err
+	}
+
+	return outgoing, nil
+}
+
+// SetBalance records an adjustment entry, booked to the user's adjustment
+// category, so that the account adds up to the given amount. No entry is
+// written if the balance already matches.
+func (s *TransactionService) SetBalance(userID int, accountID int, amount money.Money) (models.Transaction, models.Balance, error) {
+	var adjustment models.Transaction
+	var balance models.Balance
+	err := s.inLedgerTx(func(l ledgerTx) error {
+		account, err := lockOwnedAccount(l.accounts, userID, accountID)
+		if err != nil {
+			return err
+		}
+
+		current, err := currentBalance(l.transactions, account)
+		if err != nil {
+			return err
+		}
+
+		difference, err := amount.Sub(current)
+		if err != nil {
+			return err
+		}
+
+		if !difference.IsZero() {
+			category, err := adjustmentCategory(l.categories, userID)
+			if err != nil {
+				return err
+			}
+			adjustment, err = l.transactions.CreateTransaction(models.Transaction{
+				UserID:     userID,
+				AccountID:  accountID,
+				CategoryID: &category.ID,
+				Amount:     difference,
+				Date:       time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			adjustment.AccountName = account.Name
+			adjustment.CategoryName = category.Name
+		}
+
+		balance, err = recalculateBalance(l.transactions, l.balances, account)
+		return err
+	})
+	if err != nil {
+		return models.Transaction{}, models.Balance{}, err
+	}
+
+	return adjustment, balance, nil
+}
+
+// GetCurrentBalance derives the account's balance from its opening balance
+// and the ledger.
+func (s *TransactionService) GetCurrentBalance(account models.Account) (money.Money, error) {
+	return currentBalance(s.transactionRepository, account)
+}
+
+// RecalculateBalance sums the account's ledger and stores the result as a
+// new balance snapshot.
+func (s *TransactionService) RecalculateBalance(account models.Account) (models.Balance, error) {
+	var balance models.Balance
+	err := s.inLedgerTx(func(l ledgerTx) error {
+		locked, err := l.accounts.LockAccount(account.ID)
+		if err != nil {
+			return err
+		}
+
+		balance, err = recalculateBalance(l.transactions, l.balances, locked)
+		return err
+	})
+	return balance, err
+}
+
+func getOwnedTransaction(transactionRepository repositories.TransactionRepository, userID int, id int) (models.Transaction, error) {
+	transaction, err := transactionRepository.GetTransaction(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Transaction{}, ErrTransactionNotFound
+		}
+		return models.Transaction{}, err
+	}
+
+	if transaction.UserID != userID {
+		return models.Transaction{}, ErrTransactionNotFound
+	}
+
+	return transaction, nil
+}
+
+// lockOwnedAccount locks the account's row for the rest of the transaction
+// after checking that it belongs to the user.
+func lockOwnedAccount(accountRepository repositories.AccountRepository, userID int, id int) (models.Account, error) {
+	account, err := accountRepository.LockAccount(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Account{}, ErrAccountNotFound
+		}
+		return models.Account{}, err
+	}
+
+	if account.UserID != userID {
+		return models.Account{}, ErrAccountNotFound
+	}
+
+	return account, nil
+}
+
+// lockOwnedAccounts locks several accounts in ascending id order, so that two
+// requests touching the same pair of accounts cannot deadlock.
+func lockOwnedAccounts(accountRepository repositories.AccountRepository, userID int, ids ...int) (map[int]models.Account, error) {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+
+	accounts := map[int]models.Account{}
+	for _, id := range sorted {
+		if _, ok := accounts[id]; ok {
+			continue
+		}
+
+		account, err := lockOwnedAccount(accountRepository, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		accounts[id] = account
+	}
+
+	return accounts, nil
+}
+
+func currentBalance(transactionRepository repositories.TransactionRepository, account models.Account) (money.Money, error) {
+	sum, err := transactionRepository.SumTransactionsByAccountID(account.ID)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	ledger, err := money.FromDecimal(sum, account.Currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return account.OpeningBalance.Add(ledger)
+}
+
+// recalculateBalance sums the account's ledger and stores the result as a new
+// balance snapshot. Callers hold the account's row lock.
+func recalculateBalance(transactionRepository repositories.TransactionRepository, balanceRepository repositories.BalanceRepository, account models.Account) (models.Balance, error) {
+	amount, err := currentBalance(transactionRepository, account)
+	if err != nil {
+		return models.Balance{}, err
+	}
+
+	err = balanceRepository.CreateBalance(models.Balance{
+		UserID:    account.UserID,
+		AccountID: account.ID,
+		Amount:    amount,
+	})
+	if err != nil {
+		return models.Balance{}, err
+	}
+
+	return balanceRepository.GetLastBalanceByAccountID(account.ID)
+}
+
+// checkCurrency makes sure an amount is recorded in its account's currency.
+func checkCurrency(amount money.Money, account models.Account) error {
+	if amount.Currency() != account.Currency {
+		return fmt.Errorf("%w: %s amount for %s account", money.ErrCurrencyMismatch, amount.Currency(), account.Currency)
+	}
+	return nil
+}
+
+// transferRate checks the rate of a transfer between two currencies, which
+// must be a positive decimal. Within one currency it can be left out and has
+// to be 1.
+func transferRate(rate money.Decimal, from string, to string) (money.Decimal, *big.Rat, error) {
+	rate = money.Decimal(strings.TrimSpace(string(rate)))
+	if rate == "" {
+		if from != to {
+			return "", nil, fmt.Errorf("%w: a rate is needed to transfer from %s to %s", ErrInvalidTransaction, from, to)
+		}
+		rate = "1"
+	}
+
+	r, err := rate.Rat()
+	if err != nil || r.Sign() <= 0 || strings.Contains(string(rate), "/") {
+		return "", nil, fmt.Errorf("%w: invalid rate %q", ErrInvalidTransaction, string(rate))
+	}
+	if from == to && r.Cmp(big.NewRat(1, 1)) != 0 {
+		return "", nil, fmt.Errorf("%w: a transfer within %s must have a rate of 1", ErrInvalidTransaction, from)
+	}
+
+	return rate, r, nil
+}
+
+// normalizeTransactionFilter checks the filters of a transaction listing:
+// the date range and the amount range are the right way round, and the
+// amounts are plain decimals.
+func normalizeTransactionFilter(filter models.TransactionFilter) (models.TransactionFilter, error) {
+	tags, err := NormalizeTags(filter.Tags)
+	if err != nil {
+		return models.TransactionFilter{}, err
+	}
+	filter.Tags = tags
+	filter.Text = strings.TrimSpace(filter.Text)
+
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return models.TransactionFilter{}, fmt.Errorf("%w: the date range ends before it starts", ErrInvalidTransaction)
+	}
+
+	var bounds []*big.Rat
+	for _, amount := range []*money.Decimal{filter.MinAmount, filter.MaxAmount} {
+		if amount == nil {
+			bounds = append(bounds, nil)
+			continue
+		}
+		r, err := amount.Rat()
+		if err != nil || r.Sign() < 0 || strings.Contains(string(*amount), "/") {
+			return models.TransactionFilter{}, fmt.Errorf("%w: invalid amount %q", ErrInvalidTransaction, string(*amount))
+		}
+		bounds = append(bounds, r)
+	}
+	if bounds[0] != nil && bounds[1] != nil && bounds[1].Cmp(bounds[0]) < 0 {
+		return models.TransactionFilter{}, fmt.Errorf("%w: the amount range ends below where it starts", ErrInvalidTransaction)
+	}
+
+	return filter, nil
+}
+
+// A transaction cursor is the listing's sort and the date, amount and ID of
+// the entry to continue after, encoded so that clients treat it as opaque.
+func encodeTransactionCursor(transaction models.Transaction, sort models.TransactionSort) string {
+	cursor := fmt.Sprintf("%s|%s|%s|%d", sort, transaction.Date.Format(time.RFC3339Nano), transaction.Amount.Decimal(), transaction.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeTransactionCursor(value string, sort models.TransactionSort) (models.TransactionCursor, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidTransaction)
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return models.TransactionCursor{}, invalid
+	}
+	parts := strings.Split(string(data), "|")
+	if len(parts) != 4 {
+		return models.TransactionCursor{}, invalid
+	}
+	if models.TransactionSort(parts[0]) != sort {
+		return models.TransactionCursor{}, fmt.Errorf("%w: the cursor belongs to a listing sorted by %s", ErrInvalidTransaction, parts[0])
+	}
+
+	date, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return models.TransactionCursor{}, invalid
+	}
+	amount := money.Decimal(parts[2])
+	if _, err := amount.Rat(); err != nil {
+		return models.TransactionCursor{}, invalid
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return models.TransactionCursor{}, invalid
+	}
+
+	return models.TransactionCursor{Date: date, Amount: amount, ID: id}, nil
+}
+
+// normalizeSplits checks the split lines of a transaction: there are at least
+// two, each with one of the user's categories and a non-zero amount in the
+// transaction's currency, and they add up to the transaction's amount. A
+// split transaction has no category of its own.
+func normalizeSplits(categoryRepository repositories.CategoryRepository, userID int, transaction *models.Transaction) error {
+	if len(transaction.Splits) < 2 {
+		return fmt.Errorf("%w: a split transaction needs at least two lines", ErrInvalidTransaction)
+	}
+
+	for i := range transaction.Splits {
+		split := &transaction.Splits[i]
+
+		category, err := getOwnedCategory(categoryRepository, userID, split.CategoryID)
+		if err != nil {
+			return err
+		}
+		split.CategoryName = category.Name
+
+		err = checkCategoryKind(split.Amount, category)
+		if err != nil {
+			return err
+		}
+		if split.Amount.Currency() != transaction.Amount.Currency() {
+			return fmt.Errorf("%w: %s split line in a %s transaction", money.ErrCurrencyMismatch, split.Amount.Currency(), transaction.Amount.Currency())
+		}
+		if split.Amount.IsZero() {
+			return fmt.Errorf("%w: split line %d has no amount", ErrInvalidTransaction, i+1)
+		}
+
+		split.Memo = strings.TrimSpace(split.Memo)
+		if len(split.Memo) > maxMemoLength {
+			return fmt.Errorf("%w: memo of split line %d is longer than %d characters", ErrInvalidTransaction, i+1, maxMemoLength)
+		}
+	}
+
+	err := checkSplitTotal(transaction.Amount, transaction.Splits)
+	if err != nil {
+		return err
+	}
+
+	transaction.CategoryID = nil
+	transaction.CategoryName = ""
+	return nil
+}
+
+// checkSplitTotal makes sure split lines add up to the transaction's amount.
+func checkSplitTotal(amount money.Money, splits []models.Split) error {
+	total := money.Zero(amount.Currency())
+	for _, split := range splits {
+		var err error
+		total, err = total.Add(split.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	if total != amount {
+		return fmt.Errorf("%w: split lines add up to %s, not %s", ErrInvalidTransaction, total, amount)
+	}
+	return nil
+}
+
+// setPayee fills in the transaction's payee from PayeeID, or failing that
+// from PayeeName. Without either the transaction has no payee.
+func setPayee(payeeRepository repositories.PayeeRepository, transaction *models.Transaction, userID int) error {
+	var payee models.Payee
+	var err error
+	switch {
+	case transaction.PayeeID != nil:
+		payee, err = getOwnedPayee(payeeRepository, userID, *transaction.PayeeID)
+	case PayeeKey(transaction.PayeeName) != "":
+		payee, err = resolvePayee(payeeRepository, userID, transaction.PayeeName, transaction.CategoryID)
+	default:
+		transaction.PayeeID = nil
+		transaction.PayeeName = ""
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	transaction.PayeeID = &payee.ID
+	transaction.PayeeName = payee.Name
+	return nil
+}
+
+// normalizeDescription tidies up the memo and tags of a transaction before it
+// is stored.
+func normalizeDescription(transaction *models.Transaction) error {
+	transaction.Memo = strings.TrimSpace(transaction.Memo)
+	if len(transaction.Memo) > maxMemoLength {
+		return fmt.Errorf("%w: memo is longer than %d characters", ErrInvalidTransaction, maxMemoLength)
+	}
+
+	tags, err := NormalizeTags(transaction.Tags)
+	if err != nil {
+		return err
+	}
+	transaction.Tags = tags
+
+	return nil
+}
@@ -0,0 +1,690 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+)
+
+// TestCreateTransactionConcurrently writes to one account from many
+// goroutines at once. It needs a database that takes writes on several
+// connections, a SQLite file or Postgres, as the in-memory one serializes
+// everything on a single connection.
+func TestCreateTransactionConcurrently(t *testing.T) {
+	s := newTestServicesOn(t, openConcurrentTestDB(t))
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	category, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 20
+	amount := money.New(100, "JPY")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, _, err := s.transactionService.CreateTransaction(models.Transaction{
+				UserID:     userID,
+				AccountID:  account.ID,
+				CategoryID: &category.ID,
+				Amount:     amount,
+			})
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := money.New(100*workers, "JPY")
+
+	balance, err := s.transactionService.GetCurrentBalance(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != want {
+		t.Fatalf("ledger balance = %s, want %s", balance, want)
+	}
+
+	last, err := s.balanceRepository.GetLastBalanceByAccountID(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Amount != want {
+		t.Fatalf("last snapshot = %s, want %s", last.Amount, want)
+	}
+
+	// Every write must have seen the one before it, so each running total
+	// appears exactly once among the snapshots.
+	snapshots, err := s.balanceRepository.GetBalancesByUserID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[money.Money]bool{}
+	for _, snapshot := range snapshots {
+		if seen[snapshot.Amount] {
+			t.Fatalf("running total %s was written twice, an update was lost", snapshot.Amount)
+		}
+		seen[snapshot.Amount] = true
+	}
+	if len(seen) != workers+1 {
+		t.Fatalf("got %d distinct snapshots, want %d", len(seen), workers+1)
+	}
+}
+
+// TestSumsAreExact adds up many amounts whose sum a plain float addition
+// gets wrong by more than a cent. On SQLite, which keeps the amounts as
+// floats, the sums rely on its compensated summation, so the test runs on a
+// SQLite file rather than the in-memory store.
+func TestSumsAreExact(t *testing.T) {
+	s := newTestServicesOn(t, openConcurrentTestDB(t))
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Brokerage", Currency: "USD", OpeningBalance: money.New(7, "USD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	category, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Dividends", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A float sum of these comes to 296296296300.0067
+	const entries = 3000
+	amount := money.MustParse("98765432.10", "USD")
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		transactions := s.transactionRepository.WithTx(tx)
+		for i := 0; i < entries; i++ {
+			_, err := transactions.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &category.ID, Amount: amount, Date: time.Date(2024, 1, 1+i%360, 0, 0, 0, 0, time.UTC)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := money.MustParse("296296296300.00", "USD")
+	sum, err := s.transactionRepository.SumTransactionsByAccountID(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	between, err := s.transactionRepository.SumTransactionsByAccountIDBetween(account.ID, time.Time{}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, decimal := range map[string]money.Decimal{"ledger": sum, "ledger in 2024": between} {
+		got, err := money.FromDecimal(decimal, "USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%s sum = %s, want %s", name, got, want)
+		}
+	}
+
+	before, err := s.transactionRepository.SumTransactionsBefore(userID, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 1 || before[0] != want {
+		t.Fatalf("sums before 2025 = %v, want %s", before, want)
+	}
+
+	totals, err := s.transactionRepository.GetCategoryTotals(userID, time.Time{}, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].Total != want {
+		t.Fatalf("category totals = %+v, want %s", totals, want)
+	}
+
+	balances, err := s.accountRepository.GetAccountBalancesByUserID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Balance != money.MustParse("296296296300.07", "USD") {
+		t.Fatalf("account balances = %+v, want 296296296300.07", balances)
+	}
+}
+
+func TestCreateTransfer(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY", OpeningBalance: money.New(10000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savings, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Savings", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.transactionService.CreateTransfer(models.Transfer{UserID: userID, FromAccountID: cash.ID, ToAccountID: savings.ID, Amount: money.New(1000, "JPY")})
+	if err == nil {
+		t.Fatal("transfer between currencies without a rate succeeded")
+	}
+
+	outgoing, err := s.transactionService.CreateTransfer(models.Transfer{UserID: userID, FromAccountID: cash.ID, ToAccountID: savings.ID, Amount: money.New(1000, "JPY"), Rate: "0.0065"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outgoing.Transfer == nil || outgoing.Transfer.Amount != money.MustParse("6.50", "USD") {
+		t.Fatalf("incoming leg = %+v, want $6.50", outgoing.Transfer)
+	}
+
+	for account, want := range map[models.Account]money.Money{cash: money.New(9000, "JPY"), savings: money.MustParse("6.50", "USD")} {
+		balance, err := s.transactionService.GetCurrentBalance(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != want {
+			t.Fatalf("%s balance = %s, want %s", account.Name, balance, want)
+		}
+	}
+
+	transactions, err := s.transactionService.GetTransactionsByUserID(userID, models.TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 1 || transactions[0].ID != outgoing.ID {
+		t.Fatalf("listed %d transactions, want only the outgoing leg", len(transactions))
+	}
+
+	// Deleting the incoming leg removes the whole transfer
+	_, err = s.transactionService.DeleteTransaction(userID, outgoing.Transfer.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.transactionService.GetTransaction(userID, outgoing.ID)
+	if err != ErrTransactionNotFound {
+		t.Fatalf("outgoing leg after delete: err = %v, want %v", err, ErrTransactionNotFound)
+	}
+}
+
+func TestSplitTransaction(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Gifts", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := models.Transaction{
+		UserID:    userID,
+		AccountID: account.ID,
+		Amount:    money.New(-3000, "JPY"),
+		Splits: []models.Split{
+			{CategoryID: groceries.ID, Amount: money.New(-2000, "JPY")},
+			{CategoryID: gifts.ID, Amount: money.New(-500, "JPY"), Memo: "birthday card"},
+		},
+	}
+	_, _, err = s.transactionService.CreateTransaction(receipt)
+	if err == nil {
+		t.Fatal("split lines that do not add up were accepted")
+	}
+
+	receipt.Splits[1].Amount = money.New(-1000, "JPY")
+	created, _, err := s.transactionService.CreateTransaction(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.CategoryID != nil || len(created.Splits) != 2 {
+		t.Fatalf("created category = %v with %d split lines, want none with 2", created.CategoryID, len(created.Splits))
+	}
+
+	// Changing the amount alone leaves the split lines short
+	_, _, err = s.transactionService.UpdateTransaction(userID, created.ID, models.Transaction{Amount: money.New(-3500, "JPY")})
+	if err == nil {
+		t.Fatal("amount that no longer matches the split lines was accepted")
+	}
+
+	now := time.Now()
+	totals, err := s.categoryService.GetCategoryTotals(userID, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]money.Money{gifts.ID: money.New(-1000, "JPY"), groceries.ID: money.New(-2000, "JPY")}
+	if len(totals) != len(want) {
+		t.Fatalf("got %d category totals, want %d", len(totals), len(want))
+	}
+	for _, total := range totals {
+		if total.Total != want[total.CategoryID] {
+			t.Fatalf("%s total = %s, want %s", total.CategoryName, total.Total, want[total.CategoryID])
+		}
+	}
+}
+
+func TestListTransactions(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savings, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Savings", Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, ParentID: &food.ID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gifts, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Gifts", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(day int, amount string, categoryID int, payee string, memo string) models.Transaction {
+		transaction, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: cash.ID, CategoryID: &categoryID, PayeeName: payee, Amount: money.MustParse(amount, "USD"), Date: time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC), Memo: memo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transaction
+	}
+	bread := create(1, "-4.50", groceries.ID, "Bakery", "Bread")
+	flowers := create(2, "-30.00", gifts.ID, "Florist", "Flowers for Ann")
+	cake := create(2, "-12.00", food.ID, "Bakery", "Birthday cake 100%")
+	receipt, _, err := s.transactionService.CreateTransaction(models.Transaction{
+		UserID:    userID,
+		AccountID: cash.ID,
+		Amount:    money.MustParse("-20.00", "USD"),
+		Date:      time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		Memo:      "Market",
+		Splits: []models.Split{
+			{CategoryID: gifts.ID, Amount: money.MustParse("-15.00", "USD")},
+			{CategoryID: groceries.ID, Amount: money.MustParse("-5.00", "USD")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer, err := s.transactionService.CreateTransfer(models.Transfer{UserID: userID, FromAccountID: cash.ID, ToAccountID: savings.ID, Amount: money.MustParse("100", "USD"), Date: time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := transfer.ID
+
+	// Walks every page of a listing, two entries at a time
+	list := func(filter models.TransactionFilter, sort models.TransactionSort) []int {
+		t.Helper()
+		ids := []int{}
+		query := models.TransactionQuery{Filter: filter, Sort: sort, Limit: 2}
+		for pages := 0; ; pages++ {
+			page, err := s.transactionService.ListTransactions(userID, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, transaction := range page.Transactions {
+				ids = append(ids, transaction.ID)
+			}
+			if page.NextCursor == "" || pages > 10 {
+				return ids
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	day := func(d int) *time.Time {
+		date := time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	decimal := func(value string) *money.Decimal {
+		d := money.Decimal(value)
+		return &d
+	}
+
+	for _, c := range []struct {
+		name   string
+		filter models.TransactionFilter
+		sort   models.TransactionSort
+		want   []int
+	}{
+		{"newest first", models.TransactionFilter{}, "", []int{moved, receipt.ID, cake.ID, flowers.ID, bread.ID}},
+		{"oldest first", models.TransactionFilter{}, models.TransactionSortDateAsc, []int{bread.ID, flowers.ID, cake.ID, receipt.ID, moved}},
+		{"amount", models.TransactionFilter{}, models.TransactionSortAmountAsc, []int{moved, flowers.ID, receipt.ID, cake.ID, bread.ID}},
+		{"transfers into the account", models.TransactionFilter{AccountID: &savings.ID}, "", []int{moved}},
+		{"subcategories and split lines", models.TransactionFilter{CategoryID: &food.ID}, "", []int{receipt.ID, cake.ID, bread.ID}},
+		{"payee", models.TransactionFilter{PayeeID: bread.PayeeID}, "", []int{cake.ID, bread.ID}},
+		{"amount range", models.TransactionFilter{MinAmount: decimal("10"), MaxAmount: decimal("20")}, "", []int{receipt.ID, cake.ID}},
+		{"date range", models.TransactionFilter{From: day(2), To: day(3)}, "", []int{receipt.ID, cake.ID, flowers.ID}},
+		{"text in the memo", models.TransactionFilter{Text: "ann"}, "", []int{flowers.ID}},
+		{"text in the payee", models.TransactionFilter{Text: "BAKERY"}, "", []int{cake.ID, bread.ID}},
+		{"text with wildcards", models.TransactionFilter{Text: "100%"}, "", []int{cake.ID}},
+	} {
+		got := list(c.filter, c.sort)
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("%s: listed %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	page, err := s.transactionService.ListTransactions(userID, models.TransactionQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.transactionService.ListTransactions(userID, models.TransactionQuery{Sort: models.TransactionSortAmountDesc, Cursor: page.NextCursor})
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("continuing with another sort: err = %v, want %v", err, ErrInvalidTransaction)
+	}
+}
+
+func TestCategoryKindMatchesAmount(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	salary, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Salary", Kind: models.CategoryKindIncome})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groceries, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Groceries", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(categoryID int, amount int64) (models.Transaction, error) {
+		created, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &categoryID, Amount: money.New(amount, "JPY")})
+		return created, err
+	}
+	for _, c := range []struct {
+		name       string
+		categoryID int
+		amount     int64
+	}{
+		{"negative income", salary.ID, -1000},
+		{"positive expense", groceries.ID, 1000},
+	} {
+		_, err := create(c.categoryID, c.amount)
+		if !errors.Is(err, ErrInvalidTransaction) {
+			t.Fatalf("%s: err = %v, want %v", c.name, err, ErrInvalidTransaction)
+		}
+	}
+
+	pay, err := create(salary.ID, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bread, err := create(groceries.ID, -1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An update is checked against the category it ends up with, whether it
+	// keeps its own or is given a new one
+	_, _, err = s.transactionService.UpdateTransaction(userID, pay.ID, models.Transaction{Amount: money.New(-1000, "JPY")})
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("income made negative: err = %v, want %v", err, ErrInvalidTransaction)
+	}
+	_, _, err = s.transactionService.UpdateTransaction(userID, bread.ID, models.Transaction{CategoryID: &salary.ID, Amount: money.New(-1000, "JPY")})
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("expense moved to income: err = %v, want %v", err, ErrInvalidTransaction)
+	}
+	_, _, err = s.transactionService.UpdateTransaction(userID, bread.ID, models.Transaction{CategoryID: &salary.ID, Amount: money.New(1000, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each split line is checked against its own category, so a payslip can
+	// book tax against the gross salary
+	payslip := models.Transaction{
+		UserID:    userID,
+		AccountID: account.ID,
+		Amount:    money.New(8000, "JPY"),
+		Splits: []models.Split{
+			{CategoryID: salary.ID, Amount: money.New(10000, "JPY")},
+			{CategoryID: groceries.ID, Amount: money.New(-2000, "JPY")},
+		},
+	}
+	_, _, err = s.transactionService.CreateTransaction(payslip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payslip.Splits[0], payslip.Splits[1] = models.Split{CategoryID: salary.ID, Amount: money.New(-2000, "JPY")}, models.Split{CategoryID: groceries.ID, Amount: money.New(10000, "JPY")}
+	_, _, err = s.transactionService.CreateTransaction(payslip)
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatalf("split lines against their kinds: err = %v, want %v", err, ErrInvalidTransaction)
+	}
+}
+
+func TestSetBalance(t *testing.T) {
+	s := newTestServices(t)
+	user, _ := s.registerTestUser(t)
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: user.ID, Name: "Wallet", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeded, err := adjustmentCategory(s.categoryRepository, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Adjustments go either way and are booked to the seeded category
+	for _, amount := range []int64{5000, 3000} {
+		adjustment, balance, err := s.transactionService.SetBalance(user.ID, account.ID, money.New(amount, "JPY"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adjustment.CategoryID == nil || *adjustment.CategoryID != seeded.ID || adjustment.CategoryName != adjustmentCategoryName {
+			t.Fatalf("adjustment booked to %v %q, want %d %q", adjustment.CategoryID, adjustment.CategoryName, seeded.ID, adjustmentCategoryName)
+		}
+		if balance.Amount != money.New(amount, "JPY") {
+			t.Fatalf("balance %s, want %d", balance.Amount, amount)
+		}
+	}
+
+	// A balance that already matches needs no entry
+	adjustment, _, err := s.transactionService.SetBalance(user.ID, account.ID, money.New(3000, "JPY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment.ID != 0 {
+		t.Fatalf("recorded adjustment %d for a balance that matched", adjustment.ID)
+	}
+
+	// Adjustments are neither income nor expense
+	now := time.Now()
+	totals, err := s.categoryService.GetCategoryTotals(user.ID, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 0 {
+		t.Fatalf("adjustments counted in the category totals %+v", totals)
+	}
+
+	// A user without the category gets it back
+	userID := s.createUser(t).ID
+	cash, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adjustment, _, err = s.transactionService.SetBalance(userID, cash.ID, money.New(-500, "JPY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := s.categoryService.GetCategory(userID, *adjustment.CategoryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Kind != models.CategoryKindAdjustment {
+		t.Fatalf("adjustment booked to an %s category, want %s", created.Kind, models.CategoryKindAdjustment)
+	}
+}
+
+func TestFilterTransactionsByTags(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(userID int, accountID int, categoryID int, day int, tags ...string) models.Transaction {
+		t.Helper()
+		transaction, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: accountID, CategoryID: &categoryID, Amount: money.New(-1000, "JPY"), Date: time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC), Tags: tags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transaction
+	}
+	dinner := create(userID, account.ID, food.ID, 1, "#Trip-Kyoto", "reimbursable")
+	lunch := create(userID, account.ID, food.ID, 2, "trip-kyoto")
+	snack := create(userID, account.ID, food.ID, 3)
+	taxi := create(userID, account.ID, food.ID, 4, "reimbursable")
+	if fmt.Sprint(dinner.Tags) != "[reimbursable trip-kyoto]" || len(snack.Tags) != 0 {
+		t.Fatalf("stored tags %q and %q, want [reimbursable trip-kyoto] and none", dinner.Tags, snack.Tags)
+	}
+
+	// Another user's entries carry the same tag but are never listed
+	other := s.createUser(t).ID
+	otherAccount, err := s.accountService.CreateAccount(models.Account{UserID: other, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFood, err := s.categoryRepository.CreateCategory(models.Category{UserID: other, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(other, otherAccount.ID, otherFood.ID, 1, "trip-kyoto")
+
+	for _, c := range []struct {
+		name string
+		tags []string
+		want []int
+	}{
+		{"no tags", nil, []int{taxi.ID, snack.ID, lunch.ID, dinner.ID}},
+		{"one tag", []string{"trip-kyoto"}, []int{lunch.ID, dinner.ID}},
+		{"tag as typed", []string{"#TRIP-KYOTO"}, []int{lunch.ID, dinner.ID}},
+		{"every tag", []string{"trip-kyoto", "reimbursable"}, []int{dinner.ID}},
+		{"unused tag", []string{"work"}, []int{}},
+	} {
+		// Both the full listing and the pages apply the filter
+		transactions, err := s.transactionService.GetTransactionsByUserID(userID, models.TransactionFilter{Tags: c.tags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := s.transactionService.ListTransactions(userID, models.TransactionQuery{Filter: models.TransactionFilter{Tags: c.tags}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, listed := range [][]models.Transaction{transactions, page.Transactions} {
+			ids := []int{}
+			for _, transaction := range listed {
+				ids = append(ids, transaction.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.want) {
+				t.Fatalf("%s: listed %v, want %v", c.name, ids, c.want)
+			}
+			// Listed entries keep all of their tags, not only those filtered by
+			for _, transaction := range listed {
+				if transaction.ID == dinner.ID && fmt.Sprint(transaction.Tags) != "[reimbursable trip-kyoto]" {
+					t.Fatalf("%s: dinner listed with tags %q", c.name, transaction.Tags)
+				}
+			}
+		}
+	}
+
+	_, err = s.transactionService.GetTransactionsByUserID(userID, models.TransactionFilter{Tags: []string{"not a tag"}})
+	if !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("filtering by an invalid tag: err = %v, want %v", err, ErrInvalidTag)
+	}
+}
+
+// TestSearchTransactionsEscapesWildcards searches for the characters LIKE
+// treats specially. Unescaped, each of them would match every entry.
+func TestSearchTransactionsEscapesWildcards(t *testing.T) {
+	s := newTestServices(t)
+	userID := s.createUser(t).ID
+
+	account, err := s.accountService.CreateAccount(models.Account{UserID: userID, Name: "Cash", Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.categoryRepository.CreateCategory(models.Category{UserID: userID, Name: "Food", Kind: models.CategoryKindExpense})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memos := map[string]int{}
+	for day, memo := range []string{"50% off", "5000 yen", "receipt_2024", "receipt 2024", `C:\receipts`, "Plain"} {
+		transaction, _, err := s.transactionService.CreateTransaction(models.Transaction{UserID: userID, AccountID: account.ID, CategoryID: &food.ID, Amount: money.New(-1000, "JPY"), Date: time.Date(2024, 6, day+1, 0, 0, 0, 0, time.UTC), Memo: memo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		memos[memo] = transaction.ID
+	}
+
+	for text, want := range map[string][]string{
+		"%":         {"50% off"},
+		"50%":       {"50% off"},
+		"_":         {"receipt_2024"},
+		"receipt_2": {"receipt_2024"},
+		`\`:         {`C:\receipts`},
+		`\r`:        {`C:\receipts`},
+		"PLAIN":     {"Plain"},
+	} {
+		transactions, err := s.transactionService.GetTransactionsByUserID(userID, models.TransactionFilter{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, wantIDs := []int{}, []int{}
+		for _, transaction := range transactions {
+			got = append(got, transaction.ID)
+		}
+		for _, memo := range want {
+			wantIDs = append(wantIDs, memos[memo])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(wantIDs) {
+			t.Fatalf("searching %q: listed %v, want %v", text, got, wantIDs)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"time"
+
+	"balance-tracker/models"
+	"balance-tracker/money"
+	"balance-tracker/repositories"
+)
+
+type UserService struct {
+	userRepository repositories.UserRepository
+}
+
+func NewUserService(userRepository repositories.UserRepository) *UserService {
+	return &UserService{userRepository: userRepository}
+}
+
+func (s *UserService) GetUser(id int) (models.User, error) {
+	return s.userRepository.GetUser(id)
+}
+
+// SetBaseCurrency changes the currency the user's totals are shown in.
+func (s *UserService) SetBaseCurrency(userID int, currency string) (models.User, error) {
+	c, err := money.LookupCurrency(currency)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.BaseCurrency = c.Code
+	user.UpdatedAt = time.Now()
+
+	err = s.userRepository.UpdateUser(userID, user)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
@@ -3,15 +3,33 @@ package utils
 import (
 	"balance-tracker/models"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var jwtKey = []byte("secret_key")
+const (
+	tokenIssuer   = "balance-tracker"
+	tokenAudience = "balance-tracker-web"
+
+	// minKeyLength is the shortest HS256 secret accepted, in bytes.
+	minKeyLength = 32
+
+	defaultTokenLifetime   = 15 * time.Minute
+	defaultRefreshLifetime = 30 * 24 * time.Hour
+)
+
+// insecureKeys are secrets that have shipped in examples or earlier versions
+// and must never be used to sign tokens.
+var insecureKeys = []string{"secret_key", "secret", "changeme"}
 
 type Claims struct {
 	UserID int `json:"user_id"`
+	// SessionID is the family of the refresh token the access token was
+	// issued with, so that revoking the session also stops its access tokens.
+	SessionID string `json:"sid"`
 	jwt.StandardClaims
 }
 
@@ -28,29 +46,140 @@ func (d NumericDate) Time() time.Time {
 	return time.Unix(int64(d), 0)
 }
 
-func GenerateToken(user models.User) (string, error) {
-	expirationTime := NewNumericDate(time.Now().Add(365 * 24 * time.Hour))
+// TokenIssuer signs and verifies JWT access tokens. New tokens are signed
+// with the active key, while tokens signed with any other configured key stay
+// valid until they expire, so keys can be rotated without logging everyone
+// out. It also knows how long the refresh tokens that accompany them last.
+type TokenIssuer struct {
+	keys            map[string][]byte
+	activeKID       string
+	lifetime        time.Duration
+	refreshLifetime time.Duration
+}
+
+func NewTokenIssuer(keys map[string][]byte, activeKID string, lifetime time.Duration, refreshLifetime time.Duration) (*TokenIssuer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no JWT signing keys configured")
+	}
+	for kid, key := range keys {
+		if kid == "" {
+			return nil, errors.New("JWT signing keys need a non-empty key id")
+		}
+		for _, insecure := range insecureKeys {
+			if string(key) == insecure {
+				return nil, fmt.Errorf("JWT signing key %q is a well-known default, refusing to use it", kid)
+			}
+		}
+		if len(key) < minKeyLength {
+			return nil, fmt.Errorf("JWT signing key %q must be at least %d bytes", kid, minKeyLength)
+		}
+	}
+	if _, ok := keys[activeKID]; !ok {
+		return nil, fmt.Errorf("active JWT key %q is not configured", activeKID)
+	}
+	if lifetime <= 0 || refreshLifetime <= 0 {
+		return nil, errors.New("token lifetimes must be positive")
+	}
+
+	return &TokenIssuer{keys, activeKID, lifetime, refreshLifetime}, nil
+}
+
+// LoadTokenIssuer reads the signing keys from the environment:
+//
+//	JWT_KEYS            comma-separated kid:secret pairs, e.g. "2024-06:...,2024-01:..."
+//	JWT_SECRET          a single secret, used instead of JWT_KEYS with kid "default"
+//	JWT_ACTIVE_KID      key that signs new tokens, defaults to the first in JWT_KEYS
+//	JWT_TOKEN_LIFETIME      how long access tokens are valid, e.g. "10m", defaults to 15 minutes
+//	REFRESH_TOKEN_LIFETIME  how long an unused refresh token is valid, defaults to 30 days
+func LoadTokenIssuer(envs *EnvEngine) (*TokenIssuer, error) {
+	keys := map[string][]byte{}
+	activeKID := envs.LoadEnv("JWT_ACTIVE_KID")
+
+	if spec := envs.LoadEnv("JWT_KEYS"); spec != "" {
+		for _, pair := range strings.Split(spec, ",") {
+			kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok {
+				return nil, fmt.Errorf("JWT_KEYS: expected kid:secret, got %q", pair)
+			}
+			if _, exists := keys[kid]; exists {
+				return nil, fmt.Errorf("JWT_KEYS: key id %q is listed twice", kid)
+			}
+			keys[kid] = []byte(secret)
+			if activeKID == "" {
+				activeKID = kid
+			}
+		}
+	} else if secret := envs.LoadEnv("JWT_SECRET"); secret != "" {
+		keys["default"] = []byte(secret)
+		if activeKID == "" {
+			activeKID = "default"
+		}
+	}
+
+	lifetime := defaultTokenLifetime
+	if value := envs.LoadEnv("JWT_TOKEN_LIFETIME"); value != "" {
+		var err error
+		lifetime, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_TOKEN_LIFETIME: %w", err)
+		}
+	}
+
+	refreshLifetime := defaultRefreshLifetime
+	if value := envs.LoadEnv("REFRESH_TOKEN_LIFETIME"); value != "" {
+		var err error
+		refreshLifetime, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("REFRESH_TOKEN_LIFETIME: %w", err)
+		}
+	}
+
+	return NewTokenIssuer(keys, activeKID, lifetime, refreshLifetime)
+}
+
+func (t *TokenIssuer) RefreshLifetime() time.Duration {
+	return t.refreshLifetime
+}
+
+// GenerateToken issues an access token for the user's session and returns it
+// with its expiry.
+func (t *TokenIssuer) GenerateToken(user models.User, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.lifetime)
 	claims := &Claims{
-		UserID: user.ID,
+		UserID:    user.ID,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime,
-			Issuer:    "balance-tracker",
+			Audience:  tokenAudience,
+			ExpiresAt: NewNumericDate(expiresAt),
+			IssuedAt:  NewNumericDate(now),
+			Issuer:    tokenIssuer,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	token.Header["kid"] = t.activeKID
+	tokenString, err := token.SignedString(t.keys[t.activeKID])
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
-	return tokenString, nil
+	return tokenString, expiresAt, nil
 }
 
-func ParseToken(tokenString string) (*Claims, error) {
+func (t *TokenIssuer) ParseToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
 	})
 	if err != nil {
 		return nil, err
@@ -59,5 +188,12 @@ func ParseToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if !claims.VerifyAudience(tokenAudience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+
 	return claims, nil
 }
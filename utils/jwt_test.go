@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"balance-tracker/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	oldKey = []byte("an-old-signing-key-of-32-bytes-!")
+	newKey = []byte("the-new-signing-key-of-32-bytes!")
+)
+
+func newTestIssuer(t *testing.T, keys map[string][]byte, activeKID string) *TokenIssuer {
+	t.Helper()
+
+	issuer, err := NewTokenIssuer(keys, activeKID, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+// validClaims returns the claims of a token the issuer would accept.
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID:    7,
+		SessionID: "family",
+		StandardClaims: jwt.StandardClaims{
+			Audience:  tokenAudience,
+			ExpiresAt: NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  NewNumericDate(now),
+			Issuer:    tokenIssuer,
+		},
+	}
+}
+
+// sign returns a token signed with method and key, with kid in its header.
+func sign(t *testing.T, claims *Claims, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseTokenAcceptsEveryConfiguredKey(t *testing.T) {
+	keys := map[string][]byte{"old": oldKey, "new": newKey}
+	before := newTestIssuer(t, keys, "old")
+	after := newTestIssuer(t, keys, "new")
+
+	// A token from before the rotation is still accepted
+	token, _, err := before.GenerateToken(models.User{ID: 7}, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := after.ParseToken(token)
+	if err != nil {
+		t.Fatalf("token signed with the previous key: %v", err)
+	}
+	if claims.UserID != 7 || claims.SessionID != "family" {
+		t.Fatalf("claims = %+v, want user 7 of session family", claims)
+	}
+
+	token, _, err = after.GenerateToken(models.User{ID: 7}, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := jwt.Parse(token, nil)
+	if parsed == nil || parsed.Header["kid"] != "new" {
+		t.Fatal("new tokens are not signed with the active key")
+	}
+
+	// Once the old key is removed, its tokens are rejected
+	_, err = newTestIssuer(t, map[string][]byte{"new": newKey}, "new").ParseToken(sign(t, validClaims(), jwt.SigningMethodHS256, "old", oldKey))
+	if err == nil {
+		t.Fatal("accepted a token signed with a key that is no longer configured")
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	issuer := newTestIssuer(t, map[string][]byte{"old": oldKey, "new": newKey}, "new")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+	noIssuer := validClaims()
+	noIssuer.Issuer = ""
+	wrongAudience := validClaims()
+	wrongAudience.Audience = "balance-tracker-mobile"
+	expired := validClaims()
+	expired.ExpiresAt = NewNumericDate(time.Now().Add(-time.Minute))
+
+	// An RS256 header over an HMAC signature made with a configured secret
+	confused := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	confused.Header["kid"] = "new"
+	signingString, err := confused.SigningString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := jwt.SigningMethodHS256.Sign(signingString, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same token with nothing wrong is accepted, so each case below
+	// fails for its own reason
+	_, err = issuer.ParseToken(sign(t, validClaims(), jwt.SigningMethodHS256, "new", newKey))
+	if err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	tests := map[string]string{
+		"unknown kid":       sign(t, validClaims(), jwt.SigningMethodHS256, "unknown", newKey),
+		"missing kid":       sign(t, validClaims(), jwt.SigningMethodHS256, "", newKey),
+		"kid of other key":  sign(t, validClaims(), jwt.SigningMethodHS256, "old", newKey),
+		"wrong issuer":      sign(t, wrongIssuer, jwt.SigningMethodHS256, "new", newKey),
+		"missing issuer":    sign(t, noIssuer, jwt.SigningMethodHS256, "new", newKey),
+		"wrong audience":    sign(t, wrongAudience, jwt.SigningMethodHS256, "new", newKey),
+		"expired":           sign(t, expired, jwt.SigningMethodHS256, "new", newKey),
+		"alg none":          sign(t, validClaims(), jwt.SigningMethodNone, "new", jwt.UnsafeAllowNoneSignatureType),
+		"HS512":             sign(t, validClaims(), jwt.SigningMethodHS512, "new", newKey),
+		"RS256":             sign(t, validClaims(), jwt.SigningMethodRS256, "new", rsaKey),
+		"RS256 with secret": strings.Join([]string{signingString, signature}, "."),
+		"malformed":         "not.a.token",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims, err := issuer.ParseToken(token)
+			if err == nil {
+				t.Fatalf("accepted the token with claims %+v", claims)
+			}
+		})
+	}
+}